@@ -3,6 +3,7 @@ package app
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
@@ -12,6 +13,10 @@ import (
 	"github.com/johnkhk/cli_chat_app/genproto/auth"
 )
 
+// ErrRegistrationPending is returned when the server created the account but an administrator has to
+// approve it before it can log in.
+var ErrRegistrationPending = errors.New("registration is waiting for an administrator's approval")
+
 // AuthClient encapsulates the gRPC client and logger for authentication services.
 type AuthClient struct {
 	Client       auth.AuthServiceClient
@@ -22,11 +27,29 @@ type AuthClient struct {
 	ParentClient *RpcClient // Reference to the parent RpcClient
 }
 
-// RegisterUser sends a registration request to the server.
+// RegisterUser sends a registration request to the server. It returns ErrRegistrationPending if the server
+// created the account but an administrator has to approve it first.
 func (c *AuthClient) RegisterUser(username, password string) error {
+	return c.register(username, password, false, "")
+}
+
+// RegisterUserWithInvite registers a user with an invite code, which makes them a friend of the invite's
+// creator. Invite-only servers refuse registrations without one.
+func (c *AuthClient) RegisterUserWithInvite(username, password, inviteCode string) error {
+	return c.register(username, password, false, inviteCode)
+}
+
+// RegisterBot registers an automated account, which the server flags so friends can tell it apart.
+func (c *AuthClient) RegisterBot(username, password string) error {
+	return c.register(username, password, true, "")
+}
+
+func (c *AuthClient) register(username, password string, isBot bool, inviteCode string) error {
 	req := &auth.RegisterRequest{
-		Username: username,
-		Password: password,
+		Username:   username,
+		Password:   password,
+		IsBot:      isBot,
+		InviteCode: inviteCode,
 	}
 
 	resp, err := c.Client.RegisterUser(context.Background(), req)
@@ -35,7 +58,10 @@ func (c *AuthClient) RegisterUser(username, password string) error {
 		return fmt.Errorf("Failed to register user: %v", err)
 	}
 
-	if resp.Success {
+	if resp.Success && resp.PendingApproval {
+		c.Logger.Infof("Registration waiting for approval: %s", resp.Message)
+		return ErrRegistrationPending
+	} else if resp.Success {
 		c.Logger.Infof("Registration successful: %s", resp.Message)
 		return nil
 	} else {
@@ -65,7 +91,7 @@ func (c *AuthClient) LoginUser(username, password string) (error, uint32) {
 			c.Logger.Errorf("Failed to store tokens: %v", err)
 			return fmt.Errorf("failed to store tokens: %v", err), 0
 		}
-		c.Logger.Infof("JWT Tokens stored successfully to %s", c.TokenManager.filePath)
+		c.Logger.Infof("JWT Tokens stored successfully for profile %s", c.TokenManager.Profile)
 
 		// Create local identity
 		err = c.CreateLocalIdentityIfNewUserDevice(resp.UserId)
@@ -73,6 +99,11 @@ func (c *AuthClient) LoginUser(username, password string) (error, uint32) {
 			return fmt.Errorf("failed to create local identity: %v", err), 0
 		}
 
+		deviceID, _ := c.GetDeviceId()
+		if err := c.TokenManager.StoreAccount(resp.UserId, deviceID); err != nil {
+			c.Logger.Errorf("Failed to store account details: %v", err)
+		}
+
 		// // Task A: Open the persistent stream
 		// if err := c.ParentClient.ChatClient.OpenPersistentStream(context.Background()); err != nil {
 		// 	return fmt.Errorf("failed to open persistent stream: %v", err), 0
@@ -206,7 +237,7 @@ func (c *AuthClient) LogoutUser() error {
 	return nil
 }
 
-// PostLoginTasks opens the stream and starts listening for messages.
+// PostLoginTasks opens the stream and starts listening for messages and friend events.
 func (c *AuthClient) PostLoginTasks() error {
 	var err error
 	c.ParentClient.CurrentUserID, err = c.TokenManager.GetUserIdFromAccessToken()
@@ -229,6 +260,9 @@ func (c *AuthClient) PostLoginTasks() error {
 
 	// Task C: Listen for incoming messages.
 	go c.ParentClient.ChatClient.listenForMessages(listenCtx)
+
+	// Task D: Listen for friend events; the message listener's cancel function stops it too.
+	go c.ParentClient.FriendsClient.ListenForFriendEvents(listenCtx)
 	return nil
 }
 
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/Johnkhk/libsignal-go/protocol/address"
@@ -31,6 +32,9 @@ type ChatClient struct {
 	Stream           chat.ChatService_StreamMessagesClient // Persistent gRPC stream for sending messages
 	ListenCancelFunc context.CancelFunc                    // Cancel function for stopping the message listener
 	MessageChannel   chan *chat.MessageResponse            // Channel to send received messages
+
+	ackMu      sync.Mutex
+	ackWaiters map[string]chan string // Message ID to the channel waiting for the server's acknowledgement
 }
 
 // OpenPersistentStream opens a persistent gRPC stream for sending and receiving messages.
@@ -175,7 +179,61 @@ func (cc *ChatClient) EncryptMessage(ctx context.Context, recipientID, deviceID
 }
 
 func (cc *ChatClient) SendMessage(ctx context.Context, recipientID, deviceID uint32, messageBytes []byte, opts *lib.SendMessageOptions) error {
+	return cc.sendMessage(ctx, uuid.NewString(), recipientID, deviceID, messageBytes, opts)
+}
+
+// SendMessageAndWait sends a message like SendMessage and waits until the server acknowledges it.
+// It returns "delivered" if the recipient was online, "stored" if the server queued it,
+// or "request_held" if the recipient is not a friend and has yet to accept the message request.
+func (cc *ChatClient) SendMessageAndWait(ctx context.Context, recipientID, deviceID uint32, messageBytes []byte, opts *lib.SendMessageOptions) (string, error) {
+	messageID := uuid.NewString()
+
+	// Register before sending so a fast acknowledgement is not missed.
+	ack := make(chan string, 1)
+	cc.ackMu.Lock()
+	if cc.ackWaiters == nil {
+		cc.ackWaiters = make(map[string]chan string)
+	}
+	cc.ackWaiters[messageID] = ack
+	cc.ackMu.Unlock()
+	defer func() {
+		cc.ackMu.Lock()
+		delete(cc.ackWaiters, messageID)
+		cc.ackMu.Unlock()
+	}()
+
+	if err := cc.sendMessage(ctx, messageID, recipientID, deviceID, messageBytes, opts); err != nil {
+		return "", err
+	}
+
+	select {
+	case status := <-ack:
+		if status == "delivery_failed" {
+			return status, fmt.Errorf("server could not deliver message %s", messageID)
+		}
+		return status, nil
+	case <-ctx.Done():
+		return "", fmt.Errorf("no acknowledgement for message %s: %w", messageID, ctx.Err())
+	}
+}
+
+// notifyAck hands a server acknowledgement to SendMessageAndWait, if it is waiting for one.
+func (cc *ChatClient) notifyAck(messageID, status string) {
+	cc.ackMu.Lock()
+	defer cc.ackMu.Unlock()
+	if ack, ok := cc.ackWaiters[messageID]; ok {
+		select {
+		case ack <- status:
+		default:
+		}
+	}
+}
+
+func (cc *ChatClient) sendMessage(ctx context.Context, messageID string, recipientID, deviceID uint32, messageBytes []byte, opts *lib.SendMessageOptions) error {
 	// If opts is nil, assume it's a text message
+	if opts == nil {
+		opts = &lib.SendMessageOptions{FileType: "text", FileSize: uint64(len(messageBytes))}
+	}
 
 	ciphertext, err := cc.EncryptMessage(ctx, recipientID, deviceID, messageBytes)
 	if err != nil {
@@ -202,7 +260,7 @@ func (cc *ChatClient) SendMessage(ctx context.Context, recipientID, deviceID uin
 	msgRequest := &chat.MessageRequest{
 		RecipientId:      recipientID,                     // Set recipient ID
 		EncryptedMessage: ciphertext.Bytes(),              // Set encrypted message
-		MessageId:        uuid.NewString(),                // Generate a unique message ID
+		MessageId:        messageID,                       // Unique message ID
 		Timestamp:        time.Now().Format(time.RFC3339), // Timestamp in ISO 8601 format
 		EncryptionType:   encryptionType,                  // Set the message type
 		FileType:         opts.FileType,
@@ -215,7 +273,12 @@ func (cc *ChatClient) SendMessage(ctx context.Context, recipientID, deviceID uin
 		return fmt.Errorf("failed to send message request: %v", err)
 	}
 
-	// Store the message in the sender's local chat history with delivered status set to 0 (false) after successfully sending
+	// Store the message in the sender's local chat history with delivered status set to 0 (false) after successfully sending.
+	// Profile keys are not chat content, so they stay out of the history.
+	if opts.FileType == lib.ProfileKeyFileType {
+		cc.Logger.Infof("Profile key sent to recipient %d", recipientID)
+		return nil
+	}
 	if err := cc.Store.SaveChatMessage(msgRequest.MessageId, cc.AuthClient.ParentClient.CurrentUserID, recipientID, []byte(messageBytes), 0, opts); err != nil {
 		cc.Logger.Errorf("Failed to store sent message in chat history: %v", err)
 	}
@@ -273,6 +336,56 @@ func (cc *ChatClient) SendUnencryptedMessage(ctx context.Context, recipientID ui
 	return nil
 }
 
+// GetMessageRequests retrieves the message requests waiting for the current user to accept or reject them.
+func (cc *ChatClient) GetMessageRequests() ([]*chat.PendingMessageRequest, error) {
+	resp, err := cc.Client.GetMessageRequests(context.Background(), &chat.GetMessageRequestsRequest{})
+	if err != nil {
+		cc.Logger.Errorf("Failed to get message requests: %v", err)
+		return nil, fmt.Errorf("failed to get message requests: %w", err)
+	}
+
+	cc.Logger.Infof("Retrieved %d message requests", len(resp.Requests))
+	return resp.Requests, nil
+}
+
+// AcceptMessageRequest accepts the message request of a sender, making them a friend and delivering their held messages.
+func (cc *ChatClient) AcceptMessageRequest(senderID uint32) error {
+	resp, err := cc.Client.AcceptMessageRequest(context.Background(), &chat.AcceptMessageRequestRequest{
+		SenderId: senderID,
+	})
+	if err != nil {
+		cc.Logger.Errorf("Failed to accept message request: %v", err)
+		return fmt.Errorf("failed to accept message request: %w", err)
+	}
+
+	if !resp.Success {
+		cc.Logger.Infof("Failed to accept message request: %s", resp.Message)
+		return fmt.Errorf("failed to accept message request: %s", resp.Message)
+	}
+
+	cc.Logger.Infof("Message request accepted, %d messages delivered", resp.Delivered)
+	return nil
+}
+
+// RejectMessageRequest rejects the message request of a sender, dropping their held messages.
+func (cc *ChatClient) RejectMessageRequest(senderID uint32) error {
+	resp, err := cc.Client.RejectMessageRequest(context.Background(), &chat.RejectMessageRequestRequest{
+		SenderId: senderID,
+	})
+	if err != nil {
+		cc.Logger.Errorf("Failed to reject message request: %v", err)
+		return fmt.Errorf("failed to reject message request: %w", err)
+	}
+
+	if !resp.Success {
+		cc.Logger.Infof("Failed to reject message request: %s", resp.Message)
+		return fmt.Errorf("failed to reject message request: %s", resp.Message)
+	}
+
+	cc.Logger.Infof("Message request rejected: %s", resp.Message)
+	return nil
+}
+
 // listenForMessages continuously listens for messages on the open stream and handles context cancellations.
 func (cc *ChatClient) listenForMessages(ctx context.Context) {
 	defer func() {
@@ -306,6 +419,16 @@ func (cc *ChatClient) listenForMessages(ctx context.Context) {
 			switch resp.Status {
 			case "received":
 				cc.Logger.Infof("Message %s was received successfully at %s", resp.MessageId, resp.Timestamp)
+				// A message that was already received is a re-delivery; decrypting it again would fail
+				// because its ratchet keys have been consumed, so skip it.
+				exists, err := cc.Store.HasChatMessage(resp.MessageId)
+				if err != nil {
+					cc.Logger.Errorf("Failed to check for message %s in chat history: %v", resp.MessageId, err)
+				}
+				if exists {
+					cc.Logger.Infof("Message %s was already received, ignoring duplicate", resp.MessageId)
+					continue
+				}
 				// var err error
 				// for now
 				// unecryptedMessage := string(resp.EncryptedMessage)
@@ -316,6 +439,14 @@ func (cc *ChatClient) listenForMessages(ctx context.Context) {
 					continue
 				}
 
+				// A profile key lets us read the sender's profile; it is not shown in the chat
+				if resp.FileType == lib.ProfileKeyFileType {
+					if err := cc.Store.SaveProfileKey(resp.SenderId, unecryptedMessageBytes); err != nil {
+						cc.Logger.Errorf("Failed to save profile key of user %d: %v", resp.SenderId, err)
+					}
+					continue
+				}
+
 				err = cc.Store.SaveChatMessage(resp.MessageId, resp.SenderId, resp.RecipientId, unecryptedMessageBytes, 1, &lib.SendMessageOptions{
 					FileType: resp.FileType,
 					FileSize: resp.FileSize,
@@ -332,11 +463,20 @@ func (cc *ChatClient) listenForMessages(ctx context.Context) {
 				if err != nil {
 					cc.Logger.Errorf("Failed to update delivery status for message %s: %v", resp.MessageId, err)
 				}
+				cc.notifyAck(resp.MessageId, resp.Status)
 				continue
+			case "delivery_failed":
+				cc.Logger.Warnf("Message %s could not be delivered", resp.MessageId)
+				cc.notifyAck(resp.MessageId, resp.Status)
 			case "connected":
 				cc.Logger.Infof("User Connected at %s", resp.Timestamp)
 			case "stored":
 				cc.Logger.Infof("Message %s was stored in server buffer for later delivery at %s", resp.MessageId, resp.Timestamp)
+				cc.notifyAck(resp.MessageId, resp.Status)
+				continue
+			case "request_held":
+				cc.Logger.Infof("Message %s is held as a message request until the recipient accepts it", resp.MessageId)
+				cc.notifyAck(resp.MessageId, resp.Status)
 				continue
 			default:
 				cc.Logger.Warnf("Unknown response type: %s", resp.Status)
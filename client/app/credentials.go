@@ -0,0 +1,234 @@
+package app
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// credentialsVersion is the current version of the stored credentials format.
+	credentialsVersion = 1
+
+	// DefaultProfile is the profile used when the client is not told which server profile to use.
+	DefaultProfile = "default"
+
+	credentialsFileName     = "credentials"
+	legacyTokensFileName    = "jwt_tokens"
+	credentialsKeyringEntry = "credentials"
+)
+
+// ErrNoCredentials is returned when no credentials have been stored yet.
+var ErrNoCredentials = errors.New("no stored credentials")
+
+// ErrNoCredentialsKey is returned when credentials would have to be kept without encryption.
+var ErrNoCredentialsKey = errors.New("no key to encrypt credentials with")
+
+// Credentials holds everything the client keeps between runs to log back in, per server profile.
+type Credentials struct {
+	Version  int                           `json:"version"`
+	Profiles map[string]*ServerCredentials `json:"profiles"`
+}
+
+// ServerCredentials are the login details for one server profile.
+type ServerCredentials struct {
+	ServerURL    string `json:"serverUrl,omitempty"`
+	UserID       uint32 `json:"userId,omitempty"`
+	DeviceID     uint32 `json:"deviceId"`
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+// NewCredentials returns an empty set of credentials in the current format.
+func NewCredentials() *Credentials {
+	return &Credentials{
+		Version:  credentialsVersion,
+		Profiles: make(map[string]*ServerCredentials),
+	}
+}
+
+// CredentialStore persists the client's credentials.
+type CredentialStore interface {
+	// Load returns the stored credentials, or ErrNoCredentials if there are none.
+	Load() (*Credentials, error)
+	Save(credentials *Credentials) error
+}
+
+// EncryptedFileCredentialStore keeps credentials in a file encrypted with AES-256-GCM.
+type EncryptedFileCredentialStore struct {
+	Path string
+	key  []byte
+}
+
+// NewEncryptedFileCredentialStore returns a store that encrypts credentials at path with key.
+// Without a key the store refuses to load or save, so tokens are never written in the clear.
+func NewEncryptedFileCredentialStore(path string, key []byte) *EncryptedFileCredentialStore {
+	return &EncryptedFileCredentialStore{Path: path, key: key}
+}
+
+// CredentialKeyFromStoreKey derives the credentials file key from the local store's data key,
+// so unlocking the store also unlocks the saved login.
+func CredentialKeyFromStoreKey(storeKey []byte) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, storeKey, nil, []byte("cli_chat_app credentials")), key); err != nil {
+		return nil, fmt.Errorf("failed to derive credentials key: %w", err)
+	}
+	return key, nil
+}
+
+func (s *EncryptedFileCredentialStore) Load() (*Credentials, error) {
+	data, err := os.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials: %w", err)
+	}
+
+	gcm, err := newCredentialsGCM(s.key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("credentials file is corrupt")
+	}
+	data, err = gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt credentials: %w", err)
+	}
+	return decodeCredentials(data)
+}
+
+func (s *EncryptedFileCredentialStore) Save(credentials *Credentials) error {
+	data, err := json.Marshal(credentials)
+	if err != nil {
+		return fmt.Errorf("failed to encode credentials: %w", err)
+	}
+
+	gcm, err := newCredentialsGCM(s.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	data = gcm.Seal(nonce, nonce, data, nil)
+
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0700); err != nil {
+		return fmt.Errorf("failed to create credentials directory: %w", err)
+	}
+	tmpPath := s.Path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write credentials: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.Path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace credentials: %w", err)
+	}
+	return nil
+}
+
+// KeyringCredentialStore keeps credentials in the OS keyring, such as the Secret Service on Linux.
+type KeyringCredentialStore struct {
+	Keyring Keyring
+	Account string
+}
+
+// NewKeyringCredentialStore returns a store that files credentials under the given app directory
+// in keyring, so separate app directories keep separate logins.
+func NewKeyringCredentialStore(keyring Keyring, appDirPath string) *KeyringCredentialStore {
+	return &KeyringCredentialStore{
+		Keyring: keyring,
+		Account: filepath.Join(appDirPath, credentialsKeyringEntry),
+	}
+}
+
+func (s *KeyringCredentialStore) Load() (*Credentials, error) {
+	data, err := s.Keyring.Get(s.Account)
+	if errors.Is(err, ErrSecretNotFound) {
+		return nil, ErrNoCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeCredentials(data)
+}
+
+func (s *KeyringCredentialStore) Save(credentials *Credentials) error {
+	data, err := json.Marshal(credentials)
+	if err != nil {
+		return fmt.Errorf("failed to encode credentials: %w", err)
+	}
+	return s.Keyring.Set(s.Account, data)
+}
+
+// MigrateLegacyTokens moves tokens from the plaintext jwt_tokens file of older versions into
+// credentials under profile, then removes the old file. It does nothing if there is no old file.
+func MigrateLegacyTokens(appDirPath string, credentials CredentialStore, profile string) error {
+	legacyPath := filepath.Join(appDirPath, legacyTokensFileName)
+	data, err := os.ReadFile(legacyPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read legacy tokens: %w", err)
+	}
+
+	var accessToken, refreshToken string
+	if _, err := fmt.Sscanf(string(data), "access_token:%s\nrefresh_token:%s", &accessToken, &refreshToken); err == nil {
+		creds, err := credentials.Load()
+		if errors.Is(err, ErrNoCredentials) {
+			creds = NewCredentials()
+		} else if err != nil {
+			return err
+		}
+		if _, ok := creds.Profiles[profile]; !ok {
+			creds.Profiles[profile] = &ServerCredentials{AccessToken: accessToken, RefreshToken: refreshToken}
+			if err := credentials.Save(creds); err != nil {
+				return err
+			}
+		}
+	}
+
+	// An unreadable legacy file holds nothing worth keeping either.
+	if err := os.Remove(legacyPath); err != nil {
+		return fmt.Errorf("failed to remove legacy tokens: %w", err)
+	}
+	return nil
+}
+
+func decodeCredentials(data []byte) (*Credentials, error) {
+	var credentials Credentials
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return nil, fmt.Errorf("failed to decode credentials: %w", err)
+	}
+	if credentials.Version > credentialsVersion {
+		return nil, fmt.Errorf("credentials version %d is newer than this client supports", credentials.Version)
+	}
+	if credentials.Profiles == nil {
+		credentials.Profiles = make(map[string]*ServerCredentials)
+	}
+	credentials.Version = credentialsVersion
+	return &credentials, nil
+}
+
+func newCredentialsGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) == 0 {
+		return nil, ErrNoCredentialsKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credentials key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
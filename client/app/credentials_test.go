@@ -0,0 +1,130 @@
+package app
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryKeyring is an in-memory Keyring for tests.
+type memoryKeyring map[string][]byte
+
+func (k memoryKeyring) Get(account string) ([]byte, error) {
+	secret, ok := k[account]
+	if !ok {
+		return nil, ErrSecretNotFound
+	}
+	return secret, nil
+}
+
+func (k memoryKeyring) Set(account string, secret []byte) error {
+	k[account] = secret
+	return nil
+}
+
+func (k memoryKeyring) Delete(account string) error {
+	delete(k, account)
+	return nil
+}
+
+func randomKey(t *testing.T) []byte {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	assert.NoError(t, err)
+	return key
+}
+
+func TestEncryptedFileCredentialStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	key := randomKey(t)
+	credentials := NewEncryptedFileCredentialStore(path, key)
+
+	_, err := credentials.Load()
+	assert.ErrorIs(t, err, ErrNoCredentials, "an empty store should have no credentials")
+
+	saved := NewCredentials()
+	saved.Profiles[DefaultProfile] = &ServerCredentials{ServerURL: "localhost:50051", UserID: 7, AccessToken: "access-secret", RefreshToken: "refresh-secret"}
+	assert.NoError(t, credentials.Save(saved))
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.False(t, bytes.Contains(data, []byte("access-secret")), "credentials should be encrypted on disk")
+
+	loaded, err := credentials.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, saved, loaded)
+
+	_, err = NewEncryptedFileCredentialStore(path, randomKey(t)).Load()
+	assert.Error(t, err, "credentials should not load with another key")
+
+	unkeyedPath := filepath.Join(t.TempDir(), "credentials")
+	assert.ErrorIs(t, NewEncryptedFileCredentialStore(unkeyedPath, nil).Save(saved), ErrNoCredentialsKey)
+	_, err = os.Stat(unkeyedPath)
+	assert.True(t, os.IsNotExist(err), "credentials should not be written without a key")
+}
+
+func TestTokenManagerKeepsProfilesApart(t *testing.T) {
+	credentials := NewKeyringCredentialStore(memoryKeyring{}, t.TempDir())
+
+	staging := NewTokenManager(credentials, nil)
+	staging.Profile = "staging"
+	staging.ServerURL = "staging:50051"
+	production := NewTokenManager(credentials, nil)
+	production.Profile = "production"
+
+	assert.NoError(t, staging.StoreTokens("staging-access", "staging-refresh"))
+	assert.NoError(t, production.StoreTokens("production-access", "production-refresh"))
+	assert.NoError(t, staging.StoreAccount(3, 0))
+
+	access, refresh, err := staging.ReadTokens()
+	assert.NoError(t, err)
+	assert.Equal(t, "staging-access", access)
+	assert.Equal(t, "staging-refresh", refresh)
+
+	access, _, err = production.ReadTokens()
+	assert.NoError(t, err)
+	assert.Equal(t, "production-access", access)
+
+	stored, err := credentials.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, credentialsVersion, stored.Version)
+	assert.Equal(t, &ServerCredentials{ServerURL: "staging:50051", UserID: 3, AccessToken: "staging-access", RefreshToken: "staging-refresh"}, stored.Profiles["staging"])
+
+	other := NewTokenManager(credentials, nil)
+	other.Profile = "unknown"
+	_, _, err = other.ReadTokens()
+	assert.ErrorIs(t, err, ErrNoCredentials)
+}
+
+func TestMigrateLegacyTokens(t *testing.T) {
+	dir := t.TempDir()
+	legacyPath := filepath.Join(dir, legacyTokensFileName)
+	assert.NoError(t, os.WriteFile(legacyPath, []byte("access_token:old-access\nrefresh_token:old-refresh"), 0600))
+
+	credentials := NewEncryptedFileCredentialStore(filepath.Join(dir, credentialsFileName), randomKey(t))
+	assert.NoError(t, MigrateLegacyTokens(dir, credentials, DefaultProfile))
+
+	_, err := os.Stat(legacyPath)
+	assert.True(t, os.IsNotExist(err), "legacy token file should be removed")
+
+	access, refresh, err := NewTokenManager(credentials, nil).ReadTokens()
+	assert.NoError(t, err)
+	assert.Equal(t, "old-access", access)
+	assert.Equal(t, "old-refresh", refresh)
+
+	// Nothing to migrate is not an error.
+	assert.NoError(t, MigrateLegacyTokens(dir, credentials, DefaultProfile))
+}
+
+func TestCredentialsFromNewerClientAreRejected(t *testing.T) {
+	keyring := memoryKeyring{}
+	credentials := NewKeyringCredentialStore(keyring, t.TempDir())
+	keyring[credentials.Account] = []byte(`{"version": 99, "profiles": {}}`)
+
+	_, err := credentials.Load()
+	assert.Error(t, err)
+}
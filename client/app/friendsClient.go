@@ -3,16 +3,31 @@ package app
 import (
 	"context"
 	"fmt"
+	"io"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/johnkhk/cli_chat_app/genproto/friends"
 )
 
+// FriendRequestLimitError is returned when the server refuses a friend request because the user has too many
+// waiting for an answer or has sent too many today.
+type FriendRequestLimitError struct {
+	Reason string // The server's explanation of the limit that was reached
+}
+
+func (e *FriendRequestLimitError) Error() string {
+	return "friend request limit reached: " + e.Reason
+}
+
 // FriendsClient encapsulates the gRPC client for friend services.
 type FriendsClient struct {
 	Client friends.FriendManagementClient
 	Logger *logrus.Logger
+	Events chan *friends.FriendEvent // Friend events pushed by the server, dropped when nobody reads them
 }
 
 // SendFriendRequest sends a friend request to another user.
@@ -22,6 +37,10 @@ func (c *FriendsClient) SendFriendRequest(recipientUsername string) error {
 	}
 
 	resp, err := c.Client.SendFriendRequest(context.Background(), req)
+	if status.Code(err) == codes.ResourceExhausted {
+		c.Logger.Warnf("Friend request refused: %v", err)
+		return &FriendRequestLimitError{Reason: status.Convert(err).Message()}
+	}
 	if err != nil {
 		c.Logger.Errorf("Failed to send friend request: %v", err)
 		return fmt.Errorf("failed to send friend request: %w", err)
@@ -37,18 +56,48 @@ func (c *FriendsClient) SendFriendRequest(recipientUsername string) error {
 	return nil
 }
 
-// GetFriendList retrieves the list of friends for the current user.
+// GetFriendList retrieves the list of friends for the current user, most recently active first.
 func (c *FriendsClient) GetFriendList() ([]*friends.Friend, error) {
-	req := &friends.GetFriendListRequest{}
+	return c.GetFriendListSorted(friends.FriendListSort_RECENT_ACTIVITY)
+}
+
+// GetFriendListSorted retrieves the whole friend list of the current user in the given order,
+// following page tokens until the server has returned every friend.
+func (c *FriendsClient) GetFriendListSorted(sort friends.FriendListSort) ([]*friends.Friend, error) {
+	var friendList []*friends.Friend
+	pageToken := ""
+	for {
+		page, nextPageToken, err := c.GetFriendListPage(pageToken, 0, sort)
+		if err != nil {
+			return nil, err
+		}
+		friendList = append(friendList, page...)
+		if nextPageToken == "" {
+			break
+		}
+		pageToken = nextPageToken
+	}
+
+	c.Logger.Infof("Retrieved %d friends", len(friendList))
+	return friendList, nil
+}
+
+// GetFriendListPage retrieves one page of the current user's friends. An empty page token
+// starts from the beginning, and a page size of 0 uses the server's default. The returned
+// token fetches the next page and is empty after the last one.
+func (c *FriendsClient) GetFriendListPage(pageToken string, pageSize uint32, sort friends.FriendListSort) ([]*friends.Friend, string, error) {
+	req := &friends.GetFriendListRequest{
+		PageToken: pageToken,
+		PageSize:  pageSize,
+		Sort:      sort,
+	}
 
 	resp, err := c.Client.GetFriendList(context.Background(), req)
 	if err != nil {
 		c.Logger.Errorf("Failed to get friend list: %v", err)
-		return nil, fmt.Errorf("failed to get friend list: %w", err)
+		return nil, "", fmt.Errorf("failed to get friend list: %w", err)
 	}
-
-	c.Logger.Infof("Retrieved %d friends", len(resp.Friends))
-	return resp.Friends, nil
+	return resp.Friends, resp.NextPageToken, nil
 }
 
 // GetIncomingFriendRequests retrieves the incoming friend requests for the current user.
@@ -123,6 +172,27 @@ func (c *FriendsClient) DeclineFriendRequest(requestID int32) error {
 	return nil
 }
 
+// CancelFriendRequest withdraws a pending friend request the current user sent.
+func (c *FriendsClient) CancelFriendRequest(requestID int32) error {
+	req := &friends.CancelFriendRequestRequest{
+		RequestId: requestID,
+	}
+
+	resp, err := c.Client.CancelFriendRequest(context.Background(), req)
+	if err != nil {
+		c.Logger.Errorf("Failed to cancel friend request: %v", err)
+		return fmt.Errorf("failed to cancel friend request: %w", err)
+	}
+
+	if resp.Status != friends.FriendRequestStatus_CANCELED {
+		c.Logger.Infof("Failed to cancel friend request: %s", resp.Message)
+		return fmt.Errorf("failed to cancel friend request: %s", resp.Message)
+	}
+
+	c.Logger.Infof("Friend request canceled successfully: %s", resp.Message)
+	return nil
+}
+
 // RemoveFriend removes a friend from the user's friend list.
 func (c *FriendsClient) RemoveFriend(friendID int32) error {
 	req := &friends.RemoveFriendRequest{
@@ -144,3 +214,168 @@ func (c *FriendsClient) RemoveFriend(friendID int32) error {
 
 	return nil
 }
+
+// BlockUser blocks a user, which also removes them as a friend and cancels any friend request between you.
+func (c *FriendsClient) BlockUser(userID int32) error {
+	req := &friends.BlockUserRequest{
+		UserId: userID,
+	}
+
+	resp, err := c.Client.BlockUser(context.Background(), req)
+	if err != nil {
+		c.Logger.Errorf("Failed to block user: %v", err)
+		return fmt.Errorf("failed to block user: %w", err)
+	}
+
+	if resp.Success {
+		c.Logger.Infof("User blocked successfully: %s", resp.Message)
+	} else {
+		c.Logger.Infof("Failed to block user: %s", resp.Message)
+		return fmt.Errorf("failed to block user: %s", resp.Message)
+	}
+
+	return nil
+}
+
+// UnblockUser lifts a block on a user.
+func (c *FriendsClient) UnblockUser(userID int32) error {
+	req := &friends.UnblockUserRequest{
+		UserId: userID,
+	}
+
+	resp, err := c.Client.UnblockUser(context.Background(), req)
+	if err != nil {
+		c.Logger.Errorf("Failed to unblock user: %v", err)
+		return fmt.Errorf("failed to unblock user: %w", err)
+	}
+
+	if resp.Success {
+		c.Logger.Infof("User unblocked successfully: %s", resp.Message)
+	} else {
+		c.Logger.Infof("Failed to unblock user: %s", resp.Message)
+		return fmt.Errorf("failed to unblock user: %s", resp.Message)
+	}
+
+	return nil
+}
+
+// GetBlockedUsers retrieves the users the current user has blocked.
+func (c *FriendsClient) GetBlockedUsers() ([]*friends.BlockedUser, error) {
+	resp, err := c.Client.GetBlockedUsers(context.Background(), &friends.GetBlockedUsersRequest{})
+	if err != nil {
+		c.Logger.Errorf("Failed to get blocked users: %v", err)
+		return nil, fmt.Errorf("failed to get blocked users: %w", err)
+	}
+
+	return resp.BlockedUsers, nil
+}
+
+// SearchUsers finds users whose usernames match query, skipping the first offset results,
+// and reports whether there are more after this page. A limit of 0 lets the server choose.
+func (c *FriendsClient) SearchUsers(query string, offset, limit uint32) ([]*friends.UserSearchResult, bool, error) {
+	req := &friends.SearchUsersRequest{
+		Query:  query,
+		Offset: offset,
+		Limit:  limit,
+	}
+
+	resp, err := c.Client.SearchUsers(context.Background(), req)
+	if err != nil {
+		c.Logger.Errorf("Failed to search users: %v", err)
+		return nil, false, fmt.Errorf("failed to search users: %w", err)
+	}
+
+	return resp.Users, resp.HasMore, nil
+}
+
+// GetPrivacySettings retrieves the current user's privacy settings.
+func (c *FriendsClient) GetPrivacySettings() (*friends.PrivacySettings, error) {
+	resp, err := c.Client.GetPrivacySettings(context.Background(), &friends.GetPrivacySettingsRequest{})
+	if err != nil {
+		c.Logger.Errorf("Failed to get privacy settings: %v", err)
+		return nil, fmt.Errorf("failed to get privacy settings: %w", err)
+	}
+
+	return resp.Settings, nil
+}
+
+// SetDiscoverable sets whether other users can find the current user with SearchUsers.
+func (c *FriendsClient) SetDiscoverable(discoverable bool) error {
+	req := &friends.UpdatePrivacySettingsRequest{
+		Settings: &friends.PrivacySettings{Discoverable: discoverable},
+	}
+
+	resp, err := c.Client.UpdatePrivacySettings(context.Background(), req)
+	if err != nil {
+		c.Logger.Errorf("Failed to update privacy settings: %v", err)
+		return fmt.Errorf("failed to update privacy settings: %w", err)
+	}
+
+	if resp.Success {
+		c.Logger.Infof("Privacy settings updated: %s", resp.Message)
+	} else {
+		c.Logger.Infof("Failed to update privacy settings: %s", resp.Message)
+		return fmt.Errorf("failed to update privacy settings: %s", resp.Message)
+	}
+
+	return nil
+}
+
+// CreateInvite creates an invite code that makes whoever redeems it the current user's friend. It can be
+// redeemed maxUses times within validFor; zero values let the server choose.
+func (c *FriendsClient) CreateInvite(maxUses uint32, validFor time.Duration) (*friends.CreateInviteResponse, error) {
+	req := &friends.CreateInviteRequest{
+		MaxUses:        maxUses,
+		ExpiresInHours: uint32(validFor / time.Hour),
+	}
+
+	resp, err := c.Client.CreateInvite(context.Background(), req)
+	if err != nil {
+		c.Logger.Errorf("Failed to create invite: %v", err)
+		return nil, fmt.Errorf("failed to create invite: %s", status.Convert(err).Message())
+	}
+
+	c.Logger.Infof("Created invite for %d users", resp.MaxUses)
+	return resp, nil
+}
+
+// RedeemInvite redeems an invite code and returns its creator, who is now the current user's friend.
+func (c *FriendsClient) RedeemInvite(code string) (*friends.Friend, error) {
+	resp, err := c.Client.RedeemInvite(context.Background(), &friends.RedeemInviteRequest{Code: code})
+	if err != nil {
+		c.Logger.Errorf("Failed to redeem invite: %v", err)
+		return nil, fmt.Errorf("failed to redeem invite: %s", status.Convert(err).Message())
+	}
+
+	c.Logger.Infof("Redeemed invite from %s", resp.Friend.Username)
+	return resp.Friend, nil
+}
+
+// ListenForFriendEvents streams the friend events other users cause to Events until ctx is canceled
+// or the stream ends.
+func (c *FriendsClient) ListenForFriendEvents(ctx context.Context) {
+	stream, err := c.Client.StreamFriendEvents(ctx, &friends.StreamFriendEventsRequest{})
+	if err != nil {
+		c.Logger.Errorf("Failed to open friend event stream: %v", err)
+		return
+	}
+
+	for {
+		event, err := stream.Recv()
+		if err == io.EOF || ctx.Err() != nil {
+			c.Logger.Info("Friend event stream closed")
+			return
+		}
+		if err != nil {
+			c.Logger.Errorf("Failed to receive friend event: %v", err)
+			return
+		}
+
+		c.Logger.Infof("Received %s event from %s", event.Type, event.Username)
+		select {
+		case c.Events <- event:
+		default:
+			c.Logger.Warnf("Friend event channel is full, dropping %s event", event.Type)
+		}
+	}
+}
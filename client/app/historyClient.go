@@ -0,0 +1,214 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/johnkhk/cli_chat_app/client/e2ee/historysync"
+	"github.com/johnkhk/cli_chat_app/client/e2ee/store"
+	"github.com/johnkhk/cli_chat_app/genproto/history"
+)
+
+// historyUploadChunkSize is the size of the chunks the encrypted history is uploaded in.
+const historyUploadChunkSize = 1 << 20
+
+// historyPollInterval is how often the new device checks whether the history has been uploaded.
+const historyPollInterval = 2 * time.Second
+
+// ErrTransferKeyChanged is returned by SendHistory when the device waiting on the transfer no longer has
+// the identity key whose fingerprint the user verified.
+var ErrTransferKeyChanged = errors.New("the device waiting on the transfer has changed since its fingerprint was verified")
+
+// HistoryClient moves chat history between devices of the same user through the server relay.
+type HistoryClient struct {
+	Client history.HistoryTransferClient
+	Store  *store.SQLiteStore
+	Logger *logrus.Logger
+}
+
+// PendingTransfer is a transfer opened by this device, waiting for the old device to upload.
+type PendingTransfer struct {
+	Code        string    // Code to enter on the old device
+	Fingerprint string    // Fingerprint of this device's identity key, shown on both devices
+	ExpiresAt   time.Time // When the server discards the transfer
+}
+
+// StartReceive opens a transfer for this device. The returned code is entered on the old device.
+func (c *HistoryClient) StartReceive() (*PendingTransfer, error) {
+	identityKey := c.Store.IdentityStore().KeyPair(context.Background()).PublicKey().Bytes()
+
+	resp, err := c.Client.CreateTransfer(context.Background(), &history.CreateTransferRequest{
+		IdentityKey: identityKey,
+	})
+	if err != nil {
+		c.Logger.Errorf("Failed to create history transfer: %v", err)
+		return nil, fmt.Errorf("failed to create history transfer: %w", err)
+	}
+	if resp.Status == history.TransferStatus_FAILED {
+		c.Logger.Infof("Failed to create history transfer: %s", resp.Message)
+		return nil, fmt.Errorf("failed to create history transfer: %s", resp.Message)
+	}
+
+	c.Logger.Infof("Opened history transfer %s", resp.TransferCode)
+	return &PendingTransfer{
+		Code:        resp.TransferCode,
+		Fingerprint: historysync.Fingerprint(identityKey),
+		ExpiresAt:   resp.ExpiresAt.AsTime(),
+	}, nil
+}
+
+// ReceiveHistory waits for the old device to upload, then decrypts and imports the history.
+// It returns the number of messages added to the local chat history.
+func (c *HistoryClient) ReceiveHistory(ctx context.Context, code string) (int, error) {
+	for {
+		ephemeralKey, payload, err := c.download(ctx, code)
+		if status.Code(err) == codes.FailedPrecondition {
+			// Not uploaded yet, wait and try again.
+			select {
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			case <-time.After(historyPollInterval):
+				continue
+			}
+		}
+		if err != nil {
+			c.Logger.Errorf("Failed to download history transfer: %v", err)
+			return 0, fmt.Errorf("failed to download history: %w", err)
+		}
+
+		keyPair := c.Store.IdentityStore().KeyPair(ctx)
+		messages, err := historysync.Open(keyPair.PrivateKey().Bytes(), keyPair.PublicKey().Bytes(), ephemeralKey, payload)
+		if err != nil {
+			c.Logger.Errorf("Failed to open history transfer: %v", err)
+			return 0, err
+		}
+
+		imported, err := c.Store.ImportChatHistory(messages)
+		if err != nil {
+			c.Logger.Errorf("Failed to import history: %v", err)
+			return 0, err
+		}
+
+		c.Logger.Infof("Imported %d of %d transferred messages", imported, len(messages))
+		return imported, nil
+	}
+}
+
+// LookupTransfer returns the fingerprint of the device waiting on the transfer, so the user can
+// compare it with the one shown on the new device before sending.
+func (c *HistoryClient) LookupTransfer(code string) (string, error) {
+	identityKey, err := c.recipientKey(code)
+	if err != nil {
+		return "", err
+	}
+	return historysync.Fingerprint(identityKey), nil
+}
+
+// SendHistory encrypts the local chat history to the device waiting on the transfer and uploads it.
+// fingerprint is the one from LookupTransfer that the user verified; if the device's key no longer
+// matches it, nothing is sent and ErrTransferKeyChanged is returned. It returns the number of messages sent.
+func (c *HistoryClient) SendHistory(code, fingerprint string) (int, error) {
+	identityKey, err := c.recipientKey(code)
+	if err != nil {
+		return 0, err
+	}
+	if historysync.Fingerprint(identityKey) != fingerprint {
+		c.Logger.Errorf("Identity key of history transfer %s does not match the verified fingerprint", code)
+		return 0, ErrTransferKeyChanged
+	}
+
+	messages, err := c.Store.ExportChatHistory()
+	if err != nil {
+		c.Logger.Errorf("Failed to export chat history: %v", err)
+		return 0, err
+	}
+
+	ephemeralKey, payload, err := historysync.Seal(identityKey, messages)
+	if err != nil {
+		c.Logger.Errorf("Failed to seal chat history: %v", err)
+		return 0, err
+	}
+
+	stream, err := c.Client.UploadTransfer(context.Background())
+	if err != nil {
+		c.Logger.Errorf("Failed to open history upload: %v", err)
+		return 0, fmt.Errorf("failed to upload history: %w", err)
+	}
+
+	first := true
+	for first || len(payload) > 0 {
+		n := len(payload)
+		if n > historyUploadChunkSize {
+			n = historyUploadChunkSize
+		}
+		chunk := &history.TransferChunk{Data: payload[:n]}
+		if first {
+			chunk.TransferCode = code
+			chunk.EphemeralKey = ephemeralKey
+			first = false
+		}
+		if err := stream.Send(chunk); err != nil {
+			// The server's reason for aborting is reported by CloseAndRecv.
+			if err != io.EOF {
+				c.Logger.Errorf("Failed to upload history chunk: %v", err)
+				return 0, fmt.Errorf("failed to upload history: %w", err)
+			}
+			break
+		}
+		payload = payload[n:]
+	}
+
+	if _, err := stream.CloseAndRecv(); err != nil {
+		c.Logger.Errorf("Failed to upload history: %v", err)
+		return 0, fmt.Errorf("failed to upload history: %w", err)
+	}
+
+	c.Logger.Infof("Uploaded %d messages for history transfer %s", len(messages), code)
+	return len(messages), nil
+}
+
+// recipientKey fetches the identity key of the device waiting on the transfer.
+func (c *HistoryClient) recipientKey(code string) ([]byte, error) {
+	resp, err := c.Client.GetTransfer(context.Background(), &history.GetTransferRequest{TransferCode: code})
+	if err != nil {
+		c.Logger.Errorf("Failed to get history transfer: %v", err)
+		return nil, fmt.Errorf("failed to get history transfer: %w", err)
+	}
+	if resp.Status == history.TransferStatus_FAILED {
+		return nil, fmt.Errorf("transfer code %s was not found or has expired", code)
+	}
+	if resp.Status == history.TransferStatus_READY {
+		return nil, fmt.Errorf("history has already been sent for transfer code %s", code)
+	}
+	return resp.IdentityKey, nil
+}
+
+// download fetches the encrypted history for the transfer.
+func (c *HistoryClient) download(ctx context.Context, code string) ([]byte, []byte, error) {
+	stream, err := c.Client.DownloadTransfer(ctx, &history.DownloadTransferRequest{TransferCode: code})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ephemeralKey, payload []byte
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return ephemeralKey, payload, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(chunk.EphemeralKey) > 0 {
+			ephemeralKey = chunk.EphemeralKey
+		}
+		payload = append(payload, chunk.Data...)
+	}
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/johnkhk/cli_chat_app/genproto/chat"
+)
+
+// IncomingMessage is a decrypted message as handed to scripts and other non-interactive consumers.
+type IncomingMessage struct {
+	ID        string    `json:"id"`
+	SenderID  uint32    `json:"sender_id"`
+	Sender    string    `json:"sender"`
+	Timestamp time.Time `json:"timestamp"`
+	Type      string    `json:"type"`
+	Body      string    `json:"body"`
+	FileName  string    `json:"file_name,omitempty"`
+	FileSize  uint64    `json:"file_size,omitempty"`
+	Data      []byte    `json:"data,omitempty"` // File contents, base64 encoded in JSON
+}
+
+// IncomingMessageFromResponse turns a response from MessageChannel into an IncomingMessage.
+// The listener has already decrypted and saved received messages, so the plaintext is read back
+// from the local store rather than decrypted a second time. It returns nil for responses that are
+// not messages, such as connection notices.
+func (cc *ChatClient) IncomingMessageFromResponse(resp *chat.MessageResponse) (*IncomingMessage, error) {
+	if resp.Status != "received" {
+		return nil, nil
+	}
+
+	saved, err := cc.Store.GetChatMessage(resp.MessageId)
+	if err != nil {
+		return nil, err
+	}
+	if saved == nil {
+		return nil, fmt.Errorf("message %s from %s was not saved locally", resp.MessageId, resp.SenderUsername)
+	}
+
+	// Prefer the server's timestamp, which is when the message was delivered.
+	timestamp, err := time.Parse(time.RFC3339, resp.Timestamp)
+	if err != nil {
+		timestamp = saved.Timestamp
+	}
+
+	msg := &IncomingMessage{
+		ID:        resp.MessageId,
+		SenderID:  resp.SenderId,
+		Sender:    resp.SenderUsername,
+		Timestamp: timestamp.UTC(),
+		Type:      saved.FileType,
+		Body:      saved.Message,
+	}
+	if saved.FileType != "text" {
+		msg.Body = saved.FileName
+		msg.FileName = saved.FileName
+		msg.FileSize = saved.FileSize
+		msg.Data = saved.Media
+	}
+	return msg, nil
+}
+
+// ReceiveMessage waits for the next message on MessageChannel, from senderID if it is non-zero.
+// Messages from other senders are dropped while waiting.
+func (cc *ChatClient) ReceiveMessage(ctx context.Context, senderID uint32) (*IncomingMessage, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case resp, ok := <-cc.MessageChannel:
+			if !ok {
+				return nil, fmt.Errorf("message channel closed")
+			}
+			msg, err := cc.IncomingMessageFromResponse(resp)
+			if err != nil {
+				cc.Logger.Errorf("Failed to read incoming message: %v", err)
+				continue
+			}
+			if msg == nil || (senderID != 0 && msg.SenderID != senderID) {
+				continue
+			}
+			return msg, nil
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/zalando/go-keyring"
+)
+
+// keyringService is the service name the client's secrets are filed under in the OS keyring.
+const keyringService = "cli_chat_app"
+
+// ErrSecretNotFound is returned by a Keyring that holds no secret for an account.
+var ErrSecretNotFound = errors.New("secret not found in keyring")
+
+// Keyring stores small secrets outside the app directory.
+type Keyring interface {
+	Get(account string) ([]byte, error)
+	Set(account string, secret []byte) error
+	Delete(account string) error
+}
+
+// OSKeyring keeps secrets in the operating system's credential store: the macOS Keychain, the
+// Windows Credential Manager or the Secret Service on Linux. It fails on systems without one,
+// such as headless Linux servers, and callers fall back to asking for a passphrase.
+type OSKeyring struct {
+	Service string
+}
+
+func NewOSKeyring() *OSKeyring {
+	return &OSKeyring{Service: keyringService}
+}
+
+func (k *OSKeyring) Get(account string) ([]byte, error) {
+	encoded, err := keyring.Get(k.Service, account)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, ErrSecretNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from keyring: %w", err)
+	}
+	secret, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode keyring secret: %w", err)
+	}
+	return secret, nil
+}
+
+func (k *OSKeyring) Set(account string, secret []byte) error {
+	if err := keyring.Set(k.Service, account, base64.StdEncoding.EncodeToString(secret)); err != nil {
+		return fmt.Errorf("failed to write to keyring: %w", err)
+	}
+	return nil
+}
+
+func (k *OSKeyring) Delete(account string) error {
+	err := keyring.Delete(k.Service, account)
+	if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return fmt.Errorf("failed to delete from keyring: %w", err)
+	}
+	return nil
+}
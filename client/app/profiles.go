@@ -0,0 +1,166 @@
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	profilesVersion  = 1
+	profilesFileName = "profiles.json"
+	profilesDirName  = "profiles"
+)
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// ProfileConfig lists the server profiles the client knows about. Each profile has its own
+// server address and TLS settings, and its own directory for tokens and the local store.
+type ProfileConfig struct {
+	Version  int                 `json:"version"`
+	Default  string              `json:"default,omitempty"` // Profile used when none is asked for
+	Profiles map[string]*Profile `json:"profiles"`
+
+	baseDir string
+}
+
+// Profile is a named server to connect to.
+type Profile struct {
+	ServerAddress string    `json:"serverAddress,omitempty"` // Empty uses SERVER_ADDRESS or the built-in default
+	TLS           TLSConfig `json:"tls"`
+}
+
+// TLSConfig describes how to secure the connection to a profile's server.
+type TLSConfig struct {
+	Enabled    bool   `json:"enabled"`
+	CAFile     string `json:"caFile,omitempty"`     // PEM bundle to trust instead of the system roots
+	ServerName string `json:"serverName,omitempty"` // Overrides the name checked against the certificate
+}
+
+// LoadProfiles reads the profile list from the app directory. A missing file yields a list
+// holding just the default profile, which keeps using the app directory itself.
+func LoadProfiles(appDirPath string) (*ProfileConfig, error) {
+	config := &ProfileConfig{
+		Version:  profilesVersion,
+		Profiles: make(map[string]*Profile),
+		baseDir:  appDirPath,
+	}
+
+	data, err := os.ReadFile(filepath.Join(appDirPath, profilesFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read profiles: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, config); err != nil {
+			return nil, fmt.Errorf("failed to decode profiles: %w", err)
+		}
+		if config.Version > profilesVersion {
+			return nil, fmt.Errorf("profiles version %d is newer than this client supports", config.Version)
+		}
+		config.Version = profilesVersion
+		if config.Profiles == nil {
+			config.Profiles = make(map[string]*Profile)
+		}
+	}
+
+	if _, ok := config.Profiles[DefaultProfile]; !ok {
+		config.Profiles[DefaultProfile] = &Profile{}
+	}
+	return config, nil
+}
+
+// Save writes the profile list back to the app directory.
+func (c *ProfileConfig) Save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode profiles: %w", err)
+	}
+	if err := os.MkdirAll(c.baseDir, 0700); err != nil {
+		return fmt.Errorf("failed to create app directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(c.baseDir, profilesFileName), data, 0600); err != nil {
+		return fmt.Errorf("failed to write profiles: %w", err)
+	}
+	return nil
+}
+
+// Names returns the profile names in display order, with the default profile first.
+func (c *ProfileConfig) Names() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		if name != DefaultProfile {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{DefaultProfile}, names...)
+}
+
+// Selected returns the profile to use when none is given explicitly.
+func (c *ProfileConfig) Selected() string {
+	if _, ok := c.Profiles[c.Default]; ok {
+		return c.Default
+	}
+	return DefaultProfile
+}
+
+// Add stores a new profile under name.
+func (c *ProfileConfig) Add(name string, profile *Profile) error {
+	if !profileNamePattern.MatchString(name) {
+		return fmt.Errorf("profile names may only use letters, digits, '-' and '_'")
+	}
+	if _, ok := c.Profiles[name]; ok {
+		return fmt.Errorf("profile %q already exists", name)
+	}
+	c.Profiles[name] = profile
+	return nil
+}
+
+// Dir returns the directory holding a profile's tokens and local store. The default profile
+// uses the app directory itself, so data from before profiles existed stays where it is.
+func (c *ProfileConfig) Dir(name string) string {
+	if name == DefaultProfile {
+		return c.baseDir
+	}
+	return filepath.Join(c.baseDir, profilesDirName, name)
+}
+
+// Address returns the server address of the profile, falling back to fallback when it has none.
+func (p *Profile) Address(fallback string) string {
+	if p.ServerAddress != "" {
+		return p.ServerAddress
+	}
+	return fallback
+}
+
+// TransportCredentials returns the gRPC transport credentials for the profile's TLS settings.
+func (p *Profile) TransportCredentials() (credentials.TransportCredentials, error) {
+	if !p.TLS.Enabled {
+		return insecure.NewCredentials(), nil
+	}
+
+	config := &tls.Config{
+		ServerName: p.TLS.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if p.TLS.CAFile != "" {
+		pem, err := os.ReadFile(p.TLS.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", p.TLS.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	return credentials.NewTLS(config), nil
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfilesRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	profiles, err := LoadProfiles(dir)
+	assert.NoError(t, err, "a missing profiles file should not be an error")
+	assert.Equal(t, []string{DefaultProfile}, profiles.Names())
+	assert.Equal(t, DefaultProfile, profiles.Selected())
+	assert.Equal(t, dir, profiles.Dir(DefaultProfile), "the default profile should keep using the app directory")
+
+	assert.NoError(t, profiles.Add("staging", &Profile{ServerAddress: "staging:50051", TLS: TLSConfig{Enabled: true, ServerName: "staging.example"}}))
+	assert.NoError(t, profiles.Add("production", &Profile{ServerAddress: "prod:50051"}))
+	assert.Error(t, profiles.Add("staging", &Profile{}), "duplicate profiles should be rejected")
+	assert.Error(t, profiles.Add("../escape", &Profile{}), "profile names should not contain path separators")
+	profiles.Default = "staging"
+	assert.NoError(t, profiles.Save())
+
+	loaded, err := LoadProfiles(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{DefaultProfile, "production", "staging"}, loaded.Names())
+	assert.Equal(t, "staging", loaded.Selected())
+	assert.Equal(t, filepath.Join(dir, "profiles", "staging"), loaded.Dir("staging"))
+	assert.Equal(t, profiles.Profiles["staging"], loaded.Profiles["staging"])
+	assert.Equal(t, "prod:50051", loaded.Profiles["production"].Address("fallback:1"))
+	assert.Equal(t, "fallback:1", loaded.Profiles[DefaultProfile].Address("fallback:1"))
+}
+
+func TestProfileTransportCredentials(t *testing.T) {
+	plain := &Profile{}
+	creds, err := plain.TransportCredentials()
+	assert.NoError(t, err)
+	assert.Equal(t, "insecure", creds.Info().SecurityProtocol)
+
+	secure := &Profile{TLS: TLSConfig{Enabled: true}}
+	creds, err = secure.TransportCredentials()
+	assert.NoError(t, err)
+	assert.Equal(t, "tls", creds.Info().SecurityProtocol)
+
+	badCA := filepath.Join(t.TempDir(), "ca.pem")
+	assert.NoError(t, os.WriteFile(badCA, []byte("not a certificate"), 0600))
+	_, err = (&Profile{TLS: TLSConfig{Enabled: true, CAFile: badCA}}).TransportCredentials()
+	assert.Error(t, err, "a CA file without certificates should be rejected")
+}
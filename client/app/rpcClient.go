@@ -6,25 +6,32 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 
 	"github.com/johnkhk/cli_chat_app/client/e2ee/store"
 	"github.com/johnkhk/cli_chat_app/genproto/auth"
 	"github.com/johnkhk/cli_chat_app/genproto/chat"
 	"github.com/johnkhk/cli_chat_app/genproto/friends"
+	"github.com/johnkhk/cli_chat_app/genproto/history"
+	"github.com/johnkhk/cli_chat_app/genproto/userprofile"
 )
 
 // RpcClient manages multiple gRPC clients for different services.
 type RpcClient struct {
-	AuthClient      *AuthClient
-	FriendsClient   *FriendsClient
-	ChatClient      *ChatClient
-	Conn            *grpc.ClientConn
-	Logger          *logrus.Logger
-	AppDirPath      string
-	Store           *store.SQLiteStore
-	CurrentUserID   uint32
-	CurrentDeviceID uint32
+	AuthClient        *AuthClient
+	FriendsClient     *FriendsClient
+	ChatClient        *ChatClient
+	HistoryClient     *HistoryClient
+	UserProfileClient *UserProfileClient
+	Conn              *grpc.ClientConn
+	Logger            *logrus.Logger
+	AppDirPath        string
+	Store             *store.SQLiteStore
+	CurrentUserID     uint32
+	CurrentDeviceID   uint32
+	Profile           string         // Name of the server profile in use
+	Profiles          *ProfileConfig // All known profiles, for switching between them
 }
 
 type RpcClientConfig struct {
@@ -33,6 +40,11 @@ type RpcClientConfig struct {
 	Logger        *logrus.Logger
 	AppDirPath    string
 	TokenManager  *TokenManager
+	StoreVault    *store.Vault    // Unlocked encrypted store; nil keeps an unencrypted store.db
+	Credentials   CredentialStore // Where tokens are kept; defaults to a file encrypted with the store key, so one is needed without StoreVault
+	Profile       string          // Server profile the tokens belong to; defaults to DefaultProfile
+	Profiles      *ProfileConfig
+	Transport     credentials.TransportCredentials // Defaults to an insecure connection
 }
 
 // NewRpcClient initializes all service clients with a shared gRPC connection.
@@ -40,17 +52,30 @@ func NewRpcClient(config RpcClientConfig) (*RpcClient, error) {
 	logger := config.Logger
 
 	// Create the application directory if it doesn't exist
-	dir := filepath.Dir(config.AppDirPath)
+	dir := config.AppDirPath
 	config.Logger.Infof("Creating App directory at: %s", dir)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	if err := os.MkdirAll(dir, 0700); err != nil {
 		logger.Errorf("Failed to create directory %s: %v", dir, err)
 		return nil, err
 	}
 
+	// Tokens are never written in the clear, so the default credentials file needs the store key
+	if config.TokenManager == nil && config.Credentials == nil && config.StoreVault == nil {
+		logger.Error("No credential store and no encrypted local store to derive its key from")
+		return nil, ErrNoCredentialsKey
+	}
+
 	// Create a new Store instance
-	sqlitePath := filepath.Join(config.AppDirPath, "store.db")
-	logger.Info("Creating SQLite store at: ", sqlitePath)
-	sqliteStore, err := store.NewSQLiteStore(sqlitePath)
+	var sqliteStore *store.SQLiteStore
+	var err error
+	if config.StoreVault != nil {
+		logger.Info("Opening encrypted SQLite store at: ", config.StoreVault.Path)
+		sqliteStore, err = store.NewEncryptedSQLiteStore(config.StoreVault)
+	} else {
+		sqlitePath := filepath.Join(config.AppDirPath, plaintextStoreFileName)
+		logger.Info("Creating SQLite store at: ", sqlitePath)
+		sqliteStore, err = store.NewSQLiteStore(sqlitePath)
+	}
 	if err != nil {
 		logger.Errorf("Failed to create SQLite store: %v", err)
 		return nil, err
@@ -59,7 +84,23 @@ func NewRpcClient(config RpcClientConfig) (*RpcClient, error) {
 	// Create a TokenManager instance
 	tokenManager := config.TokenManager
 	if tokenManager == nil {
-		tokenManager = NewTokenManager(filepath.Join(config.AppDirPath, "jwt_tokens"), nil) // Will set the client later
+		credentialStore := config.Credentials
+		if credentialStore == nil {
+			key, err := CredentialKeyFromStoreKey(config.StoreVault.Key())
+			if err != nil {
+				logger.Errorf("Failed to derive credentials key: %v", err)
+				return nil, err
+			}
+			credentialStore = NewEncryptedFileCredentialStore(filepath.Join(config.AppDirPath, credentialsFileName), key)
+		}
+		if err := MigrateLegacyTokens(config.AppDirPath, credentialStore, DefaultProfile); err != nil {
+			logger.Warnf("Failed to migrate legacy tokens: %v", err)
+		}
+		tokenManager = NewTokenManager(credentialStore, nil) // Will set the client later
+		tokenManager.ServerURL = config.ServerAddress
+		if config.Profile != "" {
+			tokenManager.Profile = config.Profile
+		}
 	}
 
 	// Establish a single gRPC connection to the server
@@ -68,11 +109,15 @@ func NewRpcClient(config RpcClientConfig) (*RpcClient, error) {
 		// Your unary and stream interceptor functions
 		unaryInterceptor := UnaryInterceptor(tokenManager, logger)
 		streamInterceptor := StreamInterceptor(tokenManager, logger)
+		transport := config.Transport
+		if transport == nil {
+			transport = insecure.NewCredentials() // Using insecure credentials for local development/testing
+		}
 		conn, err = grpc.Dial(
 			config.ServerAddress,
-			grpc.WithTransportCredentials(insecure.NewCredentials()), // Using insecure credentials for local development/testing
-			grpc.WithChainUnaryInterceptor(unaryInterceptor),         // Add the unary interceptor
-			grpc.WithChainStreamInterceptor(streamInterceptor),       // Add the stream interceptor
+			grpc.WithTransportCredentials(transport),
+			grpc.WithChainUnaryInterceptor(unaryInterceptor),   // Add the unary interceptor
+			grpc.WithChainStreamInterceptor(streamInterceptor), // Add the stream interceptor
 		)
 		if err != nil {
 			logger.Errorf("Failed to connect to server: %v", err)
@@ -82,9 +127,11 @@ func NewRpcClient(config RpcClientConfig) (*RpcClient, error) {
 
 	// Create the RpcClient instance
 	rpcClient := &RpcClient{
-		Logger: logger,
-		Conn:   conn,
-		Store:  sqliteStore,
+		Logger:   logger,
+		Conn:     conn,
+		Store:    sqliteStore,
+		Profile:  tokenManager.Profile,
+		Profiles: config.Profiles,
 	}
 
 	// Initialize individual clients and set the ParentClient
@@ -108,12 +155,29 @@ func NewRpcClient(config RpcClientConfig) (*RpcClient, error) {
 	friendsClient := &FriendsClient{
 		Client: friends.NewFriendManagementClient(conn),
 		Logger: logger,
+		Events: make(chan *friends.FriendEvent, 10),
+	}
+
+	historyClient := &HistoryClient{
+		Client: history.NewHistoryTransferClient(conn),
+		Store:  sqliteStore,
+		Logger: logger,
+	}
+
+	userProfileClient := &UserProfileClient{
+		Client:       userprofile.NewUserProfileServiceClient(conn),
+		ChatClient:   chatClient,
+		Store:        sqliteStore,
+		Logger:       logger,
+		ParentClient: rpcClient,
 	}
 
 	// Set clients in RpcClient
 	rpcClient.AuthClient = authClient
 	rpcClient.ChatClient = chatClient
 	rpcClient.FriendsClient = friendsClient
+	rpcClient.HistoryClient = historyClient
+	rpcClient.UserProfileClient = userProfileClient
 
 	// Set the AuthService client in the TokenManager
 	tokenManager.SetClient(authClient)
@@ -130,6 +194,11 @@ func (r *RpcClient) CloseConnections() {
 	if err := r.AuthClient.LogoutUser(); err != nil {
 		r.Logger.Errorf("Failed to log out user: %v", err)
 	}
+
+	// Closing the store writes out any pending changes of an encrypted store.
+	if err := r.Store.Close(); err != nil {
+		r.Logger.Errorf("Failed to close the local store: %v", err)
+	}
 }
 
 func (r *RpcClient) GetAppDirPath() string {
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/johnkhk/cli_chat_app/client/e2ee/store"
+)
+
+const (
+	encryptedStoreFileName = "store.db.enc"
+	plaintextStoreFileName = "store.db"
+
+	// StorePassphraseEnv lets scripts and headless machines unlock the local store without a prompt.
+	StorePassphraseEnv = "CLI_CHAT_APP_STORE_PASSPHRASE"
+)
+
+// ErrStoreLocked is returned when the local store cannot be unlocked without asking the user.
+var ErrStoreLocked = errors.New("local store is locked")
+
+// StoreUnlocker unlocks the encrypted local store in the app directory. The store key is taken
+// from the OS keyring when one is available, and otherwise derived from the user's passphrase.
+type StoreUnlocker struct {
+	AppDirPath string
+	Keyring    Keyring // Optional; nil always asks for the passphrase
+	Logger     *logrus.Logger
+}
+
+func NewStoreUnlocker(appDirPath string, keyring Keyring, logger *logrus.Logger) *StoreUnlocker {
+	return &StoreUnlocker{
+		AppDirPath: appDirPath,
+		Keyring:    keyring,
+		Logger:     logger,
+	}
+}
+
+// StorePath returns the path of the encrypted store.
+func (u *StoreUnlocker) StorePath() string {
+	return filepath.Join(u.AppDirPath, encryptedStoreFileName)
+}
+
+// NeedsSetup reports whether no encrypted store exists yet, so the user has to choose a passphrase.
+func (u *StoreUnlocker) NeedsSetup() bool {
+	return !store.VaultExists(u.StorePath())
+}
+
+// HasPlaintextStore reports whether an unencrypted store from an older version is waiting to be migrated.
+func (u *StoreUnlocker) HasPlaintextStore() bool {
+	_, err := os.Stat(filepath.Join(u.AppDirPath, plaintextStoreFileName))
+	return err == nil
+}
+
+// AutoUnlock unlocks the store without prompting, using the key in the OS keyring or the
+// passphrase in StorePassphraseEnv. It returns ErrStoreLocked when neither is available.
+func (u *StoreUnlocker) AutoUnlock() (*store.Vault, error) {
+	if !u.NeedsSetup() && u.Keyring != nil {
+		key, err := u.Keyring.Get(u.StorePath())
+		if err == nil {
+			vault, err := store.OpenVaultWithKey(u.StorePath(), key)
+			if err == nil {
+				u.Logger.Info("Unlocked local store with the key from the OS keyring")
+				return vault, nil
+			}
+			u.Logger.Warnf("Stored keyring key does not unlock the local store: %v", err)
+		} else if !errors.Is(err, ErrSecretNotFound) {
+			u.Logger.Infof("OS keyring unavailable, falling back to passphrase: %v", err)
+		}
+	}
+
+	if passphrase := os.Getenv(StorePassphraseEnv); passphrase != "" {
+		return u.Unlock(passphrase)
+	}
+	return nil, ErrStoreLocked
+}
+
+// Unlock opens the store with passphrase, creating it and migrating any plaintext store first
+// if it does not exist yet. The store key is then remembered in the OS keyring when possible.
+func (u *StoreUnlocker) Unlock(passphrase string) (*store.Vault, error) {
+	var vault *store.Vault
+	var err error
+
+	if u.NeedsSetup() {
+		vault, err = u.setup(passphrase)
+	} else {
+		vault, err = store.OpenVaultWithPassphrase(u.StorePath(), []byte(passphrase))
+	}
+	if err != nil {
+		u.Logger.Errorf("Failed to unlock local store: %v", err)
+		return nil, err
+	}
+
+	if u.Keyring != nil {
+		if err := u.Keyring.Set(u.StorePath(), vault.Key()); err != nil {
+			u.Logger.Infof("Not saving the store key to the OS keyring: %v", err)
+		}
+	}
+	return vault, nil
+}
+
+func (u *StoreUnlocker) setup(passphrase string) (*store.Vault, error) {
+	if err := os.MkdirAll(u.AppDirPath, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create app directory: %w", err)
+	}
+
+	vault, err := store.CreateVault(u.StorePath(), []byte(passphrase))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create encrypted store: %w", err)
+	}
+
+	if u.HasPlaintextStore() {
+		u.Logger.Info("Encrypting existing local store")
+		if err := store.EncryptPlaintextStore(filepath.Join(u.AppDirPath, plaintextStoreFileName), vault); err != nil {
+			// Leave the plaintext store in place so nothing is lost, and try again next time.
+			os.Remove(u.StorePath())
+			return nil, fmt.Errorf("failed to encrypt existing store: %w", err)
+		}
+	}
+	u.Logger.Infof("Created encrypted store at: %s", u.StorePath())
+	return vault, nil
+}
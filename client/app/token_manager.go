@@ -4,12 +4,11 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/johnkhk/cli_chat_app/genproto/auth"
@@ -29,18 +28,17 @@ func (RealTimeProvider) Now() time.Time {
 // TokenManager handles all operations related to managing tokens.
 type TokenManager struct {
 	TimeProvider TimeProvider
-	filePath     string
+	Credentials  CredentialStore
+	Profile      string      // Server profile the tokens are stored under
+	ServerURL    string      // Recorded with the tokens so a profile remembers its server
 	AuthClient   *AuthClient // Reference to the parent AuthClient
+	mu           sync.Mutex
 }
 
-func NewTokenManager(filePath string, client *AuthClient) *TokenManager {
-	// Ensure the directory exists
-	dir := filepath.Dir(filePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		panic(fmt.Sprintf("Failed to create directory %s: %v", dir, err))
-	}
+func NewTokenManager(credentials CredentialStore, client *AuthClient) *TokenManager {
 	return &TokenManager{
-		filePath:     filePath,
+		Credentials:  credentials,
+		Profile:      DefaultProfile,
 		AuthClient:   client,
 		TimeProvider: RealTimeProvider{}, // Default TimeProvider
 	}
@@ -89,27 +87,57 @@ func (tm *TokenManager) TryAutoLogin() error {
 	return err
 }
 
-// StoreTokens stores the access and refresh tokens in a local file.
+// StoreTokens stores the access and refresh tokens for the current profile.
 func (tm *TokenManager) StoreTokens(accessToken, refreshToken string) error {
-	data := fmt.Sprintf("access_token:%s\nrefresh_token:%s", accessToken, refreshToken)
+	return tm.updateProfile(func(profile *ServerCredentials) {
+		profile.AccessToken = accessToken
+		profile.RefreshToken = refreshToken
+		if tm.ServerURL != "" {
+			profile.ServerURL = tm.ServerURL
+		}
+	})
+}
 
-	// Write the tokens to a file with secure permissions
-	return ioutil.WriteFile(tm.filePath, []byte(data), 0600)
+// StoreAccount records which user and device the current profile's tokens belong to.
+func (tm *TokenManager) StoreAccount(userID, deviceID uint32) error {
+	return tm.updateProfile(func(profile *ServerCredentials) {
+		profile.UserID = userID
+		profile.DeviceID = deviceID
+	})
 }
 
-// ReadTokens retrieves the access and refresh tokens from the local file.
+// ReadTokens retrieves the access and refresh tokens of the current profile.
 func (tm *TokenManager) ReadTokens() (string, string, error) {
-	data, err := ioutil.ReadFile(tm.filePath)
+	credentials, err := tm.Credentials.Load()
 	if err != nil {
 		return "", "", err
 	}
 
-	var accessToken, refreshToken string
-	_, err = fmt.Sscanf(string(data), "access_token:%s\nrefresh_token:%s", &accessToken, &refreshToken)
-	if err != nil {
-		return "", "", err
+	profile, ok := credentials.Profiles[tm.Profile]
+	if !ok || profile.AccessToken == "" {
+		return "", "", ErrNoCredentials
+	}
+	return profile.AccessToken, profile.RefreshToken, nil
+}
+
+func (tm *TokenManager) updateProfile(update func(profile *ServerCredentials)) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	credentials, err := tm.Credentials.Load()
+	if errors.Is(err, ErrNoCredentials) {
+		credentials = NewCredentials()
+	} else if err != nil {
+		return err
+	}
+
+	profile, ok := credentials.Profiles[tm.Profile]
+	if !ok {
+		profile = &ServerCredentials{}
+		credentials.Profiles[tm.Profile] = profile
 	}
-	return accessToken, refreshToken, nil
+	update(profile)
+	return tm.Credentials.Save(credentials)
 }
 
 // Helper function to check if a token is expired by decoding the JWT payload.
@@ -0,0 +1,260 @@
+package app
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/johnkhk/cli_chat_app/client/e2ee/store"
+	"github.com/johnkhk/cli_chat_app/client/lib"
+	"github.com/johnkhk/cli_chat_app/genproto/userprofile"
+)
+
+const (
+	// profileKeySize is the size of the AES-256 key a user's profile is encrypted with.
+	profileKeySize = 32
+
+	// MaxDisplayNameLength and MaxStatusLength are in characters.
+	MaxDisplayNameLength = 64
+	MaxStatusLength      = 140
+
+	// MaxAvatarSize keeps the encrypted profile under the server's limit.
+	MaxAvatarSize = 64 << 10
+)
+
+// UserProfile is what a user shares about themselves with their friends. The server only ever
+// sees it encrypted with the user's profile key.
+type UserProfile struct {
+	DisplayName string `json:"displayName,omitempty"`
+	Status      string `json:"status,omitempty"` // A short bio or status line
+	Avatar      []byte `json:"avatar,omitempty"` // A small image, as uploaded by the user
+}
+
+// Validate checks the profile against the length limits.
+func (p *UserProfile) Validate() error {
+	if utf8.RuneCountInString(p.DisplayName) > MaxDisplayNameLength {
+		return fmt.Errorf("display name is longer than %d characters", MaxDisplayNameLength)
+	}
+	if utf8.RuneCountInString(p.Status) > MaxStatusLength {
+		return fmt.Errorf("status is longer than %d characters", MaxStatusLength)
+	}
+	if len(p.Avatar) > MaxAvatarSize {
+		return fmt.Errorf("avatar is larger than %d KiB", MaxAvatarSize>>10)
+	}
+	return nil
+}
+
+// UserProfileClient keeps the current user's profile on the server and reads their friends' profiles.
+// Each user encrypts their profile with a random profile key that is sent to friends over the
+// end-to-end encrypted chat, so only friends can read it.
+type UserProfileClient struct {
+	Client       userprofile.UserProfileServiceClient
+	ChatClient   *ChatClient // Carries profile keys to friends
+	Store        *store.SQLiteStore
+	Logger       *logrus.Logger
+	ParentClient *RpcClient
+}
+
+// GetOwnProfile returns the current user's profile, or nil if they have not set one.
+func (c *UserProfileClient) GetOwnProfile() (*UserProfile, error) {
+	return c.GetProfile(c.ParentClient.CurrentUserID)
+}
+
+// GetProfile returns a user's profile, or nil if they have not set one or have not sent
+// this device the key to read it.
+func (c *UserProfileClient) GetProfile(userID uint32) (*UserProfile, error) {
+	key, err := c.Store.ProfileKey(userID)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, nil
+	}
+
+	resp, err := c.Client.GetProfile(context.Background(), &userprofile.GetProfileRequest{UserId: userID})
+	if err != nil {
+		c.Logger.Errorf("Failed to get profile of user %d: %v", userID, err)
+		return nil, fmt.Errorf("failed to get profile: %w", err)
+	}
+	if !resp.Found {
+		return nil, nil
+	}
+
+	profile, err := openUserProfile(key, resp.EncryptedProfile)
+	if err != nil {
+		// Most likely the key was rotated and the new one has not arrived yet.
+		c.Logger.Warnf("Failed to decrypt profile of user %d: %v", userID, err)
+		return nil, nil
+	}
+	return profile, nil
+}
+
+// GetProfiles returns the profiles of the given users that this device can read, by user ID.
+func (c *UserProfileClient) GetProfiles(userIDs []uint32) map[uint32]*UserProfile {
+	profiles := make(map[uint32]*UserProfile)
+	for _, userID := range userIDs {
+		profile, err := c.GetProfile(userID)
+		if err != nil {
+			c.Logger.Warnf("Skipping profile of user %d: %v", userID, err)
+			continue
+		}
+		if profile != nil {
+			profiles[userID] = profile
+		}
+	}
+	return profiles
+}
+
+// UpdateProfile encrypts and uploads the current user's profile. Friends are sent the profile key
+// first, creating it if this is the first profile, so they can read the profile as soon as they
+// hear it changed.
+func (c *UserProfileClient) UpdateProfile(ctx context.Context, profile *UserProfile, friendIDs []uint32) error {
+	profile.DisplayName = strings.TrimSpace(profile.DisplayName)
+	profile.Status = strings.TrimSpace(profile.Status)
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+
+	key, err := c.Store.ProfileKey(c.ParentClient.CurrentUserID)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		key = make([]byte, profileKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("failed to generate profile key: %w", err)
+		}
+		if err := c.Store.ReplaceOwnProfileKey(c.ParentClient.CurrentUserID, key); err != nil {
+			return err
+		}
+	}
+
+	c.ShareProfileKey(ctx, friendIDs)
+	return c.upload(key, profile)
+}
+
+// ShareProfileKey sends the current user's profile key to the friends that do not have it yet.
+// It does nothing before the user has set a profile. Failures are logged and retried on the next call.
+func (c *UserProfileClient) ShareProfileKey(ctx context.Context, friendIDs []uint32) {
+	key, err := c.Store.ProfileKey(c.ParentClient.CurrentUserID)
+	if err != nil || key == nil {
+		return
+	}
+	shared, err := c.Store.ProfileKeyShares()
+	if err != nil {
+		c.Logger.Errorf("Failed to load profile key shares: %v", err)
+		return
+	}
+
+	for _, friendID := range friendIDs {
+		if shared[friendID] {
+			continue
+		}
+		opts := &lib.SendMessageOptions{FileType: lib.ProfileKeyFileType, FileSize: uint64(len(key))}
+		if err := c.ChatClient.SendMessage(ctx, friendID, 0, key, opts); err != nil {
+			c.Logger.Errorf("Failed to send profile key to user %d: %v", friendID, err)
+			continue
+		}
+		if err := c.Store.MarkProfileKeyShared(friendID); err != nil {
+			c.Logger.Errorf("Failed to record profile key sent to user %d: %v", friendID, err)
+		}
+	}
+}
+
+// RotateProfileKey re-encrypts the current user's profile with a new key and sends it to the
+// remaining friends, so someone who was removed or blocked can no longer read later changes.
+func (c *UserProfileClient) RotateProfileKey(ctx context.Context, friendIDs []uint32) error {
+	profile, err := c.GetOwnProfile()
+	if err != nil {
+		return err
+	}
+	if profile == nil {
+		return nil
+	}
+
+	key := make([]byte, profileKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("failed to generate profile key: %w", err)
+	}
+	if err := c.Store.ReplaceOwnProfileKey(c.ParentClient.CurrentUserID, key); err != nil {
+		return err
+	}
+
+	c.ShareProfileKey(ctx, friendIDs)
+	return c.upload(key, profile)
+}
+
+func (c *UserProfileClient) upload(key []byte, profile *UserProfile) error {
+	sealed, err := sealUserProfile(key, profile)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.Client.UpdateProfile(context.Background(), &userprofile.UpdateProfileRequest{EncryptedProfile: sealed})
+	if err != nil {
+		c.Logger.Errorf("Failed to update profile: %v", err)
+		return fmt.Errorf("failed to update profile: %w", err)
+	}
+
+	if resp.Success {
+		c.Logger.Infof("Profile updated successfully: %s", resp.Message)
+	} else {
+		c.Logger.Infof("Failed to update profile: %s", resp.Message)
+		return fmt.Errorf("failed to update profile: %s", resp.Message)
+	}
+
+	return nil
+}
+
+// sealUserProfile encrypts a profile with AES-256-GCM, prefixing the nonce.
+func sealUserProfile(key []byte, profile *UserProfile) ([]byte, error) {
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode profile: %w", err)
+	}
+	gcm, err := newProfileGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+// openUserProfile reverses sealUserProfile.
+func openUserProfile(key, sealed []byte) (*UserProfile, error) {
+	gcm, err := newProfileGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("profile is corrupt")
+	}
+	data, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt profile: %w", err)
+	}
+
+	var profile UserProfile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("failed to decode profile: %w", err)
+	}
+	return &profile, nil
+}
+
+func newProfileGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid profile key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,33 @@
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserProfileSealing(t *testing.T) {
+	key := randomKey(t)
+	profile := &UserProfile{DisplayName: "Alice", Status: "Out hiking", Avatar: []byte{0x89, 'P', 'N', 'G'}}
+
+	sealed, err := sealUserProfile(key, profile)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(sealed), "Alice", "the server must not see the profile in the clear")
+
+	opened, err := openUserProfile(key, sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, profile, opened)
+
+	_, err = openUserProfile(randomKey(t), sealed)
+	assert.Error(t, err, "a stale key should not open a profile sealed with a new one")
+	_, err = openUserProfile(key, sealed[:4])
+	assert.Error(t, err)
+}
+
+func TestUserProfileValidate(t *testing.T) {
+	assert.NoError(t, (&UserProfile{DisplayName: strings.Repeat("é", MaxDisplayNameLength)}).Validate())
+	assert.Error(t, (&UserProfile{DisplayName: strings.Repeat("a", MaxDisplayNameLength+1)}).Validate())
+	assert.Error(t, (&UserProfile{Status: strings.Repeat("a", MaxStatusLength+1)}).Validate())
+	assert.Error(t, (&UserProfile{Avatar: make([]byte, MaxAvatarSize+1)}).Validate())
+}
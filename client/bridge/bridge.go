@@ -0,0 +1,258 @@
+// Package bridge relays chat messages between a logged-in (usually bot) account and local HTTP services.
+// Incoming messages are decrypted by the client and POSTed as JSON to a webhook, and a local HTTP API
+// accepts outgoing messages to encrypt and send.
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/johnkhk/cli_chat_app/client/app"
+	"github.com/johnkhk/cli_chat_app/client/lib"
+)
+
+const (
+	webhookAttempts = 3                // Times a webhook delivery is tried before the message is dropped
+	sendTimeout     = 10 * time.Second // How long an API send waits for the server to acknowledge
+	maxRequestBytes = 32 << 20         // Largest request body the local API accepts
+)
+
+// Messenger is the chat client the bridge relays through.
+type Messenger interface {
+	// ReceiveMessage blocks until the next incoming message.
+	ReceiveMessage(ctx context.Context) (*app.IncomingMessage, error)
+	// SendMessage sends a message to a friend by username and returns the server's acknowledgement status.
+	SendMessage(ctx context.Context, username string, message []byte, opts *lib.SendMessageOptions) (string, error)
+}
+
+// Config configures a Bridge.
+type Config struct {
+	WebhookURL    string         // Where incoming messages are POSTed
+	ListenAddress string         // Address of the local HTTP API, e.g. 127.0.0.1:8787
+	Token         string         // Bearer token the local API requires; empty disables the check
+	HTTPClient    *http.Client   // Client for webhook calls; defaults to one with a 10 second timeout
+	RetryDelay    time.Duration  // Delay before retrying a failed webhook call, doubled each attempt
+	Logger        *logrus.Logger // Logger for bridge activity
+}
+
+// OutgoingMessage is the body of a POST to the local API's /messages endpoint.
+// Setting Data sends a file named FileName instead of the text Body.
+type OutgoingMessage struct {
+	To       string `json:"to"`
+	Body     string `json:"body,omitempty"`
+	FileName string `json:"file_name,omitempty"`
+	Data     []byte `json:"data,omitempty"` // File contents, base64 encoded in JSON
+}
+
+// SendResult is the response to a successful POST to /messages.
+type SendResult struct {
+	Status string `json:"status"`
+}
+
+// Bridge relays messages between a Messenger and local HTTP services.
+type Bridge struct {
+	messenger Messenger
+	config    Config
+}
+
+// New creates a bridge relaying through messenger.
+func New(messenger Messenger, config Config) *Bridge {
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.RetryDelay == 0 {
+		config.RetryDelay = time.Second
+	}
+	if config.Logger == nil {
+		config.Logger = logrus.New()
+	}
+	return &Bridge{messenger: messenger, config: config}
+}
+
+// Run serves the local API and forwards incoming messages to the webhook until ctx is canceled.
+func (b *Bridge) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", b.config.ListenAddress)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", b.config.ListenAddress, err)
+	}
+	server := &http.Server{Handler: b.Handler(), ReadHeaderTimeout: 10 * time.Second}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		b.config.Logger.Infof("Bridge API listening on %s", listener.Addr())
+		serveErr <- server.Serve(listener)
+	}()
+
+	forwardErr := make(chan error, 1)
+	go func() {
+		forwardErr <- b.forwardIncoming(ctx)
+	}()
+
+	select {
+	case <-ctx.Done():
+	case err = <-serveErr:
+	case err = <-forwardErr:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+		b.config.Logger.Errorf("Failed to shut down bridge API: %v", shutdownErr)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	return err
+}
+
+// forwardIncoming POSTs each incoming message to the webhook until ctx is canceled.
+func (b *Bridge) forwardIncoming(ctx context.Context) error {
+	for {
+		msg, err := b.messenger.ReceiveMessage(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to receive message: %w", err)
+		}
+		if err := b.Forward(ctx, msg); err != nil {
+			b.config.Logger.Errorf("Dropping message %s from %s: %v", msg.ID, msg.Sender, err)
+		}
+	}
+}
+
+// Forward POSTs one message to the webhook, retrying with backoff if the webhook is unavailable.
+func (b *Bridge) Forward(ctx context.Context, msg *app.IncomingMessage) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	delay := b.config.RetryDelay
+	for attempt := 1; ; attempt++ {
+		err = b.post(ctx, payload)
+		if err == nil {
+			b.config.Logger.Infof("Forwarded message %s from %s to webhook", msg.ID, msg.Sender)
+			return nil
+		}
+		if attempt == webhookAttempts {
+			return fmt.Errorf("webhook failed %d times: %w", attempt, err)
+		}
+		b.config.Logger.Warnf("Webhook call for message %s failed, retrying in %s: %v", msg.ID, delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (b *Bridge) post(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.config.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Handler returns the local API: POST /messages sends a message and GET /healthz reports liveness.
+func (b *Bridge) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/messages", b.authorize(b.handleSend))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return mux
+}
+
+// authorize rejects requests without the configured bearer token.
+func (b *Bridge) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if b.config.Token != "" {
+			expected := []byte("Bearer " + b.config.Token)
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+				writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+func (b *Bridge) handleSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+
+	var msg OutgoingMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes)).Decode(&msg); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid JSON body: %v", err))
+		return
+	}
+	if msg.To == "" {
+		writeError(w, http.StatusBadRequest, `"to" is required`)
+		return
+	}
+
+	messageBytes := []byte(msg.Body)
+	var opts *lib.SendMessageOptions
+	if msg.Data != nil {
+		if msg.FileName == "" {
+			writeError(w, http.StatusBadRequest, `"file_name" is required when sending data`)
+			return
+		}
+		messageBytes = msg.Data
+		opts = &lib.SendMessageOptions{
+			FileType: lib.FileTypeFromName(msg.FileName),
+			FileSize: uint64(len(msg.Data)),
+			FileName: msg.FileName,
+		}
+	} else if msg.Body == "" {
+		writeError(w, http.StatusBadRequest, `"body" or "data" is required`)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), sendTimeout)
+	defer cancel()
+	status, err := b.messenger.SendMessage(ctx, msg.To, messageBytes, opts)
+	if err != nil {
+		b.config.Logger.Errorf("Bridge failed to send message to %s: %v", msg.To, err)
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	b.config.Logger.Infof("Bridge sent message to %s (%s)", msg.To, status)
+	writeJSON(w, http.StatusOK, SendResult{Status: status})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
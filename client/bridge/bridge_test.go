@@ -0,0 +1,123 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johnkhk/cli_chat_app/client/app"
+	"github.com/johnkhk/cli_chat_app/client/lib"
+)
+
+// fakeMessenger records sends and replays queued incoming messages.
+type fakeMessenger struct {
+	incoming chan *app.IncomingMessage
+	sent     []OutgoingMessage
+	sendErr  error
+}
+
+func (f *fakeMessenger) ReceiveMessage(ctx context.Context) (*app.IncomingMessage, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case msg := <-f.incoming:
+		return msg, nil
+	}
+}
+
+func (f *fakeMessenger) SendMessage(ctx context.Context, username string, message []byte, opts *lib.SendMessageOptions) (string, error) {
+	if f.sendErr != nil {
+		return "", f.sendErr
+	}
+	sent := OutgoingMessage{To: username, Body: string(message)}
+	if opts != nil {
+		sent = OutgoingMessage{To: username, FileName: opts.FileName, Data: message}
+	}
+	f.sent = append(f.sent, sent)
+	return "delivered", nil
+}
+
+func TestBridgeSendAPI(t *testing.T) {
+	messenger := &fakeMessenger{}
+	handler := New(messenger, Config{Token: "secret"}).Handler()
+
+	post := func(body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/messages", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post(`{"to":"alice","body":"deploy finished"}`, "wrong")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "a bad token should be rejected")
+	assert.Empty(t, messenger.sent)
+
+	rec = post(`{"to":"alice","body":"deploy finished"}`, "secret")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var result SendResult
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, "delivered", result.Status)
+
+	rec = post(`{"to":"alice","file_name":"report.png","data":"aGVsbG8="}`, "secret")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	assert.Equal(t, []OutgoingMessage{
+		{To: "alice", Body: "deploy finished"},
+		{To: "alice", FileName: "report.png", Data: []byte("hello")},
+	}, messenger.sent)
+
+	assert.Equal(t, http.StatusBadRequest, post(`{"body":"no recipient"}`, "secret").Code)
+	assert.Equal(t, http.StatusBadRequest, post(`{"to":"alice"}`, "secret").Code, "empty messages should be rejected")
+	assert.Equal(t, http.StatusBadRequest, post(`not json`, "secret").Code)
+
+	messenger.sendErr = fmt.Errorf("bob is not in the bot's friend list")
+	assert.Equal(t, http.StatusBadGateway, post(`{"to":"bob","body":"hi"}`, "secret").Code)
+}
+
+func TestBridgeForwardsToWebhook(t *testing.T) {
+	var calls atomic.Int32
+	received := make(chan app.IncomingMessage, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first call to exercise the retry.
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var msg app.IncomingMessage
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&msg))
+		received <- msg
+	}))
+	defer webhook.Close()
+
+	messenger := &fakeMessenger{incoming: make(chan *app.IncomingMessage, 1)}
+	b := New(messenger, Config{WebhookURL: webhook.URL, ListenAddress: "127.0.0.1:0", RetryDelay: time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+
+	messenger.incoming <- &app.IncomingMessage{ID: "msg-1", SenderID: 7, Sender: "alice", Type: "text", Body: "ping"}
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, "alice", msg.Sender)
+		assert.Equal(t, "ping", msg.Body)
+	case <-time.After(3 * time.Second):
+		t.Fatal("webhook did not receive the message")
+	}
+	assert.Equal(t, int32(2), calls.Load(), "the failed webhook call should have been retried once")
+
+	cancel()
+	assert.NoError(t, <-done, "the bridge should stop cleanly when canceled")
+}
@@ -0,0 +1,46 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/johnkhk/cli_chat_app/client/app"
+	"github.com/johnkhk/cli_chat_app/client/lib"
+)
+
+// RpcMessenger is a Messenger backed by a logged-in RpcClient.
+type RpcMessenger struct {
+	RpcClient *app.RpcClient
+}
+
+// NewRpcMessenger creates a Messenger for rpcClient, which must already be logged in.
+func NewRpcMessenger(rpcClient *app.RpcClient) *RpcMessenger {
+	return &RpcMessenger{RpcClient: rpcClient}
+}
+
+// ReceiveMessage returns the next message from a user, skipping server notices.
+func (m *RpcMessenger) ReceiveMessage(ctx context.Context) (*app.IncomingMessage, error) {
+	for {
+		msg, err := m.RpcClient.ChatClient.ReceiveMessage(ctx, 0)
+		if err != nil {
+			return nil, err
+		}
+		if msg.SenderID != 0 {
+			return msg, nil
+		}
+	}
+}
+
+// SendMessage looks the recipient up in the friend list and sends them an encrypted message.
+func (m *RpcMessenger) SendMessage(ctx context.Context, username string, message []byte, opts *lib.SendMessageOptions) (string, error) {
+	friendList, err := m.RpcClient.FriendsClient.GetFriendList()
+	if err != nil {
+		return "", err
+	}
+	for _, friend := range friendList {
+		if friend.Username == username {
+			return m.RpcClient.ChatClient.SendMessageAndWait(ctx, uint32(friend.UserId), m.RpcClient.CurrentDeviceID, message, opts)
+		}
+	}
+	return "", fmt.Errorf("%s is not in the bot's friend list", username)
+}
@@ -0,0 +1,156 @@
+// Package historysync encrypts chat history for transfer to another device of the same user.
+//
+// The sender generates an ephemeral X25519 key pair and derives an AES-256-GCM key from the
+// Diffie-Hellman of the ephemeral private key and the receiving device's identity key. Only the
+// receiving device, which holds the identity private key, can decrypt the payload.
+package historysync
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/johnkhk/cli_chat_app/client/e2ee/store"
+)
+
+// Version is the payload format version.
+const Version = 1
+
+// djbKeyType prefixes serialized Curve25519 public keys in libsignal.
+const djbKeyType = 0x05
+
+var hkdfInfo = []byte("cli_chat_app history transfer v1")
+
+// Payload is the plaintext content of a history transfer.
+type Payload struct {
+	Version  int                 `json:"version"`
+	Messages []store.ChatMessage `json:"messages"`
+}
+
+// Seal encrypts the messages to the recipient's public identity key. It returns the ephemeral
+// public key the recipient needs to decrypt, and the ciphertext.
+func Seal(recipientIdentityKey []byte, messages []store.ChatMessage) ([]byte, []byte, error) {
+	recipient, err := rawPublicKey(recipientIdentityKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plaintext, err := json.Marshal(Payload{Version: Version, Messages: messages})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode history: %v", err)
+	}
+
+	ephemeralPrivate := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand.Reader, ephemeralPrivate); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate ephemeral key: %v", err)
+	}
+	ephemeralPublic, err := curve25519.X25519(ephemeralPrivate, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive ephemeral public key: %v", err)
+	}
+
+	aead, err := deriveCipher(ephemeralPrivate, recipient, ephemeralPublic, recipient)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	ciphertext := aead.Seal(nonce, nonce, plaintext, ephemeralPublic)
+
+	return ephemeralPublic, ciphertext, nil
+}
+
+// Open decrypts a payload produced by Seal using the recipient's private identity key.
+func Open(identityPrivateKey, identityPublicKey, ephemeralPublicKey, ciphertext []byte) ([]store.ChatMessage, error) {
+	recipient, err := rawPublicKey(identityPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(ephemeralPublicKey) != curve25519.PointSize {
+		return nil, fmt.Errorf("invalid ephemeral key length %d", len(ephemeralPublicKey))
+	}
+
+	aead, err := deriveCipher(identityPrivateKey, ephemeralPublicKey, ephemeralPublicKey, recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("history payload is too short")
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, ephemeralPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt history: %v", err)
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		return nil, fmt.Errorf("failed to decode history: %v", err)
+	}
+	if payload.Version != Version {
+		return nil, fmt.Errorf("unsupported history format version %d", payload.Version)
+	}
+	return payload.Messages, nil
+}
+
+// Fingerprint returns a short, human-comparable digest of an identity key, so the user can
+// check that the old device is sending to the device they are holding.
+func Fingerprint(identityKey []byte) string {
+	sum := sha256.Sum256(identityKey)
+	digest := hex.EncodeToString(sum[:10])
+	groups := make([]string, 0, len(digest)/4)
+	for i := 0; i < len(digest); i += 4 {
+		groups = append(groups, digest[i:i+4])
+	}
+	return strings.Join(groups, " ")
+}
+
+// deriveCipher computes the shared secret and derives the AES-GCM cipher from it.
+// The ephemeral and recipient public keys are mixed in as the HKDF salt.
+func deriveCipher(privateKey, peerPublicKey, ephemeralPublicKey, recipientPublicKey []byte) (cipher.AEAD, error) {
+	if len(privateKey) != curve25519.ScalarSize {
+		return nil, fmt.Errorf("invalid private key length %d", len(privateKey))
+	}
+	shared, err := curve25519.X25519(privateKey, peerPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute shared secret: %v", err)
+	}
+
+	salt := bytes.Join([][]byte{ephemeralPublicKey, recipientPublicKey}, nil)
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, hkdfInfo), key); err != nil {
+		return nil, fmt.Errorf("failed to derive key: %v", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// rawPublicKey strips the libsignal key type prefix from a serialized public key.
+func rawPublicKey(key []byte) ([]byte, error) {
+	switch {
+	case len(key) == curve25519.PointSize+1 && key[0] == djbKeyType:
+		return key[1:], nil
+	case len(key) == curve25519.PointSize:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("invalid identity key length %d", len(key))
+	}
+}
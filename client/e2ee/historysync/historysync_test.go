@@ -0,0 +1,69 @@
+package historysync
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/curve25519"
+
+	"github.com/johnkhk/cli_chat_app/client/e2ee/store"
+)
+
+func generateIdentity(t *testing.T) ([]byte, []byte) {
+	private := make([]byte, curve25519.ScalarSize)
+	_, err := rand.Read(private)
+	assert.NoError(t, err)
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	assert.NoError(t, err)
+	// Serialize the public key the way libsignal does, with the key type prefix.
+	return private, append([]byte{djbKeyType}, public...)
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	private, public := generateIdentity(t)
+	messages := []store.ChatMessage{
+		{MessageID: "m1", SenderID: 1, ReceiverID: 2, Message: "hello", FileType: "text", Timestamp: time.Unix(1700000000, 0).UTC(), Delivered: 1},
+		{MessageID: "m2", SenderID: 2, ReceiverID: 1, Media: []byte{1, 2, 3}, FileType: "image/png", FileName: "a.png", FileSize: 3, Timestamp: time.Unix(1700000060, 0).UTC()},
+	}
+
+	ephemeral, ciphertext, err := Seal(public, messages)
+	assert.NoError(t, err, "should seal history without error")
+	assert.NotContains(t, string(ciphertext), "hello", "ciphertext should not contain plaintext")
+
+	opened, err := Open(private, public, ephemeral, ciphertext)
+	assert.NoError(t, err, "should open history without error")
+	assert.Equal(t, messages, opened, "opened history should match sealed history")
+}
+
+func TestOpenWithWrongKeyFails(t *testing.T) {
+	_, public := generateIdentity(t)
+	otherPrivate, otherPublic := generateIdentity(t)
+
+	ephemeral, ciphertext, err := Seal(public, []store.ChatMessage{{MessageID: "m1", Message: "secret"}})
+	assert.NoError(t, err)
+
+	_, err = Open(otherPrivate, otherPublic, ephemeral, ciphertext)
+	assert.Error(t, err, "another device should not be able to open the history")
+}
+
+func TestOpenTamperedPayloadFails(t *testing.T) {
+	private, public := generateIdentity(t)
+
+	ephemeral, ciphertext, err := Seal(public, []store.ChatMessage{{MessageID: "m1", Message: "secret"}})
+	assert.NoError(t, err)
+
+	ciphertext[len(ciphertext)-1] ^= 0xff
+	_, err = Open(private, public, ephemeral, ciphertext)
+	assert.Error(t, err, "tampered history should not open")
+}
+
+func TestFingerprintIsStable(t *testing.T) {
+	_, public := generateIdentity(t)
+	_, other := generateIdentity(t)
+
+	assert.Equal(t, Fingerprint(public), Fingerprint(public))
+	assert.NotEqual(t, Fingerprint(public), Fingerprint(other))
+	assert.Len(t, Fingerprint(public), 24, "fingerprint should be five groups of four hex digits")
+}
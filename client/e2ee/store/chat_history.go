@@ -1,6 +1,7 @@
 package store
 
 import (
+	"database/sql"
 	"fmt"
 	"time"
 
@@ -21,6 +22,8 @@ type ChatMessage struct {
 }
 
 // SaveChatMessage inserts a new chat message with the specified messageId into the `chat_history` table.
+// Saving a messageId that already exists is not an error: the stored message is kept and only its
+// delivered status is raised, so retried and re-delivered messages are idempotent.
 func (s *SQLiteStore) SaveChatMessage(messageID string, senderID, receiverID uint32, message []byte, delivered int, fileOpts *lib.SendMessageOptions) error {
 	// Prepare the SQL query for inserting a new chat message.
 	if fileOpts == nil {
@@ -34,7 +37,8 @@ func (s *SQLiteStore) SaveChatMessage(messageID string, senderID, receiverID uin
 	if fileOpts.FileType == "text" {
 		query := `
 			INSERT INTO chat_history (messageId, sender_id, receiver_id, message, delivered, file_type, file_size, file_name)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?);` // `delivered` is set to 0 (false) initially.
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(messageId) DO UPDATE SET delivered = MAX(chat_history.delivered, excluded.delivered);` // `delivered` is set to 0 (false) initially.
 		_, err := s.DB.Exec(query, messageID, senderID, receiverID, string(message), delivered, fileOpts.FileType, fileOpts.FileSize, fileOpts.FileName)
 		if err != nil {
 			return fmt.Errorf("failed to save chat message: %v", err)
@@ -42,7 +46,8 @@ func (s *SQLiteStore) SaveChatMessage(messageID string, senderID, receiverID uin
 	} else {
 		query := `
 			INSERT INTO chat_history (messageId, sender_id, receiver_id, message, media, delivered, file_type, file_size, file_name)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);` // `delivered` is set to 0 (false) initially.
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(messageId) DO UPDATE SET delivered = MAX(chat_history.delivered, excluded.delivered);` // `delivered` is set to 0 (false) initially.
 		_, err := s.DB.Exec(query, messageID, senderID, receiverID, "", message, delivered, fileOpts.FileType, fileOpts.FileSize, fileOpts.FileName)
 		if err != nil {
 			return fmt.Errorf("failed to save chat message: %v", err)
@@ -52,6 +57,34 @@ func (s *SQLiteStore) SaveChatMessage(messageID string, senderID, receiverID uin
 	return nil
 }
 
+// HasChatMessage reports whether a message with the given messageId is already in the `chat_history` table.
+func (s *SQLiteStore) HasChatMessage(messageID string) (bool, error) {
+	var exists bool
+	err := s.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM chat_history WHERE messageId = ?);`, messageID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check for message ID %s: %v", messageID, err)
+	}
+	return exists, nil
+}
+
+// GetChatMessage retrieves a single message by its messageId. It returns nil if there is no such message.
+func (s *SQLiteStore) GetChatMessage(messageID string) (*ChatMessage, error) {
+	query := `
+		SELECT messageId, sender_id, receiver_id, message, media, file_type, file_size, file_name, timestamp, delivered
+		FROM chat_history
+		WHERE messageId = ?;`
+
+	var msg ChatMessage
+	err := s.DB.QueryRow(query, messageID).Scan(&msg.MessageID, &msg.SenderID, &msg.ReceiverID, &msg.Message, &msg.Media, &msg.FileType, &msg.FileSize, &msg.FileName, &msg.Timestamp, &msg.Delivered)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message ID %s: %v", messageID, err)
+	}
+	return &msg, nil
+}
+
 // UpdateMessageDeliveryStatus updates the `delivered` status of a message in the `chat_history` table.
 func (s *SQLiteStore) UpdateMessageDeliveryStatus(messageID string, delivered bool) error {
 	query := `
@@ -104,3 +137,60 @@ func (s *SQLiteStore) DeleteMessage(messageID int64) error {
 	}
 	return nil
 }
+
+// ExportChatHistory returns every message in the `chat_history` table, oldest first.
+func (s *SQLiteStore) ExportChatHistory() ([]ChatMessage, error) {
+	query := `
+		SELECT messageId, sender_id, receiver_id, message, media, file_type, file_size, file_name, timestamp, delivered
+		FROM chat_history
+		ORDER BY timestamp ASC;`
+
+	rows, err := s.DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export chat history: %v", err)
+	}
+	defer rows.Close()
+
+	var messages []ChatMessage
+	for rows.Next() {
+		var msg ChatMessage
+		err := rows.Scan(&msg.MessageID, &msg.SenderID, &msg.ReceiverID, &msg.Message, &msg.Media, &msg.FileType, &msg.FileSize, &msg.FileName, &msg.Timestamp, &msg.Delivered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// ImportChatHistory inserts messages exported from another device, keeping their original timestamps.
+// Messages that are already present are left as they are. It returns the number of messages added.
+func (s *SQLiteStore) ImportChatHistory(messages []ChatMessage) (int, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO chat_history (messageId, sender_id, receiver_id, message, media, file_type, file_size, file_name, timestamp, delivered)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(messageId) DO NOTHING;`
+
+	imported := 0
+	for _, msg := range messages {
+		res, err := tx.Exec(query, msg.MessageID, msg.SenderID, msg.ReceiverID, msg.Message, msg.Media, msg.FileType, msg.FileSize, msg.FileName, msg.Timestamp, msg.Delivered)
+		if err != nil {
+			return 0, fmt.Errorf("failed to import message ID %s: %v", msg.MessageID, err)
+		}
+		if n, err := res.RowsAffected(); err == nil {
+			imported += int(n)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return imported, nil
+}
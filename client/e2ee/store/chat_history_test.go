@@ -0,0 +1,69 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveChatMessageIsIdempotent(t *testing.T) {
+	store := createTestSQLiteStore(t)
+
+	err := store.SaveChatMessage("msg-1", 1, 2, []byte("hello"), 0, nil)
+	assert.NoError(t, err, "should save message without error")
+
+	// Saving the same message again updates its status instead of failing.
+	err = store.SaveChatMessage("msg-1", 1, 2, []byte("hello"), 1, nil)
+	assert.NoError(t, err, "should save duplicate message without error")
+
+	history, err := store.GetChatHistory(1, 2)
+	assert.NoError(t, err, "should load chat history without error")
+	assert.Len(t, history, 1, "duplicate message should not be stored twice")
+	assert.Equal(t, "hello", history[0].Message)
+	assert.Equal(t, 1, history[0].Delivered, "duplicate save should raise the delivered status")
+
+	// A later save with a lower status does not undo delivery.
+	err = store.SaveChatMessage("msg-1", 1, 2, []byte("hello"), 0, nil)
+	assert.NoError(t, err, "should save duplicate message without error")
+	history, err = store.GetChatHistory(1, 2)
+	assert.NoError(t, err, "should load chat history without error")
+	assert.Equal(t, 1, history[0].Delivered, "delivered status should not go backwards")
+
+	exists, err := store.HasChatMessage("msg-1")
+	assert.NoError(t, err)
+	assert.True(t, exists, "saved message should exist")
+
+	exists, err = store.HasChatMessage("msg-2")
+	assert.NoError(t, err)
+	assert.False(t, exists, "unsaved message should not exist")
+
+	message, err := store.GetChatMessage("msg-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", message.Message)
+	assert.Equal(t, uint32(1), message.SenderID)
+
+	message, err = store.GetChatMessage("msg-2")
+	assert.NoError(t, err)
+	assert.Nil(t, message, "unsaved message should not be found")
+}
+
+func TestExportImportChatHistory(t *testing.T) {
+	source := createTestSQLiteStore(t)
+	assert.NoError(t, source.SaveChatMessage("msg-1", 1, 2, []byte("hello"), 1, nil))
+	assert.NoError(t, source.SaveChatMessage("msg-2", 2, 1, []byte("hi"), 1, nil))
+
+	exported, err := source.ExportChatHistory()
+	assert.NoError(t, err, "should export chat history without error")
+	assert.Len(t, exported, 2)
+
+	target := createTestSQLiteStore(t)
+	assert.NoError(t, target.SaveChatMessage("msg-2", 2, 1, []byte("hi"), 1, nil))
+
+	imported, err := target.ImportChatHistory(exported)
+	assert.NoError(t, err, "should import chat history without error")
+	assert.Equal(t, 1, imported, "messages already present should be skipped")
+
+	history, err := target.GetChatHistory(1, 2)
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+}
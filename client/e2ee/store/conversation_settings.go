@@ -0,0 +1,113 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SetConversationMuted mutes or unmutes the conversation with a user on this device.
+func (s *SQLiteStore) SetConversationMuted(peerID uint32, muted bool) error {
+	query := `
+		INSERT INTO conversation_settings (peer_id, muted)
+		VALUES (?, ?)
+		ON CONFLICT(peer_id) DO UPDATE SET muted = excluded.muted;`
+	if _, err := s.DB.Exec(query, peerID, muted); err != nil {
+		return fmt.Errorf("failed to set muted for conversation with user %d: %v", peerID, err)
+	}
+	return nil
+}
+
+// MutedConversations returns the IDs of the users whose conversations are muted.
+func (s *SQLiteStore) MutedConversations() (map[uint32]bool, error) {
+	rows, err := s.DB.Query(`SELECT peer_id FROM conversation_settings WHERE muted = 1;`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query muted conversations: %v", err)
+	}
+	defer rows.Close()
+
+	muted := make(map[uint32]bool)
+	for rows.Next() {
+		var peerID uint32
+		if err := rows.Scan(&peerID); err != nil {
+			return nil, fmt.Errorf("failed to scan muted conversation: %v", err)
+		}
+		muted[peerID] = true
+	}
+	return muted, rows.Err()
+}
+
+// ConversationSettings are the preferences for a conversation kept on this device.
+type ConversationSettings struct {
+	Muted    bool
+	Pinned   bool   // Shown at the top of the friend list
+	Nickname string // Shown instead of the other user's name; empty for none
+}
+
+// SetConversationPinned pins or unpins the conversation with a user to the top of the friend list.
+func (s *SQLiteStore) SetConversationPinned(peerID uint32, pinned bool) error {
+	query := `
+		INSERT INTO conversation_settings (peer_id, pinned)
+		VALUES (?, ?)
+		ON CONFLICT(peer_id) DO UPDATE SET pinned = excluded.pinned;`
+	if _, err := s.DB.Exec(query, peerID, pinned); err != nil {
+		return fmt.Errorf("failed to set pinned for conversation with user %d: %v", peerID, err)
+	}
+	return nil
+}
+
+// SetConversationNickname sets the name this device shows for a user. An empty nickname removes it.
+func (s *SQLiteStore) SetConversationNickname(peerID uint32, nickname string) error {
+	query := `
+		INSERT INTO conversation_settings (peer_id, nickname)
+		VALUES (?, ?)
+		ON CONFLICT(peer_id) DO UPDATE SET nickname = excluded.nickname;`
+	if _, err := s.DB.Exec(query, peerID, nickname); err != nil {
+		return fmt.Errorf("failed to set nickname for user %d: %v", peerID, err)
+	}
+	return nil
+}
+
+// AllConversationSettings returns the settings of every conversation that has any, by the other user's ID.
+func (s *SQLiteStore) AllConversationSettings() (map[uint32]ConversationSettings, error) {
+	rows, err := s.DB.Query(`SELECT peer_id, muted, pinned, nickname FROM conversation_settings;`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conversation settings: %v", err)
+	}
+	defer rows.Close()
+
+	settings := make(map[uint32]ConversationSettings)
+	for rows.Next() {
+		var peerID uint32
+		var setting ConversationSettings
+		if err := rows.Scan(&peerID, &setting.Muted, &setting.Pinned, &setting.Nickname); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation settings: %v", err)
+		}
+		settings[peerID] = setting
+	}
+	return settings, rows.Err()
+}
+
+// Preference returns a preference of this device, or def if it has not been set.
+func (s *SQLiteStore) Preference(name, def string) (string, error) {
+	var value string
+	err := s.DB.QueryRow(`SELECT value FROM preferences WHERE name = ?;`, name).Scan(&value)
+	if err == sql.ErrNoRows {
+		return def, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query preference %s: %v", name, err)
+	}
+	return value, nil
+}
+
+// SetPreference stores a preference of this device.
+func (s *SQLiteStore) SetPreference(name, value string) error {
+	query := `
+		INSERT INTO preferences (name, value)
+		VALUES (?, ?)
+		ON CONFLICT(name) DO UPDATE SET value = excluded.value;`
+	if _, err := s.DB.Exec(query, name, value); err != nil {
+		return fmt.Errorf("failed to set preference %s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMutedConversations(t *testing.T) {
+	store := createTestSQLiteStore(t)
+
+	muted, err := store.MutedConversations()
+	assert.NoError(t, err)
+	assert.Empty(t, muted, "no conversation should start muted")
+
+	assert.NoError(t, store.SetConversationMuted(2, true))
+	assert.NoError(t, store.SetConversationMuted(3, true))
+	assert.NoError(t, store.SetConversationMuted(3, false))
+
+	muted, err = store.MutedConversations()
+	assert.NoError(t, err)
+	assert.Equal(t, map[uint32]bool{2: true}, muted, "only the conversation still muted should be returned")
+}
+
+func TestConversationNicknamesAndPins(t *testing.T) {
+	store := createTestSQLiteStore(t)
+
+	assert.NoError(t, store.SetConversationMuted(2, true))
+	assert.NoError(t, store.SetConversationNickname(2, "Mum"))
+	assert.NoError(t, store.SetConversationPinned(3, true))
+	assert.NoError(t, store.SetConversationPinned(4, true))
+	assert.NoError(t, store.SetConversationPinned(4, false))
+
+	settings, err := store.AllConversationSettings()
+	assert.NoError(t, err)
+	assert.Equal(t, map[uint32]ConversationSettings{
+		2: {Muted: true, Nickname: "Mum"},
+		3: {Pinned: true},
+		4: {},
+	}, settings, "setting one thing should leave the others as they were")
+
+	assert.NoError(t, store.SetConversationNickname(2, ""))
+	settings, err = store.AllConversationSettings()
+	assert.NoError(t, err)
+	assert.Equal(t, ConversationSettings{Muted: true}, settings[2])
+}
+
+func TestPreferences(t *testing.T) {
+	store := createTestSQLiteStore(t)
+
+	value, err := store.Preference("friend_sort", "recent")
+	assert.NoError(t, err)
+	assert.Equal(t, "recent", value, "an unset preference should have its default")
+
+	assert.NoError(t, store.SetPreference("friend_sort", "alphabetical"))
+	assert.NoError(t, store.SetPreference("friend_sort", "online"))
+	value, err = store.Preference("friend_sort", "recent")
+	assert.NoError(t, err)
+	assert.Equal(t, "online", value)
+}
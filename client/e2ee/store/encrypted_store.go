@@ -0,0 +1,200 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// flushInterval is how often pending changes of an encrypted store are written to disk.
+const flushInterval = time.Second
+
+// NewEncryptedSQLiteStore opens the database held in vault. The database lives in memory while
+// the client runs; changes are encrypted and written back to the vault shortly after they are
+// made and again on Close, so the plaintext never touches the disk.
+func NewEncryptedSQLiteStore(vault *Vault) (*SQLiteStore, error) {
+	image, err := vault.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	// Every connection to ":memory:" is its own database, so keep exactly one open for good.
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+
+	s := &SQLiteStore{
+		DB:        db,
+		vault:     vault,
+		stopFlush: make(chan struct{}),
+		flushDone: make(chan struct{}),
+	}
+
+	err = s.withConn(func(conn *sqlite3.SQLiteConn) error {
+		if len(image) > 0 {
+			if err := restoreImage(conn, image); err != nil {
+				return err
+			}
+		}
+		conn.RegisterUpdateHook(func(int, string, string, int64) {
+			s.dirty.Store(true)
+		})
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to load encrypted store: %v", err)
+	}
+
+	if err := Migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %v", err)
+	}
+	// Schema changes do not fire the update hook, so persist the schema explicitly.
+	s.dirty.Store(true)
+	if err := s.Flush(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s.sessionStore = NewSessionStore(db)
+	s.preKeyStore = NewPreKeyStore(db)
+	s.signedPreKeyStore = NewSignedPreKeyStore(db)
+	s.identityStore = NewIdentityStore(db)
+	s.groupStore = NewGroupStore() // Group store is not yet supported
+
+	go s.flushLoop()
+	return s, nil
+}
+
+// EncryptPlaintextStore copies the unencrypted database at plainPath into vault and removes the
+// plaintext file. It is used once to migrate stores created before encryption at rest.
+func EncryptPlaintextStore(plainPath string, vault *Vault) error {
+	driverConn, err := (&sqlite3.SQLiteDriver{}).Open(plainPath)
+	if err != nil {
+		return fmt.Errorf("failed to open plaintext store: %v", err)
+	}
+	conn := driverConn.(*sqlite3.SQLiteConn)
+
+	image, err := conn.Serialize("main")
+	conn.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read plaintext store: %v", err)
+	}
+
+	if err := vault.Write(image); err != nil {
+		return err
+	}
+
+	for _, path := range []string{plainPath, plainPath + "-journal", plainPath + "-wal", plainPath + "-shm"} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove plaintext store: %v", err)
+		}
+	}
+	return nil
+}
+
+// Flush writes pending changes of an encrypted store to disk. It does nothing for a plaintext store.
+func (s *SQLiteStore) Flush() error {
+	if s.vault == nil || !s.dirty.Swap(false) {
+		return nil
+	}
+
+	var image []byte
+	err := s.withConn(func(conn *sqlite3.SQLiteConn) error {
+		var err error
+		image, err = conn.Serialize("main")
+		return err
+	})
+	if err == nil {
+		err = s.vault.Write(image)
+	}
+	if err != nil {
+		// Keep the changes pending so the next flush retries them.
+		s.dirty.Store(true)
+		return fmt.Errorf("failed to flush encrypted store: %v", err)
+	}
+	return nil
+}
+
+// Close flushes any pending changes and closes the database.
+func (s *SQLiteStore) Close() error {
+	if s.vault != nil {
+		close(s.stopFlush)
+		<-s.flushDone
+		if err := s.Flush(); err != nil {
+			s.DB.Close()
+			return err
+		}
+	}
+	return s.DB.Close()
+}
+
+func (s *SQLiteStore) flushLoop() {
+	defer close(s.flushDone)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// A failed flush stays dirty and is retried on the next tick or on Close.
+			s.Flush()
+		case <-s.stopFlush:
+			return
+		}
+	}
+}
+
+// withConn runs fn on the single underlying SQLite connection of an encrypted store.
+func (s *SQLiteStore) withConn(fn func(conn *sqlite3.SQLiteConn) error) error {
+	conn, err := s.DB.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection %T", driverConn)
+		}
+		return fn(sqliteConn)
+	})
+}
+
+// restoreImage loads a serialized database into conn. SQLite cannot grow a deserialized
+// database in place, so the image is opened on a scratch connection and copied over with the
+// backup API instead.
+func restoreImage(conn *sqlite3.SQLiteConn, image []byte) error {
+	driverConn, err := (&sqlite3.SQLiteDriver{}).Open(":memory:")
+	if err != nil {
+		return err
+	}
+	scratch := driverConn.(*sqlite3.SQLiteConn)
+	defer scratch.Close()
+
+	if err := scratch.Deserialize(image, "main"); err != nil {
+		return err
+	}
+
+	backup, err := conn.Backup("main", scratch, "main")
+	if err != nil {
+		return err
+	}
+	if _, err := backup.Step(-1); err != nil {
+		backup.Finish()
+		return err
+	}
+	return backup.Finish()
+}
@@ -0,0 +1,207 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migration upgrades the schema by one version. It runs inside the transaction that records the new version.
+type migration func(tx *sql.Tx) error
+
+// migrations upgrade the store one version at a time: migrations[i] takes a database from version i to i+1.
+// The version is kept in SQLite's user_version, which is 0 for new databases and for those created
+// before versioning. Append new migrations to the end and never change one that has been released.
+var migrations = []migration{
+	createTables,
+	addChatHistoryConversationIndex,
+	createConversationSettings,
+	createProfileKeys,
+	addConversationNicknamesAndPins,
+}
+
+// SchemaVersion is the schema version Migrate brings a database to.
+func SchemaVersion() int {
+	return len(migrations)
+}
+
+// Migrate creates the store's tables in a new database and upgrades one written by an older client.
+// Each migration runs in its own transaction, so a failed upgrade leaves the database at the last good version.
+func Migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %v", err)
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than this client supports (%d), please update the client", version, len(migrations))
+	}
+
+	for ; version < len(migrations); version++ {
+		if err := runMigration(db, version+1, migrations[version]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runMigration(db *sql.DB, version int, migrate migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := migrate(tx); err != nil {
+		return fmt.Errorf("failed to migrate to schema version %d: %v", version, err)
+	}
+	// PRAGMA does not take query parameters; version is always an integer.
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+		return fmt.Errorf("failed to set schema version %d: %v", version, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// createTables creates the tables of the Signal Protocol stores and the chat history.
+// Databases from before versioning already have them, so every table is created only if missing.
+func createTables(tx *sql.Tx) error {
+	// Create session table
+	sessionTable := `
+	CREATE TABLE IF NOT EXISTS sessions (
+    address TEXT NOT NULL,
+    device_id INTEGER NOT NULL,
+    record BLOB NOT NULL,
+    PRIMARY KEY (address, device_id)
+	);
+	`
+
+	// Create pre-key table
+	preKeyTable := `
+	CREATE TABLE IF NOT EXISTS prekeys (
+		id INTEGER PRIMARY KEY,
+		record BLOB NOT NULL
+	);`
+
+	// Create signed pre-key table
+	signedPreKeyTable := `
+	CREATE TABLE IF NOT EXISTS signed_prekeys (
+		id INTEGER PRIMARY KEY,
+		record BLOB NOT NULL
+	);`
+
+	// Create identity table
+	identityTable := `
+	CREATE TABLE IF NOT EXISTS identities (
+		address TEXT PRIMARY KEY,
+		key_data BLOB NOT NULL,
+		trust_level INTEGER NOT NULL
+	);`
+
+	localIdentityTable := `
+	CREATE TABLE IF NOT EXISTS local_identity (
+		key_pair BLOB NOT NULL,
+		registration_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		device_id INTEGER NOT NULL
+	);
+	`
+
+	chatHistoryTable := `
+	CREATE TABLE IF NOT EXISTS chat_history (
+		messageId TEXT PRIMARY KEY,  -- UUID as the primary key
+		sender_id INTEGER NOT NULL,
+		receiver_id INTEGER NOT NULL,
+		message TEXT NOT NULL,
+		media BLOB,                         -- Binary data for media (if stored in DB)
+		file_type TEXT,
+		file_size INTEGER,
+		file_name TEXT,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,  -- Timestamp of when the message was sent/received
+		delivered INTEGER DEFAULT 0  -- 0: Not delivered, 1: Delivered
+	);
+	`
+
+	if _, err := tx.Exec(sessionTable); err != nil {
+		return fmt.Errorf("failed to create sessions table: %v", err)
+	}
+	if _, err := tx.Exec(preKeyTable); err != nil {
+		return fmt.Errorf("failed to create prekeys table: %v", err)
+	}
+	if _, err := tx.Exec(signedPreKeyTable); err != nil {
+		return fmt.Errorf("failed to create signed_prekeys table: %v", err)
+	}
+	if _, err := tx.Exec(identityTable); err != nil {
+		return fmt.Errorf("failed to create identities table: %v", err)
+	}
+	if _, err := tx.Exec(localIdentityTable); err != nil {
+		return fmt.Errorf("failed to create local identity table: %v", err)
+	}
+	if _, err := tx.Exec(chatHistoryTable); err != nil {
+		return fmt.Errorf("failed to create chat history table: %v", err)
+	}
+	return nil
+}
+
+// addChatHistoryConversationIndex speeds up loading a conversation, which filters on both participants.
+func addChatHistoryConversationIndex(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE INDEX IF NOT EXISTS chat_history_conversation ON chat_history (sender_id, receiver_id, timestamp);`)
+	if err != nil {
+		return fmt.Errorf("failed to create chat history index: %v", err)
+	}
+	return nil
+}
+
+// createConversationSettings adds the table of per-conversation preferences that stay on this device, such as muting.
+func createConversationSettings(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS conversation_settings (
+		peer_id INTEGER PRIMARY KEY,      -- User ID of the other participant
+		muted INTEGER NOT NULL DEFAULT 0  -- 1: No unread marker for new messages
+	);`)
+	if err != nil {
+		return fmt.Errorf("failed to create conversation settings table: %v", err)
+	}
+	return nil
+}
+
+// createProfileKeys adds the tables of profile keys: this user's own and the ones friends sent, which decrypt
+// their profiles, and the friends this user's current key has been sent to.
+func createProfileKeys(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS profile_keys (
+		user_id INTEGER PRIMARY KEY,  -- Owner of the profile the key decrypts
+		profile_key BLOB NOT NULL
+	);`)
+	if err != nil {
+		return fmt.Errorf("failed to create profile keys table: %v", err)
+	}
+	_, err = tx.Exec(`
+	CREATE TABLE IF NOT EXISTS profile_key_shares (
+		peer_id INTEGER PRIMARY KEY  -- Friend who has been sent this user's current profile key
+	);`)
+	if err != nil {
+		return fmt.Errorf("failed to create profile key shares table: %v", err)
+	}
+	return nil
+}
+
+// addConversationNicknamesAndPins lets conversations carry a nickname for the other user and be pinned to the
+// top of the friend list, and adds a table for this device's other preferences, such as how to sort friends.
+func addConversationNicknamesAndPins(tx *sql.Tx) error {
+	if _, err := tx.Exec(`ALTER TABLE conversation_settings ADD COLUMN nickname TEXT NOT NULL DEFAULT '';`); err != nil {
+		return fmt.Errorf("failed to add nickname column: %v", err)
+	}
+	if _, err := tx.Exec(`ALTER TABLE conversation_settings ADD COLUMN pinned INTEGER NOT NULL DEFAULT 0;`); err != nil {
+		return fmt.Errorf("failed to add pinned column: %v", err)
+	}
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS preferences (
+		name TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);`)
+	if err != nil {
+		return fmt.Errorf("failed to create preferences table: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// openFixture loads a SQL fixture describing a store written by an older client into a new database.
+func openFixture(t *testing.T, fixture string) *sql.DB {
+	script, err := os.ReadFile(filepath.Join("testdata", fixture))
+	assert.NoError(t, err, "should read fixture")
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "store.db"))
+	assert.NoError(t, err, "should open database")
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(string(script))
+	assert.NoError(t, err, "should load fixture")
+	return db
+}
+
+func schemaVersion(t *testing.T, db *sql.DB) int {
+	var version int
+	assert.NoError(t, db.QueryRow("PRAGMA user_version").Scan(&version))
+	return version
+}
+
+func TestMigrateUpgradesOldDatabases(t *testing.T) {
+	for _, fixture := range []string{"v0_unversioned.sql", "v1.sql", "v2.sql", "v3.sql", "v4.sql"} {
+		t.Run(fixture, func(t *testing.T) {
+			db := openFixture(t, fixture)
+
+			assert.NoError(t, Migrate(db), "should upgrade the old database")
+			assert.Equal(t, SchemaVersion(), schemaVersion(t, db))
+
+			var indexes int
+			assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'chat_history_conversation'`).Scan(&indexes))
+			assert.Equal(t, 1, indexes, "the conversation index should have been added")
+
+			store := &SQLiteStore{DB: db}
+			assert.NoError(t, store.SetConversationMuted(2, true), "the conversation settings table should have been added")
+			assert.NoError(t, store.SaveProfileKey(2, []byte("key")), "the profile keys table should have been added")
+			assert.NoError(t, store.SetConversationPinned(2, true), "conversations should be able to be pinned")
+			assert.NoError(t, store.SetPreference("friend_sort", "online"), "the preferences table should have been added")
+
+			// Existing messages survive the upgrade.
+			history, err := store.GetChatHistory(1, 2)
+			assert.NoError(t, err)
+			if assert.Len(t, history, 2) {
+				assert.Equal(t, "hello from an old client", history[0].Message)
+				assert.Equal(t, "hi back", history[1].Message)
+			}
+
+			assert.NoError(t, Migrate(db), "migrating an up to date database should do nothing")
+			assert.Equal(t, SchemaVersion(), schemaVersion(t, db))
+		})
+	}
+}
+
+func TestMigrateRejectsNewerSchema(t *testing.T) {
+	db := openFixture(t, "v1.sql")
+	_, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion()+1))
+	assert.NoError(t, err)
+
+	assert.Error(t, Migrate(db), "a database from a newer client should not be touched")
+	assert.Equal(t, SchemaVersion()+1, schemaVersion(t, db))
+}
+
+func TestMigrateRollsBackFailedMigration(t *testing.T) {
+	original := migrations
+	defer func() { migrations = original }()
+	migrations = append(append([]migration{}, original...), func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`CREATE TABLE reactions (message_id TEXT NOT NULL)`); err != nil {
+			return err
+		}
+		return fmt.Errorf("simulated failure")
+	})
+
+	db := openFixture(t, "v0_unversioned.sql")
+	assert.Error(t, Migrate(db))
+	assert.Equal(t, len(original), schemaVersion(t, db), "the migrations before the failing one should be kept")
+
+	var tables int
+	assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'reactions'`).Scan(&tables))
+	assert.Equal(t, 0, tables, "the failed migration's changes should be rolled back")
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SaveProfileKey stores the key that decrypts a user's profile, replacing any older one.
+func (s *SQLiteStore) SaveProfileKey(userID uint32, key []byte) error {
+	query := `
+		INSERT INTO profile_keys (user_id, profile_key)
+		VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET profile_key = excluded.profile_key;`
+	if _, err := s.DB.Exec(query, userID, key); err != nil {
+		return fmt.Errorf("failed to save profile key of user %d: %v", userID, err)
+	}
+	return nil
+}
+
+// ProfileKey returns the key that decrypts a user's profile, or nil if this device has none.
+func (s *SQLiteStore) ProfileKey(userID uint32) ([]byte, error) {
+	var key []byte
+	err := s.DB.QueryRow(`SELECT profile_key FROM profile_keys WHERE user_id = ?;`, userID).Scan(&key)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query profile key of user %d: %v", userID, err)
+	}
+	return key, nil
+}
+
+// MarkProfileKeyShared records that a friend has been sent this user's current profile key.
+func (s *SQLiteStore) MarkProfileKeyShared(peerID uint32) error {
+	if _, err := s.DB.Exec(`INSERT OR IGNORE INTO profile_key_shares (peer_id) VALUES (?);`, peerID); err != nil {
+		return fmt.Errorf("failed to mark profile key shared with user %d: %v", peerID, err)
+	}
+	return nil
+}
+
+// ProfileKeyShares returns the IDs of the friends who have been sent this user's current profile key.
+func (s *SQLiteStore) ProfileKeyShares() (map[uint32]bool, error) {
+	rows, err := s.DB.Query(`SELECT peer_id FROM profile_key_shares;`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query profile key shares: %v", err)
+	}
+	defer rows.Close()
+
+	shared := make(map[uint32]bool)
+	for rows.Next() {
+		var peerID uint32
+		if err := rows.Scan(&peerID); err != nil {
+			return nil, fmt.Errorf("failed to scan profile key share: %v", err)
+		}
+		shared[peerID] = true
+	}
+	return shared, rows.Err()
+}
+
+// ReplaceOwnProfileKey stores a new profile key for this user and forgets who had the old one,
+// so the new key is sent to every remaining friend.
+func (s *SQLiteStore) ReplaceOwnProfileKey(userID uint32, key []byte) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO profile_keys (user_id, profile_key)
+		VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET profile_key = excluded.profile_key;`
+	if _, err := tx.Exec(query, userID, key); err != nil {
+		return fmt.Errorf("failed to save profile key of user %d: %v", userID, err)
+	}
+	if _, err := tx.Exec(`DELETE FROM profile_key_shares;`); err != nil {
+		return fmt.Errorf("failed to clear profile key shares: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileKeys(t *testing.T) {
+	store := createTestSQLiteStore(t)
+
+	key, err := store.ProfileKey(2)
+	assert.NoError(t, err)
+	assert.Nil(t, key, "no profile key should be known yet")
+
+	assert.NoError(t, store.SaveProfileKey(2, []byte("old")))
+	assert.NoError(t, store.SaveProfileKey(2, []byte("new")))
+	key, err = store.ProfileKey(2)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("new"), key, "a friend's newer key should replace the old one")
+
+	assert.NoError(t, store.ReplaceOwnProfileKey(1, []byte("mine")))
+	assert.NoError(t, store.MarkProfileKeyShared(2))
+	assert.NoError(t, store.MarkProfileKeyShared(2))
+	assert.NoError(t, store.MarkProfileKeyShared(3))
+	shared, err := store.ProfileKeyShares()
+	assert.NoError(t, err)
+	assert.Equal(t, map[uint32]bool{2: true, 3: true}, shared)
+
+	// A new key of our own has been sent to nobody
+	assert.NoError(t, store.ReplaceOwnProfileKey(1, []byte("rotated")))
+	key, err = store.ProfileKey(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("rotated"), key)
+	shared, err = store.ProfileKeyShares()
+	assert.NoError(t, err)
+	assert.Empty(t, shared, "rotating the key should forget who had the old one")
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/Johnkhk/libsignal-go/protocol/curve"
@@ -28,6 +29,12 @@ type SQLiteStore struct {
 	signedPreKeyStore prekey.SignedStore
 	identityStore     identity.Store
 	groupStore        session.GroupStore
+
+	// Set for stores opened with NewEncryptedSQLiteStore.
+	vault     *Vault
+	dirty     atomic.Bool
+	stopFlush chan struct{}
+	flushDone chan struct{}
 }
 
 func (s *SQLiteStore) SessionStore() session.Store {
@@ -53,10 +60,10 @@ func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
 		return nil, fmt.Errorf("failed to open database: %v", err)
 	}
 
-	// Create tables if they do not exist
-	err = CreateTables(db)
+	// Create the tables, or upgrade those of an older client
+	err = Migrate(db)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create tables: %v", err)
+		return nil, fmt.Errorf("failed to migrate database: %v", err)
 	}
 
 	// Initialize store components
@@ -70,111 +77,6 @@ func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
 	}, nil
 }
 
-// CreateTables ensures that the necessary tables for the Signal Protocol stores exist.
-func CreateTables(db *sql.DB) error {
-	// Create session table
-	sessionTable := `
-	CREATE TABLE IF NOT EXISTS sessions (
-    address TEXT NOT NULL,
-    device_id INTEGER NOT NULL,
-    record BLOB NOT NULL,
-    PRIMARY KEY (address, device_id)
-	);
-	`
-
-	// Create pre-key table
-	preKeyTable := `
-	CREATE TABLE IF NOT EXISTS prekeys (
-		id INTEGER PRIMARY KEY,
-		record BLOB NOT NULL
-	);`
-
-	// Create signed pre-key table
-	signedPreKeyTable := `
-	CREATE TABLE IF NOT EXISTS signed_prekeys (
-		id INTEGER PRIMARY KEY,
-		record BLOB NOT NULL
-	);`
-
-	// Create identity table
-	identityTable := `
-	CREATE TABLE IF NOT EXISTS identities (
-		address TEXT PRIMARY KEY,
-		key_data BLOB NOT NULL,
-		trust_level INTEGER NOT NULL
-	);`
-
-	localIdentityTable := `
-	CREATE TABLE IF NOT EXISTS local_identity (
-		key_pair BLOB NOT NULL,
-		registration_id INTEGER NOT NULL,
-		user_id INTEGER NOT NULL,
-		device_id INTEGER NOT NULL
-	);
-	`
-
-	chatHistoryTable := `
-	CREATE TABLE IF NOT EXISTS chat_history (
-		messageId TEXT PRIMARY KEY,  -- UUID as the primary key
-		sender_id INTEGER NOT NULL,
-		receiver_id INTEGER NOT NULL,
-		message TEXT NOT NULL,
-		media BLOB,                         -- Binary data for media (if stored in DB)
-		file_type TEXT,
-		file_size INTEGER,
-		file_name TEXT,
-		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,  -- Timestamp of when the message was sent/received
-		delivered INTEGER DEFAULT 0  -- 0: Not delivered, 1: Delivered
-	);
-	`
-
-	// Create table queries in a transaction
-	tx, err := db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
-	}
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
-
-	// Execute table creation queries
-	_, err = tx.Exec(sessionTable)
-	if err != nil {
-		return fmt.Errorf("failed to create sessions table: %v", err)
-	}
-	_, err = tx.Exec(preKeyTable)
-	if err != nil {
-		return fmt.Errorf("failed to create prekeys table: %v", err)
-	}
-	_, err = tx.Exec(signedPreKeyTable)
-	if err != nil {
-		return fmt.Errorf("failed to create signed_prekeys table: %v", err)
-	}
-	_, err = tx.Exec(identityTable)
-	if err != nil {
-		return fmt.Errorf("failed to create identities table: %v", err)
-	}
-
-	_, err = tx.Exec(localIdentityTable)
-	if err != nil {
-		return fmt.Errorf("failed to create local identity table table: %v", err)
-	}
-
-	_, err = tx.Exec(chatHistoryTable)
-	if err != nil {
-		return fmt.Errorf("failed to create chat history table: %v", err)
-	}
-
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("failed to commit transaction: %v", err)
-	}
-
-	return nil
-}
-
 type LocalIdentity struct {
 	IdentityPublicKey     []byte
 	PreKeyID              uint32
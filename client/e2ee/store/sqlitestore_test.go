@@ -21,7 +21,7 @@ func createTestSQLiteStore(t *testing.T) *SQLiteStore {
 	db, err := sql.Open("sqlite3", ":memory:")
 	assert.NoError(t, err, "should create in-memory SQLite DB without error")
 
-	err = CreateTables(db)
+	err = Migrate(db)
 	assert.NoError(t, err, "should create tables without error")
 
 	store := &SQLiteStore{
@@ -0,0 +1,51 @@
+-- A store at schema version 4, before conversation nicknames and pins.
+CREATE TABLE sessions (
+    address TEXT NOT NULL,
+    device_id INTEGER NOT NULL,
+    record BLOB NOT NULL,
+    PRIMARY KEY (address, device_id)
+);
+CREATE TABLE prekeys (id INTEGER PRIMARY KEY, record BLOB NOT NULL);
+CREATE TABLE signed_prekeys (id INTEGER PRIMARY KEY, record BLOB NOT NULL);
+CREATE TABLE identities (address TEXT PRIMARY KEY, key_data BLOB NOT NULL, trust_level INTEGER NOT NULL);
+CREATE TABLE local_identity (
+    key_pair BLOB NOT NULL,
+    registration_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    device_id INTEGER NOT NULL
+);
+CREATE TABLE chat_history (
+    messageId TEXT PRIMARY KEY,
+    sender_id INTEGER NOT NULL,
+    receiver_id INTEGER NOT NULL,
+    message TEXT NOT NULL,
+    media BLOB,
+    file_type TEXT,
+    file_size INTEGER,
+    file_name TEXT,
+    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+    delivered INTEGER DEFAULT 0
+);
+CREATE INDEX chat_history_conversation ON chat_history (sender_id, receiver_id, timestamp);
+CREATE TABLE conversation_settings (
+    peer_id INTEGER PRIMARY KEY,
+    muted INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE profile_keys (
+    user_id INTEGER PRIMARY KEY,
+    profile_key BLOB NOT NULL
+);
+
+CREATE TABLE profile_key_shares (
+    peer_id INTEGER PRIMARY KEY
+);
+
+PRAGMA user_version = 4;
+
+INSERT INTO identities (address, key_data, trust_level) VALUES ('2', x'0102', 1);
+INSERT INTO conversation_settings (peer_id, muted) VALUES (3, 1);
+INSERT INTO profile_keys (user_id, profile_key) VALUES (2, x'0a0b');
+INSERT INTO chat_history (messageId, sender_id, receiver_id, message, file_type, file_size, file_name, timestamp, delivered)
+    VALUES ('msg-1', 1, 2, 'hello from an old client', '', 0, '', '2024-10-01 12:00:00', 1);
+INSERT INTO chat_history (messageId, sender_id, receiver_id, message, file_type, file_size, file_name, timestamp, delivered)
+    VALUES ('msg-2', 2, 1, 'hi back', '', 0, '', '2024-10-01 12:01:00', 0);
@@ -0,0 +1,247 @@
+package store
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// The vault file holds the whole SQLite database encrypted at rest. Its layout is:
+//
+//	magic | version | argon2 time | argon2 memory | argon2 threads | salt | wrapped key | nonce | ciphertext
+//
+// A random data key encrypts the database image with AES-256-GCM. The data key itself is
+// wrapped with a key derived from the user's passphrase using Argon2id, so the passphrase can
+// always unlock the store, and the raw data key can be kept in the OS keyring for convenience.
+const (
+	vaultMagicString = "CCAPPDB"
+	vaultVersion     = 1
+	vaultKeySize     = 32
+	vaultSaltSize    = 16
+	vaultNonceSize   = 12
+	wrappedKeySize   = vaultNonceSize + vaultKeySize + 16 // nonce + key + GCM tag
+	vaultHeaderSize  = len(vaultMagicString) + 1 + 4 + 4 + 1 + vaultSaltSize + wrappedKeySize
+
+	// Argon2id parameters for new vaults, following the RFC 9106 second recommended option.
+	defaultArgon2Time    = 3
+	defaultArgon2Memory  = 64 * 1024
+	defaultArgon2Threads = 4
+)
+
+var vaultMagic = []byte(vaultMagicString)
+
+var (
+	// ErrWrongPassphrase is returned when a vault cannot be unlocked with the given passphrase or key.
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+	// ErrNotAVault is returned when a file is not an encrypted store.
+	ErrNotAVault = errors.New("not an encrypted store file")
+)
+
+// Vault reads and writes an encrypted database image on disk.
+type Vault struct {
+	Path string
+
+	header []byte
+	key    []byte
+}
+
+// CreateVault creates a new vault at path protected by passphrase. It holds an empty database
+// until the first Write.
+func CreateVault(path string, passphrase []byte) (*Vault, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase must not be empty")
+	}
+
+	key := make([]byte, vaultKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate store key: %v", err)
+	}
+	salt := make([]byte, vaultSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %v", err)
+	}
+
+	header := new(bytes.Buffer)
+	header.Write(vaultMagic)
+	header.WriteByte(vaultVersion)
+	binary.Write(header, binary.BigEndian, uint32(defaultArgon2Time))
+	binary.Write(header, binary.BigEndian, uint32(defaultArgon2Memory))
+	header.WriteByte(defaultArgon2Threads)
+	header.Write(salt)
+
+	wrapped, err := seal(deriveVaultKey(passphrase, salt, defaultArgon2Time, defaultArgon2Memory, defaultArgon2Threads), key, vaultMagic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap store key: %v", err)
+	}
+	header.Write(wrapped)
+
+	v := &Vault{Path: path, header: header.Bytes(), key: key}
+	if err := v.Write(nil); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// OpenVaultWithPassphrase unlocks the vault at path by deriving the wrapping key from passphrase.
+func OpenVaultWithPassphrase(path string, passphrase []byte) (*Vault, error) {
+	header, err := readVaultHeader(path)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := len(vaultMagic) + 1
+	timeCost := binary.BigEndian.Uint32(header[offset:])
+	memory := binary.BigEndian.Uint32(header[offset+4:])
+	threads := header[offset+8]
+	salt := header[offset+9 : offset+9+vaultSaltSize]
+	wrapped := header[offset+9+vaultSaltSize:]
+
+	key, err := open(deriveVaultKey(passphrase, salt, timeCost, memory, threads), wrapped, vaultMagic)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return &Vault{Path: path, header: header, key: key}, nil
+}
+
+// OpenVaultWithKey unlocks the vault at path with a data key previously returned by Key,
+// for example one kept in the OS keyring.
+func OpenVaultWithKey(path string, key []byte) (*Vault, error) {
+	header, err := readVaultHeader(path)
+	if err != nil {
+		return nil, err
+	}
+	v := &Vault{Path: path, header: header, key: key}
+
+	// The database image is authenticated with the data key, so reading it checks the key.
+	if _, err := v.Read(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// VaultExists reports whether an encrypted store exists at path.
+func VaultExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Key returns the data key of the vault.
+func (v *Vault) Key() []byte {
+	return v.key
+}
+
+// Read decrypts and returns the database image.
+func (v *Vault) Read() ([]byte, error) {
+	data, err := os.ReadFile(v.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encrypted store: %v", err)
+	}
+	if len(data) < vaultHeaderSize || !bytes.Equal(data[:vaultHeaderSize], v.header) {
+		return nil, ErrNotAVault
+	}
+
+	image, err := open(v.key, data[vaultHeaderSize:], v.header)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return image, nil
+}
+
+// Write encrypts image and atomically replaces the vault file with it.
+func (v *Vault) Write(image []byte) error {
+	body, err := seal(v.key, image, v.header)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt store: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(v.Path), filepath.Base(v.Path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary store file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(append([]byte{}, v.header...), body...)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write encrypted store: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync encrypted store: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close encrypted store: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return fmt.Errorf("failed to set encrypted store permissions: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), v.Path); err != nil {
+		return fmt.Errorf("failed to replace encrypted store: %v", err)
+	}
+	return nil
+}
+
+func readVaultHeader(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open encrypted store: %v", err)
+	}
+	defer f.Close()
+
+	header := make([]byte, vaultHeaderSize)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return nil, ErrNotAVault
+	}
+	if !bytes.Equal(header[:len(vaultMagic)], vaultMagic) {
+		return nil, ErrNotAVault
+	}
+	if header[len(vaultMagic)] != vaultVersion {
+		return nil, fmt.Errorf("unsupported encrypted store version %d", header[len(vaultMagic)])
+	}
+	return header, nil
+}
+
+func deriveVaultKey(passphrase, salt []byte, time, memory uint32, threads uint8) []byte {
+	return argon2.IDKey(passphrase, salt, time, memory, threads, vaultKeySize)
+}
+
+// seal encrypts plaintext with AES-256-GCM and returns nonce || ciphertext.
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, vaultNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open reverses seal.
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < vaultNonceSize {
+		return nil, ErrNotAVault
+	}
+	return gcm.Open(nil, sealed[:vaultNonceSize], sealed[vaultNonceSize:], additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johnkhk/cli_chat_app/client/lib"
+)
+
+func TestEncryptedStorePersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.db.enc")
+
+	vault, err := CreateVault(path, []byte("correct horse"))
+	assert.NoError(t, err, "should create vault without error")
+
+	s, err := NewEncryptedSQLiteStore(vault)
+	assert.NoError(t, err, "should open encrypted store without error")
+	assert.NoError(t, s.SaveChatMessage("msg-1", 1, 2, []byte("top secret"), 1, nil))
+	assert.NoError(t, s.Close(), "should close encrypted store without error")
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.False(t, bytes.Contains(data, []byte("top secret")), "store file should not contain plaintext")
+	assert.False(t, bytes.Contains(data, []byte("SQLite format")), "store file should not be a plain SQLite database")
+
+	// Unlock with the passphrase.
+	vault, err = OpenVaultWithPassphrase(path, []byte("correct horse"))
+	assert.NoError(t, err, "should unlock vault with passphrase")
+	s, err = NewEncryptedSQLiteStore(vault)
+	assert.NoError(t, err)
+	history, err := s.GetChatHistory(1, 2)
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+	assert.Equal(t, "top secret", history[0].Message)
+	assert.NoError(t, s.Close())
+
+	// Unlock with the data key, as the keyring does.
+	vault, err = OpenVaultWithKey(path, vault.Key())
+	assert.NoError(t, err, "should unlock vault with its data key")
+	s, err = NewEncryptedSQLiteStore(vault)
+	assert.NoError(t, err)
+	exists, err := s.HasChatMessage("msg-1")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.NoError(t, s.Close())
+}
+
+func TestEncryptedStoreGrowsPastLoadedImage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.db.enc")
+	vault, err := CreateVault(path, []byte("passphrase"))
+	assert.NoError(t, err)
+
+	s, err := NewEncryptedSQLiteStore(vault)
+	assert.NoError(t, err)
+	assert.NoError(t, s.SaveChatMessage("msg-0", 1, 2, []byte("first"), 1, nil))
+	assert.NoError(t, s.Close())
+
+	// A store loaded from disk must keep accepting writes well beyond its original size.
+	s, err = NewEncryptedSQLiteStore(vault)
+	assert.NoError(t, err)
+	media := bytes.Repeat([]byte{0xab}, 64*1024)
+	for i := 1; i <= 16; i++ {
+		err := s.SaveChatMessage(fmt.Sprintf("msg-%d", i), 1, 2, media, 1, &lib.SendMessageOptions{FileType: "image/png", FileName: "a.png", FileSize: uint64(len(media))})
+		assert.NoError(t, err, "should save message %d without error", i)
+	}
+	assert.NoError(t, s.Close())
+
+	s, err = NewEncryptedSQLiteStore(vault)
+	assert.NoError(t, err)
+	history, err := s.GetChatHistory(1, 2)
+	assert.NoError(t, err)
+	assert.Len(t, history, 17)
+	assert.NoError(t, s.Close())
+}
+
+func TestVaultRejectsWrongPassphraseAndKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.db.enc")
+	_, err := CreateVault(path, []byte("right"))
+	assert.NoError(t, err)
+
+	_, err = OpenVaultWithPassphrase(path, []byte("wrong"))
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+
+	_, err = OpenVaultWithKey(path, bytes.Repeat([]byte{1}, vaultKeySize))
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+
+	_, err = CreateVault(filepath.Join(t.TempDir(), "other.enc"), nil)
+	assert.Error(t, err, "an empty passphrase should be rejected")
+}
+
+func TestEncryptPlaintextStore(t *testing.T) {
+	dir := t.TempDir()
+	plainPath := filepath.Join(dir, "store.db")
+
+	plain, err := NewSQLiteStore(plainPath)
+	assert.NoError(t, err)
+	assert.NoError(t, plain.SaveChatMessage("msg-1", 1, 2, []byte("old message"), 1, nil))
+	assert.NoError(t, plain.Close())
+
+	vault, err := CreateVault(filepath.Join(dir, "store.db.enc"), []byte("passphrase"))
+	assert.NoError(t, err)
+	assert.NoError(t, EncryptPlaintextStore(plainPath, vault), "should migrate plaintext store without error")
+
+	_, err = os.Stat(plainPath)
+	assert.True(t, os.IsNotExist(err), "plaintext store should be removed after migration")
+
+	s, err := NewEncryptedSQLiteStore(vault)
+	assert.NoError(t, err)
+	history, err := s.GetChatHistory(1, 2)
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+	assert.Equal(t, "old message", history[0].Message)
+	assert.NoError(t, s.Close())
+}
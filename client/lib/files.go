@@ -0,0 +1,18 @@
+package lib
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// FileTypeFromName guesses the message file type ("image", "video" or "file") from a file name's extension.
+func FileTypeFromName(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".bmp", ".tiff", ".ico", ".webp":
+		return "image"
+	case ".mp4", ".avi", ".mov", ".mkv", ".flv", ".wmv":
+		return "video"
+	default:
+		return "file"
+	}
+}
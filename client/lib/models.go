@@ -5,3 +5,7 @@ type SendMessageOptions struct {
 	FileSize uint64
 	FileName string
 }
+
+// ProfileKeyFileType marks a message that carries the sender's profile key rather than chat content.
+// Receivers keep the key to decrypt the sender's profile; it is never shown or saved as a message.
+const ProfileKeyFileType = "profile_key"
@@ -5,11 +5,10 @@ import (
 	"path/filepath"
 
 	"github.com/sirupsen/logrus"
-
-	"github.com/johnkhk/cli_chat_app/client/app"
 )
 
-func InitLogger() *logrus.Logger {
+// InitLogger creates the client logger, writing to debug.log in the app directory.
+func InitLogger(appDirPath string, level logrus.Level) *logrus.Logger {
 	log := logrus.New()
 
 	// Set log format
@@ -17,13 +16,7 @@ func InitLogger() *logrus.Logger {
 		FullTimestamp: true,
 	})
 
-	// Optionally set log level
-	log.SetLevel(logrus.InfoLevel) // Set to desired level, e.g., Info, Warn, Error
-
-	appDirPath, err := app.GetAppDirPath()
-	if err != nil {
-		log.Fatalf("Failed to get app directory path: %v", err)
-	}
+	log.SetLevel(level)
 
 	// Open the log file for writing
 	logFilePath := filepath.Join(appDirPath, "debug.log")
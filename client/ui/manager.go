@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"context"
 	"fmt"
 	"os"
 
@@ -8,31 +9,71 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/johnkhk/cli_chat_app/client/app"
+	"github.com/johnkhk/cli_chat_app/client/e2ee/store"
 	"github.com/johnkhk/cli_chat_app/client/ui/pages"
 )
 
-// Run the appropriate Bubble Tea program based on the login status
-func RunUIBasedOnAuthStatus(isLoggedIn bool, log *logrus.Logger, rpcClient *app.RpcClient) {
+// Run the appropriate Bubble Tea program based on the login status. It returns the profile the
+// user picked to switch to, or "" when the user quit.
+func RunUIBasedOnAuthStatus(isLoggedIn bool, log *logrus.Logger, rpcClient *app.RpcClient) string {
+	var finalModel tea.Model
 	if isLoggedIn {
 		// log.Info("User automatically logged in with stored tokens.")
 		// runTeaProgram(pages.NewFriendManagementModel(rpcClient)) // Start the main menu if auto-login succeeds
-		runTeaProgram((pages.NewChatPanelModel(rpcClient)))
+		finalModel = runTeaProgram(pages.NewChatPanelModel(rpcClient), rpcClient)
 		// runTeaProgram((pages.NewChatModel(rpcClient)))
 	} else {
 		// log.Info("Automatic login failed or no valid token found.")
-		runTeaProgram(pages.NewLandingModel(rpcClient)) // Start the landing page if auto-login fails
+		finalModel = runTeaProgram(pages.NewLandingModel(rpcClient), rpcClient) // Start the landing page if auto-login fails
 		// runTeaProgram((pages.NewMainMenuModel(rpcClient)))
 	}
 	// runTeaProgram(pages.NewChatModel())
 	// runTeaProgram((pages.NewMainMenuModel(rpcClient)))
+
+	if picker, ok := finalModel.(pages.ProfilePickerModel); ok {
+		return picker.SwitchTo()
+	}
+	return ""
+}
+
+// RunUnlockPrompt asks the user for the local store passphrase. It returns nil if the user quit
+// without unlocking the store.
+func RunUnlockPrompt(unlocker *app.StoreUnlocker) *store.Vault {
+	p := tea.NewProgram(pages.NewUnlockModel(unlocker), tea.WithAltScreen())
+
+	finalModel, err := p.Run()
+	if err != nil {
+		fmt.Printf("Error starting Bubble Tea program: %v\n", err)
+		os.Exit(1)
+	}
+	return finalModel.(pages.UnlockModel).Vault()
 }
 
 // Function to run the Bubble Tea program
-func runTeaProgram(m tea.Model) {
+func runTeaProgram(m tea.Model, rpcClient *app.RpcClient) tea.Model {
 	p := tea.NewProgram(m, tea.WithAltScreen())
 
-	if err := p.Start(); err != nil {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go forwardFriendEvents(ctx, p, rpcClient)
+
+	finalModel, err := p.Run()
+	if err != nil {
 		fmt.Printf("Error starting Bubble Tea program: %v\n", err)
 		os.Exit(1)
 	}
+	return finalModel
+}
+
+// forwardFriendEvents hands friend events to the program, which passes them to the page showing,
+// until ctx is canceled. Pages come and go, so a single forwarder reads the channel.
+func forwardFriendEvents(ctx context.Context, p *tea.Program, rpcClient *app.RpcClient) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-rpcClient.FriendsClient.Events:
+			p.Send(pages.FriendEventMsg{Event: event})
+		}
+	}
 }
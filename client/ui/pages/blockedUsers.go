@@ -0,0 +1,84 @@
+package pages
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/johnkhk/cli_chat_app/client/app"
+	"github.com/johnkhk/cli_chat_app/genproto/friends"
+)
+
+// BlockedUsersModel lists the users the current user has blocked and lets them lift a block.
+type BlockedUsersModel struct {
+	blockedUsers []*friends.BlockedUser
+	rpcClient    *app.RpcClient
+	cursor       int
+}
+
+// NewBlockedUsersModel creates an empty blocked users list; the parent fetches its contents.
+func NewBlockedUsersModel(rpcClient *app.RpcClient) BlockedUsersModel {
+	return BlockedUsersModel{
+		blockedUsers: []*friends.BlockedUser{},
+		rpcClient:    rpcClient,
+	}
+}
+
+func (m BlockedUsersModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m BlockedUsersModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case BlockedUsersMsg:
+		if msg.Err != nil {
+			m.rpcClient.Logger.Errorf("Error fetching blocked users: %v", msg.Err)
+		} else {
+			m.blockedUsers = msg.Users
+			if m.cursor >= len(m.blockedUsers) {
+				m.cursor = max(len(m.blockedUsers)-1, 0)
+			}
+		}
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.blockedUsers)-1 {
+				m.cursor++
+			}
+		case "u":
+			// Unblock the selected user
+			if m.cursor < len(m.blockedUsers) {
+				user := m.blockedUsers[m.cursor]
+				return m, unblockUserCmd(m.rpcClient, user.UserId, user.Username)
+			}
+		case "ctrl+c", "q":
+			return m, tea.Quit
+		}
+	}
+
+	return m, nil
+}
+
+func (m BlockedUsersModel) View() string {
+	if len(m.blockedUsers) == 0 {
+		return "You have not blocked anyone."
+	}
+
+	var b strings.Builder
+	b.WriteString("Blocked users:\n\n")
+	for i, user := range m.blockedUsers {
+		cursor := " "
+		if m.cursor == i {
+			cursor = ">"
+		}
+		b.WriteString(fmt.Sprintf("%s %s\n", cursor, user.Username))
+	}
+	b.WriteString("\n[ ↑/↓: navigate | 'u': Unblock ]\n")
+	return b.String()
+}
@@ -53,6 +53,8 @@ type ChatModel struct {
 	cancel         context.CancelFunc
 	activeUserID   int32 // Add this field to track the active user ID
 	activeUsername string
+	activeProfile  *app.UserProfile // Profile of the active user, nil if they have not shared one
+	activeNickname string           // Name given to the active user on this device, empty for none
 	serverMessages []ChatMessage
 }
 
@@ -230,15 +232,7 @@ func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 				// Determine file type (simple logic based on file extension).
 				fileName := filepath.Base(filePath)
-				ext := strings.ToLower(filepath.Ext(fileName))
-				fileType := "file"
-				if ext == ".jpg" || ext == ".jpeg" || ext == ".png" || ext == ".gif" || ext == ".bmp" || ext == ".tiff" || ext == ".ico" || ext == ".webp" {
-					fileType = "image"
-				} else if ext == ".mp4" || ext == ".avi" || ext == ".mov" || ext == ".mkv" || ext == ".flv" || ext == ".wmv" {
-					fileType = "video"
-				} else {
-					fileType = "file"
-				}
+				fileType := lib.FileTypeFromName(fileName)
 
 				// Send the file message. For images, your store logic will treat it differently.
 				err = m.rpcClient.ChatClient.SendMessage(m.ctx, uint32(m.activeUserID), m.rpcClient.CurrentDeviceID, fileData, &lib.SendMessageOptions{
@@ -329,15 +323,18 @@ func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 	case ReceivedMessage:
-		// If the message is from the server, add it to the server messages.
-		if m.activeUserID == 0 && msg.SenderID == 0 {
+		// If the message is from the server, add it to the server messages, which are shown
+		// while no friend's conversation is open.
+		if msg.SenderID == 0 {
 			m.serverMessages = append(m.serverMessages, ChatMessage{
 				Sender:   msg.Sender,
 				Message:  msg.Message,
 				FileType: "text",
 			})
-			m.messages = m.serverMessages
-			m.viewport.SetContent(m.renderMessages())
+			if m.activeUserID == 0 {
+				m.messages = m.serverMessages
+				m.viewport.SetContent(m.renderMessages())
+			}
 			return m, m.listenToMessageChannel()
 		}
 
@@ -359,6 +356,13 @@ func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return m, m.listenToMessageChannel()
 
+	case FriendListMsg:
+		// Keep the header current when the active user changes their profile or is renamed
+		if msg.Err == nil {
+			m.activeProfile = msg.Profiles[uint32(m.activeUserID)]
+			m.activeNickname = msg.Settings[uint32(m.activeUserID)].Nickname
+		}
+
 	case errMsg:
 		// Handle errors from the channel.
 		m.err = msg
@@ -372,13 +376,37 @@ func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 func (m ChatModel) View() string {
 	return fmt.Sprintf(
 		// "%s\n\n%s",
-		"%s%s%s",
+		"%s%s%s%s",
+		m.renderHeader(),
 		m.viewport.View(),
 		gap,
 		m.textarea.View(),
 	)
 }
 
+// renderHeader names the user the conversation is with, by the nickname given to them on this
+// device or their display name, and shows their status if their profile has one.
+func (m ChatModel) renderHeader() string {
+	if m.activeUserID == 0 || m.activeUsername == "" {
+		return ""
+	}
+	name := m.activeUsername
+	displayName := m.activeNickname
+	var status string
+	if m.activeProfile != nil {
+		if displayName == "" {
+			displayName = m.activeProfile.DisplayName
+		}
+		if m.activeProfile.Status != "" {
+			status = "\n" + blurredStyle.Italic(true).Render(m.activeProfile.Status)
+		}
+	}
+	if displayName != "" {
+		name = displayName + " " + blurredStyle.Render("@"+m.activeUsername)
+	}
+	return lipgloss.NewStyle().Bold(true).Render(name) + status + "\n\n"
+}
+
 // renderMessages iterates over the chat messages and applies styles based on sender.
 func (m ChatModel) renderMessages() string {
 	var renderedMessages []string
@@ -4,15 +4,27 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 
 	"github.com/johnkhk/cli_chat_app/client/app"
+	"github.com/johnkhk/cli_chat_app/client/e2ee/store"
 	"github.com/johnkhk/cli_chat_app/genproto/friends"
 )
 
+// serverRow is the row above the friends where notices from the server are read. It is not a
+// friend, so it is drawn by the list rather than fetched with it.
+const serverRow = 0
+
 // ChatFriendListModel manages the friends list within the chat context.
 type ChatFriendListModel struct {
 	rpcClient *app.RpcClient
 	friends   []*friends.Friend // Holds the list of friends
-	selected  int               // Currently selected index in the friend list
+	selected  int               // Currently selected row, the server row or a friend below it
 	loading   bool              // Indicates whether the friend list is being fetched
+
+	activeUserID int32           // Friend whose conversation is open
+	unread       map[int32]bool  // Friends who sent messages since their conversation was last open
+	muted        map[uint32]bool // Friends whose conversations are muted on this device
+	profiles     map[uint32]*app.UserProfile
+	settings     map[uint32]store.ConversationSettings // Nicknames and pins kept on this device
+	sort         friends.FriendListSort
 }
 
 // NewChatFriendListModel initializes the ChatFriendListModel.
@@ -20,8 +32,30 @@ func NewChatFriendListModel(rpcClient *app.RpcClient) ChatFriendListModel {
 	return ChatFriendListModel{
 		rpcClient: rpcClient,
 		friends:   []*friends.Friend{},
-		selected:  0,    // Default to the first friend
-		loading:   true, // Start in a loading state until data is fetched
+		selected:  serverRow, // Default to the server notices
+		loading:   true,      // Start in a loading state until data is fetched
+		unread:    make(map[int32]bool),
+		muted:     make(map[uint32]bool),
+	}
+}
+
+// selectedFriend returns the friend on the selected row, or nil on the server row.
+func (m ChatFriendListModel) selectedFriend() *friends.Friend {
+	if m.selected <= serverRow || m.selected > len(m.friends) {
+		return nil
+	}
+	return m.friends[m.selected-1]
+}
+
+// selectRow opens the conversation on the selected row.
+func (m ChatFriendListModel) selectRow() tea.Cmd {
+	selected := FriendSelectedMsg{UserID: 0, Username: "server"}
+	if friend := m.selectedFriend(); friend != nil {
+		selected = FriendSelectedMsg{UserID: friend.UserId, Username: friend.Username}
+	}
+	m.rpcClient.Logger.Infof("Selected User ID: %d", selected.UserID)
+	return func() tea.Msg {
+		return selected
 	}
 }
 
@@ -32,36 +66,83 @@ func (m ChatFriendListModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		// Handle navigation with arrow keys
 		switch msg.String() {
 		case "up":
-			if m.selected > 0 {
+			if m.selected > serverRow {
 				m.selected--
 			}
 		case "down":
-			if m.selected < len(m.friends)-1 {
+			if m.selected < len(m.friends) {
 				m.selected++
 			}
 		case "enter":
 			// Trigger a user selection event by pressing "enter".
-			if m.selected >= 0 && m.selected < len(m.friends) {
-				selectedUserID := m.friends[m.selected].UserId
-				selectedUsername := m.friends[m.selected].Username
-				m.rpcClient.Logger.Infof("Selected User ID: %d", selectedUserID)
-				return m, func() tea.Msg {
-					return FriendSelectedMsg{UserID: selectedUserID, Username: selectedUsername}
-				}
+			return m, m.selectRow()
+		case "m":
+			// Mute or unmute the selected conversation
+			if friend := m.selectedFriend(); friend != nil {
+				userID := uint32(friend.UserId)
+				return m, muteConversationCmd(m.rpcClient, userID, !m.muted[userID])
 			}
+		case "p":
+			// Pin or unpin the selected conversation
+			if friend := m.selectedFriend(); friend != nil {
+				userID := uint32(friend.UserId)
+				return m, pinConversationCmd(m.rpcClient, userID, !m.settings[userID].Pinned)
+			}
+		case "s":
+			// Switch to the next order of the friend list
+			next := (m.sort + 1) % friends.FriendListSort(len(friends.FriendListSort_name))
+			return m, setFriendSortCmd(m.rpcClient, next)
+		}
+	case ReceivedMessage:
+		// Mark conversations with new messages, unless they are open or muted
+		if int32(msg.SenderID) != m.activeUserID && !m.muted[msg.SenderID] {
+			m.unread[int32(msg.SenderID)] = true
 		}
+	case MutedConversationsMsg:
+		if msg.Err != nil {
+			m.rpcClient.Logger.Errorf("Error loading muted conversations: %v", msg.Err)
+		} else {
+			m.muted = msg.Muted
+		}
+	case MuteConversationResultMsg:
+		if msg.Err != nil {
+			m.rpcClient.Logger.Errorf("Failed to change mute of conversation with user %d: %v", msg.UserID, msg.Err)
+		} else if msg.Muted {
+			m.muted[msg.UserID] = true
+			delete(m.unread, int32(msg.UserID))
+		} else {
+			delete(m.muted, msg.UserID)
+		}
+	case PinConversationResultMsg:
+		if msg.Err != nil {
+			m.rpcClient.Logger.Errorf("Failed to change pin of conversation with user %d: %v", msg.UserID, msg.Err)
+			return m, nil
+		}
+		// Pinned conversations move to the top, so the list is fetched again in its new order
+		return m, fetchFriendListCmd(m.rpcClient)
 	case FriendListMsg:
 		// Update the friend list once the data is fetched
 		if msg.Err == nil {
+			// Stay with the selected friend when the list is reloaded, unless they are gone
+			var selectedUserID int32 = -1
+			if friend := m.selectedFriend(); !m.loading && friend != nil {
+				selectedUserID = friend.UserId
+			}
 			m.friends = msg.Friends
+			m.profiles = msg.Profiles
+			m.settings = msg.Settings
+			m.sort = msg.Sort
 			m.loading = false
-			if len(m.friends) > 0 {
-				defaultUserID := m.friends[m.selected].UserId
-				defaultUsername := m.friends[m.selected].Username
-				return m, func() tea.Msg {
-					return FriendSelectedMsg{UserID: defaultUserID, Username: defaultUsername}
+			for i, friend := range m.friends {
+				if friend.UserId == selectedUserID {
+					m.selected = i + 1
+					return m, nil
 				}
 			}
+			if m.selected > len(m.friends) {
+				m.selected = len(m.friends)
+			}
+			return m, m.selectRow()
 		} else {
 			// m.friends = []string{"Failed to load friends."}
 			m.rpcClient.Logger.Errorf("Error fetching friend list: %v", msg.Err)
@@ -80,18 +161,55 @@ func (m ChatFriendListModel) View() string {
 		return "Loading friends..."
 	}
 
-	view := ""
+	view := blurredStyle.Render("By "+friendSortLabel(m.sort)) + "\n"
+	view += rowCursor(m.selected == serverRow) + " server\n"
 	for i, friend := range m.friends {
-		cursor := " " // No cursor
-		if i == m.selected {
-			cursor = ">" // Show cursor on selected item
+		userID := uint32(friend.UserId)
+		view += rowCursor(m.selected == i+1) + " "
+		if m.settings[userID].Pinned {
+			view += pinnedStyle.Render("*") + " "
 		}
-		view += cursor + " " + friend.Username + "\n"
+		view += friendName(friend, m.profiles[userID], m.settings[userID].Nickname)
+		if friend.Online {
+			view += " " + onlineStyle.Render("●")
+		}
+		if m.muted[userID] {
+			view += " " + mutedTagStyle.Render("[muted]")
+		} else if m.unread[friend.UserId] {
+			view += " " + unreadStyle.Render("•")
+		}
+		view += "\n"
 	}
 	return view
 }
 
+// rowCursor marks the selected row of the list.
+func rowCursor(selected bool) string {
+	if selected {
+		return ">" // Show cursor on selected item
+	}
+	return " " // No cursor
+}
+
+// friendSortLabel names an order of the friend list.
+func friendSortLabel(sort friends.FriendListSort) string {
+	switch sort {
+	case friends.FriendListSort_ALPHABETICAL:
+		return "name"
+	case friends.FriendListSort_ONLINE_FIRST:
+		return "online first"
+	default:
+		return "recent activity"
+	}
+}
+
+// setActive records the friend whose conversation was opened and clears its unread marker.
+func (m *ChatFriendListModel) setActive(userID int32) {
+	m.activeUserID = userID
+	delete(m.unread, userID)
+}
+
 // Init initializes the ChatFriendListModel with a command to fetch the friend list.
 func (m ChatFriendListModel) Init() tea.Cmd {
-	return fetchFriendListCmd(m.rpcClient)
+	return tea.Batch(fetchFriendListCmd(m.rpcClient), fetchMutedConversationsCmd(m.rpcClient))
 }
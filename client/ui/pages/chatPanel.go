@@ -1,10 +1,13 @@
 package pages
 
 import (
+	"fmt"
+
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 
 	"github.com/johnkhk/cli_chat_app/client/app"
+	"github.com/johnkhk/cli_chat_app/genproto/friends"
 )
 
 type focusState uint
@@ -21,8 +24,10 @@ type ChatPanelModel struct {
 	terminalHeight int
 	focusState     focusState
 	// friendsModel   DummyModel // Replace with actual friends list model.
-	friendsModel *ChatFriendListModel // Replace with actual friends list model.
-	chatModel    *ChatModel           // Use a pointer to the ChatModel.
+	friendsModel    *ChatFriendListModel // Replace with actual friends list model.
+	chatModel       *ChatModel           // Use a pointer to the ChatModel.
+	pendingRequests int                  // Incoming friend requests waiting for an answer, shown as a badge
+	messageRequests int                  // Message requests from non-friends waiting for an answer, shown as a badge
 }
 
 // Initialize the main menu model
@@ -94,6 +99,11 @@ func (m ChatPanelModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					// Return only the updated chat model and its commands, ignoring the previous model's cmds
 					return updatedChatPanelModel, tea.Batch(chatCmd, updateCmd)
 				}
+				if msg.String() == "h" {
+					historyTransferModel := NewHistoryTransferModel(m.rpcClient, m.friendsModel.selected, m.chatModel.serverMessages)
+					updatedModel, updateCmd := historyTransferModel.Update(tea.WindowSizeMsg{Width: m.terminalWidth, Height: m.terminalHeight})
+					return updatedModel, tea.Batch(historyTransferModel.Init(), updateCmd)
+				}
 				// Switch to the friend management page
 
 				// var friendCmd tea.Cmd
@@ -123,9 +133,37 @@ func (m ChatPanelModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
+	case IncomingFriendRequestsMsg:
+		if msg.Err != nil {
+			m.rpcClient.Logger.Errorf("Error fetching incoming friend requests: %v", msg.Err)
+		} else {
+			m.pendingRequests = len(msg.Requests)
+		}
+
+	case MessageRequestsMsg:
+		if msg.Err != nil {
+			m.rpcClient.Logger.Errorf("Error fetching message requests: %v", msg.Err)
+		} else {
+			m.messageRequests = len(msg.Requests)
+		}
+
+	case FriendEventMsg:
+		// Keep the badges and the friend list current
+		m.rpcClient.Logger.Infof("Friend event %s from %s", msg.Event.Type, msg.Event.Username)
+		cmd = fetchIncomingFriendRequestsCmd(m.rpcClient)
+		switch msg.Event.Type {
+		case friends.FriendEventType_FRIEND_REQUEST_ACCEPTED, friends.FriendEventType_INVITE_REDEEMED, friends.FriendEventType_FRIEND_REMOVED, friends.FriendEventType_PROFILE_UPDATED:
+			cmd = tea.Batch(cmd, fetchFriendListCmd(m.rpcClient))
+		case friends.FriendEventType_MESSAGE_REQUEST_RECEIVED:
+			cmd = tea.Batch(cmd, fetchMessageRequestsCmd(m.rpcClient))
+		}
+
 	case FriendSelectedMsg:
 		// When a friend is selected, set the active user ID in the chat model.
 		m.chatModel.SetActiveUser(msg.UserID, msg.Username)
+		m.chatModel.activeProfile = m.friendsModel.profiles[uint32(msg.UserID)]
+		m.chatModel.activeNickname = m.friendsModel.settings[uint32(msg.UserID)].Nickname
+		m.friendsModel.setActive(msg.UserID)
 		m.rpcClient.Logger.Infof("Switched to chat with user ID: %d", msg.UserID)
 		m.focusState = rightPanel
 
@@ -159,6 +197,12 @@ func (m ChatPanelModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 func (m ChatPanelModel) View() string {
 	// leftPanelContent := "Friends List\n1. Alice\n2. Bob\n3. Charlie"
 	leftPanelContent := m.friendsModel.View()
+	if m.messageRequests > 0 {
+		leftPanelContent = badgeStyle.Render(fmt.Sprintf("%d message request(s), press f", m.messageRequests)) + "\n\n" + leftPanelContent
+	}
+	if m.pendingRequests > 0 {
+		leftPanelContent = badgeStyle.Render(fmt.Sprintf("%d friend request(s), press f", m.pendingRequests)) + "\n\n" + leftPanelContent
+	}
 	rightPanelContent := m.chatModel.View()
 
 	// Define the margin from all edges
@@ -206,7 +250,7 @@ func (m ChatPanelModel) renderHelpBar() string {
 	// Determine the content based on the focused state
 	var helpBarContent string
 	if m.focusState == leftPanel {
-		helpBarContent = "\nPress Tab to switch panels | esc/ctrl+c: quit | f: friends management"
+		helpBarContent = "\nPress Tab to switch panels | esc/ctrl+c: quit | f: friends management | h: history transfer | m: mute | p: pin | s: sort"
 	} else {
 		// helpBarContent = "\nPress Tab to switch panels | esc/ctrl+c: quit | /file <path/to/file> to send a file"
 		helpBarContent = "\nPress Tab to switch panels | esc/ctrl+c: quit"
@@ -222,5 +266,7 @@ func (m ChatPanelModel) Init() tea.Cmd {
 	return tea.Batch(
 		m.chatModel.Init(),
 		m.friendsModel.Init(),
+		fetchIncomingFriendRequestsCmd(m.rpcClient), // For the friend request badge
+		fetchMessageRequestsCmd(m.rpcClient),        // For the message request badge
 	)
 }
@@ -3,19 +3,130 @@
 package pages
 
 import (
+	"context"
+	"slices"
+	"strings"
+
 	tea "github.com/charmbracelet/bubbletea"
 
 	"github.com/johnkhk/cli_chat_app/client/app"
 	f "github.com/johnkhk/cli_chat_app/genproto/friends"
 )
 
-// fetchFriendListCmd fetches the friend list for the current user.
+// friendSortPreference is the name under which the chosen friend list order is kept on this device.
+const friendSortPreference = "friend_sort"
+
+// fetchFriendListCmd fetches the friend list for the current user in the order chosen on this
+// device, with pinned conversations first.
 func fetchFriendListCmd(rpcClient *app.RpcClient) tea.Cmd {
 	return func() tea.Msg {
-		friends, err := rpcClient.FriendsClient.GetFriendList()
-		// Add server as a default friend to front of list
-		friends = append([]*f.Friend{{UserId: 0, Username: "server"}}, friends...)
-		return FriendListMsg{Friends: friends, Err: err}
+		sort := loadFriendSort(rpcClient)
+		friendList, err := rpcClient.FriendsClient.GetFriendListSorted(sort)
+		if err != nil {
+			return FriendListMsg{Sort: sort, Err: err}
+		}
+
+		// New friends need our profile key before they can read our profile
+		ids := friendUserIDs(friendList)
+		rpcClient.UserProfileClient.ShareProfileKey(context.Background(), ids)
+		profiles := rpcClient.UserProfileClient.GetProfiles(ids)
+
+		settings, err := rpcClient.Store.AllConversationSettings()
+		if err != nil {
+			// Nicknames and pins are only decoration, the list is still worth showing
+			rpcClient.Logger.Errorf("Failed to load conversation settings: %v", err)
+		}
+		slices.SortStableFunc(friendList, func(a, b *f.Friend) int {
+			aPinned, bPinned := settings[uint32(a.UserId)].Pinned, settings[uint32(b.UserId)].Pinned
+			switch {
+			case aPinned && !bPinned:
+				return -1
+			case bPinned && !aPinned:
+				return 1
+			}
+			return 0
+		})
+		return FriendListMsg{Friends: friendList, Profiles: profiles, Settings: settings, Sort: sort}
+	}
+}
+
+// loadFriendSort returns the friend list order chosen on this device, most recent activity
+// if none was.
+func loadFriendSort(rpcClient *app.RpcClient) f.FriendListSort {
+	name, err := rpcClient.Store.Preference(friendSortPreference, "")
+	if err != nil {
+		rpcClient.Logger.Errorf("Failed to load friend list order: %v", err)
+	}
+	return f.FriendListSort(f.FriendListSort_value[name])
+}
+
+// setFriendSortCmd keeps a new friend list order on this device and refetches the list in it.
+func setFriendSortCmd(rpcClient *app.RpcClient, sort f.FriendListSort) tea.Cmd {
+	return func() tea.Msg {
+		if err := rpcClient.Store.SetPreference(friendSortPreference, sort.String()); err != nil {
+			return FriendListMsg{Sort: sort, Err: err}
+		}
+		return fetchFriendListCmd(rpcClient)()
+	}
+}
+
+// pinConversationCmd pins or unpins the conversation with a user on this device.
+func pinConversationCmd(rpcClient *app.RpcClient, userID uint32, pinned bool) tea.Cmd {
+	return func() tea.Msg {
+		err := rpcClient.Store.SetConversationPinned(userID, pinned)
+		return PinConversationResultMsg{UserID: userID, Pinned: pinned, Err: err}
+	}
+}
+
+// setNicknameCmd sets the name this device shows for a user, removing it if nickname is empty.
+func setNicknameCmd(rpcClient *app.RpcClient, userID uint32, nickname string) tea.Cmd {
+	return func() tea.Msg {
+		nickname = strings.TrimSpace(nickname)
+		err := rpcClient.Store.SetConversationNickname(userID, nickname)
+		return SetNicknameResultMsg{UserID: userID, Nickname: nickname, Err: err}
+	}
+}
+
+// friendUserIDs returns the user IDs of a friend list.
+func friendUserIDs(friendList []*f.Friend) []uint32 {
+	ids := make([]uint32, 0, len(friendList))
+	for _, friend := range friendList {
+		ids = append(ids, uint32(friend.UserId))
+	}
+	return ids
+}
+
+// rotateProfileKey gives the current user's profile a new key once someone has stopped being
+// their friend, so they can't read later changes. Failing only leaves the old key in place.
+func rotateProfileKey(rpcClient *app.RpcClient) {
+	friendList, err := rpcClient.FriendsClient.GetFriendList()
+	if err != nil {
+		rpcClient.Logger.Errorf("Not rotating profile key: %v", err)
+		return
+	}
+	if err := rpcClient.UserProfileClient.RotateProfileKey(context.Background(), friendUserIDs(friendList)); err != nil {
+		rpcClient.Logger.Errorf("Failed to rotate profile key: %v", err)
+	}
+}
+
+// fetchOwnProfileCmd fetches the current user's profile.
+func fetchOwnProfileCmd(rpcClient *app.RpcClient) tea.Cmd {
+	return func() tea.Msg {
+		profile, err := rpcClient.UserProfileClient.GetOwnProfile()
+		return OwnProfileMsg{Profile: profile, Err: err}
+	}
+}
+
+// updateProfileCmd saves the current user's profile, sending the profile key to any friend
+// without it, and returns a result message.
+func updateProfileCmd(rpcClient *app.RpcClient, profile *app.UserProfile) tea.Cmd {
+	return func() tea.Msg {
+		friendList, err := rpcClient.FriendsClient.GetFriendList()
+		if err != nil {
+			return UpdateProfileResultMsg{Err: err}
+		}
+		err = rpcClient.UserProfileClient.UpdateProfile(context.Background(), profile, friendUserIDs(friendList))
+		return UpdateProfileResultMsg{Profile: profile, Err: err}
 	}
 }
 
@@ -59,10 +170,161 @@ func declineFriendRequestCmd(rpcClient *app.RpcClient, requestID int32) tea.Cmd
 	}
 }
 
+// cancelFriendRequestCmd withdraws a friend request the user sent and returns a result message.
+func cancelFriendRequestCmd(rpcClient *app.RpcClient, request *f.FriendRequest) tea.Cmd {
+	return func() tea.Msg {
+		err := rpcClient.FriendsClient.CancelFriendRequest(request.RequestId)
+		return CancelFriendRequestResultMsg{RequestID: request.RequestId, RecipientUsername: request.RecipientUsername, Err: err}
+	}
+}
+
+// createInviteCmd creates an invite code that maxUses users can redeem and returns a result message.
+func createInviteCmd(rpcClient *app.RpcClient, maxUses uint32) tea.Cmd {
+	return func() tea.Msg {
+		invite, err := rpcClient.FriendsClient.CreateInvite(maxUses, 0)
+		return CreateInviteResultMsg{Invite: invite, Err: err}
+	}
+}
+
+// redeemInviteCmd redeems an invite code and returns a result message.
+func redeemInviteCmd(rpcClient *app.RpcClient, code string) tea.Cmd {
+	return func() tea.Msg {
+		friend, err := rpcClient.FriendsClient.RedeemInvite(code)
+		return RedeemInviteResultMsg{Code: code, Friend: friend, Err: err}
+	}
+}
+
 // removeFriendCmd removes a friend from the user's friend list and returns a result message.
 func removeFriendCmd(rpcClient *app.RpcClient, friendID int32) tea.Cmd {
 	return func() tea.Msg {
 		err := rpcClient.FriendsClient.RemoveFriend(friendID)
+		if err == nil {
+			rotateProfileKey(rpcClient)
+		}
 		return RemoveFriendResultMsg{FriendID: friendID, Err: err}
 	}
 }
+
+// fetchBlockedUsersCmd fetches the users the current user has blocked.
+func fetchBlockedUsersCmd(rpcClient *app.RpcClient) tea.Cmd {
+	return func() tea.Msg {
+		users, err := rpcClient.FriendsClient.GetBlockedUsers()
+		return BlockedUsersMsg{Users: users, Err: err}
+	}
+}
+
+// blockUserCmd blocks a user and returns a result message.
+func blockUserCmd(rpcClient *app.RpcClient, userID int32, username string) tea.Cmd {
+	return func() tea.Msg {
+		err := rpcClient.FriendsClient.BlockUser(userID)
+		if err == nil {
+			rotateProfileKey(rpcClient)
+		}
+		return BlockUserResultMsg{UserID: userID, Username: username, Err: err}
+	}
+}
+
+// unblockUserCmd lifts a block on a user and returns a result message.
+func unblockUserCmd(rpcClient *app.RpcClient, userID int32, username string) tea.Cmd {
+	return func() tea.Msg {
+		err := rpcClient.FriendsClient.UnblockUser(userID)
+		return UnblockUserResultMsg{UserID: userID, Username: username, Err: err}
+	}
+}
+
+// searchUsersCmd fetches the page of users matching query that starts at offset.
+func searchUsersCmd(rpcClient *app.RpcClient, query string, offset uint32) tea.Cmd {
+	return func() tea.Msg {
+		users, more, err := rpcClient.FriendsClient.SearchUsers(query, offset, 0)
+		return SearchUsersResultMsg{Query: query, Offset: offset, Users: users, HasMore: more, Err: err}
+	}
+}
+
+// fetchPrivacySettingsCmd fetches the current user's privacy settings.
+func fetchPrivacySettingsCmd(rpcClient *app.RpcClient) tea.Cmd {
+	return func() tea.Msg {
+		settings, err := rpcClient.FriendsClient.GetPrivacySettings()
+		return PrivacySettingsMsg{Settings: settings, Err: err}
+	}
+}
+
+// setDiscoverableCmd sets whether other users can find the current user by searching, and returns a result message.
+func setDiscoverableCmd(rpcClient *app.RpcClient, discoverable bool) tea.Cmd {
+	return func() tea.Msg {
+		err := rpcClient.FriendsClient.SetDiscoverable(discoverable)
+		return SetDiscoverableResultMsg{Discoverable: discoverable, Err: err}
+	}
+}
+
+// fetchMessageRequestsCmd fetches the message requests waiting for the current user.
+func fetchMessageRequestsCmd(rpcClient *app.RpcClient) tea.Cmd {
+	return func() tea.Msg {
+		requests, err := rpcClient.ChatClient.GetMessageRequests()
+		return MessageRequestsMsg{Requests: requests, Err: err}
+	}
+}
+
+// acceptMessageRequestCmd accepts a message request and returns a result message.
+func acceptMessageRequestCmd(rpcClient *app.RpcClient, senderID uint32, username string) tea.Cmd {
+	return func() tea.Msg {
+		err := rpcClient.ChatClient.AcceptMessageRequest(senderID)
+		return AcceptMessageRequestResultMsg{SenderID: senderID, Username: username, Err: err}
+	}
+}
+
+// rejectMessageRequestCmd rejects a message request and returns a result message.
+func rejectMessageRequestCmd(rpcClient *app.RpcClient, senderID uint32, username string) tea.Cmd {
+	return func() tea.Msg {
+		err := rpcClient.ChatClient.RejectMessageRequest(senderID)
+		return RejectMessageRequestResultMsg{SenderID: senderID, Username: username, Err: err}
+	}
+}
+
+// fetchMutedConversationsCmd loads the conversations muted on this device.
+func fetchMutedConversationsCmd(rpcClient *app.RpcClient) tea.Cmd {
+	return func() tea.Msg {
+		muted, err := rpcClient.ChatClient.Store.MutedConversations()
+		return MutedConversationsMsg{Muted: muted, Err: err}
+	}
+}
+
+// muteConversationCmd mutes or unmutes the conversation with a user on this device.
+func muteConversationCmd(rpcClient *app.RpcClient, userID uint32, muted bool) tea.Cmd {
+	return func() tea.Msg {
+		err := rpcClient.ChatClient.Store.SetConversationMuted(userID, muted)
+		return MuteConversationResultMsg{UserID: userID, Muted: muted, Err: err}
+	}
+}
+
+// startHistoryReceiveCmd opens a history transfer for this device.
+func startHistoryReceiveCmd(rpcClient *app.RpcClient) tea.Cmd {
+	return func() tea.Msg {
+		transfer, err := rpcClient.HistoryClient.StartReceive()
+		return StartHistoryReceiveResultMsg{Transfer: transfer, Err: err}
+	}
+}
+
+// receiveHistoryCmd waits for the old device to upload and imports the history.
+func receiveHistoryCmd(ctx context.Context, rpcClient *app.RpcClient, code string) tea.Cmd {
+	return func() tea.Msg {
+		imported, err := rpcClient.HistoryClient.ReceiveHistory(ctx, code)
+		return HistoryReceivedMsg{Imported: imported, Err: err}
+	}
+}
+
+// lookupHistoryTransferCmd fetches the fingerprint of the device waiting on a transfer.
+func lookupHistoryTransferCmd(rpcClient *app.RpcClient, code string) tea.Cmd {
+	return func() tea.Msg {
+		fingerprint, err := rpcClient.HistoryClient.LookupTransfer(code)
+		return LookupHistoryTransferResultMsg{Code: code, Fingerprint: fingerprint, Err: err}
+	}
+}
+
+// sendHistoryCmd uploads this device's chat history to the device waiting on a transfer,
+// provided its key still has the fingerprint the user verified.
+func sendHistoryCmd(rpcClient *app.RpcClient, code, fingerprint string) tea.Cmd {
+	return func() tea.Msg {
+		sent, err := rpcClient.HistoryClient.SendHistory(code, fingerprint)
+		return SendHistoryResultMsg{Sent: sent, Err: err}
+	}
+}
@@ -1,5 +1,10 @@
 package pages
 
+import (
+	"github.com/johnkhk/cli_chat_app/client/app"
+	"github.com/johnkhk/cli_chat_app/genproto/friends"
+)
+
 type errMsg struct {
 	err error
 }
@@ -7,3 +12,19 @@ type errMsg struct {
 func (e errMsg) Error() string {
 	return e.err.Error()
 }
+
+// friendName is how a friend is shown in lists: by the nickname given to them on this device,
+// else by the display name in their profile if they set one, with bot accounts tagged.
+func friendName(friend *friends.Friend, profile *app.UserProfile, nickname string) string {
+	name := friend.Username
+	if nickname == "" && profile != nil {
+		nickname = profile.DisplayName
+	}
+	if nickname != "" {
+		name = nickname + " " + blurredStyle.Render("@"+friend.Username)
+	}
+	if friend.IsBot {
+		return name + " " + botTagStyle.Render("[bot]")
+	}
+	return name
+}
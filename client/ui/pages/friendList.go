@@ -4,18 +4,25 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 
 	"github.com/johnkhk/cli_chat_app/client/app"
+	"github.com/johnkhk/cli_chat_app/client/e2ee/store"
 	"github.com/johnkhk/cli_chat_app/genproto/friends"
 )
 
 // FriendListModel represents the model for the friend list page
 type FriendListModel struct {
 	friendList         []*friends.Friend // List of friends
-	rpcClient          *app.RpcClient    // Reference to the RPC client
-	cursor             int               // Cursor position in the list
-	removeConfirmation bool              // Indicates if we're in the remove confirmation state
+	profiles           map[uint32]*app.UserProfile
+	settings           map[uint32]store.ConversationSettings // Nicknames kept on this device
+	rpcClient          *app.RpcClient                        // Reference to the RPC client
+	cursor             int                                   // Cursor position in the list
+	removeConfirmation bool                                  // Indicates if we're in the remove confirmation state
+	blockConfirmation  bool                                  // Indicates if we're in the block confirmation state
+	editingNickname    bool                                  // Indicates if the nickname of the selected friend is being typed
+	nicknameInput      textinput.Model
 }
 
 // Init initializes the model (no initialization needed here)
@@ -34,11 +41,41 @@ func (m FriendListModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		} else {
 			m.rpcClient.Logger.Infof("Received friend list: %v", msg.Friends)
 			m.friendList = msg.Friends
+			m.profiles = msg.Profiles
+			m.settings = msg.Settings
 		}
 
 	// Handle key presses
 	case tea.KeyMsg:
-		if m.removeConfirmation {
+		if m.editingNickname {
+			switch msg.String() {
+			case "enter":
+				// An empty nickname goes back to the friend's own name
+				friend := m.friendList[m.cursor]
+				m.editingNickname = false
+				m.nicknameInput.Blur()
+				return m, setNicknameCmd(m.rpcClient, uint32(friend.UserId), m.nicknameInput.Value())
+			case "esc":
+				m.editingNickname = false
+				m.nicknameInput.Blur()
+				return m, nil
+			}
+			var cmd tea.Cmd
+			m.nicknameInput, cmd = m.nicknameInput.Update(msg)
+			return m, cmd
+		} else if m.blockConfirmation {
+			// Handle confirmation inputs
+			switch msg.String() {
+			case "y", "Y":
+				// Confirm block
+				friend := m.friendList[m.cursor]
+				m.blockConfirmation = false
+				return m, blockUserCmd(m.rpcClient, friend.UserId, friend.Username)
+			case "n", "N":
+				// Cancel block
+				m.blockConfirmation = false
+			}
+		} else if m.removeConfirmation {
 			// Handle confirmation inputs
 			switch msg.String() {
 			case "y", "Y":
@@ -66,6 +103,19 @@ func (m FriendListModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if len(m.friendList) > 0 {
 					m.removeConfirmation = true
 				}
+			case "b":
+				// Initiate block confirmation
+				if len(m.friendList) > 0 {
+					m.blockConfirmation = true
+				}
+			case "n":
+				// Give the selected friend a nickname only shown on this device
+				if len(m.friendList) > 0 {
+					m.editingNickname = true
+					m.nicknameInput.SetValue(m.settings[uint32(m.friendList[m.cursor].UserId)].Nickname)
+					m.nicknameInput.CursorEnd()
+					return m, m.nicknameInput.Focus()
+				}
 			case "ctrl+c", "q":
 				// Quit the application
 				return m, tea.Quit
@@ -103,7 +153,16 @@ func (m FriendListModel) View() string {
 
 	var b strings.Builder
 
-	if m.removeConfirmation {
+	if m.editingNickname {
+		friend := m.friendList[m.cursor]
+		b.WriteString(fmt.Sprintf("Nickname for %s, only shown on this device:\n\n", friend.Username))
+		b.WriteString(m.nicknameInput.View() + "\n")
+		b.WriteString("\n[ enter: save, empty to remove | esc: cancel ]\n")
+	} else if m.blockConfirmation {
+		// Display confirmation prompt
+		friend := m.friendList[m.cursor]
+		b.WriteString(fmt.Sprintf("Block %s? They will be removed as a friend and can't message you or send friend requests. (y/n)\n", friend.Username))
+	} else if m.removeConfirmation {
 		// Display confirmation prompt
 		friend := m.friendList[m.cursor]
 		b.WriteString(fmt.Sprintf("Are you sure you want to remove %s? (y/n)\n", friend.Username))
@@ -115,9 +174,10 @@ func (m FriendListModel) View() string {
 			if m.cursor == i {
 				cursor = ">" // Cursor
 			}
-			b.WriteString(fmt.Sprintf("%s %s\n", cursor, friend.Username))
+			b.WriteString(fmt.Sprintf("%s %s\n", cursor, friendName(friend, m.profiles[uint32(friend.UserId)], m.settings[uint32(friend.UserId)].Nickname)))
 		}
 		// b.WriteString("\nUse ↑/↓ to navigate. Press 'd' to remove the selected friend.")
+		b.WriteString("\n[ ↑/↓: navigate | 'd': Remove | 'b': Block | 'n': Nickname ]\n")
 	}
 
 	return b.String()
@@ -125,9 +185,15 @@ func (m FriendListModel) View() string {
 
 // NewFriendListModel creates and returns a new friend list model
 func NewFriendListModel(rpcClient *app.RpcClient) FriendListModel {
+	nicknameInput := textinput.New()
+	nicknameInput.Placeholder = "Nickname"
+	nicknameInput.CharLimit = app.MaxDisplayNameLength
+	nicknameInput.Width = 40
+
 	return FriendListModel{
-		friendList: []*friends.Friend{}, // Initialize with an empty friend list
-		rpcClient:  rpcClient,           // Set the RPC client reference
-		cursor:     0,                   // Start cursor at the top
+		friendList:    []*friends.Friend{}, // Initialize with an empty friend list
+		rpcClient:     rpcClient,           // Set the RPC client reference
+		cursor:        0,                   // Start cursor at the top
+		nicknameInput: nicknameInput,
 	}
 }
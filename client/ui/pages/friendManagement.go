@@ -3,6 +3,7 @@
 package pages
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -11,6 +12,14 @@ import (
 	"github.com/charmbracelet/lipgloss"
 
 	"github.com/johnkhk/cli_chat_app/client/app"
+	"github.com/johnkhk/cli_chat_app/genproto/friends"
+)
+
+// searchTab, profileTab and inviteTab are the indexes of the tabs whose text inputs take most keys while they are showing.
+const (
+	searchTab  = 5
+	profileTab = 6
+	inviteTab  = 7
 )
 
 type FriendManagementModel struct {
@@ -30,12 +39,17 @@ func NewFriendManagementModel(rpcClient *app.RpcClient, originalSelectedIdx int,
 	friendListModel := NewFriendListModel(rpcClient)
 	incomingModel := NewIncomingRequestsModel(rpcClient)
 	outgoingModel := NewOutgoingRequestsModel(rpcClient)
+	blockedModel := NewBlockedUsersModel(rpcClient)
+	messageRequestsModel := NewMessageRequestsModel(rpcClient)
+	searchModel := NewUserSearchModel(rpcClient)
+	profileModel := NewProfileEditorModel(rpcClient)
+	invitesModel := NewInvitesModel(rpcClient)
 
 	return FriendManagementModel{
 		rpcClient:              rpcClient,
-		tabs:                   []string{"Friends", "Incoming", "Outgoing"},
+		tabs:                   []string{"Friends", "Incoming", "Outgoing", "Blocked", "Requests", "Search", "Profile", "Invites"},
 		activeTab:              0,
-		tabContent:             []tea.Model{friendListModel, incomingModel, outgoingModel},
+		tabContent:             []tea.Model{friendListModel, incomingModel, outgoingModel, blockedModel, messageRequestsModel, searchModel, profileModel, invitesModel},
 		originalSelectedIdx:    originalSelectedIdx,
 		originalServerMessages: originalServerMessages,
 	}
@@ -46,6 +60,13 @@ func (m FriendManagementModel) Init() tea.Cmd {
 		fetchFriendListCmd(m.rpcClient),
 		fetchIncomingFriendRequestsCmd(m.rpcClient),
 		fetchOutgoingFriendRequestsCmd(m.rpcClient),
+		fetchBlockedUsersCmd(m.rpcClient),
+		fetchMessageRequestsCmd(m.rpcClient),
+		fetchPrivacySettingsCmd(m.rpcClient),
+		fetchOwnProfileCmd(m.rpcClient),
+		m.tabContent[searchTab].Init(),
+		m.tabContent[profileTab].Init(),
+		m.tabContent[inviteTab].Init(),
 	)
 }
 
@@ -92,6 +113,24 @@ func (m FriendManagementModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
+		// The nickname box takes every key until it is saved or cancelled
+		if friendList, ok := m.tabContent[0].(FriendListModel); ok && friendList.editingNickname && msg.String() != "ctrl+c" {
+			updatedModel, subCmd := friendList.Update(msg)
+			m.tabContent[0] = updatedModel
+			return m, subCmd
+		}
+
+		// The search box, profile editor and invite box take every key except the ones that leave the tab or quit
+		if m.activeTab == searchTab || m.activeTab == profileTab || m.activeTab == inviteTab {
+			switch msg.String() {
+			case "tab", "shift+tab", "ctrl+c":
+			default:
+				updatedModel, subCmd := m.tabContent[m.activeTab].Update(msg)
+				m.tabContent[m.activeTab] = updatedModel
+				return m, subCmd
+			}
+		}
+
 		switch keypress := msg.String(); keypress {
 		case "ctrl+c", "q":
 			m.rpcClient.Logger.Info("Exiting the application from main menu")
@@ -104,13 +143,15 @@ func (m FriendManagementModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.activeTab = (m.activeTab - 1 + len(m.tabs)) % len(m.tabs)
 
 		case "r":
-			// Refresh friend list, incoming, and outgoing friend requests
+			// Refresh friend list, incoming and outgoing friend requests, blocked users and message requests
 			cmds = append(cmds,
 				fetchFriendListCmd(m.rpcClient),
 				fetchIncomingFriendRequestsCmd(m.rpcClient),
 				fetchOutgoingFriendRequestsCmd(m.rpcClient),
+				fetchBlockedUsersCmd(m.rpcClient),
+				fetchMessageRequestsCmd(m.rpcClient),
 			)
-			m.rpcClient.Logger.Info("Refreshing friend list and friend requests")
+			m.rpcClient.Logger.Info("Refreshing friend list, friend requests, blocked users and message requests")
 
 		case "c":
 			chatPanelModel := NewChatPanelModel(m.rpcClient)
@@ -149,6 +190,26 @@ func (m FriendManagementModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.tabContent[2] = updatedModel
 		cmds = append(cmds, subCmd)
 
+	case BlockedUsersMsg:
+		updatedModel, subCmd := m.tabContent[3].Update(msg)
+		m.tabContent[3] = updatedModel
+		cmds = append(cmds, subCmd)
+
+	case MessageRequestsMsg:
+		updatedModel, subCmd := m.tabContent[4].Update(msg)
+		m.tabContent[4] = updatedModel
+		cmds = append(cmds, subCmd)
+
+	case SearchUsersResultMsg, PrivacySettingsMsg:
+		updatedModel, subCmd := m.tabContent[searchTab].Update(msg)
+		m.tabContent[searchTab] = updatedModel
+		cmds = append(cmds, subCmd)
+
+	case OwnProfileMsg:
+		updatedModel, subCmd := m.tabContent[profileTab].Update(msg)
+		m.tabContent[profileTab] = updatedModel
+		cmds = append(cmds, subCmd)
+
 	// Action messages: execute commands
 	case SendFriendRequestMsg:
 		cmd := sendFriendRequestCmd(m.rpcClient, msg.RecipientUsername)
@@ -168,7 +229,11 @@ func (m FriendManagementModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	// Result messages: handle outcomes
 	case SendFriendRequestResultMsg:
-		if msg.Err != nil {
+		var limitErr *app.FriendRequestLimitError
+		if errors.As(msg.Err, &limitErr) {
+			m.statusMessage = fmt.Sprintf("Friend request to %s not sent: %s.", msg.RecipientUsername, limitErr.Reason)
+			m.statusIsError = true
+		} else if msg.Err != nil {
 			m.rpcClient.Logger.Error("Failed to send friend request:", msg.Err)
 			m.statusMessage = fmt.Sprintf("Failed to send friend request: %v", msg.Err)
 			m.statusIsError = true
@@ -206,6 +271,44 @@ func (m FriendManagementModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		cmds = append(cmds, clearStatusMessageCmd())
 
+	case CreateInviteResultMsg:
+		if msg.Err != nil {
+			m.rpcClient.Logger.Error("Failed to create invite:", msg.Err)
+			m.statusMessage = fmt.Sprintf("Failed to create invite: %v", msg.Err)
+			m.statusIsError = true
+		} else {
+			m.statusMessage = fmt.Sprintf("Invite %s created. Share it with the people you want to add.", msg.Invite.Code)
+			m.statusIsError = false
+		}
+		// The invites tab lists the new code even if another tab is showing by now
+		updatedModel, subCmd := m.tabContent[inviteTab].Update(msg)
+		m.tabContent[inviteTab] = updatedModel
+		return m, tea.Batch(subCmd, clearStatusMessageCmd())
+
+	case RedeemInviteResultMsg:
+		if msg.Err != nil {
+			m.rpcClient.Logger.Error("Failed to redeem invite:", msg.Err)
+			m.statusMessage = fmt.Sprintf("Failed to redeem invite: %v", msg.Err)
+			m.statusIsError = true
+		} else {
+			m.statusMessage = fmt.Sprintf("You are now friends with %s.", msg.Friend.Username)
+			m.statusIsError = false
+			cmds = append(cmds, fetchFriendListCmd(m.rpcClient))
+		}
+		cmds = append(cmds, clearStatusMessageCmd())
+
+	case CancelFriendRequestResultMsg:
+		if msg.Err != nil {
+			m.rpcClient.Logger.Error("Failed to cancel friend request:", msg.Err)
+			m.statusMessage = fmt.Sprintf("Failed to cancel friend request: %v", msg.Err)
+			m.statusIsError = true
+		} else {
+			m.statusMessage = fmt.Sprintf("Friend request to %s canceled.", msg.RecipientUsername)
+			m.statusIsError = false
+			cmds = append(cmds, fetchOutgoingFriendRequestsCmd(m.rpcClient))
+		}
+		cmds = append(cmds, clearStatusMessageCmd())
+
 	case RemoveFriendResultMsg:
 		if msg.Err != nil {
 			m.rpcClient.Logger.Error("Failed to remove friend:", msg.Err)
@@ -218,6 +321,131 @@ func (m FriendManagementModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		cmds = append(cmds, clearStatusMessageCmd())
 
+	case SetNicknameResultMsg:
+		if msg.Err != nil {
+			m.rpcClient.Logger.Error("Failed to set nickname:", msg.Err)
+			m.statusMessage = fmt.Sprintf("Failed to set nickname: %v", msg.Err)
+			m.statusIsError = true
+		} else {
+			if msg.Nickname == "" {
+				m.statusMessage = "Nickname removed."
+			} else {
+				m.statusMessage = fmt.Sprintf("Nickname set to %s.", msg.Nickname)
+			}
+			m.statusIsError = false
+			cmds = append(cmds, fetchFriendListCmd(m.rpcClient))
+		}
+		cmds = append(cmds, clearStatusMessageCmd())
+
+	case BlockUserResultMsg:
+		if msg.Err != nil {
+			m.rpcClient.Logger.Error("Failed to block user:", msg.Err)
+			m.statusMessage = fmt.Sprintf("Failed to block %s: %v", msg.Username, msg.Err)
+			m.statusIsError = true
+		} else {
+			m.statusMessage = fmt.Sprintf("Blocked %s.", msg.Username)
+			m.statusIsError = false
+			// Blocking ends the friendship and any request between you
+			cmds = append(cmds,
+				fetchFriendListCmd(m.rpcClient),
+				fetchIncomingFriendRequestsCmd(m.rpcClient),
+				fetchOutgoingFriendRequestsCmd(m.rpcClient),
+				fetchBlockedUsersCmd(m.rpcClient),
+				fetchMessageRequestsCmd(m.rpcClient),
+			)
+		}
+		cmds = append(cmds, clearStatusMessageCmd())
+
+	case UnblockUserResultMsg:
+		if msg.Err != nil {
+			m.rpcClient.Logger.Error("Failed to unblock user:", msg.Err)
+			m.statusMessage = fmt.Sprintf("Failed to unblock %s: %v", msg.Username, msg.Err)
+			m.statusIsError = true
+		} else {
+			m.statusMessage = fmt.Sprintf("Unblocked %s.", msg.Username)
+			m.statusIsError = false
+			cmds = append(cmds, fetchBlockedUsersCmd(m.rpcClient))
+		}
+		cmds = append(cmds, clearStatusMessageCmd())
+
+	case SetDiscoverableResultMsg:
+		if msg.Err != nil {
+			m.rpcClient.Logger.Error("Failed to update privacy settings:", msg.Err)
+			m.statusMessage = fmt.Sprintf("Failed to update privacy settings: %v", msg.Err)
+			m.statusIsError = true
+		} else if msg.Discoverable {
+			m.statusMessage = "Others can now find you by searching."
+			m.statusIsError = false
+		} else {
+			m.statusMessage = "You are now hidden from search, except to friends."
+			m.statusIsError = false
+		}
+		cmds = append(cmds, clearStatusMessageCmd())
+
+	case UpdateProfileResultMsg:
+		if msg.Err != nil {
+			m.rpcClient.Logger.Error("Failed to update profile:", msg.Err)
+			m.statusMessage = fmt.Sprintf("Failed to update profile: %v", msg.Err)
+			m.statusIsError = true
+		} else {
+			m.statusMessage = "Profile saved. Your friends will see the change."
+			m.statusIsError = false
+			updatedModel, subCmd := m.tabContent[profileTab].Update(msg)
+			m.tabContent[profileTab] = updatedModel
+			cmds = append(cmds, subCmd)
+		}
+		cmds = append(cmds, clearStatusMessageCmd())
+
+	case AcceptMessageRequestResultMsg:
+		if msg.Err != nil {
+			m.rpcClient.Logger.Error("Failed to accept message request:", msg.Err)
+			m.statusMessage = fmt.Sprintf("Failed to accept message request from %s: %v", msg.Username, msg.Err)
+			m.statusIsError = true
+		} else {
+			m.statusMessage = fmt.Sprintf("Accepted message request from %s, who is now your friend.", msg.Username)
+			m.statusIsError = false
+			// Accepting makes you friends and settles any friend request between you
+			cmds = append(cmds,
+				fetchFriendListCmd(m.rpcClient),
+				fetchIncomingFriendRequestsCmd(m.rpcClient),
+				fetchOutgoingFriendRequestsCmd(m.rpcClient),
+				fetchMessageRequestsCmd(m.rpcClient),
+			)
+		}
+		cmds = append(cmds, clearStatusMessageCmd())
+
+	case RejectMessageRequestResultMsg:
+		if msg.Err != nil {
+			m.rpcClient.Logger.Error("Failed to reject message request:", msg.Err)
+			m.statusMessage = fmt.Sprintf("Failed to reject message request from %s: %v", msg.Username, msg.Err)
+			m.statusIsError = true
+		} else {
+			m.statusMessage = fmt.Sprintf("Rejected message request from %s.", msg.Username)
+			m.statusIsError = false
+			cmds = append(cmds, fetchMessageRequestsCmd(m.rpcClient))
+		}
+		cmds = append(cmds, clearStatusMessageCmd())
+
+	// Event messages: another user changed a friendship or request
+	case FriendEventMsg:
+		m.statusMessage = friendEventText(msg.Event)
+		m.statusIsError = false
+		switch msg.Event.Type {
+		case friends.FriendEventType_FRIEND_REQUEST_CREATED, friends.FriendEventType_FRIEND_REQUEST_CANCELED:
+			cmds = append(cmds, fetchIncomingFriendRequestsCmd(m.rpcClient))
+		case friends.FriendEventType_FRIEND_REQUEST_ACCEPTED:
+			cmds = append(cmds, fetchFriendListCmd(m.rpcClient), fetchOutgoingFriendRequestsCmd(m.rpcClient))
+		case friends.FriendEventType_INVITE_REDEEMED:
+			cmds = append(cmds, fetchFriendListCmd(m.rpcClient))
+		case friends.FriendEventType_FRIEND_REQUEST_DECLINED:
+			cmds = append(cmds, fetchOutgoingFriendRequestsCmd(m.rpcClient))
+		case friends.FriendEventType_FRIEND_REMOVED, friends.FriendEventType_PROFILE_UPDATED:
+			cmds = append(cmds, fetchFriendListCmd(m.rpcClient))
+		case friends.FriendEventType_MESSAGE_REQUEST_RECEIVED:
+			cmds = append(cmds, fetchMessageRequestsCmd(m.rpcClient))
+		}
+		cmds = append(cmds, clearStatusMessageCmd())
+
 	// Clear status message after delay
 	case ClearStatusMessageMsg:
 		m.statusMessage = ""
@@ -243,6 +471,29 @@ func clearStatusMessageCmd() tea.Cmd {
 
 type ClearStatusMessageMsg struct{}
 
+// friendEventText describes a friend event for the status line.
+func friendEventText(event *friends.FriendEvent) string {
+	switch event.Type {
+	case friends.FriendEventType_FRIEND_REQUEST_CREATED:
+		return fmt.Sprintf("%s sent you a friend request.", event.Username)
+	case friends.FriendEventType_FRIEND_REQUEST_ACCEPTED:
+		return fmt.Sprintf("%s accepted your friend request.", event.Username)
+	case friends.FriendEventType_FRIEND_REQUEST_DECLINED:
+		return fmt.Sprintf("%s declined your friend request.", event.Username)
+	case friends.FriendEventType_FRIEND_REQUEST_CANCELED:
+		return fmt.Sprintf("%s canceled their friend request.", event.Username)
+	case friends.FriendEventType_FRIEND_REMOVED:
+		return fmt.Sprintf("%s removed you as a friend.", event.Username)
+	case friends.FriendEventType_MESSAGE_REQUEST_RECEIVED:
+		return fmt.Sprintf("%s sent you a message request.", event.Username)
+	case friends.FriendEventType_PROFILE_UPDATED:
+		return fmt.Sprintf("%s updated their profile.", event.Username)
+	case friends.FriendEventType_INVITE_REDEEMED:
+		return fmt.Sprintf("%s redeemed your invite and is now your friend.", event.Username)
+	}
+	return ""
+}
+
 func (m FriendManagementModel) View() string {
 	doc := strings.Builder{}
 
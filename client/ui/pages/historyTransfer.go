@@ -0,0 +1,254 @@
+package pages
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/johnkhk/cli_chat_app/client/app"
+)
+
+type historyTransferState int
+
+const (
+	historyMenu      historyTransferState = iota // Choose between receiving and sending
+	historyReceiving                             // Showing the code and waiting for the old device
+	historyCodeInput                             // Typing the code shown on the new device
+	historyConfirm                               // Comparing fingerprints before sending
+	historySending                               // Uploading the history
+)
+
+// HistoryTransferModel moves chat history to a new device. The new device opens a transfer
+// and shows a code; the old device enters the code, checks the fingerprint and sends.
+type HistoryTransferModel struct {
+	rpcClient              *app.RpcClient
+	terminalWidth          int
+	terminalHeight         int
+	state                  historyTransferState
+	codeInput              textinput.Model
+	transfer               *app.PendingTransfer
+	sendCode               string
+	sendFingerprint        string
+	cancelReceive          context.CancelFunc
+	statusMessage          string
+	statusIsError          bool
+	originalSelectedIdx    int
+	originalServerMessages []ChatMessage
+}
+
+func NewHistoryTransferModel(rpcClient *app.RpcClient, originalSelectedIdx int, originalServerMessages []ChatMessage) HistoryTransferModel {
+	ti := textinput.New()
+	ti.Placeholder = "Transfer code (esc to cancel)"
+	ti.CharLimit = 9
+	ti.Width = 30
+
+	return HistoryTransferModel{
+		rpcClient:              rpcClient,
+		state:                  historyMenu,
+		codeInput:              ti,
+		originalSelectedIdx:    originalSelectedIdx,
+		originalServerMessages: originalServerMessages,
+	}
+}
+
+func (m HistoryTransferModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m HistoryTransferModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmds []tea.Cmd
+
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.terminalWidth = msg.Width
+		m.terminalHeight = msg.Height
+
+	case tea.KeyMsg:
+		if m.state == historyCodeInput {
+			switch msg.String() {
+			case "enter":
+				code := strings.TrimSpace(m.codeInput.Value())
+				m.codeInput.Blur()
+				m.codeInput.SetValue("")
+				if code == "" {
+					m.state = historyMenu
+					return m, nil
+				}
+				return m, lookupHistoryTransferCmd(m.rpcClient, code)
+			case "esc":
+				m.codeInput.Blur()
+				m.codeInput.SetValue("")
+				m.state = historyMenu
+				return m, nil
+			}
+			var tiCmd tea.Cmd
+			m.codeInput, tiCmd = m.codeInput.Update(msg)
+			return m, tiCmd
+		}
+
+		switch msg.String() {
+		case "ctrl+c", "q":
+			m.rpcClient.Logger.Info("Exiting the application from history transfer")
+			return m, tea.Quit
+
+		case "r":
+			if m.state == historyMenu {
+				return m, startHistoryReceiveCmd(m.rpcClient)
+			}
+
+		case "s":
+			if m.state == historyMenu {
+				m.state = historyCodeInput
+				return m, m.codeInput.Focus()
+			}
+
+		case "enter":
+			if m.state == historyConfirm {
+				m.state = historySending
+				return m, sendHistoryCmd(m.rpcClient, m.sendCode, m.sendFingerprint)
+			}
+
+		case "esc":
+			if m.state == historyReceiving && m.cancelReceive != nil {
+				m.cancelReceive()
+				m.cancelReceive = nil
+			}
+			m.state = historyMenu
+			m.transfer = nil
+
+		case "c":
+			if m.cancelReceive != nil {
+				m.cancelReceive()
+			}
+			chatPanelModel := NewChatPanelModel(m.rpcClient)
+
+			// Initialize the chat panel (e.g., fetch friends) and get the command for it
+			chatCmd := chatPanelModel.Init()
+			chatPanelModel.friendsModel.selected = m.originalSelectedIdx
+
+			updatedChatPanelModel, updateCmd := chatPanelModel.Update(tea.WindowSizeMsg{Width: m.terminalWidth, Height: m.terminalHeight})
+			castedChatPanelModel, ok := updatedChatPanelModel.(ChatPanelModel)
+			if !ok {
+				m.rpcClient.Logger.Error("Failed to assert tea.Model to ChatPanelModel")
+				return m, nil
+			}
+			castedChatPanelModel.chatModel.serverMessages = m.originalServerMessages
+			return castedChatPanelModel, tea.Batch(chatCmd, updateCmd)
+		}
+
+	// Result messages: handle outcomes
+	case StartHistoryReceiveResultMsg:
+		if msg.Err != nil {
+			m.statusMessage = fmt.Sprintf("Failed to start transfer: %v", msg.Err)
+			m.statusIsError = true
+			cmds = append(cmds, clearStatusMessageCmd())
+			break
+		}
+		ctx, cancel := context.WithDeadline(context.Background(), msg.Transfer.ExpiresAt)
+		m.transfer = msg.Transfer
+		m.cancelReceive = cancel
+		m.state = historyReceiving
+		cmds = append(cmds, receiveHistoryCmd(ctx, m.rpcClient, msg.Transfer.Code))
+
+	case HistoryReceivedMsg:
+		if m.cancelReceive != nil {
+			m.cancelReceive()
+			m.cancelReceive = nil
+		}
+		if m.state != historyReceiving {
+			// The user cancelled the transfer.
+			break
+		}
+		m.state = historyMenu
+		m.transfer = nil
+		if msg.Err != nil {
+			m.statusMessage = fmt.Sprintf("Failed to receive history: %v", msg.Err)
+			m.statusIsError = true
+		} else {
+			m.statusMessage = fmt.Sprintf("Imported %d messages.", msg.Imported)
+			m.statusIsError = false
+		}
+		cmds = append(cmds, clearStatusMessageCmd())
+
+	case LookupHistoryTransferResultMsg:
+		if msg.Err != nil {
+			m.state = historyMenu
+			m.statusMessage = fmt.Sprintf("Failed to find transfer: %v", msg.Err)
+			m.statusIsError = true
+			cmds = append(cmds, clearStatusMessageCmd())
+			break
+		}
+		m.sendCode = msg.Code
+		m.sendFingerprint = msg.Fingerprint
+		m.state = historyConfirm
+
+	case SendHistoryResultMsg:
+		m.state = historyMenu
+		if msg.Err != nil {
+			m.statusMessage = fmt.Sprintf("Failed to send history: %v", msg.Err)
+			m.statusIsError = true
+		} else {
+			m.statusMessage = fmt.Sprintf("Sent %d messages to the new device.", msg.Sent)
+			m.statusIsError = false
+		}
+		cmds = append(cmds, clearStatusMessageCmd())
+
+	case ClearStatusMessageMsg:
+		m.statusMessage = ""
+		m.statusIsError = false
+	}
+
+	return m, tea.Batch(cmds...)
+}
+
+func (m HistoryTransferModel) View() string {
+	doc := strings.Builder{}
+	doc.WriteString(titleStyle.Render("Chat History Transfer"))
+	doc.WriteString("\n\n")
+
+	switch m.state {
+	case historyMenu:
+		doc.WriteString("Move your chat history from another device you are logged in on.\n")
+		doc.WriteString("History is encrypted to this device's identity key; the server only relays it.\n\n")
+		doc.WriteString("r: receive history on this device\n")
+		doc.WriteString("s: send history from this device to a new one\n")
+	case historyReceiving:
+		doc.WriteString("On your old device, open History Transfer, press s and enter:\n\n")
+		doc.WriteString(focusedStyle.Render(m.transfer.Code))
+		doc.WriteString("\n\nCheck that the old device shows this fingerprint:\n\n")
+		doc.WriteString(m.transfer.Fingerprint)
+		doc.WriteString(fmt.Sprintf("\n\nWaiting for history... (expires at %s)", m.transfer.ExpiresAt.Local().Format("15:04")))
+	case historyCodeInput:
+		doc.WriteString("Enter the code shown on the new device:\n\n")
+		doc.WriteString(m.codeInput.View())
+	case historyConfirm:
+		doc.WriteString("Only send if this fingerprint matches the one on the new device:\n\n")
+		doc.WriteString(focusedStyle.Render(m.sendFingerprint))
+		doc.WriteString("\n\nenter: send history | esc: cancel")
+	case historySending:
+		doc.WriteString("Sending history...")
+	}
+
+	// Render the status message if it exists
+	if m.statusMessage != "" {
+		var status string
+		if m.statusIsError {
+			status = errorMsgStyle.Render("\n\n" + m.statusMessage)
+		} else {
+			status = successMsgStyle.Render("\n\n" + m.statusMessage)
+		}
+		doc.WriteString(status)
+	}
+
+	help := helpStyle.Render("\n\nesc: back | ctrl+c: quit | c: chat")
+	doc.WriteString(help)
+
+	return docStyle.Align(lipgloss.Center).
+		Width(m.terminalWidth).
+		Height(m.terminalHeight).
+		Render(doc.String())
+}
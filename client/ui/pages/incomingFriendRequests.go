@@ -140,6 +140,13 @@ func (m incomingRequestsModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 				return m, cmd
 			}
+		case "b":
+			// Block the sender of the selected friend request, which also cancels it
+			selectedRow := m.incFriendRequestTable.Cursor()
+			if selectedRow >= 0 && selectedRow < len(m.incomingRequests) {
+				request := m.incomingRequests[selectedRow]
+				return m, blockUserCmd(m.rpcClient, request.SenderId, request.SenderUsername)
+			}
 		case "q", "ctrl+c":
 			return m, tea.Quit
 		default:
@@ -168,7 +175,7 @@ func (m incomingRequestsModel) View() string {
 	// Render the received requests table
 	view.WriteString(baseStyle.Render(m.incFriendRequestTable.View()) + "\n")
 	// Show instructions
-	view.WriteString("[ ↑/↓: navigate | 'a': Accept | 'd': Decline ]\n")
+	view.WriteString("[ ↑/↓: navigate | 'a': Accept | 'd': Decline | 'b': Block ]\n")
 
 	return view.String()
 }
@@ -0,0 +1,100 @@
+package pages
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/johnkhk/cli_chat_app/client/app"
+	"github.com/johnkhk/cli_chat_app/genproto/friends"
+)
+
+// groupInviteUses is how many people an invite made with ctrl+u can bring in.
+const groupInviteUses = 10
+
+// InvitesModel redeems invite codes from others and creates codes to share, which make whoever
+// redeems them a friend without a friend request.
+type InvitesModel struct {
+	rpcClient *app.RpcClient
+	textInput textinput.Model
+	created   []*friends.CreateInviteResponse // Invites made since the page opened, newest first
+}
+
+// NewInvitesModel creates an empty redeem box.
+func NewInvitesModel(rpcClient *app.RpcClient) InvitesModel {
+	ti := textinput.New()
+	ti.Placeholder = "Invite code"
+	ti.CharLimit = 16
+	ti.Width = 20
+	ti.Focus()
+
+	return InvitesModel{
+		rpcClient: rpcClient,
+		textInput: ti,
+	}
+}
+
+func (m InvitesModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (m InvitesModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case CreateInviteResultMsg:
+		if msg.Err == nil {
+			m.created = append([]*friends.CreateInviteResponse{msg.Invite}, m.created...)
+		}
+		return m, nil
+
+	case RedeemInviteResultMsg:
+		if msg.Err == nil && strings.TrimSpace(m.textInput.Value()) == msg.Code {
+			m.textInput.SetValue("")
+		}
+		return m, nil
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "enter":
+			if code := strings.TrimSpace(m.textInput.Value()); code != "" {
+				return m, redeemInviteCmd(m.rpcClient, code)
+			}
+			return m, nil
+		case "ctrl+n":
+			return m, createInviteCmd(m.rpcClient, 1)
+		case "ctrl+u":
+			return m, createInviteCmd(m.rpcClient, groupInviteUses)
+		case "esc":
+			m.textInput.SetValue("")
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.textInput, cmd = m.textInput.Update(msg)
+	return m, cmd
+}
+
+func (m InvitesModel) View() string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Redeem an invite:"))
+	b.WriteString("\n")
+	b.WriteString(m.textInput.View() + "\n\n")
+
+	b.WriteString(titleStyle.Render("Your invites:"))
+	b.WriteString("\n")
+	if len(m.created) == 0 {
+		b.WriteString("Create a code and share it; whoever redeems it becomes your friend.\n")
+	}
+	for _, invite := range m.created {
+		uses := "single use"
+		if invite.MaxUses > 1 {
+			uses = fmt.Sprintf("%d uses", invite.MaxUses)
+		}
+		b.WriteString(fmt.Sprintf("%s  %s, expires %s\n", invite.Code, uses, invite.ExpiresAt.AsTime().Local().Format("Jan 2 15:04")))
+	}
+
+	b.WriteString(fmt.Sprintf("\n[ enter: redeem | esc: clear | ctrl+n: new invite | ctrl+u: new invite for %d ]\n", groupInviteUses))
+	return b.String()
+}
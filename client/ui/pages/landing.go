@@ -15,6 +15,7 @@ type Choice int
 const (
 	ChoiceRegister Choice = iota
 	ChoiceLogin
+	ChoiceSwitchProfile
 )
 
 type model struct {
@@ -26,8 +27,12 @@ type model struct {
 
 // Initialize the model
 func NewLandingModel(rpcClient *app.RpcClient) model {
+	choices := []string{"Register", "Login"}
+	if rpcClient.Profiles != nil {
+		choices = append(choices, "Switch Profile")
+	}
 	return model{
-		choices:   []string{"Register", "Login"},
+		choices:   choices,
 		cursor:    ChoiceRegister,
 		selected:  -1,
 		rpcClient: rpcClient,
@@ -49,7 +54,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		// Move the cursor down
 		case "down":
-			if m.cursor < 1 {
+			if int(m.cursor) < len(m.choices)-1 {
 				m.cursor++
 			}
 
@@ -77,6 +82,8 @@ func handleSelection(m model) (tea.Model, tea.Cmd) {
 		// Here, integrate your logic for handling login
 		return NewLoginModel(m.rpcClient), nil // Switch to login page
 		// return m, tea.Quit
+	case ChoiceSwitchProfile:
+		return NewProfilePickerModel(m.rpcClient), nil
 	}
 	return m, nil
 }
@@ -96,6 +103,11 @@ func (m model) View() string {
 		s += fmt.Sprintf("%s %s\n", cursor, choice)
 	}
 
+	if m.rpcClient.Profiles != nil {
+		s += helpStyle.Render(fmt.Sprintf("\nProfile: %s", m.rpcClient.Profile))
+		s += "\n"
+	}
+
 	// s += "\nPress Enter to select, Up/Down arrows to navigate."
 	s += helpStyle.Render("\nenter: select • up/down: navigate • esc/ctrl+c: quit")
 
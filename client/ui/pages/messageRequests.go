@@ -0,0 +1,97 @@
+package pages
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/johnkhk/cli_chat_app/client/app"
+	"github.com/johnkhk/cli_chat_app/genproto/chat"
+)
+
+// MessageRequestsModel lists the users who messaged the current user without being their friend,
+// and lets them accept, reject or block each one.
+type MessageRequestsModel struct {
+	requests  []*chat.PendingMessageRequest
+	rpcClient *app.RpcClient
+	cursor    int
+}
+
+// NewMessageRequestsModel creates an empty message request list; the parent fetches its contents.
+func NewMessageRequestsModel(rpcClient *app.RpcClient) MessageRequestsModel {
+	return MessageRequestsModel{
+		requests:  []*chat.PendingMessageRequest{},
+		rpcClient: rpcClient,
+	}
+}
+
+func (m MessageRequestsModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m MessageRequestsModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case MessageRequestsMsg:
+		if msg.Err != nil {
+			m.rpcClient.Logger.Errorf("Error fetching message requests: %v", msg.Err)
+		} else {
+			m.requests = msg.Requests
+			if m.cursor >= len(m.requests) {
+				m.cursor = max(len(m.requests)-1, 0)
+			}
+		}
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.requests)-1 {
+				m.cursor++
+			}
+		case "a":
+			// Accept the selected request, which also makes the sender a friend
+			if m.cursor < len(m.requests) {
+				req := m.requests[m.cursor]
+				return m, acceptMessageRequestCmd(m.rpcClient, req.SenderId, req.SenderUsername)
+			}
+		case "d":
+			// Reject the selected request, dropping its messages unread
+			if m.cursor < len(m.requests) {
+				req := m.requests[m.cursor]
+				return m, rejectMessageRequestCmd(m.rpcClient, req.SenderId, req.SenderUsername)
+			}
+		case "b":
+			// Block the sender, which drops their messages too
+			if m.cursor < len(m.requests) {
+				req := m.requests[m.cursor]
+				return m, blockUserCmd(m.rpcClient, int32(req.SenderId), req.SenderUsername)
+			}
+		case "ctrl+c", "q":
+			return m, tea.Quit
+		}
+	}
+
+	return m, nil
+}
+
+func (m MessageRequestsModel) View() string {
+	if len(m.requests) == 0 {
+		return "No message requests."
+	}
+
+	var b strings.Builder
+	b.WriteString("Messages from people who are not your friends:\n\n")
+	for i, req := range m.requests {
+		cursor := " "
+		if m.cursor == i {
+			cursor = ">"
+		}
+		b.WriteString(fmt.Sprintf("%s %s (%d message(s), last at %s)\n", cursor, req.SenderUsername, req.MessageCount, req.LastReceivedAt))
+	}
+	b.WriteString("\n[ ↑/↓: navigate | 'a': Accept | 'd': Reject | 'b': Block ]\n")
+	return b.String()
+}
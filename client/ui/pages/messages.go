@@ -2,12 +2,20 @@
 
 package pages
 
-import "github.com/johnkhk/cli_chat_app/genproto/friends"
+import (
+	"github.com/johnkhk/cli_chat_app/client/app"
+	"github.com/johnkhk/cli_chat_app/client/e2ee/store"
+	"github.com/johnkhk/cli_chat_app/genproto/chat"
+	"github.com/johnkhk/cli_chat_app/genproto/friends"
+)
 
 // Data Messages (used to pass data to child models)
 type FriendListMsg struct {
-	Friends []*friends.Friend // Actual Friend type from proto
-	Err     error
+	Friends  []*friends.Friend                     // Actual Friend type from proto, pinned conversations first
+	Profiles map[uint32]*app.UserProfile           // Profiles of the friends who shared them, by user ID
+	Settings map[uint32]store.ConversationSettings // Nicknames and pins kept on this device, by user ID
+	Sort     friends.FriendListSort                // Order the list was fetched in
+	Err      error
 }
 
 type IncomingFriendRequestsMsg struct {
@@ -20,6 +28,43 @@ type OutgoingFriendRequestsMsg struct {
 	Err      error
 }
 
+type BlockedUsersMsg struct {
+	Users []*friends.BlockedUser
+	Err   error
+}
+
+// MessageRequestsMsg carries the messages from non-friends waiting for the current user to accept or reject them.
+type MessageRequestsMsg struct {
+	Requests []*chat.PendingMessageRequest
+	Err      error
+}
+
+// SearchUsersResultMsg carries a page of users matching Query, starting at Offset.
+type SearchUsersResultMsg struct {
+	Query   string
+	Offset  uint32
+	Users   []*friends.UserSearchResult
+	HasMore bool
+	Err     error
+}
+
+type PrivacySettingsMsg struct {
+	Settings *friends.PrivacySettings
+	Err      error
+}
+
+// OwnProfileMsg carries the current user's profile, nil if they have not set one.
+type OwnProfileMsg struct {
+	Profile *app.UserProfile
+	Err     error
+}
+
+// MutedConversationsMsg carries the IDs of the users whose conversations are muted on this device.
+type MutedConversationsMsg struct {
+	Muted map[uint32]bool
+	Err   error
+}
+
 // Action Messages (sent from child models to parent model to request an action)
 type SendFriendRequestMsg struct {
 	RecipientUsername string
@@ -53,11 +98,85 @@ type DeclineFriendRequestResultMsg struct {
 	Err       error
 }
 
+type CancelFriendRequestResultMsg struct {
+	RequestID         int32
+	RecipientUsername string
+	Err               error
+}
+
+type CreateInviteResultMsg struct {
+	Invite *friends.CreateInviteResponse
+	Err    error
+}
+
+type RedeemInviteResultMsg struct {
+	Code   string
+	Friend *friends.Friend // The invite's creator, now a friend
+	Err    error
+}
+
 type RemoveFriendResultMsg struct {
 	FriendID int32
 	Err      error
 }
 
+type BlockUserResultMsg struct {
+	UserID   int32
+	Username string
+	Err      error
+}
+
+type UnblockUserResultMsg struct {
+	UserID   int32
+	Username string
+	Err      error
+}
+
+type AcceptMessageRequestResultMsg struct {
+	SenderID uint32
+	Username string
+	Err      error
+}
+
+type RejectMessageRequestResultMsg struct {
+	SenderID uint32
+	Username string
+	Err      error
+}
+
+type SetDiscoverableResultMsg struct {
+	Discoverable bool
+	Err          error
+}
+
+type UpdateProfileResultMsg struct {
+	Profile *app.UserProfile
+	Err     error
+}
+
+type MuteConversationResultMsg struct {
+	UserID uint32
+	Muted  bool
+	Err    error
+}
+
+type PinConversationResultMsg struct {
+	UserID uint32
+	Pinned bool
+	Err    error
+}
+
+type SetNicknameResultMsg struct {
+	UserID   uint32
+	Nickname string
+	Err      error
+}
+
+// FriendEventMsg carries a friend event pushed by the server to whichever page is showing.
+type FriendEventMsg struct {
+	Event *friends.FriendEvent
+}
+
 type FriendSelectedMsg struct {
 	UserID   int32
 	Username string
@@ -70,3 +189,31 @@ type OpenFileMenuMsg struct {
 }
 
 type BackMsg struct{}
+
+// History transfer messages
+type StartHistoryReceiveResultMsg struct {
+	Transfer *app.PendingTransfer
+	Err      error
+}
+
+type HistoryReceivedMsg struct {
+	Imported int
+	Err      error
+}
+
+type LookupHistoryTransferResultMsg struct {
+	Code        string
+	Fingerprint string
+	Err         error
+}
+
+type SendHistoryResultMsg struct {
+	Sent int
+	Err  error
+}
+
+// Store unlock messages
+type UnlockStoreResultMsg struct {
+	Vault *store.Vault
+	Err   error
+}
@@ -135,6 +135,13 @@ func (m outgoingRequestsModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.textInput.Focus()
 				m.sentRequestsTable.Blur()
 				return m, textinput.Blink
+			case "d":
+				// Cancel the selected friend request
+				selectedRow := m.sentRequestsTable.Cursor()
+				if selectedRow >= 0 && selectedRow < len(m.outgoingRequests) {
+					return m, cancelFriendRequestCmd(m.rpcClient, m.outgoingRequests[selectedRow])
+				}
+				return m, nil
 			case "q", "ctrl+c":
 				return m, tea.Quit
 			default:
@@ -174,7 +181,7 @@ func (m outgoingRequestsModel) View() string {
 	if m.showInput {
 		view.WriteString(m.textInput.View() + "\n")
 	} else {
-		view.WriteString("[ Press 'a' to Add Friend ]\n")
+		view.WriteString("[ Press 'a' to Add Friend | 'd' to Cancel Request ]\n")
 	}
 
 	return view.String()
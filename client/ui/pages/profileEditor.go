@@ -0,0 +1,164 @@
+package pages
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/johnkhk/cli_chat_app/client/app"
+)
+
+const (
+	displayNameField = iota
+	statusField
+	avatarField
+)
+
+// ProfileEditorModel edits the current user's profile, which only their friends can read.
+type ProfileEditorModel struct {
+	rpcClient *app.RpcClient
+	inputs    []textinput.Model // Display name, status and a path to a new avatar
+	focused   int
+	avatar    []byte // The avatar already in the profile, kept unless a new file is given
+	loaded    bool
+	err       string // Why the profile could not be saved, shown until the next edit
+}
+
+// NewProfileEditorModel creates an empty editor; the parent fetches the profile to fill it.
+func NewProfileEditorModel(rpcClient *app.RpcClient) ProfileEditorModel {
+	inputs := make([]textinput.Model, 3)
+
+	inputs[displayNameField] = textinput.New()
+	inputs[displayNameField].Placeholder = "Display name"
+	inputs[displayNameField].CharLimit = app.MaxDisplayNameLength
+	inputs[displayNameField].Width = 40
+	inputs[displayNameField].Focus()
+
+	inputs[statusField] = textinput.New()
+	inputs[statusField].Placeholder = "Status or short bio"
+	inputs[statusField].CharLimit = app.MaxStatusLength
+	inputs[statusField].Width = 40
+
+	inputs[avatarField] = textinput.New()
+	inputs[avatarField].Placeholder = "Path to a new avatar image"
+	inputs[avatarField].Width = 40
+
+	return ProfileEditorModel{
+		rpcClient: rpcClient,
+		inputs:    inputs,
+	}
+}
+
+func (m ProfileEditorModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (m ProfileEditorModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case OwnProfileMsg:
+		if msg.Err != nil {
+			m.rpcClient.Logger.Errorf("Error fetching profile: %v", msg.Err)
+			return m, nil
+		}
+		m.loaded = true
+		if msg.Profile != nil {
+			m.inputs[displayNameField].SetValue(msg.Profile.DisplayName)
+			m.inputs[statusField].SetValue(msg.Profile.Status)
+			m.avatar = msg.Profile.Avatar
+		}
+
+	case UpdateProfileResultMsg:
+		if msg.Err == nil {
+			m.avatar = msg.Profile.Avatar
+			m.inputs[avatarField].SetValue("")
+		}
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "up":
+			m.setFocus((m.focused - 1 + len(m.inputs)) % len(m.inputs))
+			return m, nil
+		case "down":
+			m.setFocus((m.focused + 1) % len(m.inputs))
+			return m, nil
+		case "ctrl+x":
+			// Remove the avatar on the next save
+			m.avatar = nil
+			m.inputs[avatarField].SetValue("")
+			return m, nil
+		case "enter":
+			profile, err := m.profile()
+			if err != nil {
+				m.err = err.Error()
+				return m, nil
+			}
+			m.err = ""
+			return m, updateProfileCmd(m.rpcClient, profile)
+		}
+
+		m.err = ""
+		var cmd tea.Cmd
+		m.inputs[m.focused], cmd = m.inputs[m.focused].Update(msg)
+		return m, cmd
+
+	default:
+		var cmd tea.Cmd
+		m.inputs[m.focused], cmd = m.inputs[m.focused].Update(msg)
+		return m, cmd
+	}
+
+	return m, nil
+}
+
+func (m *ProfileEditorModel) setFocus(field int) {
+	m.inputs[m.focused].Blur()
+	m.focused = field
+	m.inputs[m.focused].Focus()
+}
+
+// profile builds the profile to save from the inputs, reading the new avatar if one was given.
+func (m ProfileEditorModel) profile() (*app.UserProfile, error) {
+	profile := &app.UserProfile{
+		DisplayName: m.inputs[displayNameField].Value(),
+		Status:      m.inputs[statusField].Value(),
+		Avatar:      m.avatar,
+	}
+	if path := strings.TrimSpace(m.inputs[avatarField].Value()); path != "" {
+		avatar, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read avatar: %w", err)
+		}
+		profile.Avatar = avatar
+	}
+	return profile, profile.Validate()
+}
+
+func (m ProfileEditorModel) View() string {
+	if !m.loaded {
+		return "Loading profile..."
+	}
+
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Your profile:"))
+	b.WriteString("\n\n")
+	b.WriteString(m.inputs[displayNameField].View() + "\n")
+	b.WriteString(m.inputs[statusField].View() + "\n")
+	b.WriteString(m.inputs[avatarField].View() + "\n\n")
+
+	if len(m.avatar) > 0 {
+		b.WriteString(fmt.Sprintf("Current avatar: %.1f KiB\n", float64(len(m.avatar))/1024))
+	} else {
+		b.WriteString("No avatar set.\n")
+	}
+	b.WriteString(blurredStyle.Render("Only your friends can see your profile."))
+	b.WriteString("\n")
+	if m.err != "" {
+		b.WriteString(errorMsgStyle.Render(m.err) + "\n")
+	}
+
+	b.WriteString("\n[ ↑/↓: switch field | enter: save | ctrl+x: remove avatar ]\n")
+	return b.String()
+}
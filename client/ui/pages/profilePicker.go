@@ -0,0 +1,245 @@
+package pages
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/johnkhk/cli_chat_app/client/app"
+	"github.com/johnkhk/cli_chat_app/client/ui/ascii"
+)
+
+// ProfilePickerModel lists the server profiles and lets the user switch to one or add a new one.
+// Switching quits the program with the chosen profile, and the client restarts on it.
+type ProfilePickerModel struct {
+	rpcClient  *app.RpcClient
+	names      []string
+	cursor     int
+	adding     bool
+	focusIndex int
+	inputs     []textinput.Model
+	tlsEnabled bool
+	errorMsg   string
+	switchTo   string
+}
+
+func NewProfilePickerModel(rpcClient *app.RpcClient) ProfilePickerModel {
+	m := ProfilePickerModel{
+		rpcClient: rpcClient,
+		names:     rpcClient.Profiles.Names(),
+		inputs:    make([]textinput.Model, 2),
+	}
+	for i, name := range m.names {
+		if name == rpcClient.Profile {
+			m.cursor = i
+		}
+	}
+
+	for i := range m.inputs {
+		t := textinput.New()
+		t.Cursor.Style = cursorStyle
+		t.CharLimit = 64
+		switch i {
+		case 0:
+			t.Placeholder = "Profile name"
+			t.CharLimit = 32
+		case 1:
+			t.Placeholder = "Server address (host:port)"
+		}
+		m.inputs[i] = t
+	}
+	return m
+}
+
+// SwitchTo returns the profile the user chose to switch to, or "" if they did not switch.
+func (m ProfilePickerModel) SwitchTo() string {
+	return m.switchTo
+}
+
+func (m ProfilePickerModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m ProfilePickerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+	if m.adding {
+		return m.updateAdding(keyMsg)
+	}
+
+	switch keyMsg.String() {
+	case "ctrl+c", "q":
+		m.rpcClient.Logger.Info("Exiting the application from profile picker")
+		return m, tea.Quit
+
+	case "up":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+
+	case "down":
+		if m.cursor < len(m.names)-1 {
+			m.cursor++
+		}
+
+	case "n":
+		m.adding = true
+		m.errorMsg = ""
+		return m, m.setFocus(0)
+
+	case "esc":
+		return NewLandingModel(m.rpcClient), nil
+
+	case "enter":
+		name := m.names[m.cursor]
+		if name == m.rpcClient.Profile {
+			return NewLandingModel(m.rpcClient), nil
+		}
+		m.rpcClient.Profiles.Default = name
+		if err := m.rpcClient.Profiles.Save(); err != nil {
+			m.rpcClient.Logger.Errorf("Failed to remember profile %s: %v", name, err)
+		}
+		m.rpcClient.Logger.Infof("Switching to profile %s", name)
+		m.switchTo = name
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+func (m ProfilePickerModel) updateAdding(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+
+	case "esc":
+		m.adding = false
+		m.errorMsg = ""
+		for i := range m.inputs {
+			m.inputs[i].Blur()
+			m.inputs[i].SetValue("")
+		}
+		return m, nil
+
+	case "ctrl+t":
+		m.tlsEnabled = !m.tlsEnabled
+		return m, nil
+
+	case "tab", "down":
+		return m, m.setFocus((m.focusIndex + 1) % len(m.inputs))
+
+	case "shift+tab", "up":
+		return m, m.setFocus((m.focusIndex + len(m.inputs) - 1) % len(m.inputs))
+
+	case "enter":
+		if m.focusIndex < len(m.inputs)-1 {
+			return m, m.setFocus(m.focusIndex + 1)
+		}
+		name := strings.TrimSpace(m.inputs[0].Value())
+		address := strings.TrimSpace(m.inputs[1].Value())
+		if address == "" {
+			m.errorMsg = "Server address must not be empty"
+			return m, nil
+		}
+		profile := &app.Profile{ServerAddress: address, TLS: app.TLSConfig{Enabled: m.tlsEnabled}}
+		if err := m.rpcClient.Profiles.Add(name, profile); err != nil {
+			m.errorMsg = err.Error()
+			return m, nil
+		}
+		if err := m.rpcClient.Profiles.Save(); err != nil {
+			delete(m.rpcClient.Profiles.Profiles, name)
+			m.errorMsg = err.Error()
+			return m, nil
+		}
+		m.rpcClient.Logger.Infof("Added profile %s for %s", name, address)
+
+		m.adding = false
+		m.errorMsg = ""
+		m.tlsEnabled = false
+		for i := range m.inputs {
+			m.inputs[i].Blur()
+			m.inputs[i].SetValue("")
+		}
+		m.names = m.rpcClient.Profiles.Names()
+		for i, n := range m.names {
+			if n == name {
+				m.cursor = i
+			}
+		}
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.inputs[m.focusIndex], cmd = m.inputs[m.focusIndex].Update(msg)
+	return m, cmd
+}
+
+func (m *ProfilePickerModel) setFocus(index int) tea.Cmd {
+	m.focusIndex = index
+	cmds := make([]tea.Cmd, len(m.inputs))
+	for i := range m.inputs {
+		if i == index {
+			cmds[i] = m.inputs[i].Focus()
+			m.inputs[i].PromptStyle = focusedStyle
+			m.inputs[i].TextStyle = focusedStyle
+		} else {
+			m.inputs[i].Blur()
+			m.inputs[i].PromptStyle = noStyle
+			m.inputs[i].TextStyle = noStyle
+		}
+	}
+	return tea.Batch(cmds...)
+}
+
+func (m ProfilePickerModel) View() string {
+	var b strings.Builder
+
+	b.WriteString(logoStyle.Render(ascii.Logo))
+	b.WriteString("\n\n")
+
+	if m.adding {
+		b.WriteString(titleStyle.Render("New Profile"))
+		b.WriteString("\n\n")
+		for i := range m.inputs {
+			b.WriteString(m.inputs[i].View())
+			b.WriteRune('\n')
+		}
+		tls := "off"
+		if m.tlsEnabled {
+			tls = "on"
+		}
+		b.WriteString(fmt.Sprintf("TLS: %s\n", tls))
+		if m.errorMsg != "" {
+			b.WriteString(errorMsgStyle.Render("\n" + m.errorMsg))
+		}
+		b.WriteString(helpStyle.Render("\nenter: save • tab: next field • ctrl+t: toggle TLS • esc: cancel"))
+		return b.String()
+	}
+
+	b.WriteString(titleStyle.Render("Choose a profile:"))
+	b.WriteString("\n\n")
+	for i, name := range m.names {
+		cursor := " "
+		if i == m.cursor {
+			cursor = ">"
+		}
+		address := m.rpcClient.Profiles.Profiles[name].ServerAddress
+		if address == "" {
+			address = "SERVER_ADDRESS"
+		}
+		line := fmt.Sprintf("%s %s (%s)", cursor, name, address)
+		if m.rpcClient.Profiles.Profiles[name].TLS.Enabled {
+			line += " [TLS]"
+		}
+		if name == m.rpcClient.Profile {
+			line = focusedStyle.Render(line + " • current")
+		}
+		b.WriteString(line + "\n")
+	}
+
+	b.WriteString(helpStyle.Render("\nenter: switch • n: new profile • esc: back • q/ctrl+c: quit"))
+	return b.String()
+}
@@ -1,6 +1,7 @@
 package pages
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -19,12 +20,13 @@ type registerModel struct {
 	cursorMode cursor.Mode
 	rpcClient  *app.RpcClient
 	errorMsg   string // Add a field for the error message
+	noticeMsg  string // Shown instead of moving on when the account waits for approval
 }
 
 // NewRegisterModel initializes the register component
 func NewRegisterModel(rpcClient *app.RpcClient) registerModel {
 	m := registerModel{
-		inputs:     make([]textinput.Model, 2),
+		inputs:     make([]textinput.Model, 3),
 		buttons:    []string{"Submit", "Back"},
 		rpcClient:  rpcClient,
 		cursorMode: cursor.CursorBlink,
@@ -48,6 +50,9 @@ func NewRegisterModel(rpcClient *app.RpcClient) registerModel {
 			t.EchoMode = textinput.EchoPassword
 			t.EchoCharacter = '•'
 			t.CharLimit = 64
+		case 2:
+			t.Placeholder = "Invite code (optional)"
+			t.CharLimit = 16
 		}
 
 		m.inputs[i] = t
@@ -66,9 +71,16 @@ func (m registerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case errMsg:
 		m.errorMsg = msg.err.Error() // Set the error message to display
+		m.noticeMsg = ""
 		return m, nil
 
 	case registerRespMsg:
+		if msg.pending {
+			m.rpcClient.Logger.Infof("User %s registered and is waiting for approval", m.inputs[0].Value())
+			m.errorMsg = ""
+			m.noticeMsg = "Account created. An administrator has to approve it before you can log in."
+			return m, nil
+		}
 		m.rpcClient.Logger.Infof("User registered successfully: %s", m.inputs[0].Value())
 		// Go to log in page
 		return NewLoginModel(m.rpcClient), nil
@@ -85,8 +97,8 @@ func (m registerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if s == "enter" {
 				if m.focusIndex == len(m.inputs) {
 					// Submit button logic here
-					username, pasword := m.inputs[0].Value(), m.inputs[1].Value()
-					return m, registerUserCmd(m.rpcClient, username, pasword)
+					username, pasword, inviteCode := m.inputs[0].Value(), m.inputs[1].Value(), m.inputs[2].Value()
+					return m, registerUserCmd(m.rpcClient, username, pasword, inviteCode)
 					// return m, tea.Quit
 				} else if m.focusIndex == len(m.inputs)+1 {
 					// Back button logic here
@@ -176,6 +188,9 @@ func (m registerModel) View() string {
 	if m.errorMsg != "" {
 		b.WriteString(errorMsgStyle.Render(m.errorMsg))
 	}
+	if m.noticeMsg != "" {
+		b.WriteString(successMsgStyle.Render(m.noticeMsg))
+	}
 
 	// Render help text
 	// b.WriteString(helpStyle.Render("cursor mode is "))
@@ -186,9 +201,12 @@ func (m registerModel) View() string {
 	return b.String()
 }
 
-func registerUserCmd(rpcClient *app.RpcClient, username, password string) tea.Cmd {
+func registerUserCmd(rpcClient *app.RpcClient, username, password, inviteCode string) tea.Cmd {
 	return func() tea.Msg {
-		err := rpcClient.AuthClient.RegisterUser(username, password)
+		err := rpcClient.AuthClient.RegisterUserWithInvite(username, password, strings.TrimSpace(inviteCode))
+		if errors.Is(err, app.ErrRegistrationPending) {
+			return registerRespMsg{pending: true}
+		}
 		if err != nil {
 			return errMsg{err: err}
 		}
@@ -196,4 +214,6 @@ func registerUserCmd(rpcClient *app.RpcClient, username, password string) tea.Cm
 	}
 }
 
-type registerRespMsg struct{}
+type registerRespMsg struct {
+	pending bool // The account waits for an administrator's approval
+}
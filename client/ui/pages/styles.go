@@ -16,6 +16,16 @@ var (
 	cursorModeHelpStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("244"))
 	errorMsgStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("196")) // Red color for error messages
 	successMsgStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("76"))  // Green color for success messages
+	botTagStyle         = lipgloss.NewStyle().Foreground(lipgloss.Color("39"))  // Blue tag after bot accounts in friend lists
+
+	// Badge counting pending friend requests in the chat panel
+	badgeStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("0")).Background(lipgloss.Color("214")).Padding(0, 1)
+
+	// Markers after conversations in the chat friend list
+	unreadStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("214"))
+	mutedTagStyle = blurredStyle
+	pinnedStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+	onlineStyle   = successMsgStyle
 
 	// Logo Style
 	logoStyle = lipgloss.NewStyle().
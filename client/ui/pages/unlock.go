@@ -0,0 +1,197 @@
+package pages
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/johnkhk/cli_chat_app/client/app"
+	"github.com/johnkhk/cli_chat_app/client/e2ee/store"
+	"github.com/johnkhk/cli_chat_app/client/ui/ascii"
+)
+
+// UnlockModel asks for the passphrase of the encrypted local store before anything else runs.
+// When no store exists yet, it asks the user to choose a passphrase and confirm it instead.
+type UnlockModel struct {
+	focusIndex int
+	inputs     []textinput.Model
+	cursorMode cursor.Mode
+	unlocker   *app.StoreUnlocker
+	setup      bool
+	unlocking  bool
+	errorMsg   string
+	vault      *store.Vault
+}
+
+func NewUnlockModel(unlocker *app.StoreUnlocker) UnlockModel {
+	m := UnlockModel{
+		cursorMode: cursor.CursorBlink,
+		unlocker:   unlocker,
+		setup:      unlocker.NeedsSetup(),
+	}
+
+	count := 1
+	if m.setup {
+		count = 2
+	}
+	m.inputs = make([]textinput.Model, count)
+	for i := range m.inputs {
+		t := textinput.New()
+		t.Cursor.Style = cursorStyle
+		t.CharLimit = 128
+		t.EchoMode = textinput.EchoPassword
+		t.EchoCharacter = '•'
+
+		switch i {
+		case 0:
+			t.Placeholder = "Passphrase"
+			t.Focus()
+			t.PromptStyle = focusedStyle
+			t.TextStyle = focusedStyle
+		case 1:
+			t.Placeholder = "Confirm passphrase"
+		}
+
+		m.inputs[i] = t
+	}
+
+	return m
+}
+
+// Vault returns the unlocked store, or nil if the user quit without unlocking it.
+func (m UnlockModel) Vault() *store.Vault {
+	return m.vault
+}
+
+func (m UnlockModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (m UnlockModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case UnlockStoreResultMsg:
+		m.unlocking = false
+		if msg.Err != nil {
+			m.errorMsg = fmt.Sprintf("Failed to unlock: %v", msg.Err)
+			for i := range m.inputs {
+				m.inputs[i].SetValue("")
+			}
+			return m, nil
+		}
+		m.vault = msg.Vault
+		return m, tea.Quit
+
+	case tea.KeyMsg:
+		if m.unlocking {
+			return m, nil
+		}
+
+		switch msg.String() {
+		case "ctrl+c", "esc":
+			return m, tea.Quit
+
+		case "enter":
+			if m.focusIndex < len(m.inputs)-1 {
+				return m, m.setFocus(m.focusIndex + 1)
+			}
+			passphrase := m.inputs[0].Value()
+			if passphrase == "" {
+				m.errorMsg = "Passphrase must not be empty"
+				return m, nil
+			}
+			if m.setup && passphrase != m.inputs[1].Value() {
+				m.errorMsg = "Passphrases do not match"
+				m.inputs[1].SetValue("")
+				return m, nil
+			}
+			m.errorMsg = ""
+			m.unlocking = true
+			return m, unlockStoreCmd(m.unlocker, passphrase)
+
+		case "tab", "down":
+			if m.focusIndex < len(m.inputs)-1 {
+				return m, m.setFocus(m.focusIndex + 1)
+			}
+			return m, nil
+
+		case "shift+tab", "up":
+			if m.focusIndex > 0 {
+				return m, m.setFocus(m.focusIndex - 1)
+			}
+			return m, nil
+		}
+	}
+
+	cmds := make([]tea.Cmd, len(m.inputs))
+	for i := range m.inputs {
+		m.inputs[i], cmds[i] = m.inputs[i].Update(msg)
+	}
+	return m, tea.Batch(cmds...)
+}
+
+func (m *UnlockModel) setFocus(index int) tea.Cmd {
+	m.focusIndex = index
+	cmds := make([]tea.Cmd, len(m.inputs))
+	for i := range m.inputs {
+		if i == index {
+			cmds[i] = m.inputs[i].Focus()
+			m.inputs[i].PromptStyle = focusedStyle
+			m.inputs[i].TextStyle = focusedStyle
+		} else {
+			m.inputs[i].Blur()
+			m.inputs[i].PromptStyle = noStyle
+			m.inputs[i].TextStyle = noStyle
+		}
+	}
+	return tea.Batch(cmds...)
+}
+
+func (m UnlockModel) View() string {
+	var b strings.Builder
+
+	b.WriteString(logoStyle.Render(ascii.Logo))
+	b.WriteString("\n\n")
+	if m.setup {
+		b.WriteString(titleStyle.Render("Protect Your Local Data"))
+		b.WriteString("\n\n")
+		b.WriteString("Your keys and chat history are encrypted on this device.\n")
+		b.WriteString("Choose a passphrase to unlock them. It cannot be recovered if lost.\n")
+		if m.unlocker.HasPlaintextStore() {
+			b.WriteString("Your existing data will be encrypted with it.\n")
+		}
+	} else {
+		b.WriteString(titleStyle.Render("Unlock"))
+		b.WriteString("\n\n")
+		b.WriteString("Enter the passphrase for your local data.\n")
+	}
+	b.WriteString("\n")
+
+	for i := range m.inputs {
+		b.WriteString(m.inputs[i].View())
+		if i < len(m.inputs)-1 {
+			b.WriteRune('\n')
+		}
+	}
+	b.WriteString("\n\n")
+
+	if m.unlocking {
+		b.WriteString("Unlocking...\n")
+	}
+	if m.errorMsg != "" {
+		b.WriteString(errorMsgStyle.Render(m.errorMsg))
+	}
+
+	b.WriteString(helpStyle.Render("\nenter: unlock | esc/ctrl+c: quit"))
+
+	return b.String()
+}
+
+func unlockStoreCmd(unlocker *app.StoreUnlocker, passphrase string) tea.Cmd {
+	return func() tea.Msg {
+		vault, err := unlocker.Unlock(passphrase)
+		return UnlockStoreResultMsg{Vault: vault, Err: err}
+	}
+}
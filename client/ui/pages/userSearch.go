@@ -0,0 +1,213 @@
+package pages
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/johnkhk/cli_chat_app/client/app"
+	"github.com/johnkhk/cli_chat_app/genproto/friends"
+)
+
+// searchDelay is how long typing has to pause before the search box asks the server,
+// so a fast typist sends one search rather than one per key.
+const searchDelay = 300 * time.Millisecond
+
+// searchTickMsg fires searchDelay after a keystroke; only the latest keystroke's tick searches.
+type searchTickMsg struct {
+	seq int
+}
+
+// UserSearchModel finds users as you type their name and sends them friend requests.
+// It also shows and toggles whether others can find you the same way.
+type UserSearchModel struct {
+	rpcClient    *app.RpcClient
+	textInput    textinput.Model
+	seq          int // Bumped on each edit, so stale ticks and results are ignored
+	results      []*friends.UserSearchResult
+	hasMore      bool
+	loadingMore  bool
+	cursor       int
+	discoverable *bool // Nil until the settings are fetched
+}
+
+// NewUserSearchModel creates an empty search box; the parent fetches the privacy settings.
+func NewUserSearchModel(rpcClient *app.RpcClient) UserSearchModel {
+	ti := textinput.New()
+	ti.Placeholder = "Search by username"
+	ti.CharLimit = 64
+	ti.Width = 30
+	ti.Focus()
+
+	return UserSearchModel{
+		rpcClient: rpcClient,
+		textInput: ti,
+	}
+}
+
+func (m UserSearchModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+// query is the search the box currently asks for.
+func (m UserSearchModel) query() string {
+	return strings.TrimSpace(m.textInput.Value())
+}
+
+func (m UserSearchModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case searchTickMsg:
+		if msg.seq != m.seq || m.query() == "" {
+			return m, nil
+		}
+		return m, searchUsersCmd(m.rpcClient, m.query(), 0)
+
+	case SearchUsersResultMsg:
+		// Results of an older query, or a page already added, are dropped
+		if msg.Query != m.query() || (msg.Offset != 0 && int(msg.Offset) != len(m.results)) {
+			return m, nil
+		}
+		m.loadingMore = false
+		if msg.Err != nil {
+			m.rpcClient.Logger.Errorf("Error searching users: %v", msg.Err)
+			return m, nil
+		}
+		if msg.Offset == 0 {
+			m.results = msg.Users
+			m.cursor = 0
+		} else {
+			m.results = append(m.results, msg.Users...)
+		}
+		m.hasMore = msg.HasMore
+
+	case PrivacySettingsMsg:
+		if msg.Err != nil {
+			m.rpcClient.Logger.Errorf("Error fetching privacy settings: %v", msg.Err)
+		} else if msg.Settings != nil {
+			discoverable := msg.Settings.Discoverable
+			m.discoverable = &discoverable
+		}
+
+	case SetDiscoverableResultMsg:
+		if msg.Err == nil {
+			discoverable := msg.Discoverable
+			m.discoverable = &discoverable
+		}
+
+	case SendFriendRequestResultMsg:
+		if msg.Err == nil {
+			for _, user := range m.results {
+				if user.Username == msg.RecipientUsername {
+					user.RequestPending = true
+				}
+			}
+		}
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "up":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+			return m, nil
+		case "down":
+			if m.cursor < len(m.results)-1 {
+				m.cursor++
+			}
+			// Reaching the end of the list loads the next page
+			if m.cursor == len(m.results)-1 && m.hasMore && !m.loadingMore {
+				m.loadingMore = true
+				return m, searchUsersCmd(m.rpcClient, m.query(), uint32(len(m.results)))
+			}
+			return m, nil
+		case "enter":
+			if m.cursor < len(m.results) {
+				user := m.results[m.cursor]
+				if !user.IsFriend && !user.RequestPending {
+					return m, sendFriendRequestCmd(m.rpcClient, user.Username)
+				}
+			}
+			return m, nil
+		case "ctrl+p":
+			if m.discoverable != nil {
+				return m, setDiscoverableCmd(m.rpcClient, !*m.discoverable)
+			}
+			return m, nil
+		case "esc":
+			m.textInput.SetValue("")
+			m.results, m.hasMore, m.cursor = nil, false, 0
+			m.seq++
+			return m, nil
+		}
+
+		before := m.textInput.Value()
+		var cmd tea.Cmd
+		m.textInput, cmd = m.textInput.Update(msg)
+		if m.textInput.Value() == before {
+			return m, cmd
+		}
+		m.seq++
+		if m.query() == "" {
+			m.results, m.hasMore, m.cursor = nil, false, 0
+			return m, cmd
+		}
+		seq := m.seq
+		return m, tea.Batch(cmd, tea.Tick(searchDelay, func(time.Time) tea.Msg {
+			return searchTickMsg{seq: seq}
+		}))
+
+	default:
+		var cmd tea.Cmd
+		m.textInput, cmd = m.textInput.Update(msg)
+		return m, cmd
+	}
+
+	return m, nil
+}
+
+func (m UserSearchModel) View() string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Find people:"))
+	b.WriteString("\n")
+	b.WriteString(m.textInput.View() + "\n\n")
+
+	switch {
+	case m.query() == "":
+		b.WriteString("Type part of a username.\n")
+	case len(m.results) == 0:
+		b.WriteString("No users found.\n")
+	default:
+		for i, user := range m.results {
+			cursor := " "
+			if m.cursor == i {
+				cursor = ">"
+			}
+			name := user.Username
+			if user.IsBot {
+				name += " [bot]"
+			}
+			switch {
+			case user.IsFriend:
+				name += " (friend)"
+			case user.RequestPending:
+				name += " (request pending)"
+			}
+			b.WriteString(fmt.Sprintf("%s %s\n", cursor, name))
+		}
+		if m.hasMore {
+			b.WriteString("  ...\n")
+		}
+	}
+
+	discoverable := "..."
+	if m.discoverable != nil && *m.discoverable {
+		discoverable = "on"
+	} else if m.discoverable != nil {
+		discoverable = "off"
+	}
+	b.WriteString(fmt.Sprintf("\n[ ↑/↓: navigate | enter: send friend request | esc: clear | ctrl+p: discoverable (%s) ]\n", discoverable))
+	return b.String()
+}
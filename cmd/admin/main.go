@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joho/godotenv"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+
+	"github.com/johnkhk/cli_chat_app/server/storage"
+)
+
+const usage = `Usage: cli_chat_admin <command> [args]
+
+Administers the chat server's database. DATABASE_URL is read from the environment or the file
+named by ENV_PATH (default .env), like the server does.
+
+Commands:
+  users                          List accounts
+  pending                        List accounts waiting for approval (REGISTRATION_MODE=approval)
+  approve <username>             Let an account waiting for approval log in
+  reject <username>              Delete an account waiting for approval
+  lock <username>                Lock an account and end its sessions
+  unlock <username>              Unlock an account
+  logout <username>              Revoke every token issued to an account
+  reset-password <username>      Set a new password (read from the terminal or stdin) and end its sessions
+  queue                          Show messages waiting for offline users, as last reported by the server
+  purge-prekeys [--inactive d]   Delete prekey bundles of locked accounts inactive for longer than d (default 2160h)
+  migrate [up | down [n] | status]
+                                 Apply pending schema migrations, revert the latest n (default 1), or list them
+`
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(flag.CommandLine.Output(), usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := loadEnv(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := run(flag.Arg(0), flag.Args()[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// loadEnv loads the same env file as the server, if there is one.
+func loadEnv() error {
+	envPath := os.Getenv("ENV_PATH")
+	if envPath == "" {
+		envPath = ".env"
+	}
+	if _, err := os.Stat(envPath); err != nil {
+		return nil
+	}
+	if err := godotenv.Load(envPath); err != nil {
+		return fmt.Errorf("failed to load environment file %s: %w", envPath, err)
+	}
+	return nil
+}
+
+// commandArgs describes a command's positional arguments.
+type commandArgs struct {
+	usage    string
+	min, max int
+}
+
+var commands = map[string]commandArgs{
+	"users":          {},
+	"pending":        {},
+	"approve":        {"<username>", 1, 1},
+	"reject":         {"<username>", 1, 1},
+	"lock":           {"<username>", 1, 1},
+	"unlock":         {"<username>", 1, 1},
+	"logout":         {"<username>", 1, 1},
+	"reset-password": {"<username>", 1, 1},
+	"queue":          {},
+	"purge-prekeys":  {},
+	"migrate":        {"[up | down [n] | status]", 0, 2},
+}
+
+func run(command string, args []string) error {
+	fs := flag.NewFlagSet("cli_chat_admin "+command, flag.ContinueOnError)
+	inactive := fs.Duration("inactive", 90*24*time.Hour, "how long a locked account must have been inactive (purge-prekeys)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	args = fs.Args()
+
+	// Check the command line before connecting, which retries for a while if the database is down.
+	spec, ok := commands[command]
+	switch {
+	case !ok:
+		return fmt.Errorf("unknown command %q, see --help", command)
+	case len(args) < spec.min || len(args) > spec.max:
+		if spec.usage == "" {
+			return fmt.Errorf("%s takes no arguments, see --help", command)
+		}
+		return fmt.Errorf("usage: %s %s", command, spec.usage)
+	}
+
+	db, err := storage.InitDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	accounts := storage.NewAccountStore(db)
+
+	switch command {
+	case "users":
+		return listUsers(accounts)
+
+	case "pending":
+		return listPendingUsers(accounts)
+
+	case "approve":
+		if err := accounts.ApproveUser(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Approved %s. They can log in now.\n", args[0])
+
+	case "reject":
+		if err := accounts.RejectUser(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Rejected %s and deleted the account. The username is free again.\n", args[0])
+
+	case "lock":
+		if err := accounts.SetLocked(args[0], true); err != nil {
+			return err
+		}
+		fmt.Printf("Locked %s. Their tokens are rejected from now on, and the server ends their open streams within a few seconds.\n", args[0])
+
+	case "unlock":
+		if err := accounts.SetLocked(args[0], false); err != nil {
+			return err
+		}
+		fmt.Printf("Unlocked %s.\n", args[0])
+		if hasBundle, err := accounts.HasPreKeyBundle(args[0]); err == nil && !hasBundle {
+			fmt.Printf("Warning: %s has no prekey bundle, so others cannot start new conversations with them.\n", args[0])
+		}
+
+	case "logout":
+		if err := accounts.RevokeSessions(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked all sessions of %s. The server ends their open streams within a few seconds, and they must log in again.\n", args[0])
+
+	case "reset-password":
+		password, err := readNewPassword()
+		if err != nil {
+			return err
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("error hashing password: %w", err)
+		}
+		if err := accounts.SetPasswordHash(args[0], string(hash)); err != nil {
+			return err
+		}
+		fmt.Printf("Password of %s reset and their sessions revoked.\n", args[0])
+
+	case "queue":
+		return listQueueDepths(accounts)
+
+	case "purge-prekeys":
+		purged, err := accounts.PurgeStalePreKeys(*inactive)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Purged %d prekey bundles of locked accounts inactive for more than %s.\n", purged, *inactive)
+
+	case "migrate":
+		return migrate(db, args)
+	}
+	return nil
+}
+
+func listUsers(accounts *storage.AccountStore) error {
+	users, err := accounts.ListUsers()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSERNAME\tBOT\tLOCKED\tPENDING\tLAST LOGIN\tCREATED")
+	for _, user := range users {
+		lastLogin := "never"
+		if user.LastLoginAt != nil {
+			lastLogin = user.LastLoginAt.Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%t\t%t\t%t\t%s\t%s\n", user.ID, user.Username, user.IsBot, user.Locked, user.Pending, lastLogin, user.CreatedAt.Format(time.DateTime))
+	}
+	return w.Flush()
+}
+
+func listPendingUsers(accounts *storage.AccountStore) error {
+	users, err := accounts.PendingUsers()
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		fmt.Println("No accounts are waiting for approval.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSERNAME\tBOT\tREGISTERED")
+	for _, user := range users {
+		fmt.Fprintf(w, "%d\t%s\t%t\t%s\n", user.ID, user.Username, user.IsBot, user.CreatedAt.Format(time.DateTime))
+	}
+	return w.Flush()
+}
+
+func listQueueDepths(accounts *storage.AccountStore) error {
+	depths, err := accounts.QueueDepths()
+	if err != nil {
+		return err
+	}
+	if len(depths) == 0 {
+		fmt.Println("No messages are waiting for offline users.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USER ID\tUSERNAME\tQUEUED\tREPORTED")
+	total := 0
+	for _, depth := range depths {
+		total += depth.Depth
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\n", depth.UserID, depth.Username, depth.Depth, depth.RecordedAt.Format(time.DateTime))
+	}
+	fmt.Fprintf(w, "\t\t%d\ttotal\n", total)
+	return w.Flush()
+}
+
+// migrate runs the migrate command's up, down or status action against db.
+func migrate(db *sql.DB, args []string) error {
+	migrator, err := storage.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	if action != "down" && len(args) > 1 {
+		return fmt.Errorf("usage: migrate %s", commands["migrate"].usage)
+	}
+
+	switch action {
+	case "up":
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			fmt.Printf("Applied %s.\n", migration)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("The schema is up to date.")
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) == 2 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of migrations to revert: %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(steps)
+		for _, migration := range reverted {
+			fmt.Printf("Reverted %s.\n", migration)
+		}
+		if err == nil && len(reverted) == 0 {
+			fmt.Println("No migrations have been applied.")
+		}
+		return err
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "MIGRATION\tAPPLIED")
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%s\t%s\n", status.Migration, applied)
+		}
+		return w.Flush()
+	}
+	return fmt.Errorf("unknown migrate action %q, expected up, down or status", action)
+}
+
+// readNewPassword reads a password twice from the terminal, or once from stdin when it is not a terminal.
+func readNewPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("failed to read password from stdin: %w", err)
+		}
+		password := strings.TrimRight(line, "\r\n")
+		if password == "" {
+			return "", fmt.Errorf("password cannot be empty")
+		}
+		return password, nil
+	}
+
+	fmt.Fprint(os.Stderr, "New password: ")
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(os.Stderr, "Confirm password: ")
+	confirm, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if string(password) != string(confirm) {
+		return "", fmt.Errorf("passwords do not match")
+	}
+	if len(password) == 0 {
+		return "", fmt.Errorf("password cannot be empty")
+	}
+	return string(password), nil
+}
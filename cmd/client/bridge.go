@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/johnkhk/cli_chat_app/client/app"
+	"github.com/johnkhk/cli_chat_app/client/bridge"
+)
+
+// bridgeTokenEnv holds the bearer token the bridge's local API requires.
+const bridgeTokenEnv = "CLI_CHAT_APP_BRIDGE_TOKEN"
+
+// bridgeOptions are the flags of the bridge command.
+type bridgeOptions struct {
+	webhook string
+	listen  string
+	user    string
+}
+
+var bridgeFlags = bridgeOptions{listen: "127.0.0.1:8787"}
+
+func (o *bridgeOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.webhook, "webhook", o.webhook, "URL incoming messages are POSTed to as JSON (required)")
+	fs.StringVar(&o.listen, "listen", o.listen, "address of the local API that accepts outgoing messages")
+	fs.StringVar(&o.user, "user", o.user, "bot account to log in as when there is no saved session (password from "+passwordEnv+")")
+}
+
+// runBridge relays messages between the logged-in bot account and local HTTP services until interrupted.
+func runBridge(env *environment, args []string) error {
+	opts := bridgeFlags
+	if len(args) != 0 || opts.webhook == "" {
+		return fmt.Errorf("usage: bridge --webhook <url> [--listen <addr>] [--user <bot>]")
+	}
+
+	rpcClient, err := openBridgeClient(env, opts.user)
+	if err != nil {
+		return err
+	}
+	defer rpcClient.CloseConnections()
+
+	token := os.Getenv(bridgeTokenEnv)
+	if token == "" {
+		env.log.Warnf("%s is not set, the bridge API accepts requests without a token", bridgeTokenEnv)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(os.Stderr, "Bridging to %s, accepting messages on http://%s/messages\n", opts.webhook, opts.listen)
+	return bridge.New(bridge.NewRpcMessenger(rpcClient), bridge.Config{
+		WebhookURL:    opts.webhook,
+		ListenAddress: opts.listen,
+		Token:         token,
+		Logger:        env.log,
+	}).Run(ctx)
+}
+
+// openBridgeClient resumes the saved session, or logs in as user so the daemon can start unattended.
+func openBridgeClient(env *environment, user string) (*app.RpcClient, error) {
+	if user == "" {
+		return env.openLoggedInClient()
+	}
+
+	rpcClient, err := env.openClient(env.profile, unlockFromTerminal)
+	if err != nil {
+		return nil, err
+	}
+	if err := rpcClient.AuthClient.TokenManager.TryAutoLogin(); err == nil {
+		return rpcClient, nil
+	}
+
+	password, err := readPassword("Password for " + user + ": ")
+	if err == nil {
+		err, _ = rpcClient.AuthClient.LoginUser(user, password)
+	}
+	if err != nil {
+		rpcClient.CloseConnections()
+		return nil, err
+	}
+	return rpcClient, nil
+}
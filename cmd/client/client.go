@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/johnkhk/cli_chat_app/client/app"
+	"github.com/johnkhk/cli_chat_app/client/e2ee/store"
+)
+
+// passwordEnv supplies the account password to login and register without a prompt.
+const passwordEnv = "CLI_CHAT_APP_PASSWORD"
+
+// unlockFunc asks the user to unlock a store that could not be unlocked automatically.
+// It returns a nil vault if the user gave up.
+type unlockFunc func(unlocker *app.StoreUnlocker) (*store.Vault, error)
+
+// openClient unlocks the profile's local store and connects to its server.
+func (e *environment) openClient(profileName string, unlock unlockFunc) (*app.RpcClient, error) {
+	profile := e.profiles.Profiles[profileName]
+	profileDir := e.profiles.Dir(profileName)
+	e.log.Infof("Using profile %s at %s", profileName, profileDir)
+
+	// Unlock the encrypted local store, asking the user if the keyring cannot
+	keyring := app.NewOSKeyring()
+	unlocker := app.NewStoreUnlocker(profileDir, keyring, e.log)
+	vault, err := unlocker.AutoUnlock()
+	if errors.Is(err, app.ErrStoreLocked) {
+		vault, err = unlock(unlocker)
+		if err == nil && vault == nil {
+			err = app.ErrStoreLocked
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock local store: %w", err)
+	}
+
+	// The --server flag wins over the profile, which wins over SERVER_ADDRESS
+	serverAddress := e.opts.server
+	if serverAddress == "" {
+		envServerAddress := os.Getenv("SERVER_ADDRESS")
+		if envServerAddress == "" {
+			envServerAddress = defaultServerAddress
+		}
+		serverAddress = profile.Address(envServerAddress)
+	}
+	transport, err := profile.TransportCredentials()
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up TLS for profile %s: %w", profileName, err)
+	}
+
+	// Tokens go in a file encrypted with the store key unless the OS keyring is asked for
+	var credentials app.CredentialStore
+	if os.Getenv("CREDENTIAL_BACKEND") == "keyring" {
+		credentials = app.NewKeyringCredentialStore(keyring, profileDir)
+	}
+
+	// Initialize the gRPC client using RpcClient
+	rpcClient, err := app.NewRpcClient(app.RpcClientConfig{
+		ServerAddress: serverAddress,
+		Logger:        e.log,
+		AppDirPath:    profileDir,
+		StoreVault:    vault,
+		Credentials:   credentials,
+		Profile:       profileName,
+		Profiles:      e.profiles,
+		Transport:     transport,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize RPC clients: %w", err)
+	}
+	e.log.Info("gRPC clients initialized.")
+	return rpcClient, nil
+}
+
+// openLoggedInClient opens a client for commands that need an existing session.
+func (e *environment) openLoggedInClient() (*app.RpcClient, error) {
+	rpcClient, err := e.openClient(e.profile, unlockFromTerminal)
+	if err != nil {
+		return nil, err
+	}
+	if err := rpcClient.AuthClient.TokenManager.TryAutoLogin(); err != nil {
+		rpcClient.CloseConnections()
+		return nil, fmt.Errorf("not logged in, run the login command first: %w", err)
+	}
+	return rpcClient, nil
+}
+
+// unlockFromTerminal asks for the store passphrase on the terminal, twice when choosing a new one.
+func unlockFromTerminal(unlocker *app.StoreUnlocker) (*store.Vault, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("local store is locked; set %s to unlock it without a terminal", app.StorePassphraseEnv)
+	}
+
+	if unlocker.NeedsSetup() {
+		fmt.Fprintln(os.Stderr, "Your keys and chat history are encrypted on this device. Choose a passphrase to unlock them.")
+		passphrase, err := readSecret("New store passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		confirm, err := readSecret("Confirm passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		if passphrase != confirm {
+			return nil, fmt.Errorf("passphrases do not match")
+		}
+		return unlocker.Unlock(passphrase)
+	}
+
+	passphrase, err := readSecret("Store passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	return unlocker.Unlock(passphrase)
+}
+
+// readPassword returns the account password from passwordEnv, the terminal, or a line of stdin.
+func readPassword(prompt string) (string, error) {
+	if password := os.Getenv(passwordEnv); password != "" {
+		return password, nil
+	}
+	return readSecret(prompt)
+}
+
+// readSecret reads a line without echoing it when stdin is a terminal.
+func readSecret(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, prompt)
+		secret, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", strings.TrimSuffix(prompt, ": "), err)
+		}
+		return string(secret), nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read %s from stdin: %w", strings.TrimSuffix(prompt, ": "), err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/term"
+
+	"github.com/johnkhk/cli_chat_app/client/app"
+	"github.com/johnkhk/cli_chat_app/genproto/friends"
+)
+
+// registerOptions are the flags of the register command.
+type registerOptions struct {
+	bot    bool
+	invite string
+}
+
+var registerFlags registerOptions
+
+func (o *registerOptions) register(fs *flag.FlagSet) {
+	fs.BoolVar(&o.bot, "bot", false, "register an automated account, which friends see as a bot")
+	fs.StringVar(&o.invite, "invite", "", "invite code to redeem, making the account a friend of its creator")
+}
+
+func runRegister(env *environment, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: register [--bot | --invite <code>] <username>")
+	}
+	if registerFlags.bot && registerFlags.invite != "" {
+		return fmt.Errorf("bots can't register with an invite")
+	}
+
+	password, err := readPassword("Password: ")
+	if err != nil {
+		return err
+	}
+	if os.Getenv(passwordEnv) == "" && term.IsTerminal(int(os.Stdin.Fd())) {
+		confirm, err := readSecret("Confirm password: ")
+		if err != nil {
+			return err
+		}
+		if password != confirm {
+			return fmt.Errorf("passwords do not match")
+		}
+	}
+
+	rpcClient, err := env.openClient(env.profile, unlockFromTerminal)
+	if err != nil {
+		return err
+	}
+	defer rpcClient.CloseConnections()
+
+	register := func(username, password string) error {
+		return rpcClient.AuthClient.RegisterUserWithInvite(username, password, registerFlags.invite)
+	}
+	if registerFlags.bot {
+		register = rpcClient.AuthClient.RegisterBot
+	}
+	err = register(args[0], password)
+	if errors.Is(err, app.ErrRegistrationPending) {
+		fmt.Printf("Registered %s. An administrator has to approve the account before you can log in.\n", args[0])
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Registered %s. Run the login command to start chatting.\n", args[0])
+	return nil
+}
+
+func runLogin(env *environment, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: login <username>")
+	}
+
+	password, err := readPassword("Password: ")
+	if err != nil {
+		return err
+	}
+
+	rpcClient, err := env.openClient(env.profile, unlockFromTerminal)
+	if err != nil {
+		return err
+	}
+	defer rpcClient.CloseConnections()
+
+	if err, _ := rpcClient.AuthClient.LoginUser(args[0], password); err != nil {
+		return err
+	}
+	fmt.Printf("Logged in as %s on profile %s.\n", args[0], rpcClient.Profile)
+	return nil
+}
+
+func runFriends(env *environment, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: friends list|requests|add <username>|accept <username>|invite [uses]|redeem <code>")
+	}
+
+	rpcClient, err := env.openLoggedInClient()
+	if err != nil {
+		return err
+	}
+	defer rpcClient.CloseConnections()
+
+	switch args[0] {
+	case "list":
+		friendList, err := rpcClient.FriendsClient.GetFriendList()
+		if err != nil {
+			return err
+		}
+		if len(friendList) == 0 {
+			fmt.Println("You have no friends yet. Add one with: friends add <username>")
+		}
+		for _, friend := range friendList {
+			if friend.IsBot {
+				fmt.Printf("%s (bot)\n", friend.Username)
+			} else {
+				fmt.Println(friend.Username)
+			}
+		}
+
+	case "requests":
+		requests, err := rpcClient.FriendsClient.GetIncomingFriendRequests()
+		if err != nil {
+			return err
+		}
+		if len(requests) == 0 {
+			fmt.Println("No pending friend requests.")
+		}
+		for _, request := range requests {
+			fmt.Printf("%s (sent %s)\n", request.SenderUsername, request.CreatedAt.AsTime().Local().Format("2006-01-02 15:04"))
+		}
+
+	case "add":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: friends add <username>")
+		}
+		if err := rpcClient.FriendsClient.SendFriendRequest(args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Friend request sent to %s.\n", args[1])
+
+	case "accept":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: friends accept <username>")
+		}
+		requests, err := rpcClient.FriendsClient.GetIncomingFriendRequests()
+		if err != nil {
+			return err
+		}
+		for _, request := range requests {
+			if request.SenderUsername == args[1] {
+				if err := rpcClient.FriendsClient.AcceptFriendRequest(request.RequestId); err != nil {
+					return err
+				}
+				fmt.Printf("You are now friends with %s.\n", args[1])
+				return nil
+			}
+		}
+		return fmt.Errorf("no pending friend request from %s", args[1])
+
+	case "invite":
+		var uses uint64 = 1
+		if len(args) == 2 {
+			if uses, err = strconv.ParseUint(args[1], 10, 32); err != nil || uses == 0 {
+				return fmt.Errorf("usage: friends invite [uses]")
+			}
+		} else if len(args) > 2 {
+			return fmt.Errorf("usage: friends invite [uses]")
+		}
+		invite, err := rpcClient.FriendsClient.CreateInvite(uint32(uses), 0)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s (%d uses, expires %s)\n", invite.Code, invite.MaxUses, invite.ExpiresAt.AsTime().Local().Format("2006-01-02 15:04"))
+
+	case "redeem":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: friends redeem <code>")
+		}
+		friend, err := rpcClient.FriendsClient.RedeemInvite(args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("You are now friends with %s.\n", friend.Username)
+
+	default:
+		return fmt.Errorf("unknown friends command %q", args[0])
+	}
+	return nil
+}
+
+func runHistory(env *environment, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: history <user>")
+	}
+
+	rpcClient, err := env.openLoggedInClient()
+	if err != nil {
+		return err
+	}
+	defer rpcClient.CloseConnections()
+
+	friend, err := findFriend(rpcClient, args[0])
+	if err != nil {
+		return err
+	}
+
+	history, err := rpcClient.Store.GetChatHistory(rpcClient.CurrentUserID, uint32(friend.UserId))
+	if err != nil {
+		return fmt.Errorf("failed to load chat history: %w", err)
+	}
+	for _, message := range history {
+		sender := friend.Username
+		if message.SenderID == rpcClient.CurrentUserID {
+			sender = "me"
+		}
+		body := message.Message
+		if message.FileType != "" && message.FileType != "text" {
+			body = fmt.Sprintf("[file %s, %d bytes]", message.FileName, message.FileSize)
+		}
+		fmt.Printf("[%s] %s: %s\n", message.Timestamp.Local().Format("2006-01-02 15:04"), sender, body)
+	}
+	return nil
+}
+
+// findFriend looks a friend up by username.
+func findFriend(rpcClient *app.RpcClient, username string) (*friends.Friend, error) {
+	friendList, err := rpcClient.FriendsClient.GetFriendList()
+	if err != nil {
+		return nil, err
+	}
+	for _, friend := range friendList {
+		if friend.Username == username {
+			return friend, nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not in your friend list", username)
+}
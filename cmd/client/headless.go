@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/johnkhk/cli_chat_app/client/lib"
+)
+
+// sendTimeout bounds how long send waits for the server to acknowledge a message.
+const sendTimeout = 10 * time.Second
+
+// sendOptions are the flags of the send command.
+type sendOptions struct {
+	file string
+	wait time.Duration
+	json bool
+}
+
+var sendFlags sendOptions
+
+func (o *sendOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.file, "file", "", "send this file instead of a text message")
+	fs.DurationVar(&o.wait, "wait", 0, "wait this long for a reply from the recipient and print it")
+	fs.BoolVar(&o.json, "json", false, "print the result and any reply as JSON lines")
+}
+
+// sendResult is what send prints with --json once the server has acknowledged the message.
+type sendResult struct {
+	Recipient string `json:"recipient"`
+	Status    string `json:"status"`
+}
+
+func runSend(env *environment, args []string) error {
+	opts := sendFlags
+	if len(args) < 1 || (opts.file == "" && len(args) < 2) || (opts.file != "" && len(args) > 1) {
+		return fmt.Errorf("usage: send [--wait 30s] [--json] <user> <message...>, or send --file <path> <user>")
+	}
+
+	// Read the file before connecting so a bad path fails fast.
+	messageBytes := []byte(strings.Join(args[1:], " "))
+	var fileOpts *lib.SendMessageOptions
+	if opts.file != "" {
+		data, err := os.ReadFile(opts.file)
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		fileName := filepath.Base(opts.file)
+		messageBytes = data
+		fileOpts = &lib.SendMessageOptions{
+			FileType: lib.FileTypeFromName(fileName),
+			FileSize: uint64(len(data)),
+			FileName: fileName,
+		}
+	}
+
+	rpcClient, err := env.openLoggedInClient()
+	if err != nil {
+		return err
+	}
+	defer rpcClient.CloseConnections()
+
+	friend, err := findFriend(rpcClient, args[0])
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	status, err := rpcClient.ChatClient.SendMessageAndWait(ctx, uint32(friend.UserId), rpcClient.CurrentDeviceID, messageBytes, fileOpts)
+	if err != nil {
+		return err
+	}
+
+	output := json.NewEncoder(os.Stdout)
+	if opts.json {
+		if err := output.Encode(sendResult{Recipient: friend.Username, Status: status}); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("Message to %s %s.\n", friend.Username, status)
+	}
+
+	if opts.wait <= 0 {
+		return nil
+	}
+
+	waitCtx, cancelWait := context.WithTimeout(context.Background(), opts.wait)
+	defer cancelWait()
+	reply, err := rpcClient.ChatClient.ReceiveMessage(waitCtx, uint32(friend.UserId))
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("no reply from %s within %s", friend.Username, opts.wait)
+	}
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return output.Encode(reply)
+	}
+	fmt.Printf("%s: %s\n", reply.Sender, reply.Body)
+	return nil
+}
+
+// listenOptions are the flags of the listen command.
+type listenOptions struct {
+	from    string
+	count   int
+	timeout time.Duration
+}
+
+var listenFlags listenOptions
+
+func (o *listenOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.from, "from", "", "only print messages from this friend")
+	fs.IntVar(&o.count, "count", 0, "exit after this many messages (0 for no limit)")
+	fs.DurationVar(&o.timeout, "timeout", 0, "exit after this long (0 to wait until interrupted)")
+}
+
+// runListen prints incoming messages as JSON lines until interrupted, or until --count or --timeout is reached.
+func runListen(env *environment, args []string) error {
+	opts := listenFlags
+	if len(args) != 0 {
+		return fmt.Errorf("usage: listen [--from <user>] [--count <n>] [--timeout <duration>]")
+	}
+
+	rpcClient, err := env.openLoggedInClient()
+	if err != nil {
+		return err
+	}
+	defer rpcClient.CloseConnections()
+
+	var senderID uint32
+	if opts.from != "" {
+		friend, err := findFriend(rpcClient, opts.from)
+		if err != nil {
+			return err
+		}
+		senderID = uint32(friend.UserId)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+
+	output := json.NewEncoder(os.Stdout)
+	for received := 0; opts.count == 0 || received < opts.count; received++ {
+		msg, err := rpcClient.ChatClient.ReceiveMessage(ctx, senderID)
+		if errors.Is(err, context.DeadlineExceeded) && opts.count > 0 {
+			return fmt.Errorf("timed out after %d of %d messages", received, opts.count)
+		}
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := output.Encode(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,93 +1,185 @@
 package main
 
 import (
-	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
 
 	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
 
 	"github.com/johnkhk/cli_chat_app/client/app"
 	"github.com/johnkhk/cli_chat_app/client/logger"
-	"github.com/johnkhk/cli_chat_app/client/ui"
 )
 
 // Default server address (can be overridden with a build flag)
 var defaultServerAddress = "localhost:50051"
 
+const usage = `Usage: cli_chat_app [flags] [command] [args]
+
+Commands:
+  tui                          Start the interactive chat client (default)
+  register <username>          Create an account
+       --bot                    register an automated account, shown as a bot
+       --invite <code>          redeem an invite, needed on invite-only servers
+  login <username>             Log in and remember the session
+  send <user> <message...>     Send an encrypted message to a friend
+       --file <path>            send a file instead of a message
+       --wait <duration>        wait this long for a reply and print it
+       --json                   print the result and reply as JSON
+  listen                       Print incoming messages as JSON lines
+       --from <user>            only print messages from this friend
+       --count <n>              exit after n messages
+       --timeout <duration>     exit after this long
+  friends list                 List your friends
+  friends requests             List incoming friend requests
+  friends add <username>       Send a friend request
+  friends accept <username>    Accept a friend request
+  friends invite [uses]        Create an invite code that makes whoever redeems it your friend
+  friends redeem <code>        Redeem an invite code
+  history <user>               Print your chat history with a friend
+  bridge --webhook <url>       Relay messages between this account and local HTTP services
+       --listen <addr>          address of the local send API (default 127.0.0.1:8787)
+       --user <bot>             log in as this account if there is no saved session
+
+Passwords are read from the terminal, or from CLI_CHAT_APP_PASSWORD when set.
+
+Flags:
+`
+
+// options are the flags shared by every command.
+type options struct {
+	server   string
+	appDir   string
+	logLevel string
+	profile  string
+}
+
+// register adds the shared flags to fs, keeping any values already parsed so they can be given
+// before or after the command name.
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.server, "server", o.server, "server address, overriding the profile's (host:port)")
+	fs.StringVar(&o.appDir, "app-dir", o.appDir, "directory for the local store, tokens and logs")
+	fs.StringVar(&o.logLevel, "log-level", o.logLevel, "log level: debug, info, warn or error")
+	fs.StringVar(&o.profile, "profile", o.profile, "server profile to use (defaults to the last one picked)")
+}
+
 func main() {
-	// Load environment variables from .env file
-	if err := godotenv.Load(); err != nil {
-		fmt.Printf("Error loading .env file: %v\n", err)
+	opts := &options{logLevel: "info"}
+	fs := flag.NewFlagSet("cli_chat_app", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	opts.register(fs)
+	fs.Parse(os.Args[1:])
+
+	command := "tui"
+	args := fs.Args()
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	// Load environment variables from the .env file, if there is one
+	if _, err := os.Stat(".env"); err == nil {
+		if err := godotenv.Load(); err != nil {
+			fmt.Printf("Error loading .env file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := run(command, args, opts); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+}
 
-	// Initialize the client logger
-	log := logger.InitLogger()
-	log.Info("Client application started")
-	appDirPath, err := app.GetAppDirPath()
-	if err != nil {
-		log.Fatalf("Failed to get app directory path: %v", err)
+// command is a subcommand of the client binary.
+type command struct {
+	run   func(*environment, []string) error
+	flags func(*flag.FlagSet) // Adds the command's own flags, if it has any
+}
+
+func run(name string, args []string, opts *options) error {
+	commands := map[string]command{
+		"tui":      {run: runTUI},
+		"register": {run: runRegister, flags: registerFlags.register},
+		"login":    {run: runLogin},
+		"send":     {run: runSend, flags: sendFlags.register},
+		"listen":   {run: runListen, flags: listenFlags.register},
+		"friends":  {run: runFriends},
+		"history":  {run: runHistory},
+		"bridge":   {run: runBridge, flags: bridgeFlags.register},
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q, see --help", name)
 	}
 
-	// Initialize the gRPC client using RpcClient
-	serverAddress := os.Getenv("SERVER_ADDRESS")
-	if serverAddress == "" {
-		serverAddress = defaultServerAddress
+	// Commands accept the shared flags after their name too.
+	fs := flag.NewFlagSet("cli_chat_app "+name, flag.ContinueOnError)
+	opts.register(fs)
+	if cmd.flags != nil {
+		cmd.flags(fs)
 	}
-	rpcClientConfig := app.RpcClientConfig{
-		ServerAddress: serverAddress,
-		Logger:        log,
-		AppDirPath:    appDirPath,
+	if err := fs.Parse(args); err != nil {
+		return err
 	}
-	rpcClient, err := app.NewRpcClient(rpcClientConfig)
+
+	env, err := newEnvironment(opts)
 	if err != nil {
-		log.Fatalf("Failed to initialize RPC clients: %v", err)
+		return err
 	}
-	defer rpcClient.CloseConnections() // Ensure the connection is closed when the application exits
-	log.Info("gRPC clients initialized.")
+	return cmd.run(env, fs.Args())
+}
+
+// environment is what every command needs before it talks to a server.
+type environment struct {
+	opts     *options
+	log      *logrus.Logger
+	profiles *app.ProfileConfig
+	profile  string
+}
 
-	// Attempt auto login
-	err = rpcClient.AuthClient.TokenManager.TryAutoLogin()
+func newEnvironment(opts *options) (*environment, error) {
+	appDirPath := opts.appDir
+	if appDirPath == "" {
+		var err error
+		appDirPath, err = app.GetAppDirPath()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get app directory path: %w", err)
+		}
+	}
+
+	level, err := logrus.ParseLevel(opts.logLevel)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q", opts.logLevel)
+	}
+
+	// Initialize the client logger
+	log := logger.InitLogger(appDirPath, level)
+	log.Info("Client application started")
+
+	profiles, err := app.LoadProfiles(appDirPath)
 	if err != nil {
-		log.Infof("Log in failed: %v", err)
-	} else {
-		log.Info("User automatically logged in with stored tokens.")
+		return nil, fmt.Errorf("failed to load profiles: %w", err)
+	}
+	profileName := opts.profile
+	if profileName == "" {
+		profileName = profiles.Selected()
 	}
-	isLoggedIn := err == nil
-
-	// Create a context that is canceled on interrupt signals
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	// Set up a channel to listen for OS signals
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-
-	// Start a goroutine to listen for signals
-	go func() {
-		sig := <-sigs
-		log.Infof("Received signal: %v, initiating shutdown...", sig)
-		cancel()
-	}()
-
-	// Run the UI in a separate goroutine
-	uiDone := make(chan struct{})
-	go func() {
-		ui.RunUIBasedOnAuthStatus(isLoggedIn, log, rpcClient)
-		close(uiDone)
-	}()
-
-	// Wait for either the UI to finish or a signal to be received
-	select {
-	case <-ctx.Done():
-		log.Info("Context canceled, shutting down...")
-	case <-uiDone:
-		log.Info("UI exited, shutting down...")
+	if _, ok := profiles.Profiles[profileName]; !ok {
+		return nil, fmt.Errorf("unknown profile %q, known profiles: %v", profileName, profiles.Names())
 	}
 
-	// Deferred CloseConnections will be called here
-	log.Info("Application shutdown complete.")
+	return &environment{
+		opts:     opts,
+		log:      log,
+		profiles: profiles,
+		profile:  profileName,
+	}, nil
 }
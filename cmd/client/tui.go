@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/johnkhk/cli_chat_app/client/app"
+	"github.com/johnkhk/cli_chat_app/client/e2ee/store"
+	"github.com/johnkhk/cli_chat_app/client/ui"
+)
+
+// runTUI starts the interactive client, switching profiles until the user quits.
+func runTUI(env *environment, args []string) error {
+	log := env.log
+
+	// Create a context that is canceled on interrupt signals
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Set up a channel to listen for OS signals
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	// Start a goroutine to listen for signals
+	go func() {
+		sig := <-sigs
+		log.Infof("Received signal: %v, initiating shutdown...", sig)
+		cancel()
+	}()
+
+	// Run profiles until the user quits instead of switching to another one
+	profileName := env.profile
+	for profileName != "" && ctx.Err() == nil {
+		var err error
+		profileName, err = runProfile(ctx, env, profileName)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Info("Application shutdown complete.")
+	return nil
+}
+
+// runProfile runs the interactive client against one server profile and returns the profile the
+// user switched to, or "" to exit.
+func runProfile(ctx context.Context, env *environment, profileName string) (string, error) {
+	log := env.log
+
+	rpcClient, err := env.openClient(profileName, func(unlocker *app.StoreUnlocker) (*store.Vault, error) {
+		return ui.RunUnlockPrompt(unlocker), nil
+	})
+	if errors.Is(err, app.ErrStoreLocked) {
+		log.Info("Local store left locked, exiting.")
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer rpcClient.CloseConnections() // Ensure the connection is closed when the profile exits
+
+	// Attempt auto login
+	err = rpcClient.AuthClient.TokenManager.TryAutoLogin()
+	if err != nil {
+		log.Infof("Log in failed: %v", err)
+	} else {
+		log.Info("User automatically logged in with stored tokens.")
+	}
+	isLoggedIn := err == nil
+
+	// Run the UI in a separate goroutine
+	uiDone := make(chan string, 1)
+	go func() {
+		uiDone <- ui.RunUIBasedOnAuthStatus(isLoggedIn, log, rpcClient)
+	}()
+
+	// Wait for either the UI to finish or a signal to be received
+	select {
+	case <-ctx.Done():
+		log.Info("Context canceled, shutting down...")
+		return "", nil
+	case next := <-uiDone:
+		log.Info("UI exited, shutting down...")
+		return next, nil
+	}
+}
@@ -54,6 +54,23 @@ func main() {
 	}
 	defer db.Close()
 
+	// Bring the schema up to date, unless the operator applies migrations with the admin tool
+	if os.Getenv("SKIP_MIGRATIONS") == "" {
+		migrator, err := storage.NewMigrator(db)
+		if err != nil {
+			log.Fatalf("Failed to load migrations: %v", err)
+		}
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			log.Infof("Applied migration %s", migration)
+		}
+		if err != nil {
+			log.Fatalf("Failed to migrate the database: %v", err)
+		}
+	} else {
+		log.Info("SKIP_MIGRATIONS is set, not migrating the database")
+	}
+
 	// Create a context that is canceled on SIGINT or SIGTERM
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
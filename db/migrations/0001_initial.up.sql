@@ -1,4 +1,5 @@
-CREATE TABLE users (
+-- Tables are created only if missing, so databases set up before versioned migrations adopt this version as is.
+CREATE TABLE IF NOT EXISTS users (
     id INT AUTO_INCREMENT PRIMARY KEY,
     username VARCHAR(255) NOT NULL UNIQUE,
     password_hash VARCHAR(255) NOT NULL,
@@ -6,7 +7,7 @@ CREATE TABLE users (
 );
 
 
-CREATE TABLE friend_requests (
+CREATE TABLE IF NOT EXISTS friend_requests (
     id SERIAL PRIMARY KEY,
     requester_id INT NOT NULL, -- User ID of the requester
     recipient_id INT NOT NULL, -- User ID of the recipient
@@ -17,7 +18,7 @@ CREATE TABLE friend_requests (
     FOREIGN KEY (recipient_id) REFERENCES users(id)
 );
 
-CREATE TABLE friends (
+CREATE TABLE IF NOT EXISTS friends (
     id SERIAL PRIMARY KEY,
     user_id INT NOT NULL, -- ID of the user
     friend_id INT NOT NULL, -- ID of the friend
@@ -28,7 +29,7 @@ CREATE TABLE friends (
 );
 
 
-CREATE TABLE prekey_bundle (
+CREATE TABLE IF NOT EXISTS prekey_bundle (
     id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY, 
     user_id INT NOT NULL UNIQUE,  -- Make user_id unique
     registration_id INT UNSIGNED NOT NULL,      
@@ -48,4 +49,4 @@ CREATE TABLE IF NOT EXISTS onetime_prekeys (
     prekey_id INT PRIMARY KEY,               -- ID of the one-time prekey
     prekey BLOB NOT NULL,                    -- The one-time prekey
     FOREIGN KEY (user_id) REFERENCES prekey_bundle(user_id)
-);
\ No newline at end of file
+);
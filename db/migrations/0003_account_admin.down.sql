@@ -0,0 +1,7 @@
+-- Drop the offline_queue_depth table
+DROP TABLE IF EXISTS offline_queue_depth;
+
+ALTER TABLE users
+    DROP COLUMN last_login_at,
+    DROP COLUMN sessions_revoked_at,
+    DROP COLUMN locked;
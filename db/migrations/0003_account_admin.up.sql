@@ -0,0 +1,12 @@
+ALTER TABLE users
+    ADD COLUMN locked BOOLEAN NOT NULL DEFAULT FALSE, -- Locked accounts cannot log in or use their tokens
+    ADD COLUMN sessions_revoked_at TIMESTAMP NULL DEFAULT NULL, -- Tokens issued before this are rejected
+    ADD COLUMN last_login_at TIMESTAMP NULL DEFAULT NULL;
+
+
+CREATE TABLE IF NOT EXISTS offline_queue_depth (
+    user_id INT NOT NULL PRIMARY KEY,        -- User with messages waiting for them
+    depth INT NOT NULL,                      -- Number of messages queued on the server
+    recorded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- When the server last reported the depth
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+-- Drop the blocked_users table
+DROP TABLE IF EXISTS blocked_users;
@@ -0,0 +1,2 @@
+-- Drop the message_requests table
+DROP TABLE IF EXISTS message_requests;
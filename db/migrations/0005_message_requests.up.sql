@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS message_requests (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    sender_id INT NOT NULL,                  -- User who is not a friend of the recipient
+    recipient_id INT NOT NULL,               -- User the message is held for
+    message_id VARCHAR(255) NOT NULL,        -- Client-generated ID of the held message
+    payload BLOB NOT NULL,                   -- The message as the server would deliver it, still end-to-end encrypted
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- When the message was held
+    INDEX message_requests_recipient (recipient_id, sender_id),
+    FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (recipient_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+-- Drop the discoverable column
+ALTER TABLE users
+    DROP COLUMN discoverable;
@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD COLUMN discoverable BOOLEAN NOT NULL DEFAULT TRUE; -- Whether other users can find the account with SearchUsers
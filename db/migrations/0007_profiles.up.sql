@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS profiles (
+    user_id INT NOT NULL PRIMARY KEY,        -- Owner of the profile
+    ciphertext MEDIUMBLOB NOT NULL,          -- Profile encrypted with the owner's profile key, which the server never sees
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- When the owner last changed the profile
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+ALTER TABLE friends
+    ADD COLUMN last_activity_at TIMESTAMP NULL DEFAULT NULL; -- When the two friends last messaged each other, for sorting friend lists
@@ -0,0 +1,2 @@
+-- Drop the invites table
+DROP TABLE IF EXISTS invites;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS invites (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    code VARCHAR(32) NOT NULL UNIQUE,        -- Short code the creator shares out of band
+    creator_id INT NOT NULL,                 -- User who becomes friends with everyone who redeems the invite
+    max_uses INT NOT NULL,                   -- How many users can redeem the invite
+    uses INT NOT NULL DEFAULT 0,             -- How many users have redeemed it
+    expires_at TIMESTAMP NOT NULL,           -- When the invite stops working
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (creator_id) REFERENCES users(id) ON DELETE CASCADE
+);
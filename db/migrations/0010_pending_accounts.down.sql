@@ -0,0 +1,3 @@
+-- Drop the pending column
+ALTER TABLE users
+    DROP COLUMN pending;
@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD COLUMN pending BOOLEAN NOT NULL DEFAULT FALSE; -- Accounts waiting for an administrator's approval, which cannot log in
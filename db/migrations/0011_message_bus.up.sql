@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS bus_presence (
+    user_id INT PRIMARY KEY,                 -- User with an open chat stream
+    node_id VARCHAR(255) NOT NULL,           -- Server node holding the stream
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX bus_presence_node (node_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS bus_forwarded (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    node_id VARCHAR(255) NOT NULL,           -- Server node the message is forwarded to
+    payload MEDIUMBLOB NOT NULL,             -- The message as the server would deliver it, still end-to-end encrypted
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX bus_forwarded_node (node_id, id)
+);
+
+CREATE TABLE IF NOT EXISTS bus_queue (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,                    -- Offline user the message waits for
+    payload MEDIUMBLOB NOT NULL,             -- The message as the server would deliver it, still end-to-end encrypted
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX bus_queue_user (user_id, id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
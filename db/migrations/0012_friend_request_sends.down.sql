@@ -0,0 +1,2 @@
+-- Drop the friend_request_sends table
+DROP TABLE IF EXISTS friend_request_sends;
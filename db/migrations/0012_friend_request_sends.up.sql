@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS friend_request_sends (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    requester_id INT NOT NULL,               -- User who sent the friend request
+    recipient_id INT NOT NULL,               -- User it was sent to
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- When it was sent, once per send including resends
+    INDEX friend_request_sends_requester (requester_id, created_at),
+    FOREIGN KEY (requester_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (recipient_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Requests sent so far count once each
+INSERT INTO friend_request_sends (requester_id, recipient_id, created_at)
+SELECT requester_id, recipient_id, created_at FROM friend_requests;
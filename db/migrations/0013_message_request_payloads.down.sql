@@ -0,0 +1,3 @@
+-- Shrink payload back to a BLOB, which fails while a held message is larger
+ALTER TABLE message_requests
+    MODIFY COLUMN payload BLOB NOT NULL;
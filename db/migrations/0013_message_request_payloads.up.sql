@@ -0,0 +1,2 @@
+ALTER TABLE message_requests
+    MODIFY COLUMN payload MEDIUMBLOB NOT NULL; -- Held file messages don't fit in a BLOB
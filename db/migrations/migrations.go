@@ -0,0 +1,30 @@
+// Package migrations embeds the server's versioned schema migrations.
+//
+// Each version has a <version>_<name>.up.sql file and a matching .down.sql file that reverts it.
+// The MySQL migrations live at the top level and the SQLite ones, with the same versions, in sqlite/.
+// Add new versions with the next number to both; never edit a migration that has been released.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// FS holds the MySQL migration files.
+//
+//go:embed *.sql
+var FS embed.FS
+
+//go:embed sqlite/*.sql
+var sqliteFS embed.FS
+
+// SQLite holds the SQLite migration files.
+var SQLite = mustSub(sqliteFS, "sqlite")
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
@@ -0,0 +1,14 @@
+-- Drop the onetime_prekeys table
+DROP TABLE IF EXISTS onetime_prekeys;
+
+-- Drop the prekey_bundle table
+DROP TABLE IF EXISTS prekey_bundle;
+
+-- Drop the friend_requests table
+DROP TABLE IF EXISTS friend_requests;
+
+-- Drop the friends table
+DROP TABLE IF EXISTS friends;
+
+-- Drop the users table
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,51 @@
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+
+CREATE TABLE IF NOT EXISTS friend_requests (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    requester_id INTEGER NOT NULL, -- User ID of the requester
+    recipient_id INTEGER NOT NULL, -- User ID of the recipient
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- When the request was made
+    status TEXT DEFAULT 'PENDING', -- Status of the request (pending, accepted, declined)
+    response_at TIMESTAMP NULL DEFAULT NULL,
+    FOREIGN KEY (requester_id) REFERENCES users(id),
+    FOREIGN KEY (recipient_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS friends (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL, -- ID of the user
+    friend_id INTEGER NOT NULL, -- ID of the friend
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- When the friendship was established
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (friend_id) REFERENCES users(id),
+    UNIQUE(user_id, friend_id) -- Ensure that each friendship is unique
+);
+
+
+CREATE TABLE IF NOT EXISTS prekey_bundle (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL UNIQUE,
+    registration_id INTEGER NOT NULL,
+    device_id INTEGER NOT NULL,
+    identity_key BLOB NOT NULL,
+    pre_key_id INTEGER NOT NULL,
+    pre_key BLOB NOT NULL,
+    signed_pre_key_id INTEGER NOT NULL,
+    signed_pre_key BLOB NOT NULL,
+    signed_pre_key_signature BLOB NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+
+CREATE TABLE IF NOT EXISTS onetime_prekeys (
+    user_id INTEGER NOT NULL,                -- Foreign key to reference prekey_bundles
+    prekey_id INTEGER PRIMARY KEY,           -- ID of the one-time prekey
+    prekey BLOB NOT NULL,                    -- The one-time prekey
+    FOREIGN KEY (user_id) REFERENCES prekey_bundle(user_id)
+);
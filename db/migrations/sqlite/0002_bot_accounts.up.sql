@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN is_bot BOOLEAN NOT NULL DEFAULT FALSE; -- Automated accounts, such as webhook bridges
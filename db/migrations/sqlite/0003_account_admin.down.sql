@@ -0,0 +1,6 @@
+-- Drop the offline_queue_depth table
+DROP TABLE IF EXISTS offline_queue_depth;
+
+ALTER TABLE users DROP COLUMN last_login_at;
+ALTER TABLE users DROP COLUMN sessions_revoked_at;
+ALTER TABLE users DROP COLUMN locked;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS blocked_users (
+    user_id INTEGER NOT NULL,                -- User who blocked
+    blocked_id INTEGER NOT NULL,             -- User they blocked
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- When the block was made
+    PRIMARY KEY (user_id, blocked_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (blocked_id) REFERENCES users(id) ON DELETE CASCADE
+);
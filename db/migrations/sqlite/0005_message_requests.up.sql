@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS message_requests (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    sender_id INTEGER NOT NULL,              -- User who is not a friend of the recipient
+    recipient_id INTEGER NOT NULL,           -- User the message is held for
+    message_id TEXT NOT NULL,                -- Client-generated ID of the held message
+    payload BLOB NOT NULL,                   -- The message as the server would deliver it, still end-to-end encrypted
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- When the message was held
+    FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (recipient_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS message_requests_recipient ON message_requests (recipient_id, sender_id);
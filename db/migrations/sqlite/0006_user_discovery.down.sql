@@ -0,0 +1,2 @@
+-- Drop the discoverable column
+ALTER TABLE users DROP COLUMN discoverable;
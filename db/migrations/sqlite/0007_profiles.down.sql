@@ -0,0 +1,2 @@
+-- Drop the profiles table
+DROP TABLE IF EXISTS profiles;
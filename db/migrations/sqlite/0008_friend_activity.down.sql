@@ -0,0 +1,2 @@
+-- Drop the last_activity_at column
+ALTER TABLE friends DROP COLUMN last_activity_at;
@@ -0,0 +1 @@
+ALTER TABLE friends ADD COLUMN last_activity_at TIMESTAMP; -- When the two friends last messaged each other, for sorting friend lists
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS invites (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code TEXT NOT NULL UNIQUE,               -- Short code the creator shares out of band
+    creator_id INTEGER NOT NULL,             -- User who becomes friends with everyone who redeems the invite
+    max_uses INTEGER NOT NULL,               -- How many users can redeem the invite
+    uses INTEGER NOT NULL DEFAULT 0,         -- How many users have redeemed it
+    expires_at TIMESTAMP NOT NULL,           -- When the invite stops working
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (creator_id) REFERENCES users(id) ON DELETE CASCADE
+);
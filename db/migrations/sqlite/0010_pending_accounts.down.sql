@@ -0,0 +1,2 @@
+-- Drop the pending column
+ALTER TABLE users DROP COLUMN pending;
@@ -0,0 +1,4 @@
+-- Drop the message bus tables
+DROP TABLE IF EXISTS bus_queue;
+DROP TABLE IF EXISTS bus_forwarded;
+DROP TABLE IF EXISTS bus_presence;
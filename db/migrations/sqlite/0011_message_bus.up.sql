@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS bus_presence (
+    user_id INTEGER PRIMARY KEY,             -- User with an open chat stream
+    node_id TEXT NOT NULL,                   -- Server node holding the stream
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS bus_presence_node ON bus_presence (node_id);
+
+CREATE TABLE IF NOT EXISTS bus_forwarded (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    node_id TEXT NOT NULL,                   -- Server node the message is forwarded to
+    payload BLOB NOT NULL,                   -- The message as the server would deliver it, still end-to-end encrypted
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS bus_forwarded_node ON bus_forwarded (node_id, id);
+
+CREATE TABLE IF NOT EXISTS bus_queue (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,                -- Offline user the message waits for
+    payload BLOB NOT NULL,                   -- The message as the server would deliver it, still end-to-end encrypted
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS bus_queue_user ON bus_queue (user_id, id);
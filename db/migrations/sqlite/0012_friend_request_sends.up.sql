@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS friend_request_sends (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    requester_id INTEGER NOT NULL,           -- User who sent the friend request
+    recipient_id INTEGER NOT NULL,           -- User it was sent to
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- When it was sent, once per send including resends
+    FOREIGN KEY (requester_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (recipient_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS friend_request_sends_requester ON friend_request_sends (requester_id, created_at);
+
+-- Requests sent so far count once each
+INSERT INTO friend_request_sends (requester_id, recipient_id, created_at)
+SELECT requester_id, recipient_id, created_at FROM friend_requests;
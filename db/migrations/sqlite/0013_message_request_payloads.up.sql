@@ -0,0 +1 @@
+-- SQLite BLOBs have no size limit, so held messages already fit
@@ -19,7 +19,10 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	ChatService_StreamMessages_FullMethodName = "/chat.ChatService/StreamMessages"
+	ChatService_StreamMessages_FullMethodName       = "/chat.ChatService/StreamMessages"
+	ChatService_GetMessageRequests_FullMethodName   = "/chat.ChatService/GetMessageRequests"
+	ChatService_AcceptMessageRequest_FullMethodName = "/chat.ChatService/AcceptMessageRequest"
+	ChatService_RejectMessageRequest_FullMethodName = "/chat.ChatService/RejectMessageRequest"
 )
 
 // ChatServiceClient is the client API for ChatService service.
@@ -33,6 +36,12 @@ const (
 type ChatServiceClient interface {
 	// Bidirectional streaming RPC for sending and receiving messages
 	StreamMessages(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[MessageRequest, MessageResponse], error)
+	// Messages from users who are not your friends are held as message requests until you answer them
+	GetMessageRequests(ctx context.Context, in *GetMessageRequestsRequest, opts ...grpc.CallOption) (*GetMessageRequestsResponse, error)
+	// Accepting makes the sender your friend and delivers their held messages
+	AcceptMessageRequest(ctx context.Context, in *AcceptMessageRequestRequest, opts ...grpc.CallOption) (*AcceptMessageRequestResponse, error)
+	// Rejecting drops the held messages; the sender can still send new ones
+	RejectMessageRequest(ctx context.Context, in *RejectMessageRequestRequest, opts ...grpc.CallOption) (*RejectMessageRequestResponse, error)
 }
 
 type chatServiceClient struct {
@@ -56,6 +65,36 @@ func (c *chatServiceClient) StreamMessages(ctx context.Context, opts ...grpc.Cal
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type ChatService_StreamMessagesClient = grpc.BidiStreamingClient[MessageRequest, MessageResponse]
 
+func (c *chatServiceClient) GetMessageRequests(ctx context.Context, in *GetMessageRequestsRequest, opts ...grpc.CallOption) (*GetMessageRequestsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetMessageRequestsResponse)
+	err := c.cc.Invoke(ctx, ChatService_GetMessageRequests_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServiceClient) AcceptMessageRequest(ctx context.Context, in *AcceptMessageRequestRequest, opts ...grpc.CallOption) (*AcceptMessageRequestResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AcceptMessageRequestResponse)
+	err := c.cc.Invoke(ctx, ChatService_AcceptMessageRequest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServiceClient) RejectMessageRequest(ctx context.Context, in *RejectMessageRequestRequest, opts ...grpc.CallOption) (*RejectMessageRequestResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RejectMessageRequestResponse)
+	err := c.cc.Invoke(ctx, ChatService_RejectMessageRequest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ChatServiceServer is the server API for ChatService service.
 // All implementations must embed UnimplementedChatServiceServer
 // for forward compatibility.
@@ -67,6 +106,12 @@ type ChatService_StreamMessagesClient = grpc.BidiStreamingClient[MessageRequest,
 type ChatServiceServer interface {
 	// Bidirectional streaming RPC for sending and receiving messages
 	StreamMessages(grpc.BidiStreamingServer[MessageRequest, MessageResponse]) error
+	// Messages from users who are not your friends are held as message requests until you answer them
+	GetMessageRequests(context.Context, *GetMessageRequestsRequest) (*GetMessageRequestsResponse, error)
+	// Accepting makes the sender your friend and delivers their held messages
+	AcceptMessageRequest(context.Context, *AcceptMessageRequestRequest) (*AcceptMessageRequestResponse, error)
+	// Rejecting drops the held messages; the sender can still send new ones
+	RejectMessageRequest(context.Context, *RejectMessageRequestRequest) (*RejectMessageRequestResponse, error)
 	mustEmbedUnimplementedChatServiceServer()
 }
 
@@ -80,6 +125,15 @@ type UnimplementedChatServiceServer struct{}
 func (UnimplementedChatServiceServer) StreamMessages(grpc.BidiStreamingServer[MessageRequest, MessageResponse]) error {
 	return status.Errorf(codes.Unimplemented, "method StreamMessages not implemented")
 }
+func (UnimplementedChatServiceServer) GetMessageRequests(context.Context, *GetMessageRequestsRequest) (*GetMessageRequestsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMessageRequests not implemented")
+}
+func (UnimplementedChatServiceServer) AcceptMessageRequest(context.Context, *AcceptMessageRequestRequest) (*AcceptMessageRequestResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AcceptMessageRequest not implemented")
+}
+func (UnimplementedChatServiceServer) RejectMessageRequest(context.Context, *RejectMessageRequestRequest) (*RejectMessageRequestResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RejectMessageRequest not implemented")
+}
 func (UnimplementedChatServiceServer) mustEmbedUnimplementedChatServiceServer() {}
 func (UnimplementedChatServiceServer) testEmbeddedByValue()                     {}
 
@@ -108,13 +162,80 @@ func _ChatService_StreamMessages_Handler(srv interface{}, stream grpc.ServerStre
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type ChatService_StreamMessagesServer = grpc.BidiStreamingServer[MessageRequest, MessageResponse]
 
+func _ChatService_GetMessageRequests_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMessageRequestsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).GetMessageRequests(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChatService_GetMessageRequests_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).GetMessageRequests(ctx, req.(*GetMessageRequestsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatService_AcceptMessageRequest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AcceptMessageRequestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).AcceptMessageRequest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChatService_AcceptMessageRequest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).AcceptMessageRequest(ctx, req.(*AcceptMessageRequestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatService_RejectMessageRequest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RejectMessageRequestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).RejectMessageRequest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChatService_RejectMessageRequest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).RejectMessageRequest(ctx, req.(*RejectMessageRequestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // ChatService_ServiceDesc is the grpc.ServiceDesc for ChatService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
 var ChatService_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "chat.ChatService",
 	HandlerType: (*ChatServiceServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetMessageRequests",
+			Handler:    _ChatService_GetMessageRequests_Handler,
+		},
+		{
+			MethodName: "AcceptMessageRequest",
+			Handler:    _ChatService_AcceptMessageRequest_Handler,
+		},
+		{
+			MethodName: "RejectMessageRequest",
+			Handler:    _ChatService_RejectMessageRequest_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "StreamMessages",
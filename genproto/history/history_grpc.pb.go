@@ -0,0 +1,248 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.0
+// source: proto/history/history.proto
+
+package history
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	HistoryTransfer_CreateTransfer_FullMethodName   = "/history.HistoryTransfer/CreateTransfer"
+	HistoryTransfer_GetTransfer_FullMethodName      = "/history.HistoryTransfer/GetTransfer"
+	HistoryTransfer_UploadTransfer_FullMethodName   = "/history.HistoryTransfer/UploadTransfer"
+	HistoryTransfer_DownloadTransfer_FullMethodName = "/history.HistoryTransfer/DownloadTransfer"
+)
+
+// HistoryTransferClient is the client API for HistoryTransfer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Service definition for moving chat history to a new device.
+// The server only relays the payload, which is encrypted to the new device's identity key,
+// and forgets it once it is downloaded or expires.
+type HistoryTransferClient interface {
+	// Called by the new device to open a transfer and get a code to enter on the old device.
+	CreateTransfer(ctx context.Context, in *CreateTransferRequest, opts ...grpc.CallOption) (*CreateTransferResponse, error)
+	// Called by the old device to look up the identity key of the device it is sending to.
+	GetTransfer(ctx context.Context, in *GetTransferRequest, opts ...grpc.CallOption) (*GetTransferResponse, error)
+	// Called by the old device to upload the encrypted history in chunks.
+	UploadTransfer(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[TransferChunk, UploadTransferResponse], error)
+	// Called by the new device to download the encrypted history once it has been uploaded.
+	DownloadTransfer(ctx context.Context, in *DownloadTransferRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TransferChunk], error)
+}
+
+type historyTransferClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewHistoryTransferClient(cc grpc.ClientConnInterface) HistoryTransferClient {
+	return &historyTransferClient{cc}
+}
+
+func (c *historyTransferClient) CreateTransfer(ctx context.Context, in *CreateTransferRequest, opts ...grpc.CallOption) (*CreateTransferResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateTransferResponse)
+	err := c.cc.Invoke(ctx, HistoryTransfer_CreateTransfer_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *historyTransferClient) GetTransfer(ctx context.Context, in *GetTransferRequest, opts ...grpc.CallOption) (*GetTransferResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetTransferResponse)
+	err := c.cc.Invoke(ctx, HistoryTransfer_GetTransfer_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *historyTransferClient) UploadTransfer(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[TransferChunk, UploadTransferResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &HistoryTransfer_ServiceDesc.Streams[0], HistoryTransfer_UploadTransfer_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[TransferChunk, UploadTransferResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type HistoryTransfer_UploadTransferClient = grpc.ClientStreamingClient[TransferChunk, UploadTransferResponse]
+
+func (c *historyTransferClient) DownloadTransfer(ctx context.Context, in *DownloadTransferRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TransferChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &HistoryTransfer_ServiceDesc.Streams[1], HistoryTransfer_DownloadTransfer_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[DownloadTransferRequest, TransferChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type HistoryTransfer_DownloadTransferClient = grpc.ServerStreamingClient[TransferChunk]
+
+// HistoryTransferServer is the server API for HistoryTransfer service.
+// All implementations must embed UnimplementedHistoryTransferServer
+// for forward compatibility.
+//
+// Service definition for moving chat history to a new device.
+// The server only relays the payload, which is encrypted to the new device's identity key,
+// and forgets it once it is downloaded or expires.
+type HistoryTransferServer interface {
+	// Called by the new device to open a transfer and get a code to enter on the old device.
+	CreateTransfer(context.Context, *CreateTransferRequest) (*CreateTransferResponse, error)
+	// Called by the old device to look up the identity key of the device it is sending to.
+	GetTransfer(context.Context, *GetTransferRequest) (*GetTransferResponse, error)
+	// Called by the old device to upload the encrypted history in chunks.
+	UploadTransfer(grpc.ClientStreamingServer[TransferChunk, UploadTransferResponse]) error
+	// Called by the new device to download the encrypted history once it has been uploaded.
+	DownloadTransfer(*DownloadTransferRequest, grpc.ServerStreamingServer[TransferChunk]) error
+	mustEmbedUnimplementedHistoryTransferServer()
+}
+
+// UnimplementedHistoryTransferServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedHistoryTransferServer struct{}
+
+func (UnimplementedHistoryTransferServer) CreateTransfer(context.Context, *CreateTransferRequest) (*CreateTransferResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateTransfer not implemented")
+}
+func (UnimplementedHistoryTransferServer) GetTransfer(context.Context, *GetTransferRequest) (*GetTransferResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTransfer not implemented")
+}
+func (UnimplementedHistoryTransferServer) UploadTransfer(grpc.ClientStreamingServer[TransferChunk, UploadTransferResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method UploadTransfer not implemented")
+}
+func (UnimplementedHistoryTransferServer) DownloadTransfer(*DownloadTransferRequest, grpc.ServerStreamingServer[TransferChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadTransfer not implemented")
+}
+func (UnimplementedHistoryTransferServer) mustEmbedUnimplementedHistoryTransferServer() {}
+func (UnimplementedHistoryTransferServer) testEmbeddedByValue()                         {}
+
+// UnsafeHistoryTransferServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to HistoryTransferServer will
+// result in compilation errors.
+type UnsafeHistoryTransferServer interface {
+	mustEmbedUnimplementedHistoryTransferServer()
+}
+
+func RegisterHistoryTransferServer(s grpc.ServiceRegistrar, srv HistoryTransferServer) {
+	// If the following call pancis, it indicates UnimplementedHistoryTransferServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&HistoryTransfer_ServiceDesc, srv)
+}
+
+func _HistoryTransfer_CreateTransfer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateTransferRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HistoryTransferServer).CreateTransfer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HistoryTransfer_CreateTransfer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HistoryTransferServer).CreateTransfer(ctx, req.(*CreateTransferRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HistoryTransfer_GetTransfer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTransferRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HistoryTransferServer).GetTransfer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HistoryTransfer_GetTransfer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HistoryTransferServer).GetTransfer(ctx, req.(*GetTransferRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HistoryTransfer_UploadTransfer_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(HistoryTransferServer).UploadTransfer(&grpc.GenericServerStream[TransferChunk, UploadTransferResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type HistoryTransfer_UploadTransferServer = grpc.ClientStreamingServer[TransferChunk, UploadTransferResponse]
+
+func _HistoryTransfer_DownloadTransfer_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DownloadTransferRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(HistoryTransferServer).DownloadTransfer(m, &grpc.GenericServerStream[DownloadTransferRequest, TransferChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type HistoryTransfer_DownloadTransferServer = grpc.ServerStreamingServer[TransferChunk]
+
+// HistoryTransfer_ServiceDesc is the grpc.ServiceDesc for HistoryTransfer service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var HistoryTransfer_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "history.HistoryTransfer",
+	HandlerType: (*HistoryTransferServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateTransfer",
+			Handler:    _HistoryTransfer_CreateTransfer_Handler,
+		},
+		{
+			MethodName: "GetTransfer",
+			Handler:    _HistoryTransfer_GetTransfer_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "UploadTransfer",
+			Handler:       _HistoryTransfer_UploadTransfer_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DownloadTransfer",
+			Handler:       _HistoryTransfer_DownloadTransfer_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/history/history.proto",
+}
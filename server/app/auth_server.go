@@ -2,50 +2,52 @@ package app
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/johnkhk/cli_chat_app/genproto/auth"
+	"github.com/johnkhk/cli_chat_app/genproto/friends"
 	"github.com/johnkhk/cli_chat_app/server/storage"
 )
 
 // AuthServer implements the AuthService.
 type AuthServer struct {
 	auth.UnimplementedAuthServiceServer
-	DB                     *sql.DB
+	Repo                   storage.Repository
 	Logger                 *logrus.Logger
 	AccessTokenExpiration  time.Duration
 	RefreshTokenExpiration time.Duration
+	Registration           RegistrationPolicy // Who can create an account
+	Events                 *FriendEventHub    // Tells invite creators about new friends; optional
 }
 
 // NewAuthServer creates a new AuthServer with the given dependencies.
-func NewAuthServer(db *sql.DB, logger *logrus.Logger, accessTokenExpiration, refreshTokenExpiration time.Duration) *AuthServer {
+func NewAuthServer(repo storage.Repository, logger *logrus.Logger, accessTokenExpiration, refreshTokenExpiration time.Duration) *AuthServer {
 	return &AuthServer{
-		DB:                     db,
+		Repo:                   repo,
 		Logger:                 logger,
 		AccessTokenExpiration:  accessTokenExpiration,
 		RefreshTokenExpiration: refreshTokenExpiration,
+		Registration:           RegistrationPolicy{Mode: RegistrationOpen},
 	}
 }
 
 // RegisterUser handles user registration requests.
 func (s *AuthServer) RegisterUser(ctx context.Context, req *auth.RegisterRequest) (*auth.RegisterResponse, error) {
-	s.Logger.Infof("Registering new user: %s", req.Username)
+	s.Logger.Infof("Registering new user: %s (bot: %t)", req.Username, req.IsBot)
 
-	// Check if the user already exists
-	var count int
-	err := s.DB.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", req.Username).Scan(&count)
-	if err != nil {
-		return nil, fmt.Errorf("error checking user existence: %w", err)
-	}
-	if count > 0 {
+	// Check the username against the allowlist before doing any work
+	if !s.Registration.Allows(req.Username) {
+		s.Logger.Warnf("Refused registration of %s: not on the allowlist", req.Username)
 		return &auth.RegisterResponse{
 			Success: false,
-			Message: "Username already exists",
+			Message: "This username is not allowed to register on this server",
 		}, nil
 	}
 
@@ -55,11 +57,67 @@ func (s *AuthServer) RegisterUser(ctx context.Context, req *auth.RegisterRequest
 		return nil, fmt.Errorf("error hashing password: %w", err)
 	}
 
-	// Save the user data to the database
-	_, err = s.DB.Exec("INSERT INTO users (username, password_hash, created_at) VALUES (?, ?, NOW())",
-		req.Username, string(hashedPassword))
-	if err != nil {
-		return nil, fmt.Errorf("error saving user to database: %w", err)
+	inviteCode := normalizeCode(req.InviteCode)
+	if inviteCode == "" {
+		createUser := s.Repo.CreateUser
+		switch s.Registration.Mode {
+		case RegistrationInviteOnly:
+			return &auth.RegisterResponse{
+				Success: false,
+				Message: "This server is invite-only; an invite code is required",
+			}, nil
+		case RegistrationApproval:
+			createUser = s.Repo.CreatePendingUser
+		}
+
+		// Save the user unless the username is taken
+		_, err = createUser(req.Username, string(hashedPassword), req.IsBot)
+		if errors.Is(err, storage.ErrUsernameTaken) {
+			return &auth.RegisterResponse{
+				Success: false,
+				Message: "Username already exists",
+			}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if s.Registration.Mode == RegistrationApproval {
+			s.Logger.Infof("User %s registered and is waiting for approval", req.Username)
+			return &auth.RegisterResponse{
+				Success:         true,
+				Message:         "Account created; an administrator has to approve it before you can log in",
+				PendingApproval: true,
+			}, nil
+		}
+	} else {
+		// An invite from an existing user is enough, even on servers that approve accounts
+		// Save the user and make them a friend of the invite's creator, or neither
+		userID, creator, err := s.Repo.CreateUserWithInvite(req.Username, string(hashedPassword), req.IsBot, inviteCode)
+		switch {
+		case errors.Is(err, storage.ErrUsernameTaken):
+			return &auth.RegisterResponse{
+				Success: false,
+				Message: "Username already exists",
+			}, nil
+		case errors.Is(err, storage.ErrInviteNotFound):
+			return &auth.RegisterResponse{
+				Success: false,
+				Message: "Invite code is invalid, expired or used up",
+			}, nil
+		case err != nil:
+			return nil, err
+		}
+		s.Logger.Infof("User %s registered with an invite from user %d", req.Username, creator.UserID)
+
+		if s.Events != nil {
+			s.Events.Publish(creator.UserID, &friends.FriendEvent{
+				Type:      friends.FriendEventType_INVITE_REDEEMED,
+				UserId:    int32(userID),
+				Username:  req.Username,
+				Timestamp: timestamppb.Now(),
+			})
+		}
 	}
 
 	return &auth.RegisterResponse{
@@ -73,8 +131,7 @@ func (s *AuthServer) LoginUser(ctx context.Context, req *auth.LoginRequest) (*au
 	s.Logger.Infof("User login attempt: %s", req.Username)
 
 	// Retrieve the user data from the database
-	var user storage.User
-	err := s.DB.QueryRow("SELECT id, username, password_hash FROM users WHERE username = ?", req.Username).Scan(&user.ID, &user.Username, &user.Password)
+	user, err := s.Repo.GetUserByUsername(req.Username)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving user data: %w", err)
 	}
@@ -88,6 +145,26 @@ func (s *AuthServer) LoginUser(ctx context.Context, req *auth.LoginRequest) (*au
 		}, nil
 	}
 
+	if user.Pending {
+		s.Logger.Infof("Login attempt for account waiting for approval: %s", req.Username)
+		return &auth.LoginResponse{
+			Success: false,
+			Message: "Account is waiting for an administrator's approval",
+		}, nil
+	}
+
+	if user.Locked {
+		s.Logger.Warnf("Login attempt for locked account: %s", req.Username)
+		return &auth.LoginResponse{
+			Success: false,
+			Message: "Account is locked",
+		}, nil
+	}
+
+	if err := s.Repo.RecordLogin(user.ID); err != nil {
+		s.Logger.Errorf("Failed to record login: %v", err)
+	}
+
 	// Generate new access and refresh tokens using user ID as the subject
 	accessToken, err := generateAccessToken(user.ID, user.Username, s.AccessTokenExpiration)
 	if err != nil {
@@ -114,11 +191,20 @@ func (s *AuthServer) RefreshToken(ctx context.Context, req *auth.RefreshTokenReq
 	refreshToken := req.RefreshToken
 
 	// Validate and parse the refresh token
-	userID, username, err := parseAndValidateRefreshToken(refreshToken)
+	userID, username, issuedAt, err := parseAndValidateRefreshToken(refreshToken)
 	if err != nil {
 		return nil, fmt.Errorf("invalid refresh token: %v", err)
 	}
 
+	// A locked account or a forced logout invalidates refresh tokens too
+	revoked, err := s.Repo.IsRevoked(userID, issuedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check refresh token: %v", err)
+	}
+	if revoked {
+		return nil, fmt.Errorf("invalid refresh token: token has been revoked")
+	}
+
 	// Generate a new access token using the extracted user ID
 	newAccessToken, err := generateAccessToken(userID, username, s.AccessTokenExpiration)
 	if err != nil {
@@ -139,55 +225,30 @@ func (s *AuthServer) UploadPublicKeys(ctx context.Context, req *auth.PublicKeyUp
 		return nil, fmt.Errorf("failed to retrieve userID from context")
 	}
 
-	// Begin a new transaction
-	tx, err := s.DB.BeginTx(ctx, nil)
+	userIDInt, err := strconv.ParseUint(userID, 10, 32)
 	if err != nil {
-		return nil, fmt.Errorf("failed to begin transaction: %v", err)
-	}
-
-	// Insert the primary prekey bundle information, including user_id
-	insertQuery := `
-        INSERT INTO prekey_bundle (user_id, registration_id, device_id, identity_key, pre_key_id, pre_key, signed_pre_key_id, signed_pre_key, signed_pre_key_signature)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-    `
-	_, err = tx.ExecContext(ctx, insertQuery,
-		userID,                    // user_id from context
-		req.RegistrationId,        // registration_id
-		req.DeviceId,              // device_id
-		req.IdentityKey,           // identity_key
-		req.PreKeyId,              // pre_key_id
-		req.PreKey,                // pre_key
-		req.SignedPreKeyId,        // signed_pre_key_id
-		req.SignedPreKey,          // signed_pre_key
-		req.SignedPreKeySignature) // signed_pre_key_signature
+		return nil, fmt.Errorf("invalid user ID format: %w", err)
+	}
+
+	// Store the primary prekey bundle for the device
+	err = s.Repo.SavePreKeyBundle(storage.PreKeyBundle{
+		UserID:                uint32(userIDInt),
+		RegistrationID:        req.RegistrationId,
+		DeviceID:              req.DeviceId,
+		IdentityKey:           req.IdentityKey,
+		PreKeyID:              req.PreKeyId,
+		PreKey:                req.PreKey,
+		SignedPreKeyID:        req.SignedPreKeyId,
+		SignedPreKey:          req.SignedPreKey,
+		SignedPreKeySignature: req.SignedPreKeySignature,
+	})
 	if err != nil {
-		tx.Rollback() // Rollback in case of error
 		s.Logger.Errorf("failed to insert prekey bundle: %v", err)
-		return nil, fmt.Errorf("failed to insert prekey bundle: %v", err)
-	}
-
-	// Uncomment this part if you're handling One-Time PreKeys in the future
-	// if len(req.OneTimePreKeys) > 0 {
-	// 	oneTimePreKeyQuery := `
-	//         INSERT INTO one_time_prekeys (pre_key_id, pre_key, bundle_id)
-	//         VALUES (?, ?, LAST_INSERT_ID())  -- LAST_INSERT_ID() gets the last inserted bundle_id from prekey_bundle
-	//     `
-	// 	for _, oneTimePreKey := range req.OneTimePreKeys {
-	// 		_, err := tx.ExecContext(ctx, oneTimePreKeyQuery,
-	// 			oneTimePreKey.PreKeyId, // One-Time PreKey ID
-	// 			oneTimePreKey.PreKey)   // One-Time PreKey Public Key
-	// 		if err != nil {
-	// 			tx.Rollback() // Rollback in case of error
-	// 			return nil, fmt.Errorf("failed to insert one-time prekey: %v", err)
-	// 		}
-	// 	}
-	// }
-
-	// Commit the transaction
-	if err = tx.Commit(); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+		return nil, err
 	}
 
+	// One-time prekeys (req.OneTimePreKeys) are not stored yet.
+
 	s.Logger.Infof("Public keys uploaded successfully for user: %s", userID)
 	// Return a success response
 	return &auth.PublicKeyUploadResponse{
@@ -196,38 +257,23 @@ func (s *AuthServer) UploadPublicKeys(ctx context.Context, req *auth.PublicKeyUp
 }
 
 func (s *AuthServer) GetPublicKeyBundle(ctx context.Context, req *auth.PublicKeyBundleRequest) (*auth.PublicKeyBundleResponse, error) {
-	var identityKey, preKey, signedPreKey, signedPreKeySignature []byte
-	var preKeyID, signedPreKeyID, userID, registrationID, deviceID uint32
-	var query string
-	var err error
-
-	// If device_id is 0, select the first device's pre-key bundle for the user
-	if req.GetDeviceId() == 0 {
-		query = `SELECT user_id, registration_id, device_id, identity_key, pre_key_id, pre_key, signed_pre_key_id, signed_pre_key, signed_pre_key_signature
-                 FROM prekey_bundle WHERE user_id = ? LIMIT 1`
-		err = s.DB.QueryRow(query, req.GetUserId()).Scan(&userID, &registrationID, &deviceID, &identityKey, &preKeyID, &preKey, &signedPreKeyID, &signedPreKey, &signedPreKeySignature)
-	} else {
-		// Fetch the prekey bundle for the specific device
-		query = `SELECT user_id, registration_id, device_id, identity_key, pre_key_id, pre_key, signed_pre_key_id, signed_pre_key, signed_pre_key_signature
-                 FROM prekey_bundle WHERE user_id = ? AND device_id = ?`
-		err = s.DB.QueryRow(query, req.GetUserId(), req.GetDeviceId()).Scan(&userID, &registrationID, &deviceID, &identityKey, &preKeyID, &preKey, &signedPreKeyID, &signedPreKey, &signedPreKeySignature)
-	}
-
+	// A device ID of 0 selects the user's first device
+	bundle, err := s.Repo.GetPreKeyBundle(req.GetUserId(), req.GetDeviceId())
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch prekey bundle: %v", err)
 	}
 
 	// Return the public key bundle
 	return &auth.PublicKeyBundleResponse{
-		UserId:                userID,
-		RegistrationId:        registrationID,
-		DeviceId:              deviceID,
-		IdentityKey:           identityKey,
-		PreKeyId:              preKeyID,
-		PreKey:                preKey,
-		SignedPreKeyId:        signedPreKeyID,
-		SignedPreKey:          signedPreKey,
-		SignedPreKeySignature: signedPreKeySignature,
+		UserId:                bundle.UserID,
+		RegistrationId:        bundle.RegistrationID,
+		DeviceId:              bundle.DeviceID,
+		IdentityKey:           bundle.IdentityKey,
+		PreKeyId:              bundle.PreKeyID,
+		PreKey:                bundle.PreKey,
+		SignedPreKeyId:        bundle.SignedPreKeyID,
+		SignedPreKey:          bundle.SignedPreKey,
+		SignedPreKeySignature: bundle.SignedPreKeySignature,
 		OneTimePreKeys:        nil, // Handle one-time prekeys if needed
 	}, nil
 }
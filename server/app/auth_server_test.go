@@ -0,0 +1,212 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johnkhk/cli_chat_app/genproto/auth"
+	"github.com/johnkhk/cli_chat_app/genproto/friends"
+)
+
+func newTestAuthServer(t *testing.T) (*AuthServer, *fakeRepository) {
+	t.Setenv("CLI_CHAT_APP_JWT_SECRET_KEY", "dGVzdC1zZWNyZXQtZm9yLWF1dGgtc2VydmVyLXRlc3Rz")
+	repo := newFakeRepository()
+	return NewAuthServer(repo, testLogger(), time.Minute, time.Hour), repo
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	server, repo := newTestAuthServer(t)
+	ctx := context.Background()
+
+	resp, err := server.RegisterUser(ctx, &auth.RegisterRequest{Username: "alice", Password: "secret"})
+	if err != nil || !resp.Success {
+		t.Fatalf("Expected registration to succeed, got %v (err: %v)", resp, err)
+	}
+	resp, err = server.RegisterUser(ctx, &auth.RegisterRequest{Username: "alice", Password: "other"})
+	if err != nil || resp.Success || resp.Message != "Username already exists" {
+		t.Fatalf("Expected a taken username to be refused, got %v (err: %v)", resp, err)
+	}
+
+	login, err := server.LoginUser(ctx, &auth.LoginRequest{Username: "alice", Password: "wrong"})
+	if err != nil || login.Success {
+		t.Fatalf("Expected a wrong password to be refused, got %v (err: %v)", login, err)
+	}
+	login, err = server.LoginUser(ctx, &auth.LoginRequest{Username: "alice", Password: "secret"})
+	if err != nil || !login.Success || login.AccessToken == "" || login.RefreshToken == "" {
+		t.Fatalf("Expected login to succeed with tokens, got %v (err: %v)", login, err)
+	}
+	if user, _ := repo.GetUserByUsername("alice"); user.LastLoginAt == nil {
+		t.Fatalf("Expected the login to be recorded")
+	}
+
+	refreshed, err := server.RefreshToken(ctx, &auth.RefreshTokenRequest{RefreshToken: login.RefreshToken})
+	if err != nil || refreshed.AccessToken == "" {
+		t.Fatalf("Expected the refresh token to work, got %v (err: %v)", refreshed, err)
+	}
+
+	// Revoking the sessions invalidates the refresh token
+	repo.revoked[login.UserId] = time.Now().Add(time.Minute)
+	if _, err := server.RefreshToken(ctx, &auth.RefreshTokenRequest{RefreshToken: login.RefreshToken}); err == nil {
+		t.Fatalf("Expected a revoked refresh token to be refused")
+	}
+}
+
+func TestLoginLockedAccount(t *testing.T) {
+	server, repo := newTestAuthServer(t)
+	ctx := context.Background()
+	if _, err := server.RegisterUser(ctx, &auth.RegisterRequest{Username: "alice", Password: "secret"}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	repo.users[0].Locked = true
+
+	login, err := server.LoginUser(ctx, &auth.LoginRequest{Username: "alice", Password: "secret"})
+	if err != nil || login.Success || login.Message != "Account is locked" {
+		t.Fatalf("Expected a locked account to be refused, got %v (err: %v)", login, err)
+	}
+}
+
+func TestPublicKeyBundle(t *testing.T) {
+	server, repo := newTestAuthServer(t)
+	alice := repo.addUser("alice")
+
+	upload := &auth.PublicKeyUploadRequest{RegistrationId: 7, DeviceId: 2, IdentityKey: []byte("identity"), SignedPreKeySignature: []byte("signature")}
+	if resp, err := server.UploadPublicKeys(userContext(alice, "alice"), upload); err != nil || !resp.Success {
+		t.Fatalf("Expected the upload to succeed, got %v (err: %v)", resp, err)
+	}
+	bundle, err := server.GetPublicKeyBundle(context.Background(), &auth.PublicKeyBundleRequest{UserId: alice})
+	if err != nil || bundle.RegistrationId != 7 || bundle.DeviceId != 2 {
+		t.Fatalf("Unexpected bundle: %v (err: %v)", bundle, err)
+	}
+	if _, err := server.GetPublicKeyBundle(context.Background(), &auth.PublicKeyBundleRequest{UserId: alice, DeviceId: 3}); err == nil {
+		t.Fatalf("Expected no bundle for another device")
+	}
+}
+
+func TestRegisterWithInvite(t *testing.T) {
+	server, repo := newTestAuthServer(t)
+	server.Registration.Mode = RegistrationInviteOnly
+	server.Events = NewFriendEventHub(testLogger())
+	ctx := context.Background()
+	alice := repo.addUser("alice")
+	events, unsubscribe := server.Events.Subscribe(alice)
+	defer unsubscribe()
+
+	resp, err := server.RegisterUser(ctx, &auth.RegisterRequest{Username: "bob", Password: "secret"})
+	if err != nil || resp.Success {
+		t.Fatalf("Expected registering without an invite to be refused, got %v (err: %v)", resp, err)
+	}
+	resp, err = server.RegisterUser(ctx, &auth.RegisterRequest{Username: "bob", Password: "secret", InviteCode: "NOPE-NOPE"})
+	if err != nil || resp.Success {
+		t.Fatalf("Expected an unknown invite to be refused, got %v (err: %v)", resp, err)
+	}
+	if _, err := repo.GetUserByUsername("bob"); err == nil {
+		t.Fatalf("Expected no account to be created for a refused invite")
+	}
+
+	repo.CreateInvite(alice, "ABCDEFGH", 1, time.Now().Add(time.Hour))
+	resp, err = server.RegisterUser(ctx, &auth.RegisterRequest{Username: "bob", Password: "secret", InviteCode: "abcd-efgh"})
+	if err != nil || !resp.Success {
+		t.Fatalf("Expected registering with an invite to succeed, got %v (err: %v)", resp, err)
+	}
+	bob, _ := repo.GetUserByUsername("bob")
+	if areFriends, _ := repo.AreFriends(alice, bob.ID); !areFriends {
+		t.Fatalf("Expected the new account to be the invite creator's friend")
+	}
+	if event := <-events; event.Type != friends.FriendEventType_INVITE_REDEEMED || event.UserId != int32(bob.ID) {
+		t.Fatalf("Expected alice to hear that bob redeemed the invite, got %v", event)
+	}
+
+	// A locked account's invites stop letting anyone in
+	repo.CreateInvite(alice, "LOCKED12", 5, time.Now().Add(time.Hour))
+	repo.mu.Lock()
+	repo.userByID(alice).Locked = true
+	repo.mu.Unlock()
+	resp, err = server.RegisterUser(ctx, &auth.RegisterRequest{Username: "carol", Password: "secret", InviteCode: "LOCKED12"})
+	if err != nil || resp.Success {
+		t.Fatalf("Expected the invite of a locked account to be refused, got %v (err: %v)", resp, err)
+	}
+	if _, err := repo.GetUserByUsername("carol"); err == nil {
+		t.Fatalf("Expected no account to be created with a locked account's invite")
+	}
+}
+
+func TestRegisterWithApproval(t *testing.T) {
+	server, repo := newTestAuthServer(t)
+	server.Registration.Mode = RegistrationApproval
+	ctx := context.Background()
+
+	resp, err := server.RegisterUser(ctx, &auth.RegisterRequest{Username: "alice", Password: "secret"})
+	if err != nil || !resp.Success || !resp.PendingApproval {
+		t.Fatalf("Expected the account to wait for approval, got %v (err: %v)", resp, err)
+	}
+	login, err := server.LoginUser(ctx, &auth.LoginRequest{Username: "alice", Password: "secret"})
+	if err != nil || login.Success || !strings.Contains(login.Message, "approval") {
+		t.Fatalf("Expected a pending account not to log in, got %v (err: %v)", login, err)
+	}
+
+	// Approving lets the account log in
+	repo.users[0].Pending = false
+	login, err = server.LoginUser(ctx, &auth.LoginRequest{Username: "alice", Password: "secret"})
+	if err != nil || !login.Success {
+		t.Fatalf("Expected an approved account to log in, got %v (err: %v)", login, err)
+	}
+
+	// An invite from an existing user counts as approval
+	repo.CreateInvite(login.UserId, "ABCDEFGH", 1, time.Now().Add(time.Hour))
+	resp, err = server.RegisterUser(ctx, &auth.RegisterRequest{Username: "bob", Password: "secret", InviteCode: "ABCD-EFGH"})
+	if err != nil || !resp.Success || resp.PendingApproval {
+		t.Fatalf("Expected registering with an invite not to wait for approval, got %v (err: %v)", resp, err)
+	}
+	if user, _ := repo.GetUserByUsername("bob"); user.Pending {
+		t.Fatalf("Expected bob not to be pending")
+	}
+}
+
+func TestRegisterAllowlist(t *testing.T) {
+	server, _ := newTestAuthServer(t)
+	allowlist, err := ParseAllowlist("@example.com, ops-*")
+	if err != nil {
+		t.Fatalf("Failed to parse allowlist: %v", err)
+	}
+	server.Registration.Allowlist = allowlist
+	ctx := context.Background()
+
+	for username, allowed := range map[string]bool{
+		"alice@example.com":  true,
+		"Bob@EXAMPLE.com":    true,
+		"ops-bot":            true,
+		"mallory@evil.com":   false,
+		"eve@example.com.io": false,
+		"carol":              false,
+	} {
+		resp, err := server.RegisterUser(ctx, &auth.RegisterRequest{Username: username, Password: "secret"})
+		if err != nil || resp.Success != allowed {
+			t.Errorf("Expected registering %s to be allowed: %t, got %v (err: %v)", username, allowed, resp, err)
+		}
+	}
+
+	if _, err := ParseAllowlist("[a-"); err == nil {
+		t.Fatalf("Expected a malformed pattern to be refused")
+	}
+}
+
+func TestRegistrationPolicyFromEnv(t *testing.T) {
+	t.Setenv("REGISTRATION_MODE", "")
+	t.Setenv("REGISTRATION_ALLOWLIST", "")
+	if policy, err := RegistrationPolicyFromEnv(); err != nil || policy.Mode != RegistrationOpen || len(policy.Allowlist) != 0 {
+		t.Fatalf("Expected open registration by default, got %+v (err: %v)", policy, err)
+	}
+
+	t.Setenv("REGISTRATION_MODE", "Approval")
+	t.Setenv("REGISTRATION_ALLOWLIST", "@example.com,")
+	if policy, err := RegistrationPolicyFromEnv(); err != nil || policy.Mode != RegistrationApproval || len(policy.Allowlist) != 1 {
+		t.Fatalf("Expected approval with one pattern, got %+v (err: %v)", policy, err)
+	}
+
+	t.Setenv("REGISTRATION_MODE", "closed")
+	if _, err := RegistrationPolicyFromEnv(); err == nil {
+		t.Fatalf("Expected an unknown mode to be refused")
+	}
+}
@@ -15,9 +15,15 @@ type TokenValidator interface {
 	ValidateToken(token string) (userID string, username string, err error)
 }
 
+// RevocationChecker reports whether a token issued to a user at a given time has been revoked.
+type RevocationChecker interface {
+	IsRevoked(userID uint32, issuedAt time.Time) (bool, error)
+}
+
 // JWTTokenValidator is a struct that implements the TokenValidator interface using JWT.
 type JWTTokenValidator struct {
-	secretKey string
+	secretKey   string
+	Revocations RevocationChecker // Optional check for locked accounts and revoked sessions
 }
 
 // NewJWTTokenValidator creates a new instance of JWTTokenValidator.
@@ -62,6 +68,21 @@ func (v *JWTTokenValidator) ValidateToken(tokenString string) (string, string, e
 			return "", "", fmt.Errorf("invalid username in token claims")
 		}
 
+		// Reject tokens of locked accounts and tokens issued before a forced logout
+		if v.Revocations != nil {
+			parsedUserID, err := parseUint32(userID)
+			if err != nil {
+				return "", "", fmt.Errorf("failed to parse user ID: %v", err)
+			}
+			revoked, err := v.Revocations.IsRevoked(parsedUserID, issuedAt(claims))
+			if err != nil {
+				return "", "", err
+			}
+			if revoked {
+				return "", "", fmt.Errorf("token has been revoked")
+			}
+		}
+
 		return userID, username, nil
 	}
 
@@ -93,6 +114,7 @@ func generateAccessToken(userID uint32, username string, expirationDuration time
 		"sub":      fmt.Sprintf("%d", userID),                 // Use user ID as subject
 		"username": username,                                  // Add username to claims
 		"exp":      time.Now().Add(expirationDuration).Unix(), // Token expires based on the given duration
+		"iat":      time.Now().Unix(),                         // Issue time, checked against forced logouts
 		"nonce":    randomValue,                               // Add a minimal random claim to ensure uniqueness
 
 	}
@@ -128,6 +150,7 @@ func generateRefreshToken(userID uint32, username string, expirationDuration tim
 		"sub":      fmt.Sprintf("%d", userID),                 // Use user ID as subject
 		"username": username,                                  // Add username to claims
 		"exp":      time.Now().Add(expirationDuration).Unix(), // Refresh token expires based on the given duration
+		"iat":      time.Now().Unix(),                         // Issue time, checked against forced logouts
 		"nonce":    randomValue,                               // Add a minimal random claim to ensure uniqueness
 	}
 
@@ -143,11 +166,11 @@ func generateRefreshToken(userID uint32, username string, expirationDuration tim
 	return refreshToken, nil
 }
 
-// Helper function to validate and parse the refresh token.
-func parseAndValidateRefreshToken(tokenString string) (uint32, string, error) {
+// Helper function to validate and parse the refresh token. It also returns when the token was issued.
+func parseAndValidateRefreshToken(tokenString string) (uint32, string, time.Time, error) {
 	secretKey := os.Getenv("CLI_CHAT_APP_JWT_SECRET_KEY")
 	if secretKey == "" {
-		return 0, "", fmt.Errorf("JWT secret key is not set")
+		return 0, "", time.Time{}, fmt.Errorf("JWT secret key is not set")
 	}
 
 	// Parse the token.
@@ -161,39 +184,39 @@ func parseAndValidateRefreshToken(tokenString string) (uint32, string, error) {
 	})
 
 	if err != nil {
-		return 0, "", err
+		return 0, "", time.Time{}, err
 	}
 
 	// Check if the token is valid.
 	if !token.Valid {
-		return 0, "", fmt.Errorf("invalid token")
+		return 0, "", time.Time{}, fmt.Errorf("invalid token")
 	}
 
 	// Extract the claims from the token.
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok || !token.Valid {
-		return 0, "", fmt.Errorf("invalid token claims")
+		return 0, "", time.Time{}, fmt.Errorf("invalid token claims")
 	}
 
 	// Extract the user ID from the claims.
 	userID, ok := claims["sub"].(string)
 	if !ok {
-		return 0, "", fmt.Errorf("invalid user ID in token claims")
+		return 0, "", time.Time{}, fmt.Errorf("invalid user ID in token claims")
 	}
 
 	// Parse the user ID string to int64.
 	parsedUserID, err := parseUint32(userID)
 	if err != nil {
-		return 0, "", fmt.Errorf("failed to parse user ID: %v", err)
+		return 0, "", time.Time{}, fmt.Errorf("failed to parse user ID: %v", err)
 	}
 
 	// Extract the username from the claims (if added).
 	username, ok := claims["username"].(string)
 	if !ok {
-		return 0, "", fmt.Errorf("invalid username in token claims")
+		return 0, "", time.Time{}, fmt.Errorf("invalid username in token claims")
 	}
 
-	return parsedUserID, username, nil
+	return parsedUserID, username, issuedAt(claims), nil
 }
 
 // Helper function to parse a string to uint32.
@@ -205,3 +228,11 @@ func parseUint32(s string) (uint32, error) {
 	}
 	return id, nil
 }
+
+// issuedAt returns the token's "iat" claim, or the zero time for tokens issued without one.
+func issuedAt(claims jwt.MapClaims) time.Time {
+	if iat, ok := claims["iat"].(float64); ok {
+		return time.Unix(int64(iat), 0)
+	}
+	return time.Time{}
+}
@@ -0,0 +1,167 @@
+package app
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/johnkhk/cli_chat_app/genproto/chat"
+)
+
+// BusRouter is a MessageRouter for running several server nodes behind a load balancer.
+// Streams held by this node are delivered to directly; everything else goes through the bus,
+// which knows which node holds each user's stream and keeps messages for offline users.
+type BusRouter struct {
+	NodeID      string
+	Bus         MessageBus
+	Logger      *logrus.Logger
+	local       *LocalRouter
+	unsubscribe func()
+}
+
+var _ MessageRouter = (*BusRouter)(nil)
+
+// NewBusRouter creates a router for the node and subscribes it to messages forwarded by other nodes.
+func NewBusRouter(nodeID string, bus MessageBus, logger *logrus.Logger) (*BusRouter, error) {
+	r := &BusRouter{
+		NodeID: nodeID,
+		Bus:    bus,
+		Logger: logger,
+		local:  NewLocalRouter(logger),
+	}
+
+	unsubscribe, err := bus.Subscribe(nodeID, r.handleForwarded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe node %s to message bus: %w", nodeID, err)
+	}
+	r.unsubscribe = unsubscribe
+
+	return r, nil
+}
+
+// MessageRouterFromEnv creates the router selected by MESSAGE_BUS. Unset or local gives a LocalRouter, which
+// only suits a single server. sql gives a BusRouter over an SQLBus in db, shared by every server node using
+// the same database. NODE_ID names this node on the bus, defaults to the host name and must differ between
+// nodes. The returned func stops the router.
+func MessageRouterFromEnv(db *sql.DB, logger *logrus.Logger) (MessageRouter, func(), error) {
+	switch bus := strings.ToLower(strings.TrimSpace(os.Getenv("MESSAGE_BUS"))); bus {
+	case "", "local":
+		return NewLocalRouter(logger), func() {}, nil
+	case "sql":
+		nodeID := strings.TrimSpace(os.Getenv("NODE_ID"))
+		if nodeID == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				return nil, nil, fmt.Errorf("NODE_ID is not set and the host name is unknown: %w", err)
+			}
+			nodeID = hostname
+		}
+		router, err := NewBusRouter(nodeID, NewSQLBus(db, logger), logger)
+		if err != nil {
+			return nil, nil, err
+		}
+		return router, router.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown MESSAGE_BUS %q, expected local or sql", bus)
+	}
+}
+
+// Close stops receiving messages forwarded by other nodes.
+func (r *BusRouter) Close() {
+	r.unsubscribe()
+}
+
+// Register attaches the stream to this node and announces the user's presence on the bus.
+func (r *BusRouter) Register(userID uint32, stream chat.ChatService_StreamMessagesServer) {
+	r.local.Register(userID, stream)
+	if err := r.Bus.SetPresence(userID, r.NodeID); err != nil {
+		r.Logger.Errorf("Failed to set presence of user %d on node %s: %v", userID, r.NodeID, err)
+	}
+}
+
+// Unregister detaches the stream and clears the user's presence if it still points at this node.
+// If the user has reconnected to this node, the newer stream and its presence are kept.
+func (r *BusRouter) Unregister(userID uint32, stream chat.ChatService_StreamMessagesServer) {
+	if !r.local.unregister(userID, stream) {
+		return
+	}
+	if err := r.Bus.ClearPresence(userID, r.NodeID); err != nil {
+		r.Logger.Errorf("Failed to clear presence of user %d on node %s: %v", userID, r.NodeID, err)
+	}
+}
+
+// Disconnect ends the user's stream if this node holds it. Every node watches for revoked sessions,
+// so streams on other nodes are ended by those nodes.
+func (r *BusRouter) Disconnect(userID uint32) bool {
+	return r.local.Disconnect(userID)
+}
+
+// IsOnline reports whether the user has a stream on this node or any other.
+func (r *BusRouter) IsOnline(userID uint32) bool {
+	if r.local.IsOnline(userID) {
+		return true
+	}
+	_, ok, err := r.Bus.Presence(userID)
+	if err != nil {
+		r.Logger.Errorf("Failed to look up presence of user %d: %v", userID, err)
+		return false
+	}
+	return ok
+}
+
+// Route delivers the message to a local stream, forwards it to the node holding the recipient's stream,
+// or queues it on the bus if the recipient is offline. A forwarded message counts as delivered.
+func (r *BusRouter) Route(resp *chat.MessageResponse) (bool, error) {
+	delivered, err := r.local.deliverLocal(resp)
+	if err != nil || delivered {
+		return delivered, err
+	}
+
+	nodeID, ok, err := r.Bus.Presence(resp.RecipientId)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up presence of user %d: %w", resp.RecipientId, err)
+	}
+
+	if ok && nodeID != r.NodeID {
+		r.Logger.Infof("Forwarding message ID %s for recipient %d to node %s", resp.MessageId, resp.RecipientId, nodeID)
+		if err := r.Bus.Publish(nodeID, resp); err != nil {
+			return false, fmt.Errorf("failed to forward message ID %s to node %s: %w", resp.MessageId, nodeID, err)
+		}
+		return true, nil
+	}
+
+	r.Logger.Warnf("Recipient %d is not connected, queueing message ID %s on the bus", resp.RecipientId, resp.MessageId)
+	if err := r.Bus.Enqueue(resp.RecipientId, resp); err != nil {
+		return false, fmt.Errorf("failed to queue message ID %s: %w", resp.MessageId, err)
+	}
+	return false, nil
+}
+
+// TakeUndelivered drains the messages queued on the bus for the user.
+func (r *BusRouter) TakeUndelivered(userID uint32) ([]*chat.MessageResponse, error) {
+	return r.Bus.Drain(userID)
+}
+
+// QueueDepths returns the queue depths kept by the bus, which cover every node.
+func (r *BusRouter) QueueDepths() (map[uint32]int, error) {
+	return r.Bus.QueueDepths()
+}
+
+// handleForwarded delivers a message forwarded by another node. If the recipient has
+// disconnected in the meantime, the message is queued for their next connection.
+func (r *BusRouter) handleForwarded(resp *chat.MessageResponse) {
+	delivered, err := r.local.deliverLocal(resp)
+	if err != nil {
+		r.Logger.Errorf("Failed to deliver forwarded message ID %s: %v", resp.MessageId, err)
+	}
+	if delivered {
+		return
+	}
+
+	if err := r.Bus.Enqueue(resp.RecipientId, resp); err != nil {
+		r.Logger.Errorf("Failed to queue forwarded message ID %s: %v", resp.MessageId, err)
+	}
+}
@@ -2,38 +2,72 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/johnkhk/cli_chat_app/genproto/chat"
+	"github.com/johnkhk/cli_chat_app/genproto/friends"
+	"github.com/johnkhk/cli_chat_app/server/storage"
 )
 
+// BlockChecker reports whether either of two users has blocked the other.
+type BlockChecker interface {
+	IsBlocked(userID, otherID uint32) (bool, error)
+}
+
+// MessageRequestStore tells friends apart and holds the messages of everyone else until the recipient answers.
+type MessageRequestStore interface {
+	AreFriends(userID, otherID uint32) (bool, error)
+	storage.MessageRequestRepository
+}
+
+// ActivityRecorder notes when friends message each other, so friend lists can put recent conversations first.
+type ActivityRecorder interface {
+	RecordFriendActivity(userID, friendID uint32) error
+}
+
+// errBlocked is returned by route for messages between users when one has blocked the other.
+var errBlocked = errors.New("sender or recipient is blocked")
+
 type ChatServiceServer struct {
 	chat.UnimplementedChatServiceServer
-	ActiveClients       map[uint32]chat.ChatService_StreamMessagesServer // Map from userID to their active stream
-	UndeliveredMessages map[uint32][]*chat.MessageResponse               // Map from userID to their undelivered messages
-	mu                  sync.RWMutex                                     // Protect access to ActiveClients and UndeliveredMessages
-	Logger              *logrus.Logger
+	Router       MessageRouter        // Routes messages to the node holding the recipient's stream
+	SendQueue    SendQueueConfig      // Outbound queue settings for each connected client
+	QueueMetrics *SendQueueMetrics    // Depth and overflow counters across all client queues
+	Dedup        *MessageDeduplicator // Suppresses retried messages by (sender, message ID)
+	Blocks       BlockChecker         // Refuses messages between blocked users; optional
+	Requests     MessageRequestStore  // Holds messages from non-friends as message requests; optional
+	Events       *FriendEventHub      // Tells recipients about new message requests; optional
+	Activity     ActivityRecorder     // Records when friends last messaged each other; optional
+	Logger       *logrus.Logger
 }
 
-func NewChatServiceServer(logger *logrus.Logger) *ChatServiceServer {
+// NewChatServiceServer creates a chat server that delivers messages through the given router.
+// A nil router defaults to an in-process LocalRouter.
+func NewChatServiceServer(logger *logrus.Logger, router MessageRouter) *ChatServiceServer {
+	if router == nil {
+		router = NewLocalRouter(logger)
+	}
 	return &ChatServiceServer{
-		ActiveClients:       make(map[uint32]chat.ChatService_StreamMessagesServer),
-		UndeliveredMessages: make(map[uint32][]*chat.MessageResponse),
-		Logger:              logger,
+		Router:       router,
+		SendQueue:    DefaultSendQueueConfig(),
+		QueueMetrics: NewSendQueueMetrics(),
+		Dedup:        NewMessageDeduplicator(DefaultDedupWindow),
+		Logger:       logger,
 	}
 }
 
-// IsActiveClient checks if a user is in the ActiveClients map.
+// IsActiveClient checks if a user has an open stream on any node.
 func (s *ChatServiceServer) IsActiveClient(userID uint32) bool {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	_, exists := s.ActiveClients[userID]
-	return exists
+	return s.Router.IsOnline(userID)
 }
 
 // StreamMessages handles bidirectional message streaming between users.
@@ -49,9 +83,19 @@ func (s *ChatServiceServer) StreamMessages(stream chat.ChatService_StreamMessage
 	}
 	s.Logger.Infof("User %d connected with stream", senderID)
 
-	// Register the sender's stream in the active clients map when the stream is established.
-	s.registerClient(senderID, stream)
-	defer s.unregisterClient(senderID)
+	// All writes to the client go through a bounded queue drained by its own goroutine,
+	// so a slow reader never blocks the senders writing to them.
+	out := NewSendQueue(senderID, stream, s.SendQueue, s.QueueMetrics, s.Logger)
+	stream = out
+
+	// Register the sender's stream with the router when the stream is established.
+	// Once it is unregistered, messages it could not take are routed again, which stores them.
+	var undelivered []*chat.MessageResponse
+	s.Router.Register(senderID, stream)
+	defer func() {
+		s.Router.Unregister(senderID, stream)
+		s.requeueUnsent(senderID, append(out.Close(), undelivered...))
+	}()
 
 	// Send a welcome message after the stream is established.
 	welcomeResponse := &chat.MessageResponse{
@@ -76,18 +120,28 @@ func (s *ChatServiceServer) StreamMessages(stream chat.ChatService_StreamMessage
 	}
 	s.Logger.Infof("Sent welcome message to user %d", senderID)
 
-	// Deliver any undelivered messages to the client.
-	if err := s.deliverUndeliveredMessages(senderID); err != nil {
+	// Deliver any undelivered messages to the client. If the client can't take them all, end the stream
+	// so the rest are stored again for its next connection.
+	undelivered, err = s.deliverUndeliveredMessages(senderID, stream)
+	if len(undelivered) > 0 {
+		s.Logger.Errorf("Ending stream of user %d with %d undelivered messages left: %v", senderID, len(undelivered), err)
+		return status.Error(codes.Unavailable, "could not deliver stored messages; reconnect to receive them")
+	}
+	if err != nil {
 		s.Logger.Errorf("Failed to deliver undelivered messages to user %d: %v", senderID, err)
 	}
 
+	incoming := receiveMessages(stream)
 	for {
 		select {
 		case <-ctx.Done(): // Handle client disconnection more explicitly.
 			s.Logger.Infof("Client %d context closed: %v", senderID, ctx.Err())
 			return nil
-		default:
-			req, err := stream.Recv() // Blocking call to receive a message.
+		case <-out.Disconnected():
+			s.Logger.Infof("Ending stream of user %d, whose session was revoked", senderID)
+			return status.Error(codes.Unauthenticated, "session revoked")
+		case r := <-incoming:
+			req, err := r.req, r.err
 			if err == io.EOF {
 				s.Logger.Infof("Stream closed by client %d", senderID)
 				return nil // Client closed the stream.
@@ -103,8 +157,35 @@ func (s *ChatServiceServer) StreamMessages(stream chat.ChatService_StreamMessage
 
 			s.Logger.Infof("Received message with ID %s from user %d to recipient %d", req.MessageId, senderID, req.RecipientId)
 
-			// Send the message directly to the recipient's stream if they are connected.
-			if err := s.sendMessageToRecipient(&chat.MessageResponse{
+			// Acknowledge retries of a message that was already routed instead of delivering it twice.
+			if req.MessageId != "" {
+				if deliveryStatus, duplicate := s.Dedup.Claim(senderID, req.MessageId); duplicate {
+					s.Logger.Infof("Duplicate message ID %s from user %d, skipping delivery", req.MessageId, senderID)
+					if deliveryStatus == "" {
+						continue // The original is still being routed and will be acknowledged.
+					}
+					duplicateResponse := &chat.MessageResponse{
+						SenderId:       senderID,
+						SenderUsername: senderUsername,
+						RecipientId:    req.RecipientId,
+						MessageId:      req.MessageId,
+						Status:         deliveryStatus,
+						Timestamp:      time.Now().Format(time.RFC3339),
+						EncryptionType: req.EncryptionType,
+						FileName:       req.FileName,
+						FileType:       req.FileType,
+						FileSize:       req.FileSize,
+					}
+					if err := stream.Send(duplicateResponse); err != nil {
+						s.Logger.Errorf("Failed to acknowledge duplicate message to sender %d: %v", senderID, err)
+						return err
+					}
+					continue
+				}
+			}
+
+			// Route the message to the recipient's stream, wherever it is connected.
+			routeStatus, err := s.route(&chat.MessageResponse{
 				SenderId:         senderID,
 				SenderUsername:   senderUsername, // Include sender's username
 				RecipientId:      req.RecipientId,
@@ -116,8 +197,10 @@ func (s *ChatServiceServer) StreamMessages(stream chat.ChatService_StreamMessage
 				FileName:         req.FileName,
 				FileType:         req.FileType,
 				FileSize:         req.FileSize,
-			}); err != nil {
+			})
+			if err != nil {
 				s.Logger.Errorf("Failed to send/store message ID %s to recipient %d: %v", req.MessageId, req.RecipientId, err)
+				s.Dedup.Forget(senderID, req.MessageId) // Let the client retry
 
 				// Send a response back to the sender indicating a failed delivery.
 				failedDeliveryResponse := &chat.MessageResponse{
@@ -137,13 +220,8 @@ func (s *ChatServiceServer) StreamMessages(stream chat.ChatService_StreamMessage
 					return sendErr
 				}
 			} else {
-				var status string
-				if s.IsActiveClient(req.RecipientId) {
-					status = "delivered"
-				} else {
-					status = "stored"
-				}
-				s.Logger.Infof("Message ID %s successfully processed for recipient %d with status %s", req.MessageId, req.RecipientId, status)
+				s.Logger.Infof("Message ID %s successfully processed for recipient %d with status %s", req.MessageId, req.RecipientId, routeStatus)
+				s.Dedup.Record(senderID, req.MessageId, routeStatus)
 
 				// Send a response back to the sender indicating message status.
 				deliveryResponse := &chat.MessageResponse{
@@ -152,7 +230,7 @@ func (s *ChatServiceServer) StreamMessages(stream chat.ChatService_StreamMessage
 					RecipientId:      req.RecipientId,
 					MessageId:        req.MessageId,
 					EncryptedMessage: req.EncryptedMessage, // Include the actual message content for confirmation.
-					Status:           status,
+					Status:           routeStatus,
 					Timestamp:        time.Now().Format(time.RFC3339),
 					EncryptionType:   req.EncryptionType,
 					FileName:         req.FileName,
@@ -163,10 +241,200 @@ func (s *ChatServiceServer) StreamMessages(stream chat.ChatService_StreamMessage
 					s.Logger.Errorf("Failed to send delivery confirmation to sender %d: %v", senderID, err)
 					return err
 				}
-				s.Logger.Infof("Sent delivery confirmation for message ID %s with status %s", req.MessageId, status)
+				s.Logger.Infof("Sent delivery confirmation for message ID %s with status %s", req.MessageId, routeStatus)
+			}
+		}
+	}
+}
+
+// receivedMessage is a message read from a client stream, or the error that ended it.
+type receivedMessage struct {
+	req *chat.MessageRequest
+	err error
+}
+
+// receiveMessages reads the stream in its own goroutine, so the handler can stop waiting for the client
+// when the stream is disconnected. It stops after the first error or once the stream has ended.
+func receiveMessages(stream chat.ChatService_StreamMessagesServer) <-chan receivedMessage {
+	messages := make(chan receivedMessage)
+	go func() {
+		for {
+			req, err := stream.Recv() // Blocking call to receive a message.
+			select {
+			case messages <- receivedMessage{req: req, err: err}:
+			case <-stream.Context().Done():
+				return
 			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return messages
+}
+
+// route hands a message to the router and returns the status to acknowledge it with: "delivered" if the recipient
+// was online, "stored" if it was queued for them, or "request_held" if the sender is not their friend and the
+// message waits for them to accept a message request.
+// Messages between users who have blocked one another fail like any other undeliverable message,
+// so the sender can't tell they were blocked.
+func (s *ChatServiceServer) route(msg *chat.MessageResponse) (string, error) {
+	if s.Blocks != nil {
+		blocked, err := s.Blocks.IsBlocked(msg.SenderId, msg.RecipientId)
+		if err != nil {
+			return "", fmt.Errorf("failed to check blocks: %w", err)
+		}
+		if blocked {
+			return "", errBlocked
+		}
+	}
+
+	if s.Requests != nil {
+		friends, err := s.Requests.AreFriends(msg.SenderId, msg.RecipientId)
+		if err != nil {
+			return "", fmt.Errorf("failed to check friendship: %w", err)
+		}
+		if !friends {
+			return "request_held", s.holdMessage(msg)
+		}
+	}
+
+	delivered, err := s.Router.Route(msg)
+	if err != nil {
+		return "", err
+	}
+	if s.Activity != nil {
+		// Only sorts friend lists, so it is not worth failing the message over
+		if err := s.Activity.RecordFriendActivity(msg.SenderId, msg.RecipientId); err != nil {
+			s.Logger.Warnf("Failed to record activity of users %d and %d: %v", msg.SenderId, msg.RecipientId, err)
+		}
+	}
+	if delivered {
+		return "delivered", nil
+	}
+	return "stored", nil
+}
+
+// holdMessage keeps a message from a non-friend as part of their message request,
+// letting the recipient know when it is the first one.
+func (s *ChatServiceServer) holdMessage(msg *chat.MessageResponse) error {
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+	held, err := s.Requests.HoldMessage(storage.HeldMessage{
+		SenderID:    msg.SenderId,
+		RecipientID: msg.RecipientId,
+		MessageID:   msg.MessageId,
+		Payload:     payload,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to hold message: %w", err)
+	}
+	s.Logger.Infof("Held message ID %s from user %d for user %d, who is not their friend (%d waiting)", msg.MessageId, msg.SenderId, msg.RecipientId, held)
+
+	if held == 1 && s.Events != nil {
+		s.Events.Publish(msg.RecipientId, &friends.FriendEvent{
+			Type:      friends.FriendEventType_MESSAGE_REQUEST_RECEIVED,
+			UserId:    int32(msg.SenderId),
+			Username:  msg.SenderUsername,
+			Timestamp: timestamppb.Now(),
+		})
+	}
+	return nil
+}
+
+// GetMessageRequests lists the users whose messages are waiting for the user to accept them.
+func (s *ChatServiceServer) GetMessageRequests(ctx context.Context, req *chat.GetMessageRequestsRequest) (*chat.GetMessageRequestsResponse, error) {
+	userID, _, err := s.extractSenderIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.Requests == nil {
+		return &chat.GetMessageRequestsResponse{}, nil
+	}
+
+	requests, err := s.Requests.MessageRequests(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []*chat.PendingMessageRequest
+	for _, request := range requests {
+		pending = append(pending, &chat.PendingMessageRequest{
+			SenderId:       request.SenderID,
+			SenderUsername: request.SenderUsername,
+			MessageCount:   uint32(request.Messages),
+			LastReceivedAt: request.LastReceivedAt.Format(time.RFC3339),
+		})
+	}
+	return &chat.GetMessageRequestsResponse{Requests: pending}, nil
+}
+
+// AcceptMessageRequest makes the sender the user's friend and delivers the messages they sent before.
+func (s *ChatServiceServer) AcceptMessageRequest(ctx context.Context, req *chat.AcceptMessageRequestRequest) (*chat.AcceptMessageRequestResponse, error) {
+	userID, username, err := s.extractSenderIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.Requests == nil {
+		return &chat.AcceptMessageRequestResponse{Success: false, Message: "Message requests are not enabled"}, nil
+	}
+
+	held, err := s.Requests.AcceptMessageRequest(userID, req.SenderId)
+	if errors.Is(err, storage.ErrMessageRequestNotFound) {
+		return &chat.AcceptMessageRequestResponse{Success: false, Message: "No messages from this user are waiting"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The friendship is in place, so a message that fails to route now is lost like any other
+	var delivered uint32
+	for _, message := range held {
+		var msg chat.MessageResponse
+		if err := proto.Unmarshal(message.Payload, &msg); err != nil {
+			s.Logger.Errorf("Failed to decode held message ID %s: %v", message.MessageID, err)
+			continue
 		}
+		if _, err := s.Router.Route(&msg); err != nil {
+			s.Logger.Errorf("Failed to route held message ID %s to user %d: %v", message.MessageID, userID, err)
+			continue
+		}
+		delivered++
+	}
+	s.Logger.Infof("User %d accepted the message request of user %d, delivering %d of %d messages", userID, req.SenderId, delivered, len(held))
+
+	// To the sender, being accepted is like having their friend request accepted
+	if s.Events != nil {
+		s.Events.Publish(req.SenderId, &friends.FriendEvent{
+			Type:      friends.FriendEventType_FRIEND_REQUEST_ACCEPTED,
+			UserId:    int32(userID),
+			Username:  username,
+			Timestamp: timestamppb.Now(),
+		})
 	}
+	return &chat.AcceptMessageRequestResponse{Success: true, Message: "Message request accepted", Delivered: delivered}, nil
+}
+
+// RejectMessageRequest drops the messages the sender is waiting to have accepted, without telling them.
+func (s *ChatServiceServer) RejectMessageRequest(ctx context.Context, req *chat.RejectMessageRequestRequest) (*chat.RejectMessageRequestResponse, error) {
+	userID, _, err := s.extractSenderIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.Requests == nil {
+		return &chat.RejectMessageRequestResponse{Success: false, Message: "Message requests are not enabled"}, nil
+	}
+
+	rejected, err := s.Requests.RejectMessageRequest(userID, req.SenderId)
+	if err != nil {
+		return nil, err
+	}
+	if !rejected {
+		return &chat.RejectMessageRequestResponse{Success: false, Message: "No messages from this user are waiting"}, nil
+	}
+	return &chat.RejectMessageRequestResponse{Success: true, Message: "Message request rejected"}, nil
 }
 
 // Extracts the sender ID from the context (assuming userID is set in context)
@@ -192,89 +460,44 @@ func (s *ChatServiceServer) extractSenderIDFromContext(ctx context.Context) (uin
 	return senderID, senderUsername, nil
 }
 
-// registerClient registers a client's stream with their user ID
-func (s *ChatServiceServer) registerClient(userID uint32, stream chat.ChatService_StreamMessagesServer) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.ActiveClients[userID] = stream
-	s.Logger.Infof("User %d has been registered in active clients", userID)
-}
-
-// unregisterClient removes a client's stream from the active clients map
-func (s *ChatServiceServer) unregisterClient(userID uint32) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	delete(s.ActiveClients, userID)
-	s.Logger.Infof("User %d has been unregistered from active clients", userID)
-}
-
-// sendMessageToRecipient attempts to send a message directly to the recipient if they are connected.
-// If the recipient is not connected, it stores the message in the undelivered messages buffer.
-func (s *ChatServiceServer) sendMessageToRecipient(resp *chat.MessageResponse) error {
-	s.mu.RLock()
-	recipientStream, recipientConnected := s.ActiveClients[resp.RecipientId]
-	s.mu.RUnlock()
-
-	if !recipientConnected {
-		s.Logger.Warnf("Recipient %d is not connected, storing message ID %s in buffer", resp.RecipientId, resp.MessageId)
-		// Store the message in the undelivered messages buffer
-		s.mu.Lock()
-		s.UndeliveredMessages[resp.RecipientId] = append(s.UndeliveredMessages[resp.RecipientId], resp)
-		s.mu.Unlock()
-		return nil
-	}
-
-	// Forward the response to the recipient's stream
-	s.Logger.Infof("Forwarding message ID %s to recipient %d", resp.MessageId, resp.RecipientId)
-
-	if err := recipientStream.Send(resp); err != nil {
-		return fmt.Errorf("failed to send message ID %s to recipient %d: %v", resp.MessageId, resp.RecipientId, err)
+// requeueUnsent routes chat messages that were still queued for the user when their stream closed,
+// so they are stored for the next connection. Server notices in the queue are discarded.
+func (s *ChatServiceServer) requeueUnsent(userID uint32, pending []*chat.MessageResponse) {
+	for _, resp := range pending {
+		if resp.RecipientId != userID || resp.Status != "received" {
+			continue
+		}
+		if _, err := s.Router.Route(resp); err != nil {
+			s.Logger.Errorf("Failed to requeue message ID %s for user %d: %v", resp.MessageId, userID, err)
+		}
 	}
-
-	s.Logger.Infof("Message ID %s successfully delivered to recipient %d", resp.MessageId, resp.RecipientId)
-	return nil
 }
 
 // deliverUndeliveredMessages sends any stored messages to the user upon reconnection.
-func (s *ChatServiceServer) deliverUndeliveredMessages(userID uint32) error {
-	var messages []*chat.MessageResponse
-
-	// Lock the UndeliveredMessages map and get the messages
-	s.mu.Lock()
-	if msgs, exists := s.UndeliveredMessages[userID]; exists && len(msgs) > 0 {
-		messages = msgs
-		// Remove messages from buffer
-		delete(s.UndeliveredMessages, userID)
+// The messages are no longer stored once taken, so if one can't be sent it stops and returns
+// that message and the rest, for the caller to store again.
+func (s *ChatServiceServer) deliverUndeliveredMessages(userID uint32, stream chat.ChatService_StreamMessagesServer) ([]*chat.MessageResponse, error) {
+	messages, err := s.Router.TakeUndelivered(userID)
+	if err != nil {
+		if len(messages) == 0 {
+			return nil, fmt.Errorf("failed to load undelivered messages: %w", err)
+		}
+		s.Logger.Errorf("Dropped undelivered messages of user %d: %v", userID, err)
 	}
-	s.mu.Unlock()
 
 	if len(messages) == 0 {
 		s.Logger.Infof("No undelivered messages for user %d", userID)
-		return nil
+		return nil, nil
 	}
 
 	s.Logger.Infof("Delivering %d undelivered messages to user %d", len(messages), userID)
 
-	s.mu.RLock()
-	recipientStream, recipientConnected := s.ActiveClients[userID]
-	s.mu.RUnlock()
-	if !recipientConnected {
-		s.Logger.Warnf("Recipient %d is not connected while trying to deliver undelivered messages", userID)
-		// If recipient is not connected, put the messages back into the buffer
-		s.mu.Lock()
-		s.UndeliveredMessages[userID] = messages // Put messages back
-		s.mu.Unlock()
-		return fmt.Errorf("recipient %d is not connected", userID)
-	}
-
-	for _, msg := range messages {
-		if err := recipientStream.Send(msg); err != nil {
-			s.Logger.Errorf("Failed to send undelivered message ID %s to user %d: %v", msg.MessageId, userID, err)
-			// Optionally, handle error
-		} else {
-			s.Logger.Infof("Delivered undelivered message ID %s to user %d", msg.MessageId, userID)
+	for i, msg := range messages {
+		if err := stream.Send(msg); err != nil {
+			return messages[i:], fmt.Errorf("failed to send undelivered message ID %s: %w", msg.MessageId, err)
 		}
+		s.Logger.Infof("Delivered undelivered message ID %s to user %d", msg.MessageId, userID)
 	}
 
-	return nil
+	return nil, nil
 }
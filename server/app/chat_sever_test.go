@@ -0,0 +1,227 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/johnkhk/cli_chat_app/genproto/chat"
+	"github.com/johnkhk/cli_chat_app/genproto/friends"
+	"github.com/johnkhk/cli_chat_app/server/storage"
+)
+
+func TestRouteRefusesBlockedUsers(t *testing.T) {
+	repo := newFakeRepository()
+	alice, bob := repo.addUser("alice"), repo.addUser("bob")
+	server := NewChatServiceServer(testLogger(), nil)
+	server.Blocks = repo
+
+	message := func(from, to uint32) *chat.MessageResponse {
+		return &chat.MessageResponse{SenderId: from, RecipientId: to, MessageId: "m", Status: "received"}
+	}
+	if _, err := server.route(message(alice, bob)); err != nil {
+		t.Fatalf("Expected the message to be stored for bob, got: %v", err)
+	}
+
+	repo.BlockUser(bob, alice)
+	for _, msg := range []*chat.MessageResponse{message(alice, bob), message(bob, alice)} {
+		if _, err := server.route(msg); !errors.Is(err, errBlocked) {
+			t.Fatalf("Expected the message from %d to %d to be refused, got: %v", msg.SenderId, msg.RecipientId, err)
+		}
+	}
+	if undelivered, _ := server.Router.TakeUndelivered(bob); len(undelivered) != 1 {
+		t.Fatalf("Expected only the message sent before the block to be stored, got %d", len(undelivered))
+	}
+}
+
+func TestMessageRequests(t *testing.T) {
+	repo := newFakeRepository()
+	alice, bob, carol := repo.addUser("alice"), repo.addUser("bob"), repo.addUser("carol")
+	hub := NewFriendEventHub(testLogger())
+	server := NewChatServiceServer(testLogger(), nil)
+	server.Requests = repo
+	server.Events = hub
+	aliceEvents, unsubscribeAlice := hub.Subscribe(alice)
+	defer unsubscribeAlice()
+	bobEvents, unsubscribeBob := hub.Subscribe(bob)
+	defer unsubscribeBob()
+
+	send := func(from, to uint32, id string) (string, error) {
+		return server.route(&chat.MessageResponse{SenderId: from, SenderUsername: "user", RecipientId: to, MessageId: id, Status: "received", EncryptedMessage: []byte(id)})
+	}
+
+	// Messages from a stranger are held, and the recipient hears about the first one only
+	for _, id := range []string{"m1", "m2"} {
+		if status, err := send(alice, bob, id); err != nil || status != "request_held" {
+			t.Fatalf("Expected message %s to be held, got %q (err: %v)", id, status, err)
+		}
+	}
+	if event := <-bobEvents; event.Type != friends.FriendEventType_MESSAGE_REQUEST_RECEIVED || event.UserId != int32(alice) {
+		t.Fatalf("Expected a message request event from alice, got %v", event)
+	}
+	if len(bobEvents) != 0 {
+		t.Fatalf("Expected a single message request event, got %d more", len(bobEvents))
+	}
+	if undelivered, _ := server.Router.TakeUndelivered(bob); len(undelivered) != 0 {
+		t.Fatalf("Expected held messages not to be queued for delivery, got %d", len(undelivered))
+	}
+
+	bobCtx := userContext(bob, "bob")
+	requests, err := server.GetMessageRequests(bobCtx, &chat.GetMessageRequestsRequest{})
+	if err != nil || len(requests.Requests) != 1 || requests.Requests[0].SenderUsername != "alice" || requests.Requests[0].MessageCount != 2 {
+		t.Fatalf("Expected alice's request with 2 messages, got %v (err: %v)", requests, err)
+	}
+
+	// Accepting delivers the held messages in order and makes them friends
+	resp, err := server.AcceptMessageRequest(bobCtx, &chat.AcceptMessageRequestRequest{SenderId: alice})
+	if err != nil || !resp.Success || resp.Delivered != 2 {
+		t.Fatalf("Expected both messages to be delivered, got %v (err: %v)", resp, err)
+	}
+	undelivered, _ := server.Router.TakeUndelivered(bob)
+	if len(undelivered) != 2 || undelivered[0].MessageId != "m1" || string(undelivered[1].EncryptedMessage) != "m2" {
+		t.Fatalf("Expected the held messages to be queued for bob, got %v", undelivered)
+	}
+	if event := <-aliceEvents; event.Type != friends.FriendEventType_FRIEND_REQUEST_ACCEPTED || event.UserId != int32(bob) {
+		t.Fatalf("Expected alice to hear bob accepted, got %v", event)
+	}
+	if status, err := send(alice, bob, "m3"); err != nil || status != "stored" {
+		t.Fatalf("Expected messages between friends to go through, got %q (err: %v)", status, err)
+	}
+	if resp, _ := server.AcceptMessageRequest(bobCtx, &chat.AcceptMessageRequestRequest{SenderId: alice}); resp.Success {
+		t.Fatalf("Expected nothing left to accept, got %v", resp)
+	}
+
+	// Rejecting drops the messages without delivering them
+	send(carol, bob, "c1")
+	reject, err := server.RejectMessageRequest(bobCtx, &chat.RejectMessageRequestRequest{SenderId: carol})
+	if err != nil || !reject.Success {
+		t.Fatalf("Expected carol's request to be rejected, got %v (err: %v)", reject, err)
+	}
+	if requests, _ := server.GetMessageRequests(bobCtx, &chat.GetMessageRequestsRequest{}); len(requests.Requests) != 0 {
+		t.Fatalf("Expected no requests left, got %v", requests.Requests)
+	}
+
+	// A stranger can only have so many messages waiting
+	for i := 0; i < storage.MaxHeldMessages; i++ {
+		if _, err := send(carol, alice, "spam"); err != nil {
+			t.Fatalf("Expected message %d to be held: %v", i, err)
+		}
+	}
+	if _, err := send(carol, alice, "spam"); !errors.Is(err, storage.ErrMessageRequestFull) {
+		t.Fatalf("Expected ErrMessageRequestFull, got: %v", err)
+	}
+}
+
+// revokedUsers is a RevokedSessions that reports a fixed set of users.
+type revokedUsers []uint32
+
+func (r revokedUsers) SessionsRevokedSince(since time.Time) ([]uint32, error) {
+	return r, nil
+}
+
+func TestDisconnectRevokedSessions(t *testing.T) {
+	router := NewLocalRouter(testLogger())
+	hub := NewFriendEventHub(testLogger())
+	revoked := &recordingStream{}
+	kept := &recordingStream{}
+	revokedQueue := NewSendQueue(1, revoked, DefaultSendQueueConfig(), NewSendQueueMetrics(), testLogger())
+	defer revokedQueue.Close()
+	keptQueue := NewSendQueue(2, kept, DefaultSendQueueConfig(), NewSendQueueMetrics(), testLogger())
+	defer keptQueue.Close()
+	router.Register(1, revokedQueue)
+	router.Register(2, keptQueue)
+	revokedEvents, unsubscribe := hub.Subscribe(1)
+	defer unsubscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go DisconnectRevokedSessions(ctx, revokedUsers{1}, router, hub, 10*time.Millisecond, testLogger())
+
+	select {
+	case <-revokedQueue.Disconnected():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the chat stream of the revoked user to be disconnected")
+	}
+	select {
+	case _, ok := <-revokedEvents:
+		if ok {
+			t.Fatal("Expected the friend event subscription to be closed, not to get an event")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the friend event subscription of the revoked user to be closed")
+	}
+	select {
+	case <-keptQueue.Disconnected():
+		t.Fatal("Expected the other user's stream to stay connected")
+	default:
+	}
+}
+
+// slowStream is a client stream that takes a while to write each message and waits for the client
+// to hang up on reads.
+type slowStream struct {
+	recordingStream
+	ctx   context.Context
+	delay time.Duration
+}
+
+func (s *slowStream) Send(resp *chat.MessageResponse) error {
+	time.Sleep(s.delay)
+	return s.recordingStream.Send(resp)
+}
+
+func (s *slowStream) Recv() (*chat.MessageRequest, error) {
+	<-s.ctx.Done()
+	return nil, s.ctx.Err()
+}
+
+func (s *slowStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestStoredMessagesSurviveFullSendQueue(t *testing.T) {
+	server := NewChatServiceServer(testLogger(), nil)
+	server.SendQueue = SendQueueConfig{Capacity: 1, EnqueueTimeout: 10 * time.Millisecond, Overflow: OverflowReject}
+	ids := []string{"m1", "m2", "m3", "m4", "m5"}
+	for _, id := range ids {
+		server.Router.Route(&chat.MessageResponse{SenderId: 2, RecipientId: 1, MessageId: id, Status: "received"})
+	}
+
+	// The queue fills up while the stored messages are being drained
+	ctx, cancel := context.WithCancel(userContext(1, "alice"))
+	defer cancel()
+	stream := &slowStream{ctx: ctx, delay: 50 * time.Millisecond}
+	done := make(chan error, 1)
+	go func() { done <- server.StreamMessages(stream) }()
+	select {
+	case err := <-done:
+		if status.Code(err) != codes.Unavailable {
+			t.Fatalf("Expected the stream to end once the queue was full, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the stream to end once the queue was full")
+	}
+
+	// Every message was either written to the client or stored again, in order
+	var got []string
+	for _, resp := range stream.messages() {
+		if resp.Status == "received" {
+			got = append(got, resp.MessageId)
+		}
+	}
+	stored, _ := server.Router.TakeUndelivered(1)
+	if len(stored) == 0 {
+		t.Fatal("Expected the messages the client could not take to be stored again")
+	}
+	for _, resp := range stored {
+		got = append(got, resp.MessageId)
+	}
+	if strings.Join(got, ",") != strings.Join(ids, ",") {
+		t.Fatalf("Expected %v to be written or stored, got %v", ids, got)
+	}
+}
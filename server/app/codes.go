@@ -0,0 +1,38 @@
+package app
+
+import (
+	"crypto/rand"
+	"strings"
+)
+
+// codeAlphabet leaves out characters that are easy to confuse when typed.
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// generateCode returns a random 8 character code for users to type in, such as a history transfer
+// or invite code.
+func generateCode() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = codeAlphabet[int(b)%len(codeAlphabet)]
+	}
+	return string(buf), nil
+}
+
+// formatCode splits a code into two groups for display, e.g. ABCD-EFGH.
+func formatCode(code string) string {
+	if len(code) != 8 {
+		return code
+	}
+	return code[:4] + "-" + code[4:]
+}
+
+// normalizeCode accepts codes typed with any case, spaces or dashes.
+func normalizeCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+	return code
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultDedupWindow is how long the server remembers a message ID after routing it.
+const DefaultDedupWindow = 10 * time.Minute
+
+type dedupKey struct {
+	senderID  uint32
+	messageID string
+}
+
+type dedupEntry struct {
+	status string // Outcome reported to the sender, empty while the message is still being routed
+	seenAt time.Time
+}
+
+// MessageDeduplicator remembers recently routed messages by (sender, message ID), so a message
+// retried after a reconnect is acknowledged again instead of being delivered twice.
+// It only sees messages received by this node.
+type MessageDeduplicator struct {
+	Window    time.Duration
+	Now       func() time.Time
+	mu        sync.Mutex
+	seen      map[dedupKey]dedupEntry
+	lastSweep time.Time
+}
+
+// NewMessageDeduplicator creates a deduplicator that remembers message IDs for the given window.
+func NewMessageDeduplicator(window time.Duration) *MessageDeduplicator {
+	return &MessageDeduplicator{
+		Window: window,
+		Now:    time.Now,
+		seen:   make(map[dedupKey]dedupEntry),
+	}
+}
+
+// Claim marks the message as being routed. If the message was already seen within the window,
+// it returns true along with the status reported for it, which is empty if it is still in flight.
+func (d *MessageDeduplicator) Claim(senderID uint32, messageID string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.Now()
+	d.sweep(now)
+
+	key := dedupKey{senderID: senderID, messageID: messageID}
+	if entry, ok := d.seen[key]; ok && now.Sub(entry.seenAt) < d.Window {
+		return entry.status, true
+	}
+	d.seen[key] = dedupEntry{seenAt: now}
+	return "", false
+}
+
+// Record stores the status reported to the sender for a claimed message.
+func (d *MessageDeduplicator) Record(senderID uint32, messageID, status string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key := dedupKey{senderID: senderID, messageID: messageID}
+	if entry, ok := d.seen[key]; ok {
+		entry.status = status
+		d.seen[key] = entry
+	}
+}
+
+// Forget releases a claimed message so a retry is routed again, e.g. after delivery failed.
+func (d *MessageDeduplicator) Forget(senderID uint32, messageID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.seen, dedupKey{senderID: senderID, messageID: messageID})
+}
+
+// sweep drops expired entries at most once per window. The caller must hold d.mu.
+func (d *MessageDeduplicator) sweep(now time.Time) {
+	if now.Sub(d.lastSweep) < d.Window {
+		return
+	}
+	for key, entry := range d.seen {
+		if now.Sub(entry.seenAt) >= d.Window {
+			delete(d.seen, key)
+		}
+	}
+	d.lastSweep = now
+}
@@ -0,0 +1,44 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+// TestMessageDeduplicator checks that retried messages are recognised within the window and forgotten after it.
+func TestMessageDeduplicator(t *testing.T) {
+	now := time.Now()
+	dedup := NewMessageDeduplicator(time.Minute)
+	dedup.Now = func() time.Time { return now }
+
+	if _, duplicate := dedup.Claim(1, "m1"); duplicate {
+		t.Fatalf("Expected first message to not be a duplicate")
+	}
+
+	// A retry while the original is still being routed has no status yet.
+	if status, duplicate := dedup.Claim(1, "m1"); !duplicate || status != "" {
+		t.Fatalf("Expected in-flight duplicate with empty status, got: %q, %v", status, duplicate)
+	}
+
+	dedup.Record(1, "m1", "delivered")
+	if status, duplicate := dedup.Claim(1, "m1"); !duplicate || status != "delivered" {
+		t.Fatalf("Expected duplicate with status delivered, got: %q, %v", status, duplicate)
+	}
+
+	// The same message ID from another sender is a different message.
+	if _, duplicate := dedup.Claim(2, "m1"); duplicate {
+		t.Fatalf("Expected message from another sender to not be a duplicate")
+	}
+
+	// A forgotten message can be retried.
+	dedup.Forget(2, "m1")
+	if _, duplicate := dedup.Claim(2, "m1"); duplicate {
+		t.Fatalf("Expected forgotten message to not be a duplicate")
+	}
+
+	// Once the window has passed the message is routed again.
+	now = now.Add(2 * time.Minute)
+	if _, duplicate := dedup.Claim(1, "m1"); duplicate {
+		t.Fatalf("Expected message outside the window to not be a duplicate")
+	}
+}
@@ -0,0 +1,636 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/johnkhk/cli_chat_app/server/storage"
+)
+
+// fakeRepository is an in-memory storage.Repository for unit testing the handlers.
+type fakeRepository struct {
+	mu       sync.Mutex
+	users    []*storage.User
+	requests []*storage.FriendRequest
+	sends    map[uint32][]time.Time  // Times each user sent a friend request, including sending one again
+	friends  map[[2]uint32]time.Time // Keyed by (user, friend), holding both directions
+	activity map[[2]uint32]time.Time // Last activity of a friendship, keyed like friends
+	blocked  map[[2]uint32]time.Time // Keyed by (user, blocked user)
+	hidden   map[uint32]bool         // Users who opted out of discovery
+	held     []storage.HeldMessage
+	profiles map[uint32]storage.EncryptedProfile
+	bundles  []storage.PreKeyBundle
+	revoked  map[uint32]time.Time // Sessions revoked at, by user ID
+	invites  []*storage.Invite
+}
+
+var _ storage.Repository = (*fakeRepository)(nil)
+
+func newFakeRepository() *fakeRepository {
+	return &fakeRepository{
+		sends:    make(map[uint32][]time.Time),
+		friends:  make(map[[2]uint32]time.Time),
+		activity: make(map[[2]uint32]time.Time),
+		blocked:  make(map[[2]uint32]time.Time),
+		hidden:   make(map[uint32]bool),
+		profiles: make(map[uint32]storage.EncryptedProfile),
+		revoked:  make(map[uint32]time.Time),
+	}
+}
+
+// addUser creates a user directly and returns its ID.
+func (r *fakeRepository) addUser(username string) uint32 {
+	id, err := r.CreateUser(username, "", false)
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+func (r *fakeRepository) userByID(id uint32) *storage.User {
+	for _, user := range r.users {
+		if user.ID == id {
+			return user
+		}
+	}
+	return nil
+}
+
+func (r *fakeRepository) GetUserByUsername(username string) (*storage.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if user.Username == username {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", storage.ErrUserNotFound, username)
+}
+
+func (r *fakeRepository) CreateUser(username, passwordHash string, isBot bool) (uint32, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.createUser(username, passwordHash, isBot, false)
+}
+
+func (r *fakeRepository) CreatePendingUser(username, passwordHash string, isBot bool) (uint32, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.createUser(username, passwordHash, isBot, true)
+}
+
+func (r *fakeRepository) createUser(username, passwordHash string, isBot, pending bool) (uint32, error) {
+	for _, user := range r.users {
+		if user.Username == username {
+			return 0, storage.ErrUsernameTaken
+		}
+	}
+	user := &storage.User{ID: uint32(len(r.users) + 1), Username: username, Password: passwordHash, IsBot: isBot, Pending: pending, CreatedAt: time.Now()}
+	r.users = append(r.users, user)
+	return user.ID, nil
+}
+
+func (r *fakeRepository) RecordLogin(userID uint32) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if user := r.userByID(userID); user != nil {
+		now := time.Now()
+		user.LastLoginAt = &now
+	}
+	return nil
+}
+
+func (r *fakeRepository) IsRevoked(userID uint32, issuedAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user := r.userByID(userID)
+	if user == nil {
+		return true, nil
+	}
+	revokedAt, ok := r.revoked[userID]
+	return user.Locked || user.Pending || (ok && revokedAt.After(issuedAt)), nil
+}
+
+// requestBetween returns the request between two users, sent in either direction, or nil.
+func (r *fakeRepository) requestBetween(userID, otherID uint32) *storage.FriendRequest {
+	for _, request := range r.requests {
+		if (request.RequesterID == userID && request.RecipientID == otherID) ||
+			(request.RequesterID == otherID && request.RecipientID == userID) {
+			return request
+		}
+	}
+	return nil
+}
+
+func (r *fakeRepository) SendFriendRequest(requesterID, recipientID uint32, limits storage.FriendRequestLimits) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.isBlocked(requesterID, recipientID) {
+		return false, storage.ErrBlocked
+	}
+	if _, ok := r.friends[[2]uint32{requesterID, recipientID}]; ok {
+		return false, storage.ErrAlreadyFriends
+	}
+	request := r.requestBetween(requesterID, recipientID)
+	switch {
+	case request == nil:
+	case request.Status == storage.StatusPendingStr:
+		return false, storage.ErrFriendRequestPending
+	case request.Status == storage.StatusAcceptedStr:
+		return false, storage.ErrAlreadyFriends
+	}
+
+	pending, sent := r.friendRequestStats(requesterID, 24*time.Hour)
+	if limits.MaxPending > 0 && pending >= limits.MaxPending {
+		return false, storage.ErrTooManyPendingFriendRequests
+	}
+	if limits.MaxPerDay > 0 && sent >= limits.MaxPerDay {
+		return false, storage.ErrFriendRequestDailyLimit
+	}
+	r.sends[requesterID] = append(r.sends[requesterID], time.Now())
+
+	if request == nil {
+		r.requests = append(r.requests, &storage.FriendRequest{
+			ID:                uint32(len(r.requests) + 1),
+			RequesterID:       requesterID,
+			RecipientID:       recipientID,
+			RequesterUsername: r.userByID(requesterID).Username,
+			RecipientUsername: r.userByID(recipientID).Username,
+			Status:            storage.StatusPendingStr,
+			CreatedAt:         time.Now(),
+		})
+		return false, nil
+	}
+	request.RequesterID, request.RecipientID = requesterID, recipientID
+	request.RequesterUsername, request.RecipientUsername = r.userByID(requesterID).Username, r.userByID(recipientID).Username
+	request.Status = storage.StatusPendingStr
+	request.CreatedAt = time.Now()
+	return true, nil
+}
+
+func (r *fakeRepository) respond(requestID, recipientID uint32, status string) (*storage.FriendRequest, error) {
+	for _, request := range r.requests {
+		if request.ID == requestID && request.RecipientID == recipientID && request.Status == storage.StatusPendingStr {
+			request.Status = status
+			return request, nil
+		}
+	}
+	return nil, storage.ErrFriendRequestNotFound
+}
+
+func (r *fakeRepository) AcceptFriendRequest(requestID, recipientID uint32) (uint32, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	request, err := r.respond(requestID, recipientID, storage.StatusAcceptedStr)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	r.friends[[2]uint32{request.RequesterID, recipientID}] = now
+	r.friends[[2]uint32{recipientID, request.RequesterID}] = now
+	return request.RequesterID, nil
+}
+
+func (r *fakeRepository) DeclineFriendRequest(requestID, recipientID uint32) (uint32, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	request, err := r.respond(requestID, recipientID, storage.StatusDeclinedStr)
+	if err != nil {
+		return 0, err
+	}
+	return request.RequesterID, nil
+}
+
+func (r *fakeRepository) CancelFriendRequest(requestID, requesterID uint32) (uint32, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, request := range r.requests {
+		if request.ID == requestID && request.RequesterID == requesterID && request.Status == storage.StatusPendingStr {
+			request.Status = storage.StatusCancelledStr
+			return request.RecipientID, nil
+		}
+	}
+	return 0, storage.ErrFriendRequestNotFound
+}
+
+func (r *fakeRepository) FriendRequestStats(requesterID uint32, window time.Duration) (int, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pending, sent := r.friendRequestStats(requesterID, window)
+	return pending, sent, nil
+}
+
+func (r *fakeRepository) friendRequestStats(requesterID uint32, window time.Duration) (int, int) {
+	var pending, sent int
+	for _, request := range r.requests {
+		if request.RequesterID == requesterID && request.Status == storage.StatusPendingStr {
+			pending++
+		}
+	}
+	for _, sentAt := range r.sends[requesterID] {
+		if time.Since(sentAt) <= window {
+			sent++
+		}
+	}
+	return pending, sent
+}
+
+func (r *fakeRepository) ExpireFriendRequests(maxAge time.Duration) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var expired int64
+	for _, request := range r.requests {
+		if request.Status == storage.StatusPendingStr && time.Since(request.CreatedAt) > maxAge {
+			request.Status = storage.StatusExpiredStr
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+func (r *fakeRepository) RemoveFriend(userID, friendID uint32) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.friends[[2]uint32{userID, friendID}]; !ok {
+		return false, nil
+	}
+	delete(r.friends, [2]uint32{userID, friendID})
+	delete(r.friends, [2]uint32{friendID, userID})
+	if request := r.requestBetween(userID, friendID); request != nil {
+		request.Status = storage.StatusCancelledStr
+	}
+	return true, nil
+}
+
+func (r *fakeRepository) pending(match func(*storage.FriendRequest) bool) []storage.FriendRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var requests []storage.FriendRequest
+	for _, request := range r.requests {
+		if request.Status == storage.StatusPendingStr && match(request) {
+			requests = append(requests, *request)
+		}
+	}
+	return requests
+}
+
+func (r *fakeRepository) IncomingFriendRequests(userID uint32) ([]storage.FriendRequest, error) {
+	return r.pending(func(request *storage.FriendRequest) bool { return request.RecipientID == userID }), nil
+}
+
+func (r *fakeRepository) OutgoingFriendRequests(userID uint32) ([]storage.FriendRequest, error) {
+	return r.pending(func(request *storage.FriendRequest) bool { return request.RequesterID == userID }), nil
+}
+
+func (r *fakeRepository) ListFriends(userID uint32) ([]storage.Friend, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var friends []storage.Friend
+	for pair, addedAt := range r.friends {
+		if pair[0] != userID {
+			continue
+		}
+		friend := r.userByID(pair[1])
+		entry := storage.Friend{UserID: friend.ID, Username: friend.Username, IsBot: friend.IsBot, AddedAt: addedAt}
+		if at, ok := r.activity[pair]; ok {
+			entry.LastActivityAt = &at
+		}
+		friends = append(friends, entry)
+	}
+	sort.Slice(friends, func(i, j int) bool { return friends[i].UserID < friends[j].UserID })
+	return friends, nil
+}
+
+func (r *fakeRepository) ListFriendsPage(userID uint32, order storage.FriendOrder, after *storage.Friend, limit int) ([]storage.Friend, error) {
+	all, _ := r.ListFriends(userID)
+	compare := func(a, b *storage.Friend) int {
+		c := 0
+		switch order {
+		case storage.FriendsByName:
+			c = strings.Compare(strings.ToLower(a.Username), strings.ToLower(b.Username))
+		default:
+			switch {
+			case a.LastActivityAt != nil && b.LastActivityAt != nil:
+				c = b.LastActivityAt.Compare(*a.LastActivityAt)
+			case a.LastActivityAt != nil:
+				c = -1
+			case b.LastActivityAt != nil:
+				c = 1
+			}
+			if c == 0 {
+				c = b.AddedAt.Compare(a.AddedAt)
+			}
+		}
+		if c == 0 {
+			c = int(a.UserID) - int(b.UserID)
+		}
+		return c
+	}
+	sort.Slice(all, func(i, j int) bool { return compare(&all[i], &all[j]) < 0 })
+
+	var page []storage.Friend
+	for i := range all {
+		if (after == nil || compare(&all[i], after) > 0) && len(page) < limit {
+			page = append(page, all[i])
+		}
+	}
+	return page, nil
+}
+
+func (r *fakeRepository) AreFriends(userID, otherID uint32) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.friends[[2]uint32{userID, otherID}]
+	return ok, nil
+}
+
+func (r *fakeRepository) RecordFriendActivity(userID, friendID uint32) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, pair := range [][2]uint32{{userID, friendID}, {friendID, userID}} {
+		if _, ok := r.friends[pair]; ok {
+			r.activity[pair] = now
+		}
+	}
+	return nil
+}
+
+func (r *fakeRepository) BlockUser(userID, blockedID uint32) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.userByID(blockedID) == nil {
+		return false, fmt.Errorf("%w: %d", storage.ErrUserNotFound, blockedID)
+	}
+	if _, ok := r.blocked[[2]uint32{userID, blockedID}]; !ok {
+		r.blocked[[2]uint32{userID, blockedID}] = time.Now()
+	}
+	_, wasFriend := r.friends[[2]uint32{userID, blockedID}]
+	delete(r.friends, [2]uint32{userID, blockedID})
+	delete(r.friends, [2]uint32{blockedID, userID})
+	if request := r.requestBetween(userID, blockedID); request != nil {
+		request.Status = storage.StatusCancelledStr
+	}
+	r.dropHeld(userID, blockedID)
+	r.dropHeld(blockedID, userID)
+	return wasFriend, nil
+}
+
+func (r *fakeRepository) UnblockUser(userID, blockedID uint32) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.blocked[[2]uint32{userID, blockedID}]; !ok {
+		return false, nil
+	}
+	delete(r.blocked, [2]uint32{userID, blockedID})
+	return true, nil
+}
+
+func (r *fakeRepository) ListBlockedUsers(userID uint32) ([]storage.BlockedUser, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var blocked []storage.BlockedUser
+	for pair, blockedAt := range r.blocked {
+		if pair[0] != userID {
+			continue
+		}
+		user := r.userByID(pair[1])
+		blocked = append(blocked, storage.BlockedUser{UserID: user.ID, Username: user.Username, BlockedAt: blockedAt})
+	}
+	sort.Slice(blocked, func(i, j int) bool { return blocked[i].UserID < blocked[j].UserID })
+	return blocked, nil
+}
+
+func (r *fakeRepository) IsBlocked(userID, otherID uint32) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.isBlocked(userID, otherID), nil
+}
+
+func (r *fakeRepository) isBlocked(userID, otherID uint32) bool {
+	_, blocked := r.blocked[[2]uint32{userID, otherID}]
+	_, blockedBy := r.blocked[[2]uint32{otherID, userID}]
+	return blocked || blockedBy
+}
+
+// SearchUsers matches substrings only, in username order, which is enough to test the handler.
+func (r *fakeRepository) SearchUsers(searcherID uint32, query string, offset, limit int) ([]storage.UserSearchResult, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []storage.UserSearchResult
+	for _, user := range r.users {
+		_, friend := r.friends[[2]uint32{searcherID, user.ID}]
+		if user.ID == searcherID || user.Locked || user.Pending || r.isBlocked(searcherID, user.ID) || (r.hidden[user.ID] && !friend) ||
+			!strings.Contains(strings.ToLower(user.Username), strings.ToLower(query)) {
+			continue
+		}
+		request := r.requestBetween(searcherID, user.ID)
+		found = append(found, storage.UserSearchResult{
+			UserID:         user.ID,
+			Username:       user.Username,
+			IsBot:          user.IsBot,
+			IsFriend:       friend,
+			RequestPending: request != nil && request.Status == storage.StatusPendingStr,
+		})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Username < found[j].Username })
+
+	if offset >= len(found) {
+		return nil, false, nil
+	}
+	found = found[offset:]
+	if len(found) > limit {
+		return found[:limit], true, nil
+	}
+	return found, false, nil
+}
+
+func (r *fakeRepository) Discoverable(userID uint32) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.userByID(userID) == nil {
+		return false, fmt.Errorf("%w: %d", storage.ErrUserNotFound, userID)
+	}
+	return !r.hidden[userID], nil
+}
+
+func (r *fakeRepository) SetDiscoverable(userID uint32, discoverable bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hidden[userID] = !discoverable
+	return nil
+}
+
+func (r *fakeRepository) HoldMessage(message storage.HeldMessage) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if recipient := r.userByID(message.RecipientID); recipient == nil || recipient.Pending {
+		return 0, fmt.Errorf("%w: %d", storage.ErrUserNotFound, message.RecipientID)
+	}
+	held := 0
+	for _, m := range r.held {
+		if m.SenderID == message.SenderID && m.RecipientID == message.RecipientID {
+			held++
+		}
+	}
+	if held >= storage.MaxHeldMessages {
+		return held, storage.ErrMessageRequestFull
+	}
+	message.ID = uint32(len(r.held) + 1)
+	message.CreatedAt = time.Now()
+	r.held = append(r.held, message)
+	return held + 1, nil
+}
+
+func (r *fakeRepository) MessageRequests(recipientID uint32) ([]storage.MessageRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var requests []storage.MessageRequest
+	bySender := make(map[uint32]int)
+	for _, m := range r.held {
+		if m.RecipientID != recipientID {
+			continue
+		}
+		i, ok := bySender[m.SenderID]
+		if !ok {
+			i = len(requests)
+			bySender[m.SenderID] = i
+			requests = append(requests, storage.MessageRequest{SenderID: m.SenderID, SenderUsername: r.userByID(m.SenderID).Username})
+		}
+		requests[i].Messages++
+		requests[i].LastReceivedAt = m.CreatedAt
+	}
+	return requests, nil
+}
+
+// dropHeld removes the messages the sender has waiting for the recipient and returns them.
+func (r *fakeRepository) dropHeld(recipientID, senderID uint32) []storage.HeldMessage {
+	var dropped, kept []storage.HeldMessage
+	for _, m := range r.held {
+		if m.RecipientID == recipientID && m.SenderID == senderID {
+			dropped = append(dropped, m)
+		} else {
+			kept = append(kept, m)
+		}
+	}
+	r.held = kept
+	return dropped
+}
+
+func (r *fakeRepository) AcceptMessageRequest(recipientID, senderID uint32) ([]storage.HeldMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	held := r.dropHeld(recipientID, senderID)
+	if len(held) == 0 {
+		return nil, storage.ErrMessageRequestNotFound
+	}
+	now := time.Now()
+	r.friends[[2]uint32{recipientID, senderID}] = now
+	r.friends[[2]uint32{senderID, recipientID}] = now
+	return held, nil
+}
+
+func (r *fakeRepository) RejectMessageRequest(recipientID, senderID uint32) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.dropHeld(recipientID, senderID)) > 0, nil
+}
+
+func (r *fakeRepository) SaveProfile(userID uint32, ciphertext []byte) (time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	updatedAt := time.Now()
+	r.profiles[userID] = storage.EncryptedProfile{UserID: userID, Ciphertext: ciphertext, UpdatedAt: updatedAt}
+	return updatedAt, nil
+}
+
+func (r *fakeRepository) GetProfile(userID uint32) (*storage.EncryptedProfile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	profile, ok := r.profiles[userID]
+	if !ok {
+		return nil, storage.ErrProfileNotFound
+	}
+	return &profile, nil
+}
+
+func (r *fakeRepository) SavePreKeyBundle(bundle storage.PreKeyBundle) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bundles = append(r.bundles, bundle)
+	return nil
+}
+
+func (r *fakeRepository) GetPreKeyBundle(userID, deviceID uint32) (*storage.PreKeyBundle, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, bundle := range r.bundles {
+		if bundle.UserID == userID && (deviceID == 0 || bundle.DeviceID == deviceID) {
+			copied := bundle
+			return &copied, nil
+		}
+	}
+	return nil, storage.ErrPreKeyBundleNotFound
+}
+
+func (r *fakeRepository) CreateInvite(creatorID uint32, code string, maxUses int, expiresAt time.Time) (*storage.Invite, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	invite := &storage.Invite{ID: uint32(len(r.invites) + 1), Code: code, CreatorID: creatorID, MaxUses: maxUses, ExpiresAt: expiresAt, CreatedAt: time.Now()}
+	r.invites = append(r.invites, invite)
+	copied := *invite
+	return &copied, nil
+}
+
+func (r *fakeRepository) RedeemInvite(code string, userID uint32) (*storage.Friend, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.redeemInvite(code, userID)
+}
+
+func (r *fakeRepository) CreateUserWithInvite(username, passwordHash string, isBot bool, code string) (uint32, *storage.Friend, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	users := r.users
+	userID, err := r.createUser(username, passwordHash, isBot, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	creator, err := r.redeemInvite(code, userID)
+	if err != nil {
+		r.users = users
+		return 0, nil, err
+	}
+	return userID, creator, nil
+}
+
+func (r *fakeRepository) redeemInvite(code string, userID uint32) (*storage.Friend, error) {
+	for _, invite := range r.invites {
+		if invite.Code != code || invite.Uses >= invite.MaxUses || !invite.ExpiresAt.After(time.Now()) {
+			continue
+		}
+		if creator := r.userByID(invite.CreatorID); creator == nil || creator.Locked || creator.Pending {
+			continue
+		}
+		if invite.CreatorID == userID {
+			return nil, storage.ErrOwnInvite
+		}
+		if r.isBlocked(userID, invite.CreatorID) {
+			return nil, storage.ErrBlocked
+		}
+		if _, ok := r.friends[[2]uint32{userID, invite.CreatorID}]; ok {
+			return nil, storage.ErrAlreadyFriends
+		}
+		invite.Uses++
+		now := time.Now()
+		r.friends[[2]uint32{userID, invite.CreatorID}] = now
+		r.friends[[2]uint32{invite.CreatorID, userID}] = now
+		creator := r.userByID(invite.CreatorID)
+		return &storage.Friend{UserID: creator.ID, Username: creator.Username, IsBot: creator.IsBot, AddedAt: now}, nil
+	}
+	return nil, storage.ErrInviteNotFound
+}
@@ -0,0 +1,84 @@
+package app
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/johnkhk/cli_chat_app/genproto/friends"
+)
+
+// friendEventBuffer is how many events a subscriber can fall behind before newer ones are dropped.
+// Clients reload their lists when they reconnect, so a dropped event only delays an update.
+const friendEventBuffer = 16
+
+// FriendEventHub fans friend events out to the StreamFriendEvents streams of the users they affect.
+// Like LocalRouter, it only knows about streams held by this process.
+type FriendEventHub struct {
+	mu          sync.Mutex
+	subscribers map[uint32]map[chan *friends.FriendEvent]struct{}
+	Logger      *logrus.Logger
+}
+
+// NewFriendEventHub creates a hub with no subscribers.
+func NewFriendEventHub(logger *logrus.Logger) *FriendEventHub {
+	return &FriendEventHub{
+		subscribers: make(map[uint32]map[chan *friends.FriendEvent]struct{}),
+		Logger:      logger,
+	}
+}
+
+// Subscribe returns a channel receiving the user's events and a func that ends the subscription.
+// A user may subscribe more than once, for example from two devices. The channel is closed if the
+// user is disconnected.
+func (h *FriendEventHub) Subscribe(userID uint32) (<-chan *friends.FriendEvent, func()) {
+	events := make(chan *friends.FriendEvent, friendEventBuffer)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[chan *friends.FriendEvent]struct{})
+	}
+	h.subscribers[userID][events] = struct{}{}
+
+	return events, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subscribers[userID], events)
+		if len(h.subscribers[userID]) == 0 {
+			delete(h.subscribers, userID)
+		}
+	}
+}
+
+// Disconnect ends every subscription of the user by closing its channel, and returns how many there were.
+func (h *FriendEventHub) Disconnect(userID uint32) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subscriptions := h.subscribers[userID]
+	for events := range subscriptions {
+		close(events)
+	}
+	delete(h.subscribers, userID)
+	return len(subscriptions)
+}
+
+// Subscribers returns the number of open subscriptions of the user.
+func (h *FriendEventHub) Subscribers(userID uint32) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers[userID])
+}
+
+// Publish hands the event to each of the user's subscriptions without waiting for them.
+func (h *FriendEventHub) Publish(userID uint32, event *friends.FriendEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for events := range h.subscribers[userID] {
+		select {
+		case events <- event:
+		default:
+			h.Logger.Warnf("Dropping %s event for user %d, whose stream is not keeping up", event.Type, userID)
+		}
+	}
+}
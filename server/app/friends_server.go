@@ -2,29 +2,67 @@ package app
 
 import (
 	"context"
-	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/johnkhk/cli_chat_app/genproto/friends"
 	"github.com/johnkhk/cli_chat_app/server/storage"
 )
 
+const (
+	// defaultFriendPageSize is how many friends GetFriendList returns when the request doesn't say.
+	defaultFriendPageSize = 100
+	// maxFriendPageSize caps the friends returned by one GetFriendList call.
+	maxFriendPageSize = 500
+	// defaultSearchLimit is how many users SearchUsers returns when the request doesn't say.
+	defaultSearchLimit = 20
+	// maxSearchLimit caps the users returned by one SearchUsers call, so enumerating accounts takes many calls.
+	maxSearchLimit = 50
+	// defaultInviteUses is how many users can redeem an invite when the request doesn't say.
+	defaultInviteUses = 1
+	// maxInviteUses caps the users who can redeem one invite.
+	maxInviteUses = 100
+	// defaultInviteLifetime is how long an invite works when the request doesn't say.
+	defaultInviteLifetime = 7 * 24 * time.Hour
+	// maxInviteLifetime caps how long an invite works.
+	maxInviteLifetime = 30 * 24 * time.Hour
+)
+
+// DefaultFriendRequestLimits are the limits a new FriendsServer enforces.
+var DefaultFriendRequestLimits = storage.FriendRequestLimits{MaxPending: 50, MaxPerDay: 100}
+
+// PresenceChecker reports whether a user is connected.
+type PresenceChecker interface {
+	IsOnline(userID uint32) bool
+}
+
 // FriendsServer implements the FriendsService.
 type FriendsServer struct {
 	friends.UnimplementedFriendManagementServer
-	DB     *sql.DB
-	Logger *logrus.Logger
+	Repo     storage.Repository
+	Events   *FriendEventHub
+	Presence PresenceChecker // Shows which friends are online; optional, everyone is offline without it
+	Limits   storage.FriendRequestLimits
+	Logger   *logrus.Logger
 }
 
 // NewFriendsServer creates a new FriendsServer with the given dependencies.
-func NewFriendsServer(db *sql.DB, logger *logrus.Logger) *FriendsServer {
+func NewFriendsServer(repo storage.Repository, events *FriendEventHub, logger *logrus.Logger) *FriendsServer {
 	return &FriendsServer{
-		DB:     db,
+		Repo:   repo,
+		Events: events,
+		Limits: DefaultFriendRequestLimits,
 		Logger: logger,
 	}
 }
@@ -61,10 +99,13 @@ func (s *FriendsServer) SendFriendRequest(ctx context.Context, req *friends.Send
 	s.Logger.Infof("Received friend request from user ID: %s (username: %s) to username: %s", requesterID, requesterUsername, req.RecipientUsername)
 
 	// Step 1: Retrieve the recipient's ID from the username
-	var recipientID int
-	err = s.DB.QueryRow("SELECT id FROM users WHERE username = ?", req.RecipientUsername).Scan(&recipientID)
+	recipient, err := s.Repo.GetUserByUsername(req.RecipientUsername)
+	if err == nil && recipient.Pending {
+		// Accounts waiting for approval don't exist as far as other users can tell
+		err = storage.ErrUserNotFound
+	}
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, storage.ErrUserNotFound) {
 			// Recipient not found
 			return &friends.SendFriendRequestResponse{
 				Status:    friends.FriendRequestStatus_FAILED,
@@ -76,72 +117,48 @@ func (s *FriendsServer) SendFriendRequest(ctx context.Context, req *friends.Send
 		return nil, fmt.Errorf("error retrieving recipient ID: %w", err)
 	}
 
-	// Step 2: Check if a friend request already exists
-	var existingStatus string
-	err = s.DB.QueryRow(`
-		SELECT status 
-		FROM friend_requests 
-		WHERE (requester_id = ? AND recipient_id = ?) 
-		   OR (requester_id = ? AND recipient_id = ?)`,
-		requesterIDInt, recipientID, recipientID, requesterIDInt).Scan(&existingStatus)
-
-	if err != nil && err != sql.ErrNoRows {
-		return nil, fmt.Errorf("error checking existing friend request: %w", err)
+	// Step 2: Send the request, or reopen an answered one, unless one is pending, they are friends,
+	// or the requester already has too many waiting or sent too many today
+	reopened, err := s.Repo.SendFriendRequest(uint32(requesterIDInt), recipient.ID, s.Limits)
+	switch {
+	case errors.Is(err, storage.ErrTooManyPendingFriendRequests):
+		return nil, status.Errorf(codes.ResourceExhausted,
+			"you have %d friend requests waiting for an answer; cancel some or wait for them to be answered", s.Limits.MaxPending)
+	case errors.Is(err, storage.ErrFriendRequestDailyLimit):
+		return nil, status.Errorf(codes.ResourceExhausted,
+			"you have sent %d friend requests in the last day, the most allowed; try again tomorrow", s.Limits.MaxPerDay)
+	case errors.Is(err, storage.ErrFriendRequestPending):
+		return &friends.SendFriendRequestResponse{
+			Status:    friends.FriendRequestStatus_FAILED,
+			Message:   "A friend request is already pending",
+			Timestamp: timestamppb.Now(),
+		}, nil
+	case errors.Is(err, storage.ErrAlreadyFriends):
+		return &friends.SendFriendRequestResponse{
+			Status:    friends.FriendRequestStatus_FAILED,
+			Message:   "You are already friends",
+			Timestamp: timestamppb.Now(),
+		}, nil
+	case errors.Is(err, storage.ErrBlocked):
+		// Don't tell the requester whether they were blocked or blocked the recipient themselves
+		return &friends.SendFriendRequestResponse{
+			Status:    friends.FriendRequestStatus_FAILED,
+			Message:   "Cannot send a friend request to this user",
+			Timestamp: timestamppb.Now(),
+		}, nil
+	case err != nil:
+		return nil, err
 	}
 
-	if err == nil { // If there is an existing friend request
-		s.Logger.Infof("Existing status for friend request: %s", existingStatus)
-
-		statusEnum, ok := friends.FriendRequestStatus_value[existingStatus]
-		if !ok {
-			// If the status does not match any known value, use UNKNOWN
-			statusEnum = storage.StatusUnknownInt32
-		}
+	s.publishEvent(ctx, recipient.ID, friends.FriendEventType_FRIEND_REQUEST_CREATED)
 
-		// Handle the relevant existing statuses
-		switch friends.FriendRequestStatus(statusEnum) {
-		case friends.FriendRequestStatus_PENDING:
-			return &friends.SendFriendRequestResponse{
-				Status:    friends.FriendRequestStatus_FAILED,
-				Message:   "A friend request is already pending",
-				Timestamp: timestamppb.Now(),
-			}, nil
-		case friends.FriendRequestStatus_ACCEPTED:
-			return &friends.SendFriendRequestResponse{
-				Status:    friends.FriendRequestStatus_FAILED,
-				Message:   "You are already friends",
-				Timestamp: timestamppb.Now(),
-			}, nil
-		case friends.FriendRequestStatus_DECLINED, friends.FriendRequestStatus_CANCELED:
-			// Allow sending the friend request again if it was previously declined or canceled
-			_, err = s.DB.Exec(`
-				UPDATE friend_requests
-				SET status = ?, created_at = NOW()
-				WHERE requester_id = ? AND recipient_id = ? AND status IN (?, ?)`,
-				storage.StatusPendingStr, requesterIDInt, recipientID, storage.StatusDeclinedStr, storage.StatusCancelledStr)
-			if err != nil {
-				return nil, fmt.Errorf("error updating friend request to pending: %w", err)
-			}
-			return &friends.SendFriendRequestResponse{
-				Status:    friends.FriendRequestStatus_PENDING,
-				Message:   "Friend request sent again successfully",
-				Timestamp: timestamppb.Now(),
-			}, nil
-		}
-	}
-
-	// Step 3: Insert a new friend request if no existing request
-	_, err = s.DB.Exec(`
-		INSERT INTO friend_requests (requester_id, recipient_id, status)
-		VALUES (?, ?, ?)`,
-		requesterIDInt, recipientID, storage.StatusPendingStr)
-	if err != nil {
-		return nil, fmt.Errorf("error inserting friend request into database: %w", err)
+	message := "Friend request sent successfully"
+	if reopened {
+		message = "Friend request sent again successfully"
 	}
-
 	return &friends.SendFriendRequestResponse{
 		Status:    friends.FriendRequestStatus_PENDING,
-		Message:   "Friend request sent successfully",
+		Message:   message,
 		Timestamp: timestamppb.Now(),
 	}, nil
 }
@@ -160,46 +177,22 @@ func (s *FriendsServer) AcceptFriendRequest(ctx context.Context, req *friends.Ac
 		return nil, fmt.Errorf("invalid user ID format: %w", err)
 	}
 
-	// Step 1: Update the friend request status to "ACCEPTED" if it exists and is pending
-	res, err := s.DB.Exec(`UPDATE friend_requests SET status = ?, response_at = NOW() WHERE id = ? AND recipient_id = ? AND status = ?`,
-		storage.StatusAcceptedStr, req.RequestId, userIDInt, storage.StatusPendingStr)
-
-	if err != nil {
-		return nil, fmt.Errorf("error updating friend request status to accepted: %w", err)
-	}
-
-	// Step 2: Check if exactly one row was affected by the update
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
-		return nil, fmt.Errorf("error checking affected rows: %w", err)
-	}
-
-	if rowsAffected != 1 {
-		// No rows were affected, indicating that the request does not exist or is not pending
+	// Step 1: Accept the request if it exists and is pending, and add the friendship in the same transaction
+	requesterID, err := s.Repo.AcceptFriendRequest(uint32(req.RequestId), uint32(userIDInt))
+	if errors.Is(err, storage.ErrFriendRequestNotFound) {
+		// The request does not exist or is not pending
 		return &friends.AcceptFriendRequestResponse{
 			Status:    friends.FriendRequestStatus_FAILED,
 			Message:   "Friend request does not exist or is not pending",
 			Timestamp: timestamppb.Now(),
 		}, nil
 	}
-
-	// Step 3: Retrieve the requester ID from the friend request
-	var requesterID int
-	err = s.DB.QueryRow(`SELECT requester_id FROM friend_requests WHERE id = ?`, req.RequestId).Scan(&requesterID)
-	if err != nil {
-		return nil, fmt.Errorf("error retrieving requester ID: %w", err)
-	}
-
-	// Step 4: Insert the new friendship into the friends table
-	_, err = s.DB.Exec(`
-		INSERT INTO friends (user_id, friend_id, created_at) VALUES (?, ?, NOW()), (?, ?, NOW())`,
-		userIDInt, requesterID, requesterID, userIDInt)
-
 	if err != nil {
-		return nil, fmt.Errorf("error inserting into friends table: %w", err)
+		return nil, err
 	}
 
-	// Step 5: Return a successful response
+	// Step 2: Let the requester know, then return a successful response
+	s.publishEvent(ctx, requesterID, friends.FriendEventType_FRIEND_REQUEST_ACCEPTED)
 	return &friends.AcceptFriendRequestResponse{
 		Status:    friends.FriendRequestStatus_ACCEPTED,
 		Message:   "Friend request accepted successfully",
@@ -221,56 +214,12 @@ func (s *FriendsServer) GetIncomingFriendRequests(ctx context.Context, req *frie
 		return nil, fmt.Errorf("invalid user ID format: %w", err)
 	}
 
-	// Query to get all incoming friend requests for this user, including usernames
-	rows, err := s.DB.Query(`
-        SELECT fr.id, fr.requester_id, fr.recipient_id, fr.status, fr.created_at,
-               u_sender.username AS sender_username,
-               u_recipient.username AS recipient_username
-        FROM friend_requests fr
-        JOIN users u_sender ON fr.requester_id = u_sender.id
-        JOIN users u_recipient ON fr.recipient_id = u_recipient.id
-        WHERE fr.recipient_id = ? AND fr.status = ?`, userIDInt, storage.StatusPendingStr)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching incoming friend requests: %w", err)
-	}
-	defer rows.Close()
-
-	// Prepare the response
-	var incomingRequests []*friends.FriendRequest
-	for rows.Next() {
-		var friendReq friends.FriendRequest
-		var createdAt time.Time
-		var status string
-		var senderUsername string
-		var recipientUsername string
-
-		if err := rows.Scan(
-			&friendReq.RequestId,
-			&friendReq.SenderId,
-			&friendReq.RecipientId,
-			&status,
-			&createdAt,
-			&senderUsername,
-			&recipientUsername,
-		); err != nil {
-			return nil, fmt.Errorf("error scanning friend request row: %w", err)
-		}
-
-		// Convert status to enum and time to protobuf timestamp
-		friendReq.Status = friends.FriendRequestStatus(friends.FriendRequestStatus_value[status])
-		friendReq.CreatedAt = timestamppb.New(createdAt)
-
-		// Set the usernames
-		friendReq.SenderUsername = senderUsername
-		friendReq.RecipientUsername = recipientUsername
-
-		incomingRequests = append(incomingRequests, &friendReq)
-	}
-
-	// Check for errors from iterating over rows.
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating over incoming friend requests: %w", err)
+	// Get all incoming friend requests for this user, including usernames
+	requests, err := s.Repo.IncomingFriendRequests(uint32(userIDInt))
+	if err != nil {
+		return nil, err
 	}
+	incomingRequests := friendRequestsToProto(requests)
 
 	return &friends.GetIncomingFriendRequestsResponse{
 		IncomingRequests: incomingRequests,
@@ -291,63 +240,23 @@ func (s *FriendsServer) GetOutgoingFriendRequests(ctx context.Context, req *frie
 		return nil, fmt.Errorf("invalid user ID format: %w", err)
 	}
 
-	// Query to get all outgoing friend requests for this user, including usernames
-	rows, err := s.DB.Query(`
-        SELECT fr.id, fr.requester_id, fr.recipient_id, fr.status, fr.created_at,
-               u_sender.username AS sender_username,
-               u_recipient.username AS recipient_username
-        FROM friend_requests fr
-        JOIN users u_sender ON fr.requester_id = u_sender.id
-        JOIN users u_recipient ON fr.recipient_id = u_recipient.id
-        WHERE fr.requester_id = ? AND fr.status = ?`, userIDInt, storage.StatusPendingStr)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching outgoing friend requests: %w", err)
-	}
-	defer rows.Close()
-
-	// Prepare the response
-	var outgoingRequests []*friends.FriendRequest
-	for rows.Next() {
-		var friendReq friends.FriendRequest
-		var createdAt time.Time
-		var status string
-		var senderUsername string
-		var recipientUsername string
-
-		if err := rows.Scan(
-			&friendReq.RequestId,
-			&friendReq.SenderId,
-			&friendReq.RecipientId,
-			&status,
-			&createdAt,
-			&senderUsername,
-			&recipientUsername,
-		); err != nil {
-			return nil, fmt.Errorf("error scanning friend request row: %w", err)
-		}
-
-		// Convert status to enum and time to protobuf timestamp
-		friendReq.Status = friends.FriendRequestStatus(friends.FriendRequestStatus_value[status])
-		friendReq.CreatedAt = timestamppb.New(createdAt)
-
-		// Set the usernames
-		friendReq.SenderUsername = senderUsername
-		friendReq.RecipientUsername = recipientUsername
-
-		outgoingRequests = append(outgoingRequests, &friendReq)
-	}
-
-	// Check for errors after iteration
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating over outgoing friend requests: %w", err)
+	// Get all outgoing friend requests for this user, including usernames
+	requests, err := s.Repo.OutgoingFriendRequests(uint32(userIDInt))
+	if err != nil {
+		return nil, err
 	}
+	outgoingRequests := friendRequestsToProto(requests)
 
 	return &friends.GetOutgoingFriendRequestsResponse{
 		OutgoingRequests: outgoingRequests,
 	}, nil
 }
 
-// GetFriendList retrieves the list of friends for the user.
+// GetFriendList retrieves the list of friends for the user, a page at a time. Each page continues after
+// the last friend of the previous one, so friends added or removed in between don't shift it. A friend
+// whose position changes between pages, such as by connecting in ONLINE_FIRST order, can be skipped or repeated.
+// The database reads one page at a time, except in ONLINE_FIRST order, which depends on who is connected
+// and so is sorted here.
 func (s *FriendsServer) GetFriendList(ctx context.Context, req *friends.GetFriendListRequest) (*friends.GetFriendListResponse, error) {
 	// Retrieve the user ID from the context (e.g., extracted from the token)
 	userID, ok := ctx.Value("userID").(string)
@@ -361,37 +270,191 @@ func (s *FriendsServer) GetFriendList(ctx context.Context, req *friends.GetFrien
 		return nil, fmt.Errorf("invalid user ID format: %w", err)
 	}
 
-	// Query to get all friends for this user
-	rows, err := s.DB.Query(`
-        SELECT f.friend_id, u.username, f.created_at
-        FROM friends f
-        JOIN users u ON f.friend_id = u.id
-        WHERE f.user_id = ?`, userIDInt)
+	after, err := decodeFriendPageToken(req.PageToken, req.Sort)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	pageSize := int(req.PageSize)
+	if pageSize == 0 {
+		pageSize = defaultFriendPageSize
+	}
+	pageSize = min(pageSize, maxFriendPageSize)
+
+	var friendsList []*friends.Friend
+	if req.Sort == friends.FriendListSort_ONLINE_FIRST {
+		friendsList, err = s.onlineFirstFriends(uint32(userIDInt), after, pageSize+1)
+	} else {
+		order := storage.FriendsByRecentActivity
+		if req.Sort == friends.FriendListSort_ALPHABETICAL {
+			order = storage.FriendsByName
+		}
+		var friendRows []storage.Friend
+		friendRows, err = s.Repo.ListFriendsPage(uint32(userIDInt), order, friendCursor(after), pageSize+1)
+		for _, friend := range friendRows {
+			friendsList = append(friendsList, s.friendToProto(friend))
+		}
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error fetching friend list: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
 
-	// Prepare the response
+	// One extra friend tells whether there is another page
+	resp := &friends.GetFriendListResponse{Friends: friendsList}
+	if len(friendsList) > pageSize {
+		resp.Friends = friendsList[:pageSize]
+		resp.NextPageToken = encodeFriendPageToken(friendsList[pageSize-1], req.Sort)
+	}
+	return resp, nil
+}
+
+// onlineFirstFriends returns up to limit of the user's friends in ONLINE_FIRST order, starting after the
+// friend after. Whether a friend is online is only known here, so all friends are loaded and sorted.
+func (s *FriendsServer) onlineFirstFriends(userID uint32, after *friends.Friend, limit int) ([]*friends.Friend, error) {
+	friendRows, err := s.Repo.ListFriends(userID)
+	if err != nil {
+		return nil, err
+	}
 	var friendsList []*friends.Friend
-	for rows.Next() {
-		var friend friends.Friend
-		var addedAt time.Time
+	for _, friend := range friendRows {
+		friendsList = append(friendsList, s.friendToProto(friend))
+	}
+	slices.SortFunc(friendsList, compareOnlineFirst)
 
-		// Scan the required fields
-		if err := rows.Scan(&friend.UserId, &friend.Username, &addedAt); err != nil {
-			return nil, fmt.Errorf("error scanning friend row: %w", err)
+	start := 0
+	if after != nil {
+		start, _ = slices.BinarySearchFunc(friendsList, after, compareOnlineFirst)
+		if start < len(friendsList) && compareOnlineFirst(friendsList[start], after) == 0 {
+			start++
 		}
+	}
+	return friendsList[start:min(start+limit, len(friendsList))], nil
+}
 
-		// Convert `added_at` to protobuf timestamp
-		friend.AddedAt = timestamppb.New(addedAt)
+// friendToProto converts a friend, adding whether they are online.
+func (s *FriendsServer) friendToProto(friend storage.Friend) *friends.Friend {
+	entry := &friends.Friend{
+		UserId:   int32(friend.UserID),
+		Username: friend.Username,
+		IsBot:    friend.IsBot,
+		AddedAt:  timestamppb.New(friend.AddedAt),
+		Online:   s.Presence != nil && s.Presence.IsOnline(friend.UserID),
+	}
+	if friend.LastActivityAt != nil {
+		entry.LastActivityAt = timestamppb.New(*friend.LastActivityAt)
+	}
+	return entry
+}
 
-		friendsList = append(friendsList, &friend)
+// friendCursor converts the friend a page continues after for the repository, or returns nil for none.
+func friendCursor(after *friends.Friend) *storage.Friend {
+	if after == nil {
+		return nil
+	}
+	cursor := &storage.Friend{UserID: uint32(after.UserId), Username: after.Username}
+	if after.AddedAt != nil {
+		cursor.AddedAt = after.AddedAt.AsTime()
 	}
+	if after.LastActivityAt != nil {
+		lastActivityAt := after.LastActivityAt.AsTime()
+		cursor.LastActivityAt = &lastActivityAt
+	}
+	return cursor
+}
 
-	return &friends.GetFriendListResponse{
-		Friends: friendsList,
-	}, nil
+// compareOnlineFirst is the ONLINE_FIRST order: online friends first, then like RECENT_ACTIVITY.
+// No two friends compare equal, so a page token can name the last friend of a page and the next page
+// starts right after it.
+func compareOnlineFirst(a, b *friends.Friend) int {
+	if a.Online != b.Online {
+		if a.Online {
+			return -1
+		}
+		return 1
+	}
+	// Friends never messaged go after the rest, newest friendships first
+	if c := compareTimes(b.LastActivityAt, a.LastActivityAt); c != 0 {
+		return c
+	}
+	if c := compareTimes(b.AddedAt, a.AddedAt); c != 0 {
+		return c
+	}
+	return int(a.UserId) - int(b.UserId)
+}
+
+// compareTimes orders timestamps oldest first, with unset ones before all others.
+func compareTimes(a, b *timestamppb.Timestamp) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	return a.AsTime().Compare(b.AsTime())
+}
+
+// friendPageToken is the sort key of the last friend on a page. The next page starts after that key,
+// so friends added, removed or reordered meanwhile don't shift the following pages. The sort order is
+// part of the token, since a key in one order means nothing in another.
+type friendPageToken struct {
+	Sort           friends.FriendListSort `json:"sort"`
+	UserID         int32                  `json:"id"`
+	Username       string                 `json:"name,omitempty"`
+	Online         bool                   `json:"online,omitempty"`
+	LastActivityAt *time.Time             `json:"active,omitempty"`
+	AddedAt        *time.Time             `json:"added,omitempty"`
+}
+
+// encodeFriendPageToken makes the token for the page that follows last.
+func encodeFriendPageToken(last *friends.Friend, order friends.FriendListSort) string {
+	token := friendPageToken{Sort: order, UserID: last.UserId}
+	switch order {
+	case friends.FriendListSort_ALPHABETICAL:
+		token.Username = last.Username
+	case friends.FriendListSort_ONLINE_FIRST:
+		token.Online = last.Online
+		fallthrough
+	default:
+		if last.LastActivityAt != nil {
+			lastActivityAt := last.LastActivityAt.AsTime()
+			token.LastActivityAt = &lastActivityAt
+		}
+		if last.AddedAt != nil {
+			addedAt := last.AddedAt.AsTime()
+			token.AddedAt = &addedAt
+		}
+	}
+	data, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeFriendPageToken returns the friend a page token from encodeFriendPageToken continues after,
+// or nil for no token.
+func decodeFriendPageToken(token string, order friends.FriendListSort) (*friends.Friend, error) {
+	if token == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page token")
+	}
+	var decoded friendPageToken
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("invalid page token")
+	}
+	if decoded.Sort != order {
+		return nil, fmt.Errorf("page token is for a different sort order")
+	}
+
+	after := &friends.Friend{UserId: decoded.UserID, Username: decoded.Username, Online: decoded.Online}
+	if decoded.LastActivityAt != nil {
+		after.LastActivityAt = timestamppb.New(*decoded.LastActivityAt)
+	}
+	if decoded.AddedAt != nil {
+		after.AddedAt = timestamppb.New(*decoded.AddedAt)
+	}
+	return after, nil
 }
 
 // DeclineFriendRequest handles declining a friend request.
@@ -409,32 +472,61 @@ func (s *FriendsServer) DeclineFriendRequest(ctx context.Context, req *friends.D
 	}
 
 	// Step 1: Update the friend request status to "DECLINED" if it exists and is pending
-	res, err := s.DB.Exec(`UPDATE friend_requests SET status = ?, response_at = NOW() WHERE id = ? AND recipient_id = ? AND status = ?`,
-		storage.StatusDeclinedStr, req.RequestId, userIDInt, storage.StatusPendingStr)
-
+	requesterID, err := s.Repo.DeclineFriendRequest(uint32(req.RequestId), uint32(userIDInt))
+	if errors.Is(err, storage.ErrFriendRequestNotFound) {
+		// The request does not exist or is not pending
+		return &friends.DeclineFriendRequestResponse{
+			Status:    friends.FriendRequestStatus_FAILED,
+			Message:   "Friend request does not exist or is not pending",
+			Timestamp: timestamppb.Now(),
+		}, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error updating friend request status to declined: %w", err)
+		return nil, err
+	}
+
+	// Step 2: Let the requester know, then return a successful response
+	s.publishEvent(ctx, requesterID, friends.FriendEventType_FRIEND_REQUEST_DECLINED)
+	return &friends.DeclineFriendRequestResponse{
+		Status:    friends.FriendRequestStatus_DECLINED,
+		Message:   "Friend request declined successfully",
+		Timestamp: timestamppb.Now(),
+	}, nil
+}
+
+// CancelFriendRequest handles withdrawing a friend request the user sent.
+func (s *FriendsServer) CancelFriendRequest(ctx context.Context, req *friends.CancelFriendRequestRequest) (*friends.CancelFriendRequestResponse, error) {
+	// Retrieve the user ID from the context
+	userID, ok := ctx.Value("userID").(string)
+	if !ok || userID == "" {
+		return nil, fmt.Errorf("user ID not found in context")
 	}
 
-	// Step 2: Check if exactly one row was affected by the update
-	rowsAffected, err := res.RowsAffected()
+	// Convert userID from string to int
+	userIDInt, err := strconv.Atoi(userID)
 	if err != nil {
-		return nil, fmt.Errorf("error checking affected rows: %w", err)
+		return nil, fmt.Errorf("invalid user ID format: %w", err)
 	}
 
-	if rowsAffected != 1 {
-		// No rows were affected, indicating that the request does not exist or is not pending
-		return &friends.DeclineFriendRequestResponse{
+	// Step 1: Update the friend request status to "CANCELED" if the user sent it and it is pending
+	recipientID, err := s.Repo.CancelFriendRequest(uint32(req.RequestId), uint32(userIDInt))
+	if errors.Is(err, storage.ErrFriendRequestNotFound) {
+		// The request does not exist, was sent by someone else or is not pending
+		return &friends.CancelFriendRequestResponse{
 			Status:    friends.FriendRequestStatus_FAILED,
 			Message:   "Friend request does not exist or is not pending",
 			Timestamp: timestamppb.Now(),
 		}, nil
 	}
+	if err != nil {
+		return nil, err
+	}
 
-	// Step 3: Return a successful response
-	return &friends.DeclineFriendRequestResponse{
-		Status:    friends.FriendRequestStatus_DECLINED,
-		Message:   "Friend request declined successfully",
+	// Step 2: Let the recipient know so it leaves their incoming requests, then return a successful response
+	s.publishEvent(ctx, recipientID, friends.FriendEventType_FRIEND_REQUEST_CANCELED)
+	return &friends.CancelFriendRequestResponse{
+		Status:    friends.FriendRequestStatus_CANCELED,
+		Message:   "Friend request canceled successfully",
 		Timestamp: timestamppb.Now(),
 	}, nil
 }
@@ -453,20 +545,14 @@ func (s *FriendsServer) RemoveFriend(ctx context.Context, req *friends.RemoveFri
 		return nil, fmt.Errorf("invalid user ID format: %w", err)
 	}
 
-	// Step 1: Remove the friendship from the friends table
-	res, err := s.DB.Exec(`DELETE FROM friends WHERE (user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)`,
-		userIDInt, req.FriendId, req.FriendId, userIDInt)
-	if err != nil {
-		return nil, fmt.Errorf("error removing friend from friends table: %w", err)
-	}
-
-	// Step 2: Check if any rows were affected by the deletion
-	rowsAffected, err := res.RowsAffected()
+	// Step 1: Remove the friendship and cancel the requests between the two users
+	removed, err := s.Repo.RemoveFriend(uint32(userIDInt), uint32(req.FriendId))
 	if err != nil {
-		return nil, fmt.Errorf("error checking affected rows: %w", err)
+		return nil, err
 	}
 
-	if rowsAffected == 0 {
+	// Step 2: Check whether there was a friendship to remove
+	if !removed {
 		// No rows were affected, indicating that the friendship does not exist
 		return &friends.RemoveFriendResponse{
 			Success:   false,
@@ -475,17 +561,375 @@ func (s *FriendsServer) RemoveFriend(ctx context.Context, req *friends.RemoveFri
 		}, nil
 	}
 
-	// Step 3: Update the friend request status to "CANCELLED" if it exists
-	_, err = s.DB.Exec(`UPDATE friend_requests SET status = ? WHERE (requester_id = ? AND recipient_id = ?) OR (requester_id = ? AND recipient_id = ?)`,
-		storage.StatusCancelledStr, userIDInt, req.FriendId, req.FriendId, userIDInt)
+	// Step 3: Let the removed friend know, then return a successful response
+	s.publishEvent(ctx, uint32(req.FriendId), friends.FriendEventType_FRIEND_REMOVED)
+	return &friends.RemoveFriendResponse{
+		Success:   true,
+		Message:   "Friend removed successfully",
+		Timestamp: timestamppb.Now(),
+	}, nil
+}
+
+// BlockUser handles blocking a user, which also ends any friendship or friend request with them.
+func (s *FriendsServer) BlockUser(ctx context.Context, req *friends.BlockUserRequest) (*friends.BlockUserResponse, error) {
+	// Retrieve the user ID from the context
+	userID, ok := ctx.Value("userID").(string)
+	if !ok || userID == "" {
+		return nil, fmt.Errorf("user ID not found in context")
+	}
+
+	// Convert userID from string to int
+	userIDInt, err := strconv.Atoi(userID)
 	if err != nil {
-		return nil, fmt.Errorf("error updating friend request status to cancelled: %w", err)
+		return nil, fmt.Errorf("invalid user ID format: %w", err)
 	}
 
-	// Step 4: Return a successful response
-	return &friends.RemoveFriendResponse{
+	if userIDInt == int(req.UserId) {
+		return &friends.BlockUserResponse{
+			Success:   false,
+			Message:   "Cannot block yourself",
+			Timestamp: timestamppb.Now(),
+		}, nil
+	}
+
+	// Step 1: Add the block and end the friendship and requests between the two users
+	wasFriend, err := s.Repo.BlockUser(uint32(userIDInt), uint32(req.UserId))
+	if errors.Is(err, storage.ErrUserNotFound) {
+		return &friends.BlockUserResponse{
+			Success:   false,
+			Message:   "User not found",
+			Timestamp: timestamppb.Now(),
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 2: A blocked friend sees the friendship end, as if they were removed; a stranger is not told anything
+	if wasFriend {
+		s.publishEvent(ctx, uint32(req.UserId), friends.FriendEventType_FRIEND_REMOVED)
+	}
+	return &friends.BlockUserResponse{
 		Success:   true,
-		Message:   "Friend removed successfully",
+		Message:   "User blocked successfully",
+		Timestamp: timestamppb.Now(),
+	}, nil
+}
+
+// UnblockUser handles lifting a block. It does not restore the friendship the block ended.
+func (s *FriendsServer) UnblockUser(ctx context.Context, req *friends.UnblockUserRequest) (*friends.UnblockUserResponse, error) {
+	// Retrieve the user ID from the context
+	userID, ok := ctx.Value("userID").(string)
+	if !ok || userID == "" {
+		return nil, fmt.Errorf("user ID not found in context")
+	}
+
+	// Convert userID from string to int
+	userIDInt, err := strconv.Atoi(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID format: %w", err)
+	}
+
+	unblocked, err := s.Repo.UnblockUser(uint32(userIDInt), uint32(req.UserId))
+	if err != nil {
+		return nil, err
+	}
+	if !unblocked {
+		return &friends.UnblockUserResponse{
+			Success:   false,
+			Message:   "User is not blocked",
+			Timestamp: timestamppb.Now(),
+		}, nil
+	}
+	return &friends.UnblockUserResponse{
+		Success:   true,
+		Message:   "User unblocked successfully",
 		Timestamp: timestamppb.Now(),
 	}, nil
 }
+
+// GetBlockedUsers retrieves the users the user has blocked.
+func (s *FriendsServer) GetBlockedUsers(ctx context.Context, req *friends.GetBlockedUsersRequest) (*friends.GetBlockedUsersResponse, error) {
+	// Retrieve the user ID from the context
+	userID, ok := ctx.Value("userID").(string)
+	if !ok || userID == "" {
+		return nil, fmt.Errorf("user ID not found in context")
+	}
+
+	// Convert userID from string to int
+	userIDInt, err := strconv.Atoi(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID format: %w", err)
+	}
+
+	blockedRows, err := s.Repo.ListBlockedUsers(uint32(userIDInt))
+	if err != nil {
+		return nil, err
+	}
+
+	var blockedUsers []*friends.BlockedUser
+	for _, blocked := range blockedRows {
+		blockedUsers = append(blockedUsers, &friends.BlockedUser{
+			UserId:    int32(blocked.UserID),
+			Username:  blocked.Username,
+			BlockedAt: timestamppb.New(blocked.BlockedAt),
+		})
+	}
+
+	return &friends.GetBlockedUsersResponse{
+		BlockedUsers: blockedUsers,
+	}, nil
+}
+
+// SearchUsers finds users whose usernames match the query, so friend requests don't need the exact name.
+func (s *FriendsServer) SearchUsers(ctx context.Context, req *friends.SearchUsersRequest) (*friends.SearchUsersResponse, error) {
+	// Retrieve the user ID from the context
+	userID, ok := ctx.Value("userID").(string)
+	if !ok || userID == "" {
+		return nil, fmt.Errorf("user ID not found in context")
+	}
+
+	// Convert userID from string to int
+	userIDInt, err := strconv.Atoi(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID format: %w", err)
+	}
+
+	query := strings.TrimSpace(req.Query)
+	if query == "" {
+		return &friends.SearchUsersResponse{}, nil
+	}
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultSearchLimit
+	}
+	limit = min(limit, maxSearchLimit)
+
+	found, more, err := s.Repo.SearchUsers(uint32(userIDInt), query, int(req.Offset), limit)
+	if err != nil {
+		s.Logger.Errorf("Error searching users for %q: %v", query, err)
+		return nil, fmt.Errorf("error searching users: %w", err)
+	}
+
+	var users []*friends.UserSearchResult
+	for _, user := range found {
+		users = append(users, &friends.UserSearchResult{
+			UserId:         int32(user.UserID),
+			Username:       user.Username,
+			IsBot:          user.IsBot,
+			IsFriend:       user.IsFriend,
+			RequestPending: user.RequestPending,
+		})
+	}
+
+	return &friends.SearchUsersResponse{
+		Users:   users,
+		HasMore: more,
+	}, nil
+}
+
+// GetPrivacySettings retrieves the user's privacy settings.
+func (s *FriendsServer) GetPrivacySettings(ctx context.Context, req *friends.GetPrivacySettingsRequest) (*friends.GetPrivacySettingsResponse, error) {
+	// Retrieve the user ID from the context
+	userID, ok := ctx.Value("userID").(string)
+	if !ok || userID == "" {
+		return nil, fmt.Errorf("user ID not found in context")
+	}
+
+	// Convert userID from string to int
+	userIDInt, err := strconv.Atoi(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID format: %w", err)
+	}
+
+	discoverable, err := s.Repo.Discoverable(uint32(userIDInt))
+	if err != nil {
+		return nil, err
+	}
+
+	return &friends.GetPrivacySettingsResponse{
+		Settings: &friends.PrivacySettings{Discoverable: discoverable},
+	}, nil
+}
+
+// UpdatePrivacySettings saves the user's privacy settings.
+func (s *FriendsServer) UpdatePrivacySettings(ctx context.Context, req *friends.UpdatePrivacySettingsRequest) (*friends.UpdatePrivacySettingsResponse, error) {
+	// Retrieve the user ID from the context
+	userID, ok := ctx.Value("userID").(string)
+	if !ok || userID == "" {
+		return nil, fmt.Errorf("user ID not found in context")
+	}
+
+	// Convert userID from string to int
+	userIDInt, err := strconv.Atoi(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID format: %w", err)
+	}
+
+	if req.Settings == nil {
+		return &friends.UpdatePrivacySettingsResponse{
+			Success: false,
+			Message: "No settings given",
+		}, nil
+	}
+
+	if err := s.Repo.SetDiscoverable(uint32(userIDInt), req.Settings.Discoverable); err != nil {
+		s.Logger.Errorf("Error updating privacy settings of user %s: %v", userID, err)
+		return nil, fmt.Errorf("error updating privacy settings: %w", err)
+	}
+	s.Logger.Infof("User %s set discoverable to %t", userID, req.Settings.Discoverable)
+
+	return &friends.UpdatePrivacySettingsResponse{
+		Success: true,
+		Message: "Privacy settings updated",
+	}, nil
+}
+
+// CreateInvite creates an invite code that makes whoever redeems it a friend of the user.
+func (s *FriendsServer) CreateInvite(ctx context.Context, req *friends.CreateInviteRequest) (*friends.CreateInviteResponse, error) {
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	maxUses := int(req.MaxUses)
+	if maxUses == 0 {
+		maxUses = defaultInviteUses
+	}
+	if maxUses > maxInviteUses {
+		return nil, status.Errorf(codes.InvalidArgument, "an invite can be redeemed at most %d times", maxInviteUses)
+	}
+	// Check the hours before converting them, since a large enough count overflows a Duration
+	if time.Duration(req.ExpiresInHours) > maxInviteLifetime/time.Hour {
+		return nil, status.Errorf(codes.InvalidArgument, "an invite can work for at most %d days", maxInviteLifetime/(24*time.Hour))
+	}
+	validFor := time.Duration(req.ExpiresInHours) * time.Hour
+	if validFor == 0 {
+		validFor = defaultInviteLifetime
+	}
+
+	code, err := generateCode()
+	if err != nil {
+		return nil, fmt.Errorf("error generating invite code: %w", err)
+	}
+	invite, err := s.Repo.CreateInvite(uint32(userID), code, maxUses, time.Now().Add(validFor))
+	if err != nil {
+		s.Logger.Errorf("Error creating invite for user %d: %v", userID, err)
+		return nil, fmt.Errorf("error creating invite: %w", err)
+	}
+	s.Logger.Infof("User %d created an invite for %d users", userID, maxUses)
+
+	return &friends.CreateInviteResponse{
+		Code:      formatCode(invite.Code),
+		MaxUses:   uint32(invite.MaxUses),
+		ExpiresAt: timestamppb.New(invite.ExpiresAt),
+	}, nil
+}
+
+// RedeemInvite makes the user a friend of the invite's creator.
+func (s *FriendsServer) RedeemInvite(ctx context.Context, req *friends.RedeemInviteRequest) (*friends.RedeemInviteResponse, error) {
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	creator, err := s.Repo.RedeemInvite(normalizeCode(req.Code), uint32(userID))
+	switch {
+	case errors.Is(err, storage.ErrInviteNotFound):
+		return nil, status.Error(codes.NotFound, "invite code is invalid, expired or used up")
+	case errors.Is(err, storage.ErrOwnInvite):
+		return nil, status.Error(codes.InvalidArgument, "you can't redeem your own invite")
+	case errors.Is(err, storage.ErrAlreadyFriends):
+		return nil, status.Error(codes.AlreadyExists, "you are already friends with the invite's creator")
+	case errors.Is(err, storage.ErrBlocked):
+		// Don't reveal which of the two blocked the other
+		return nil, status.Error(codes.FailedPrecondition, "the invite can't be redeemed")
+	case err != nil:
+		return nil, err
+	}
+	s.Logger.Infof("User %d redeemed an invite from user %d", userID, creator.UserID)
+
+	// Let the creator know they have a new friend
+	s.publishEvent(ctx, creator.UserID, friends.FriendEventType_INVITE_REDEEMED)
+	return &friends.RedeemInviteResponse{
+		Friend: &friends.Friend{
+			UserId:   int32(creator.UserID),
+			Username: creator.Username,
+			IsBot:    creator.IsBot,
+			AddedAt:  timestamppb.New(creator.AddedAt),
+			Online:   s.Presence != nil && s.Presence.IsOnline(creator.UserID),
+		},
+	}, nil
+}
+
+// StreamFriendEvents sends the user the friend events caused by other users until the stream ends.
+func (s *FriendsServer) StreamFriendEvents(req *friends.StreamFriendEventsRequest, stream friends.FriendManagement_StreamFriendEventsServer) error {
+	ctx := stream.Context()
+
+	// Retrieve the user ID from the context
+	userID, ok := ctx.Value("userID").(string)
+	if !ok || userID == "" {
+		return fmt.Errorf("user ID not found in context")
+	}
+
+	// Convert userID from string to int
+	userIDInt, err := strconv.Atoi(userID)
+	if err != nil {
+		return fmt.Errorf("invalid user ID format: %w", err)
+	}
+
+	events, unsubscribe := s.Events.Subscribe(uint32(userIDInt))
+	defer unsubscribe()
+	s.Logger.Infof("User %s subscribed to friend events", userID)
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.Logger.Infof("Friend event stream of user %s ended: %v", userID, ctx.Err())
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				s.Logger.Infof("Friend event stream of user %s was disconnected", userID)
+				return status.Error(codes.Unauthenticated, "session revoked")
+			}
+			if err := stream.Send(event); err != nil {
+				return fmt.Errorf("failed to send friend event to user %s: %w", userID, err)
+			}
+		}
+	}
+}
+
+// publishEvent tells the user with recipientID that the user making the request caused an event.
+func (s *FriendsServer) publishEvent(ctx context.Context, recipientID uint32, eventType friends.FriendEventType) {
+	userID, _ := ctx.Value("userID").(string)
+	username, _ := ctx.Value("username").(string)
+	userIDInt, err := strconv.Atoi(userID)
+	if err != nil {
+		s.Logger.Errorf("Not sending %s event: invalid user ID %q", eventType, userID)
+		return
+	}
+
+	s.Events.Publish(recipientID, &friends.FriendEvent{
+		Type:      eventType,
+		UserId:    int32(userIDInt),
+		Username:  username,
+		Timestamp: timestamppb.Now(),
+	})
+}
+
+// friendRequestsToProto converts stored friend requests to their protobuf form.
+func friendRequestsToProto(requests []storage.FriendRequest) []*friends.FriendRequest {
+	var converted []*friends.FriendRequest
+	for _, request := range requests {
+		converted = append(converted, &friends.FriendRequest{
+			RequestId:         int32(request.ID),
+			SenderId:          int32(request.RequesterID),
+			RecipientId:       int32(request.RecipientID),
+			Status:            friends.FriendRequestStatus(friends.FriendRequestStatus_value[request.Status]),
+			CreatedAt:         timestamppb.New(request.CreatedAt),
+			SenderUsername:    request.RequesterUsername,
+			RecipientUsername: request.RecipientUsername,
+		})
+	}
+	return converted
+}
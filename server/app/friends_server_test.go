@@ -0,0 +1,663 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/johnkhk/cli_chat_app/genproto/friends"
+	"github.com/johnkhk/cli_chat_app/server/storage"
+)
+
+// testLogger returns a logger that discards its output.
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// userContext returns a context carrying the user as the auth interceptor sets it.
+func userContext(userID uint32, username string) context.Context {
+	ctx := context.WithValue(context.Background(), "userID", strconv.FormatUint(uint64(userID), 10))
+	return context.WithValue(ctx, "username", username)
+}
+
+func TestSendFriendRequest(t *testing.T) {
+	repo := newFakeRepository()
+	alice, bob := repo.addUser("alice"), repo.addUser("bob")
+	repo.CreatePendingUser("dave", "hash", false)
+	server := NewFriendsServer(repo, NewFriendEventHub(testLogger()), testLogger())
+
+	send := func(from uint32, fromName, to string) *friends.SendFriendRequestResponse {
+		t.Helper()
+		resp, err := server.SendFriendRequest(userContext(from, fromName), &friends.SendFriendRequestRequest{RecipientUsername: to})
+		if err != nil {
+			t.Fatalf("SendFriendRequest from %s to %s failed: %v", fromName, to, err)
+		}
+		return resp
+	}
+
+	tests := []struct {
+		name           string
+		from           uint32
+		fromName, to   string
+		expectedStatus friends.FriendRequestStatus
+		expectedMsg    string
+	}{
+		{"to self", alice, "alice", "alice", friends.FriendRequestStatus_FAILED, "Cannot send a friend request to yourself"},
+		{"to unknown user", alice, "alice", "carol", friends.FriendRequestStatus_FAILED, "Recipient not found"},
+		{"to account waiting for approval", alice, "alice", "dave", friends.FriendRequestStatus_FAILED, "Recipient not found"},
+		{"new request", alice, "alice", "bob", friends.FriendRequestStatus_PENDING, "Friend request sent successfully"},
+		{"already pending", alice, "alice", "bob", friends.FriendRequestStatus_FAILED, "A friend request is already pending"},
+		{"pending the other way", bob, "bob", "alice", friends.FriendRequestStatus_FAILED, "A friend request is already pending"},
+	}
+	for _, tt := range tests {
+		resp := send(tt.from, tt.fromName, tt.to)
+		if resp.Status != tt.expectedStatus || resp.Message != tt.expectedMsg {
+			t.Fatalf("%s: expected %v %q, got %v %q", tt.name, tt.expectedStatus, tt.expectedMsg, resp.Status, resp.Message)
+		}
+	}
+
+	// Declining lets either user send again
+	incoming, _ := repo.IncomingFriendRequests(bob)
+	if _, err := server.DeclineFriendRequest(userContext(bob, "bob"), &friends.DeclineFriendRequestRequest{RequestId: int32(incoming[0].ID)}); err != nil {
+		t.Fatalf("DeclineFriendRequest failed: %v", err)
+	}
+	if resp := send(bob, "bob", "alice"); resp.Status != friends.FriendRequestStatus_PENDING || resp.Message != "Friend request sent again successfully" {
+		t.Fatalf("Expected the declined request to be sent again, got %v %q", resp.Status, resp.Message)
+	}
+	if outgoing, _ := repo.OutgoingFriendRequests(bob); len(outgoing) != 1 || outgoing[0].RecipientID != alice {
+		t.Fatalf("Expected bob's request to alice to be pending, got %v", outgoing)
+	}
+}
+
+func TestCancelFriendRequest(t *testing.T) {
+	repo := newFakeRepository()
+	alice, bob := repo.addUser("alice"), repo.addUser("bob")
+	server := NewFriendsServer(repo, NewFriendEventHub(testLogger()), testLogger())
+	repo.SendFriendRequest(alice, bob, storage.FriendRequestLimits{})
+	outgoing, _ := repo.OutgoingFriendRequests(alice)
+	req := &friends.CancelFriendRequestRequest{RequestId: int32(outgoing[0].ID)}
+
+	// Only the requester can cancel
+	resp, err := server.CancelFriendRequest(userContext(bob, "bob"), req)
+	if err != nil || resp.Status != friends.FriendRequestStatus_FAILED {
+		t.Fatalf("Expected the recipient not to be able to cancel, got %v (err: %v)", resp, err)
+	}
+
+	resp, err = server.CancelFriendRequest(userContext(alice, "alice"), req)
+	if err != nil || resp.Status != friends.FriendRequestStatus_CANCELED {
+		t.Fatalf("Expected the request to be canceled, got %v (err: %v)", resp, err)
+	}
+	incoming, err := server.GetIncomingFriendRequests(userContext(bob, "bob"), &friends.GetIncomingFriendRequestsRequest{})
+	if err != nil || len(incoming.IncomingRequests) != 0 {
+		t.Fatalf("Expected the canceled request to leave bob's incoming requests, got %v (err: %v)", incoming, err)
+	}
+
+	// A canceled request can't be accepted or canceled again, but can be sent again
+	if resp, _ := server.CancelFriendRequest(userContext(alice, "alice"), req); resp.Status != friends.FriendRequestStatus_FAILED {
+		t.Fatalf("Expected canceling again to fail, got %v", resp)
+	}
+	if resp, _ := server.AcceptFriendRequest(userContext(bob, "bob"), &friends.AcceptFriendRequestRequest{RequestId: req.RequestId}); resp.Status != friends.FriendRequestStatus_FAILED {
+		t.Fatalf("Expected a canceled request not to be accepted, got %v", resp)
+	}
+	sendResp, err := server.SendFriendRequest(userContext(alice, "alice"), &friends.SendFriendRequestRequest{RecipientUsername: "bob"})
+	if err != nil || sendResp.Status != friends.FriendRequestStatus_PENDING {
+		t.Fatalf("Expected the canceled request to be sent again, got %v (err: %v)", sendResp, err)
+	}
+}
+
+func TestSendFriendRequestLimits(t *testing.T) {
+	repo := newFakeRepository()
+	alice := repo.addUser("alice")
+	for _, username := range []string{"bob", "carol", "dave", "erin"} {
+		repo.addUser(username)
+	}
+	server := NewFriendsServer(repo, NewFriendEventHub(testLogger()), testLogger())
+	server.Limits = storage.FriendRequestLimits{MaxPending: 2, MaxPerDay: 3}
+	send := func(to string) error {
+		_, err := server.SendFriendRequest(userContext(alice, "alice"), &friends.SendFriendRequestRequest{RecipientUsername: to})
+		return err
+	}
+
+	for _, to := range []string{"bob", "carol"} {
+		if err := send(to); err != nil {
+			t.Fatalf("SendFriendRequest to %s failed: %v", to, err)
+		}
+	}
+	if err := send("dave"); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Expected too many pending requests to be refused, got %v", err)
+	}
+
+	// Canceling makes room, but only until the daily limit
+	outgoing, _ := repo.OutgoingFriendRequests(alice)
+	server.CancelFriendRequest(userContext(alice, "alice"), &friends.CancelFriendRequestRequest{RequestId: int32(outgoing[0].ID)})
+	if err := send("dave"); err != nil {
+		t.Fatalf("Expected a request after canceling one to be sent, got %v", err)
+	}
+	server.CancelFriendRequest(userContext(alice, "alice"), &friends.CancelFriendRequestRequest{RequestId: int32(outgoing[1].ID)})
+	err := send("erin")
+	if status.Code(err) != codes.ResourceExhausted || !strings.Contains(err.Error(), "last day") {
+		t.Fatalf("Expected the daily limit to be reached, got %v", err)
+	}
+
+	// A day later the requests are old enough to send more
+	repo.mu.Lock()
+	for i := range repo.sends[alice] {
+		repo.sends[alice][i] = repo.sends[alice][i].Add(-25 * time.Hour)
+	}
+	repo.mu.Unlock()
+	if err := send("erin"); err != nil {
+		t.Fatalf("Expected a request the next day to be sent, got %v", err)
+	}
+}
+
+func TestSendFriendRequestLimitsCountResends(t *testing.T) {
+	repo := newFakeRepository()
+	alice, bob := repo.addUser("alice"), repo.addUser("bob")
+	hub := NewFriendEventHub(testLogger())
+	server := NewFriendsServer(repo, hub, testLogger())
+	server.Limits = storage.FriendRequestLimits{MaxPending: 5, MaxPerDay: 3}
+	bobEvents, unsubscribe := hub.Subscribe(bob)
+	defer unsubscribe()
+
+	// Canceling and sending again reuses the request, but each send counts toward the daily limit
+	var err error
+	created := 0
+	for i := 0; i < 5 && err == nil; i++ {
+		_, err = server.SendFriendRequest(userContext(alice, "alice"), &friends.SendFriendRequestRequest{RecipientUsername: "bob"})
+		if err == nil {
+			created++
+			outgoing, _ := repo.OutgoingFriendRequests(alice)
+			server.CancelFriendRequest(userContext(alice, "alice"), &friends.CancelFriendRequestRequest{RequestId: int32(outgoing[0].ID)})
+		}
+	}
+	if status.Code(err) != codes.ResourceExhausted || created != 3 {
+		t.Fatalf("Expected the fourth send to reach the daily limit, got %d sends and %v", created, err)
+	}
+
+	// bob only heard about the requests that were sent
+	events := 0
+	for len(bobEvents) > 0 {
+		if event := <-bobEvents; event.Type == friends.FriendEventType_FRIEND_REQUEST_CREATED {
+			events++
+		}
+	}
+	if events != created {
+		t.Fatalf("Expected %d request events, got %d", created, events)
+	}
+}
+
+func TestExpireFriendRequests(t *testing.T) {
+	repo := newFakeRepository()
+	alice, bob := repo.addUser("alice"), repo.addUser("bob")
+	repo.SendFriendRequest(alice, bob, storage.FriendRequestLimits{})
+	repo.requests[0].CreatedAt = time.Now().Add(-2 * FriendRequestMaxAge)
+
+	// The first pass runs straight away
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ExpireFriendRequests(ctx, repo, FriendRequestMaxAge, time.Hour, testLogger())
+		close(done)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if incoming, _ := repo.IncomingFriendRequests(bob); len(incoming) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the stale request to expire")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+}
+
+func TestInvites(t *testing.T) {
+	repo := newFakeRepository()
+	alice, bob, carol := repo.addUser("alice"), repo.addUser("bob"), repo.addUser("carol")
+	hub := NewFriendEventHub(testLogger())
+	server := NewFriendsServer(repo, hub, testLogger())
+	events, unsubscribe := hub.Subscribe(alice)
+	defer unsubscribe()
+
+	if _, err := server.CreateInvite(userContext(alice, "alice"), &friends.CreateInviteRequest{MaxUses: maxInviteUses + 1}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected too many uses to be refused, got %v", err)
+	}
+	// 2562048 hours is just past the longest Duration, and overflows to a negative one
+	for _, hours := range []uint32{uint32(maxInviteLifetime/time.Hour) + 1, 2562048, math.MaxUint32} {
+		if _, err := server.CreateInvite(userContext(alice, "alice"), &friends.CreateInviteRequest{ExpiresInHours: hours}); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Expected an invite working for %d hours to be refused, got %v", hours, err)
+		}
+	}
+	invite, err := server.CreateInvite(userContext(alice, "alice"), &friends.CreateInviteRequest{})
+	if err != nil || invite.MaxUses != 1 || len(invite.Code) != 9 {
+		t.Fatalf("Expected a single use invite, got %v (err: %v)", invite, err)
+	}
+
+	// The creator can't redeem their own invite
+	if _, err := server.RedeemInvite(userContext(alice, "alice"), &friends.RedeemInviteRequest{Code: invite.Code}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected redeeming an own invite to be refused, got %v", err)
+	}
+
+	// The code works in lower case and without the dash
+	code := strings.ToLower(strings.ReplaceAll(invite.Code, "-", ""))
+	resp, err := server.RedeemInvite(userContext(bob, "bob"), &friends.RedeemInviteRequest{Code: code})
+	if err != nil || resp.Friend.Username != "alice" {
+		t.Fatalf("Expected bob to become alice's friend, got %v (err: %v)", resp, err)
+	}
+	if areFriends, _ := repo.AreFriends(alice, bob); !areFriends {
+		t.Fatalf("Expected alice and bob to be friends")
+	}
+	if event := <-events; event.Type != friends.FriendEventType_INVITE_REDEEMED || event.Username != "bob" {
+		t.Fatalf("Expected alice to hear that bob redeemed the invite, got %v", event)
+	}
+
+	// A single use invite is used up
+	if _, err := server.RedeemInvite(userContext(carol, "carol"), &friends.RedeemInviteRequest{Code: invite.Code}); status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected a used up invite to be refused, got %v", err)
+	}
+
+	// Blocked users and friends can't redeem a multi-use invite, but others can
+	invite, _ = server.CreateInvite(userContext(alice, "alice"), &friends.CreateInviteRequest{MaxUses: 5, ExpiresInHours: 1})
+	if _, err := server.RedeemInvite(userContext(bob, "bob"), &friends.RedeemInviteRequest{Code: invite.Code}); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("Expected a friend redeeming again to be refused, got %v", err)
+	}
+	repo.BlockUser(carol, alice)
+	if _, err := server.RedeemInvite(userContext(carol, "carol"), &friends.RedeemInviteRequest{Code: invite.Code}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("Expected a blocked invite to be refused, got %v", err)
+	}
+	repo.UnblockUser(carol, alice)
+	if _, err := server.RedeemInvite(userContext(carol, "carol"), &friends.RedeemInviteRequest{Code: invite.Code}); err != nil {
+		t.Fatalf("Expected carol to redeem the invite, got %v", err)
+	}
+
+	// Expired invites can't be redeemed
+	dave := repo.addUser("dave")
+	repo.mu.Lock()
+	repo.invites[1].ExpiresAt = time.Now().Add(-time.Minute)
+	repo.mu.Unlock()
+	if _, err := server.RedeemInvite(userContext(dave, "dave"), &friends.RedeemInviteRequest{Code: invite.Code}); status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected an expired invite to be refused, got %v", err)
+	}
+}
+
+func TestAcceptFriendRequest(t *testing.T) {
+	repo := newFakeRepository()
+	alice, bob := repo.addUser("alice"), repo.addUser("bob")
+	server := NewFriendsServer(repo, NewFriendEventHub(testLogger()), testLogger())
+	repo.SendFriendRequest(alice, bob, storage.FriendRequestLimits{})
+	incoming, _ := repo.IncomingFriendRequests(bob)
+	req := &friends.AcceptFriendRequestRequest{RequestId: int32(incoming[0].ID)}
+
+	// Only the recipient can accept
+	resp, err := server.AcceptFriendRequest(userContext(alice, "alice"), req)
+	if err != nil || resp.Status != friends.FriendRequestStatus_FAILED {
+		t.Fatalf("Expected the requester not to be able to accept, got %v (err: %v)", resp, err)
+	}
+
+	resp, err = server.AcceptFriendRequest(userContext(bob, "bob"), req)
+	if err != nil || resp.Status != friends.FriendRequestStatus_ACCEPTED {
+		t.Fatalf("Expected the request to be accepted, got %v (err: %v)", resp, err)
+	}
+	list, err := server.GetFriendList(userContext(alice, "alice"), &friends.GetFriendListRequest{})
+	if err != nil || len(list.Friends) != 1 || list.Friends[0].Username != "bob" {
+		t.Fatalf("Expected bob in alice's friend list, got %v (err: %v)", list, err)
+	}
+
+	// Accepting twice fails, and sending another request is refused
+	if resp, _ := server.AcceptFriendRequest(userContext(bob, "bob"), req); resp.Status != friends.FriendRequestStatus_FAILED {
+		t.Fatalf("Expected accepting again to fail, got %v", resp)
+	}
+	sendResp, err := server.SendFriendRequest(userContext(bob, "bob"), &friends.SendFriendRequestRequest{RecipientUsername: "alice"})
+	if err != nil || sendResp.Message != "You are already friends" {
+		t.Fatalf("Expected a request between friends to be refused, got %v (err: %v)", sendResp, err)
+	}
+}
+
+func TestRemoveFriend(t *testing.T) {
+	repo := newFakeRepository()
+	alice, bob := repo.addUser("alice"), repo.addUser("bob")
+	server := NewFriendsServer(repo, NewFriendEventHub(testLogger()), testLogger())
+	repo.SendFriendRequest(alice, bob, storage.FriendRequestLimits{})
+	incoming, _ := repo.IncomingFriendRequests(bob)
+	repo.AcceptFriendRequest(incoming[0].ID, bob)
+
+	resp, err := server.RemoveFriend(userContext(bob, "bob"), &friends.RemoveFriendRequest{FriendId: int32(alice)})
+	if err != nil || !resp.Success {
+		t.Fatalf("Expected the friend to be removed, got %v (err: %v)", resp, err)
+	}
+	if list, _ := repo.ListFriends(alice); len(list) != 0 {
+		t.Fatalf("Expected the friendship to be gone for both users, got %v", list)
+	}
+	resp, err = server.RemoveFriend(userContext(bob, "bob"), &friends.RemoveFriendRequest{FriendId: int32(alice)})
+	if err != nil || resp.Success {
+		t.Fatalf("Expected removing again to fail, got %v (err: %v)", resp, err)
+	}
+
+	// The canceled request can be sent again
+	sendResp, err := server.SendFriendRequest(userContext(alice, "alice"), &friends.SendFriendRequestRequest{RecipientUsername: "bob"})
+	if err != nil || sendResp.Status != friends.FriendRequestStatus_PENDING {
+		t.Fatalf("Expected a new request after removing, got %v (err: %v)", sendResp, err)
+	}
+}
+
+// fakePresence marks the users in it as online.
+type fakePresence map[uint32]bool
+
+func (p fakePresence) IsOnline(userID uint32) bool {
+	return p[userID]
+}
+
+func TestGetFriendListSortsAndPages(t *testing.T) {
+	repo := newFakeRepository()
+	alice := repo.addUser("alice")
+	server := NewFriendsServer(repo, NewFriendEventHub(testLogger()), testLogger())
+	base := time.Now().Add(-time.Hour)
+	var ids []uint32
+	for i, name := range []string{"Dave", "bob", "carol", "erin"} {
+		id := repo.addUser(name)
+		repo.SendFriendRequest(alice, id, storage.FriendRequestLimits{})
+		incoming, _ := repo.IncomingFriendRequests(id)
+		repo.AcceptFriendRequest(incoming[0].ID, id)
+		repo.friends[[2]uint32{alice, id}] = base.Add(time.Duration(i) * time.Minute)
+		ids = append(ids, id)
+	}
+	dave, bob, carol := ids[0], ids[1], ids[2]
+	repo.activity[[2]uint32{alice, bob}] = base.Add(time.Hour)
+	repo.activity[[2]uint32{alice, dave}] = base.Add(30 * time.Minute)
+	server.Presence = fakePresence{carol: true}
+
+	list := func(order friends.FriendListSort) []string {
+		t.Helper()
+		var names []string
+		token := ""
+		for {
+			resp, err := server.GetFriendList(userContext(alice, "alice"), &friends.GetFriendListRequest{PageToken: token, PageSize: 3, Sort: order})
+			if err != nil {
+				t.Fatalf("GetFriendList failed: %v", err)
+			}
+			for _, friend := range resp.Friends {
+				names = append(names, friend.Username)
+			}
+			if token = resp.NextPageToken; token == "" {
+				return names
+			}
+		}
+	}
+
+	for _, tt := range []struct {
+		order friends.FriendListSort
+		want  string
+	}{
+		{friends.FriendListSort_RECENT_ACTIVITY, "bob Dave erin carol"},
+		{friends.FriendListSort_ALPHABETICAL, "bob carol Dave erin"},
+		{friends.FriendListSort_ONLINE_FIRST, "carol bob Dave erin"},
+	} {
+		if got := fmt.Sprint(list(tt.order)); got != "["+tt.want+"]" {
+			t.Fatalf("Expected %s order %s, got %s", tt.order, tt.want, got)
+		}
+	}
+
+	// A token only continues the order it came from
+	first, err := server.GetFriendList(userContext(alice, "alice"), &friends.GetFriendListRequest{PageSize: 1})
+	if err != nil || first.NextPageToken == "" {
+		t.Fatalf("Expected a next page token, got %v (err: %v)", first, err)
+	}
+	if friend := first.Friends[0]; friend.Username != "bob" || friend.Online || friend.LastActivityAt == nil {
+		t.Fatalf("Expected bob, offline and with activity, got %v", friend)
+	}
+	if _, err := server.GetFriendList(userContext(alice, "alice"), &friends.GetFriendListRequest{PageToken: first.NextPageToken, Sort: friends.FriendListSort_ALPHABETICAL}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected a token of another order to be refused, got %v", err)
+	}
+	if _, err := server.GetFriendList(userContext(alice, "alice"), &friends.GetFriendListRequest{PageToken: "not a token"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected a malformed token to be refused, got %v", err)
+	}
+
+	// The next page continues after the last friend shown, even if friends before it have gone since
+	first, err = server.GetFriendList(userContext(alice, "alice"), &friends.GetFriendListRequest{PageSize: 2})
+	if err != nil || len(first.Friends) != 2 || first.Friends[1].Username != "Dave" {
+		t.Fatalf("Expected a first page ending with Dave, got %v (err: %v)", first, err)
+	}
+	repo.RemoveFriend(alice, bob)
+	next, err := server.GetFriendList(userContext(alice, "alice"), &friends.GetFriendListRequest{PageToken: first.NextPageToken, PageSize: 2})
+	if err != nil || len(next.Friends) != 2 || next.Friends[0].Username != "erin" || next.Friends[1].Username != "carol" || next.NextPageToken != "" {
+		t.Fatalf("Expected the last page to be erin and carol, got %v (err: %v)", next, err)
+	}
+}
+
+func TestFriendsServerRequiresUser(t *testing.T) {
+	server := NewFriendsServer(newFakeRepository(), NewFriendEventHub(testLogger()), testLogger())
+	if _, err := server.GetFriendList(context.Background(), &friends.GetFriendListRequest{}); err == nil {
+		t.Fatalf("Expected an error without a user in the context")
+	}
+}
+
+// friendEventStream is a FriendManagement_StreamFriendEventsServer that hands sent events to a channel.
+type friendEventStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	events chan *friends.FriendEvent
+}
+
+func (s *friendEventStream) Context() context.Context { return s.ctx }
+
+func (s *friendEventStream) Send(event *friends.FriendEvent) error {
+	s.events <- event
+	return nil
+}
+
+// nextEvent waits for the next event sent on the stream.
+func (s *friendEventStream) nextEvent(t *testing.T) *friends.FriendEvent {
+	t.Helper()
+	select {
+	case event := <-s.events:
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for a friend event")
+		return nil
+	}
+}
+
+func TestStreamFriendEvents(t *testing.T) {
+	repo := newFakeRepository()
+	alice, bob := repo.addUser("alice"), repo.addUser("bob")
+	hub := NewFriendEventHub(testLogger())
+	server := NewFriendsServer(repo, hub, testLogger())
+
+	// Open an event stream for each user and wait until both are subscribed
+	streams := make(map[uint32]*friendEventStream)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 2)
+	for userID, username := range map[uint32]string{alice: "alice", bob: "bob"} {
+		streamCtx := context.WithValue(context.WithValue(ctx, "userID", strconv.FormatUint(uint64(userID), 10)), "username", username)
+		stream := &friendEventStream{ctx: streamCtx, events: make(chan *friends.FriendEvent, 4)}
+		streams[userID] = stream
+		go func() { done <- server.StreamFriendEvents(&friends.StreamFriendEventsRequest{}, stream) }()
+	}
+	for hub.Subscribers(alice) == 0 || hub.Subscribers(bob) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	expect := func(userID uint32, eventType friends.FriendEventType, fromID uint32, fromName string) {
+		t.Helper()
+		event := streams[userID].nextEvent(t)
+		if event.Type != eventType || event.UserId != int32(fromID) || event.Username != fromName {
+			t.Fatalf("Expected %v from %s, got %v", eventType, fromName, event)
+		}
+	}
+
+	server.SendFriendRequest(userContext(alice, "alice"), &friends.SendFriendRequestRequest{RecipientUsername: "bob"})
+	expect(bob, friends.FriendEventType_FRIEND_REQUEST_CREATED, alice, "alice")
+
+	incoming, _ := repo.IncomingFriendRequests(bob)
+	server.DeclineFriendRequest(userContext(bob, "bob"), &friends.DeclineFriendRequestRequest{RequestId: int32(incoming[0].ID)})
+	expect(alice, friends.FriendEventType_FRIEND_REQUEST_DECLINED, bob, "bob")
+
+	server.SendFriendRequest(userContext(alice, "alice"), &friends.SendFriendRequestRequest{RecipientUsername: "bob"})
+	expect(bob, friends.FriendEventType_FRIEND_REQUEST_CREATED, alice, "alice")
+	server.AcceptFriendRequest(userContext(bob, "bob"), &friends.AcceptFriendRequestRequest{RequestId: int32(incoming[0].ID)})
+	expect(alice, friends.FriendEventType_FRIEND_REQUEST_ACCEPTED, bob, "bob")
+
+	server.RemoveFriend(userContext(alice, "alice"), &friends.RemoveFriendRequest{FriendId: int32(bob)})
+	expect(bob, friends.FriendEventType_FRIEND_REMOVED, alice, "alice")
+
+	server.SendFriendRequest(userContext(alice, "alice"), &friends.SendFriendRequestRequest{RecipientUsername: "bob"})
+	expect(bob, friends.FriendEventType_FRIEND_REQUEST_CREATED, alice, "alice")
+	server.CancelFriendRequest(userContext(alice, "alice"), &friends.CancelFriendRequestRequest{RequestId: int32(incoming[0].ID)})
+	expect(bob, friends.FriendEventType_FRIEND_REQUEST_CANCELED, alice, "alice")
+
+	// Failed operations send nothing
+	server.RemoveFriend(userContext(alice, "alice"), &friends.RemoveFriendRequest{FriendId: int32(bob)})
+	select {
+	case event := <-streams[bob].events:
+		t.Fatalf("Expected no event for a failed removal, got %v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Ending the streams unsubscribes them
+	cancel()
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("StreamFriendEvents returned an error: %v", err)
+		}
+	}
+	if hub.Subscribers(alice) != 0 || hub.Subscribers(bob) != 0 {
+		t.Fatalf("Expected no subscribers after the streams ended")
+	}
+}
+
+func TestFriendEventHubDropsWhenFull(t *testing.T) {
+	hub := NewFriendEventHub(testLogger())
+	events, unsubscribe := hub.Subscribe(1)
+	defer unsubscribe()
+
+	for i := 0; i < friendEventBuffer+5; i++ {
+		hub.Publish(1, &friends.FriendEvent{Type: friends.FriendEventType_FRIEND_REQUEST_CREATED})
+	}
+	if len(events) != friendEventBuffer {
+		t.Fatalf("Expected %d buffered events, got %d", friendEventBuffer, len(events))
+	}
+	hub.Publish(2, &friends.FriendEvent{}) // No subscribers, nothing to do
+}
+
+func TestBlockUser(t *testing.T) {
+	repo := newFakeRepository()
+	alice, bob := repo.addUser("alice"), repo.addUser("bob")
+	hub := NewFriendEventHub(testLogger())
+	server := NewFriendsServer(repo, hub, testLogger())
+	repo.SendFriendRequest(alice, bob, storage.FriendRequestLimits{})
+	incoming, _ := repo.IncomingFriendRequests(bob)
+	repo.AcceptFriendRequest(incoming[0].ID, bob)
+	events, unsubscribe := hub.Subscribe(alice)
+	defer unsubscribe()
+
+	if resp, err := server.BlockUser(userContext(bob, "bob"), &friends.BlockUserRequest{UserId: int32(bob)}); err != nil || resp.Success {
+		t.Fatalf("Expected blocking yourself to fail, got %v (err: %v)", resp, err)
+	}
+	if resp, err := server.BlockUser(userContext(bob, "bob"), &friends.BlockUserRequest{UserId: 99}); err != nil || resp.Message != "User not found" {
+		t.Fatalf("Expected blocking an unknown user to fail, got %v (err: %v)", resp, err)
+	}
+
+	// Blocking a friend ends the friendship, which they see as a removal
+	resp, err := server.BlockUser(userContext(bob, "bob"), &friends.BlockUserRequest{UserId: int32(alice)})
+	if err != nil || !resp.Success {
+		t.Fatalf("Expected alice to be blocked, got %v (err: %v)", resp, err)
+	}
+	if list, _ := repo.ListFriends(alice); len(list) != 0 {
+		t.Fatalf("Expected the friendship to end, got %v", list)
+	}
+	if event := <-events; event.Type != friends.FriendEventType_FRIEND_REMOVED || event.UserId != int32(bob) {
+		t.Fatalf("Expected a removal event from bob, got %v", event)
+	}
+	blocked, err := server.GetBlockedUsers(userContext(bob, "bob"), &friends.GetBlockedUsersRequest{})
+	if err != nil || len(blocked.BlockedUsers) != 1 || blocked.BlockedUsers[0].Username != "alice" {
+		t.Fatalf("Expected alice in bob's block list, got %v (err: %v)", blocked, err)
+	}
+
+	// Neither side can send a friend request while the block lasts
+	for _, from := range []struct {
+		id       uint32
+		name, to string
+	}{{alice, "alice", "bob"}, {bob, "bob", "alice"}} {
+		sendResp, err := server.SendFriendRequest(userContext(from.id, from.name), &friends.SendFriendRequestRequest{RecipientUsername: from.to})
+		if err != nil || sendResp.Status != friends.FriendRequestStatus_FAILED || sendResp.Message != "Cannot send a friend request to this user" {
+			t.Fatalf("Expected the request from %s to be refused, got %v (err: %v)", from.name, sendResp, err)
+		}
+	}
+
+	// Only bob can lift the block, and doing so lets requests through again
+	if resp, err := server.UnblockUser(userContext(alice, "alice"), &friends.UnblockUserRequest{UserId: int32(bob)}); err != nil || resp.Success {
+		t.Fatalf("Expected alice to have no block to lift, got %v (err: %v)", resp, err)
+	}
+	if resp, err := server.UnblockUser(userContext(bob, "bob"), &friends.UnblockUserRequest{UserId: int32(alice)}); err != nil || !resp.Success {
+		t.Fatalf("Expected alice to be unblocked, got %v (err: %v)", resp, err)
+	}
+	sendResp, err := server.SendFriendRequest(userContext(alice, "alice"), &friends.SendFriendRequestRequest{RecipientUsername: "bob"})
+	if err != nil || sendResp.Status != friends.FriendRequestStatus_PENDING {
+		t.Fatalf("Expected a request after unblocking, got %v (err: %v)", sendResp, err)
+	}
+}
+
+func TestSearchUsers(t *testing.T) {
+	repo := newFakeRepository()
+	alice := repo.addUser("alice")
+	for i := 0; i < maxSearchLimit+5; i++ {
+		repo.addUser(fmt.Sprintf("user%02d", i))
+	}
+	bob := repo.addUser("bob")
+	server := NewFriendsServer(repo, NewFriendEventHub(testLogger()), testLogger())
+	ctx := userContext(alice, "alice")
+
+	search := func(req *friends.SearchUsersRequest) *friends.SearchUsersResponse {
+		t.Helper()
+		resp, err := server.SearchUsers(ctx, req)
+		if err != nil {
+			t.Fatalf("SearchUsers %q failed: %v", req.Query, err)
+		}
+		return resp
+	}
+
+	if resp := search(&friends.SearchUsersRequest{Query: "  "}); len(resp.Users) != 0 {
+		t.Fatalf("Expected a blank query to find nobody, got %v", resp.Users)
+	}
+	if resp := search(&friends.SearchUsersRequest{Query: "user"}); len(resp.Users) != defaultSearchLimit || !resp.HasMore {
+		t.Fatalf("Expected a default page of %d with more to come, got %d (more %t)", defaultSearchLimit, len(resp.Users), resp.HasMore)
+	}
+	if resp := search(&friends.SearchUsersRequest{Query: "user", Limit: 1000}); len(resp.Users) != maxSearchLimit {
+		t.Fatalf("Expected the limit to be capped at %d, got %d", maxSearchLimit, len(resp.Users))
+	}
+	resp := search(&friends.SearchUsersRequest{Query: "user", Offset: maxSearchLimit})
+	if len(resp.Users) != 5 || resp.HasMore || resp.Users[0].Username != fmt.Sprintf("user%02d", maxSearchLimit) {
+		t.Fatalf("Expected the last 5 users on the final page, got %v (more %t)", resp.Users, resp.HasMore)
+	}
+
+	// Opting out hides bob from search
+	bobCtx := userContext(bob, "bob")
+	if resp, err := server.UpdatePrivacySettings(bobCtx, &friends.UpdatePrivacySettingsRequest{}); err != nil || resp.Success {
+		t.Fatalf("Expected an update without settings to fail, got %v (err: %v)", resp, err)
+	}
+	update := &friends.UpdatePrivacySettingsRequest{Settings: &friends.PrivacySettings{Discoverable: false}}
+	if resp, err := server.UpdatePrivacySettings(bobCtx, update); err != nil || !resp.Success {
+		t.Fatalf("Failed to update privacy settings: %v (err: %v)", resp, err)
+	}
+	settings, err := server.GetPrivacySettings(bobCtx, &friends.GetPrivacySettingsRequest{})
+	if err != nil || settings.Settings.Discoverable {
+		t.Fatalf("Expected bob not to be discoverable, got %v (err: %v)", settings, err)
+	}
+	if resp := search(&friends.SearchUsersRequest{Query: "bob"}); len(resp.Users) != 0 {
+		t.Fatalf("Expected bob to be hidden, got %v", resp.Users)
+	}
+}
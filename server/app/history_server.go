@@ -0,0 +1,312 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/johnkhk/cli_chat_app/genproto/history"
+)
+
+const (
+	// DefaultHistoryTransferTTL is how long a transfer is kept before it is discarded.
+	DefaultHistoryTransferTTL = 15 * time.Minute
+	// MaxHistoryTransferSize caps the size of an uploaded history payload.
+	MaxHistoryTransferSize = 64 << 20
+	// DefaultHistoryBufferSize caps the history held in memory across all transfers, uploaded or on the way.
+	DefaultHistoryBufferSize = 256 << 20
+	// historyChunkSize is the size of the chunks a payload is streamed back in.
+	historyChunkSize = 1 << 20
+)
+
+// historyTransfer is a pending transfer of chat history between two devices of the same user.
+type historyTransfer struct {
+	userID       int
+	identityKey  []byte // Public identity key of the receiving device
+	ephemeralKey []byte // Sender's ephemeral public key, set once uploaded
+	payload      []byte // Encrypted history, set once uploaded
+	ready        bool
+	expiresAt    time.Time
+}
+
+// HistoryServer implements the HistoryTransfer service. It relays encrypted chat history
+// between devices in memory and never sees the plaintext.
+// Each user has at most one open transfer, and BufferSize caps the bytes held across all of them.
+type HistoryServer struct {
+	history.UnimplementedHistoryTransferServer
+	TTL        time.Duration
+	BufferSize int
+	Logger     *logrus.Logger
+	mu         sync.Mutex
+	transfers  map[string]*historyTransfer
+	buffered   int // Bytes of uploaded payloads and uploads in progress
+}
+
+// NewHistoryServer creates a new HistoryServer with the given dependencies.
+func NewHistoryServer(logger *logrus.Logger) *HistoryServer {
+	return &HistoryServer{
+		TTL:        DefaultHistoryTransferTTL,
+		BufferSize: DefaultHistoryBufferSize,
+		Logger:     logger,
+		transfers:  make(map[string]*historyTransfer),
+	}
+}
+
+// CreateTransfer opens a transfer for the calling device and returns the code to enter on the old device.
+// It replaces any transfer the user still has open.
+func (s *HistoryServer) CreateTransfer(ctx context.Context, req *history.CreateTransferRequest) (*history.CreateTransferResponse, error) {
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(req.IdentityKey) == 0 {
+		return &history.CreateTransferResponse{
+			Status:  history.TransferStatus_FAILED,
+			Message: "Identity key is required",
+		}, nil
+	}
+
+	code, err := generateCode()
+	if err != nil {
+		s.Logger.Errorf("Failed to generate transfer code: %v", err)
+		return nil, fmt.Errorf("failed to generate transfer code: %w", err)
+	}
+
+	expiresAt := time.Now().Add(s.TTL)
+	s.mu.Lock()
+	s.sweepLocked()
+	for openCode, transfer := range s.transfers {
+		if transfer.userID == userID {
+			s.removeLocked(openCode)
+		}
+	}
+	s.transfers[code] = &historyTransfer{
+		userID:      userID,
+		identityKey: req.IdentityKey,
+		expiresAt:   expiresAt,
+	}
+	s.mu.Unlock()
+
+	s.Logger.Infof("User %d opened history transfer %s", userID, code)
+	return &history.CreateTransferResponse{
+		Status:       history.TransferStatus_WAITING,
+		TransferCode: formatCode(code),
+		ExpiresAt:    timestamppb.New(expiresAt),
+	}, nil
+}
+
+// GetTransfer returns the identity key of the device waiting on the transfer.
+func (s *HistoryServer) GetTransfer(ctx context.Context, req *history.GetTransferRequest) (*history.GetTransferResponse, error) {
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	transfer, ok := s.lookupLocked(userID, req.TransferCode)
+	if !ok {
+		return &history.GetTransferResponse{Status: history.TransferStatus_FAILED}, nil
+	}
+
+	transferStatus := history.TransferStatus_WAITING
+	if transfer.ready {
+		transferStatus = history.TransferStatus_READY
+	}
+	return &history.GetTransferResponse{
+		Status:      transferStatus,
+		IdentityKey: transfer.identityKey,
+		ExpiresAt:   timestamppb.New(transfer.expiresAt),
+	}, nil
+}
+
+// UploadTransfer receives the encrypted history from the old device.
+// It fails with ResourceExhausted while the server holds too much history to take more.
+func (s *HistoryServer) UploadTransfer(stream history.HistoryTransfer_UploadTransferServer) error {
+	userID, err := userIDFromContext(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	// Count the payload against BufferSize as it arrives, until it is stored or the upload fails
+	var code string
+	var ephemeralKey, payload []byte
+	stored := false
+	defer func() {
+		if !stored {
+			s.mu.Lock()
+			s.buffered -= len(payload)
+			s.mu.Unlock()
+		}
+	}()
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if code == "" {
+			code = chunk.TransferCode
+			ephemeralKey = chunk.EphemeralKey
+			s.mu.Lock()
+			transfer, ok := s.lookupLocked(userID, code)
+			ready := ok && transfer.ready
+			s.mu.Unlock()
+			if !ok {
+				return status.Error(codes.NotFound, "transfer not found or expired")
+			}
+			if ready {
+				return status.Error(codes.AlreadyExists, "history has already been uploaded for this transfer")
+			}
+		}
+
+		if len(payload)+len(chunk.Data) > MaxHistoryTransferSize {
+			return status.Errorf(codes.ResourceExhausted, "history is larger than %d bytes", MaxHistoryTransferSize)
+		}
+		s.mu.Lock()
+		full := s.buffered+len(chunk.Data) > s.BufferSize
+		if !full {
+			s.buffered += len(chunk.Data)
+		}
+		s.mu.Unlock()
+		if full {
+			return status.Error(codes.ResourceExhausted, "the server is relaying too much history right now; try again later")
+		}
+		payload = append(payload, chunk.Data...)
+	}
+
+	if code == "" || len(ephemeralKey) == 0 {
+		return status.Error(codes.InvalidArgument, "transfer code and ephemeral key are required")
+	}
+
+	// Check again: another upload for the code may have finished since the first chunk
+	s.mu.Lock()
+	transfer, ok := s.lookupLocked(userID, code)
+	ready := ok && transfer.ready
+	if ok && !ready {
+		transfer.ephemeralKey = ephemeralKey
+		transfer.payload = payload
+		transfer.ready = true
+		stored = true
+	}
+	s.mu.Unlock()
+	if !ok {
+		return status.Error(codes.NotFound, "transfer not found or expired")
+	}
+	if ready {
+		return status.Error(codes.AlreadyExists, "history has already been uploaded for this transfer")
+	}
+
+	s.Logger.Infof("User %d uploaded %d bytes of history for transfer %s", userID, len(payload), normalizeCode(code))
+	return stream.SendAndClose(&history.UploadTransferResponse{
+		Status:    history.TransferStatus_READY,
+		Message:   "History uploaded",
+		Timestamp: timestamppb.Now(),
+	})
+}
+
+// DownloadTransfer streams the encrypted history to the new device and then discards it.
+// It fails with FailedPrecondition while the old device has not uploaded yet.
+func (s *HistoryServer) DownloadTransfer(req *history.DownloadTransferRequest, stream history.HistoryTransfer_DownloadTransferServer) error {
+	userID, err := userIDFromContext(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	transfer, ok := s.lookupLocked(userID, req.TransferCode)
+	if ok && transfer.ready {
+		s.removeLocked(normalizeCode(req.TransferCode))
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return status.Error(codes.NotFound, "transfer not found or expired")
+	}
+	if !transfer.ready {
+		return status.Error(codes.FailedPrecondition, "history has not been uploaded yet")
+	}
+
+	payload := transfer.payload
+	first := true
+	for first || len(payload) > 0 {
+		n := len(payload)
+		if n > historyChunkSize {
+			n = historyChunkSize
+		}
+		chunk := &history.TransferChunk{Data: payload[:n]}
+		if first {
+			chunk.TransferCode = formatCode(normalizeCode(req.TransferCode))
+			chunk.EphemeralKey = transfer.ephemeralKey
+			first = false
+		}
+		if err := stream.Send(chunk); err != nil {
+			return err
+		}
+		payload = payload[n:]
+	}
+
+	s.Logger.Infof("User %d downloaded history transfer %s", userID, normalizeCode(req.TransferCode))
+	return nil
+}
+
+// lookupLocked returns the user's unexpired transfer for the code. The caller must hold s.mu.
+func (s *HistoryServer) lookupLocked(userID int, code string) (*historyTransfer, bool) {
+	key := normalizeCode(code)
+	transfer, ok := s.transfers[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(transfer.expiresAt) {
+		s.removeLocked(key)
+		return nil, false
+	}
+	// Transfers are only visible to devices of the user who opened them.
+	if transfer.userID != userID {
+		return nil, false
+	}
+	return transfer, true
+}
+
+// sweepLocked discards expired transfers. The caller must hold s.mu.
+func (s *HistoryServer) sweepLocked() {
+	now := time.Now()
+	for code, transfer := range s.transfers {
+		if now.After(transfer.expiresAt) {
+			s.removeLocked(code)
+		}
+	}
+}
+
+// removeLocked discards a transfer and the bytes it holds. The caller must hold s.mu.
+func (s *HistoryServer) removeLocked(code string) {
+	if transfer, ok := s.transfers[code]; ok {
+		s.buffered -= len(transfer.payload)
+		delete(s.transfers, code)
+	}
+}
+
+// userIDFromContext reads the authenticated user's ID set by the interceptors.
+func userIDFromContext(ctx context.Context) (int, error) {
+	userID, ok := ctx.Value("userID").(string)
+	if !ok || userID == "" {
+		return 0, fmt.Errorf("user ID not found in context")
+	}
+	userIDInt, err := strconv.Atoi(userID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID format: %w", err)
+	}
+	return userIDInt, nil
+}
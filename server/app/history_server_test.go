@@ -0,0 +1,149 @@
+package app
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/johnkhk/cli_chat_app/genproto/history"
+)
+
+// uploadStream is a server-side upload stream that hands out the given chunks, waiting on wait (if set)
+// before the last one.
+type uploadStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	chunks []*history.TransferChunk
+	wait   chan struct{}
+}
+
+func (s *uploadStream) Recv() (*history.TransferChunk, error) {
+	if len(s.chunks) == 0 {
+		return nil, io.EOF
+	}
+	if len(s.chunks) == 1 && s.wait != nil {
+		<-s.wait
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
+
+func (s *uploadStream) SendAndClose(*history.UploadTransferResponse) error {
+	return nil
+}
+
+func (s *uploadStream) Context() context.Context {
+	return s.ctx
+}
+
+// upload returns a stream uploading size bytes for the transfer in two chunks.
+func upload(ctx context.Context, code string, size int) *uploadStream {
+	return &uploadStream{ctx: ctx, chunks: []*history.TransferChunk{
+		{TransferCode: code, EphemeralKey: []byte("ephemeral"), Data: make([]byte, size/2)},
+		{Data: make([]byte, size-size/2)},
+	}}
+}
+
+func TestHistoryTransferReplacesOpenTransfer(t *testing.T) {
+	server := NewHistoryServer(testLogger())
+	ctx := userContext(1, "alice")
+
+	first, err := server.CreateTransfer(ctx, &history.CreateTransferRequest{IdentityKey: []byte("key")})
+	if err != nil {
+		t.Fatalf("CreateTransfer failed: %v", err)
+	}
+	if err := server.UploadTransfer(upload(ctx, first.TransferCode, 100)); err != nil {
+		t.Fatalf("UploadTransfer failed: %v", err)
+	}
+	second, err := server.CreateTransfer(ctx, &history.CreateTransferRequest{IdentityKey: []byte("key")})
+	if err != nil {
+		t.Fatalf("CreateTransfer failed: %v", err)
+	}
+
+	if resp, _ := server.GetTransfer(ctx, &history.GetTransferRequest{TransferCode: first.TransferCode}); resp.Status != history.TransferStatus_FAILED {
+		t.Fatalf("Expected the first transfer to be replaced, got %v", resp.Status)
+	}
+	if resp, _ := server.GetTransfer(ctx, &history.GetTransferRequest{TransferCode: second.TransferCode}); resp.Status != history.TransferStatus_WAITING {
+		t.Fatalf("Expected the second transfer to be open, got %v", resp.Status)
+	}
+	if server.buffered != 0 {
+		t.Fatalf("Expected the replaced upload to be freed, still holding %d bytes", server.buffered)
+	}
+}
+
+func TestHistoryTransferBufferSize(t *testing.T) {
+	server := NewHistoryServer(testLogger())
+	server.BufferSize = 150
+	alice, bob := userContext(1, "alice"), userContext(2, "bob")
+
+	aliceTransfer, _ := server.CreateTransfer(alice, &history.CreateTransferRequest{IdentityKey: []byte("key")})
+	bobTransfer, _ := server.CreateTransfer(bob, &history.CreateTransferRequest{IdentityKey: []byte("key")})
+	if err := server.UploadTransfer(upload(alice, aliceTransfer.TransferCode, 100)); err != nil {
+		t.Fatalf("UploadTransfer failed: %v", err)
+	}
+	if err := server.UploadTransfer(upload(bob, bobTransfer.TransferCode, 100)); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Expected an upload over the buffer size to be refused, got %v", err)
+	}
+	if server.buffered != 100 {
+		t.Fatalf("Expected the refused upload to be freed, holding %d bytes", server.buffered)
+	}
+
+	// Downloading frees the space
+	if err := server.DownloadTransfer(&history.DownloadTransferRequest{TransferCode: aliceTransfer.TransferCode}, &downloadStream{ctx: alice}); err != nil {
+		t.Fatalf("DownloadTransfer failed: %v", err)
+	}
+	if err := server.UploadTransfer(upload(bob, bobTransfer.TransferCode, 100)); err != nil {
+		t.Fatalf("Expected the upload to fit once the other was downloaded, got %v", err)
+	}
+}
+
+func TestHistoryTransferConcurrentUploads(t *testing.T) {
+	server := NewHistoryServer(testLogger())
+	ctx := userContext(1, "alice")
+	transfer, _ := server.CreateTransfer(ctx, &history.CreateTransferRequest{IdentityKey: []byte("key")})
+
+	// Both uploads pass the check on their first chunk before either finishes
+	slow := upload(ctx, transfer.TransferCode, 100)
+	slow.wait = make(chan struct{})
+	done := make(chan error)
+	go func() { done <- server.UploadTransfer(slow) }()
+	for {
+		server.mu.Lock()
+		started := server.buffered > 0
+		server.mu.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := server.UploadTransfer(upload(ctx, transfer.TransferCode, 10)); err != nil {
+		t.Fatalf("UploadTransfer failed: %v", err)
+	}
+	close(slow.wait)
+	if err := <-done; status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("Expected the second upload to finish to be refused, got %v", err)
+	}
+	if server.buffered != 10 {
+		t.Fatalf("Expected only the stored upload to be held, holding %d bytes", server.buffered)
+	}
+}
+
+// downloadStream is a server-side download stream that discards what is sent to it.
+type downloadStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *downloadStream) Send(*history.TransferChunk) error {
+	return nil
+}
+
+func (s *downloadStream) Context() context.Context {
+	return s.ctx
+}
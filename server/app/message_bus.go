@@ -0,0 +1,168 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/johnkhk/cli_chat_app/genproto/chat"
+)
+
+// MessageBus is the transport shared by all server nodes. It carries messages between nodes,
+// tracks which node holds each user's stream, and keeps messages for users that are offline.
+type MessageBus interface {
+	// Publish sends the message to the node with the given ID.
+	Publish(nodeID string, resp *chat.MessageResponse) error
+	// Subscribe registers the handler for messages published to the node. The returned func cancels the subscription.
+	Subscribe(nodeID string, handler func(*chat.MessageResponse)) (func(), error)
+	// SetPresence records that the user's stream is held by the node.
+	SetPresence(userID uint32, nodeID string) error
+	// ClearPresence removes the user's presence, but only if it is still held by the node.
+	ClearPresence(userID uint32, nodeID string) error
+	// Presence returns the node holding the user's stream, if any.
+	Presence(userID uint32) (string, bool, error)
+	// Enqueue stores a message for an offline user.
+	Enqueue(userID uint32, resp *chat.MessageResponse) error
+	// Drain removes and returns the messages stored for the user. Stored messages that can't be decoded
+	// are dropped and reported in the error, which comes with the messages that could be.
+	Drain(userID uint32) ([]*chat.MessageResponse, error)
+	// QueueDepths returns the number of messages stored for each offline user.
+	QueueDepths() (map[uint32]int, error)
+}
+
+// LocalBus is an in-memory MessageBus that stands in for an external broker.
+// Several routers sharing one LocalBus behave like server nodes sharing a broker.
+// Messages are serialized on the way through, as they would be on the wire.
+type LocalBus struct {
+	mu          sync.RWMutex
+	subscribers map[string]func(*chat.MessageResponse)
+	presence    map[uint32]string
+	offline     map[uint32][][]byte
+}
+
+var _ MessageBus = (*LocalBus)(nil)
+
+// NewLocalBus creates an empty in-memory bus.
+func NewLocalBus() *LocalBus {
+	return &LocalBus{
+		subscribers: make(map[string]func(*chat.MessageResponse)),
+		presence:    make(map[uint32]string),
+		offline:     make(map[uint32][][]byte),
+	}
+}
+
+// Publish delivers the message to the node's subscriber.
+func (b *LocalBus) Publish(nodeID string, resp *chat.MessageResponse) error {
+	data, err := proto.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	b.mu.RLock()
+	handler, ok := b.subscribers[nodeID]
+	b.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("no subscriber for node %s", nodeID)
+	}
+
+	msg := &chat.MessageResponse{}
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+	handler(msg)
+	return nil
+}
+
+// Subscribe registers the handler for the node, replacing any previous one.
+func (b *LocalBus) Subscribe(nodeID string, handler func(*chat.MessageResponse)) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[nodeID] = handler
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, nodeID)
+	}, nil
+}
+
+// SetPresence records the node holding the user's stream.
+func (b *LocalBus) SetPresence(userID uint32, nodeID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.presence[userID] = nodeID
+	return nil
+}
+
+// ClearPresence removes the user's presence if it still points at the node.
+func (b *LocalBus) ClearPresence(userID uint32, nodeID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.presence[userID] == nodeID {
+		delete(b.presence, userID)
+	}
+	return nil
+}
+
+// Presence returns the node holding the user's stream.
+func (b *LocalBus) Presence(userID uint32) (string, bool, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	nodeID, ok := b.presence[userID]
+	return nodeID, ok, nil
+}
+
+// Enqueue stores the message until the user reconnects.
+func (b *LocalBus) Enqueue(userID uint32, resp *chat.MessageResponse) error {
+	data, err := proto.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.offline[userID] = append(b.offline[userID], data)
+	return nil
+}
+
+// Drain removes and returns the stored messages for the user. Every message is decoded before the queue
+// is removed, so one that can't be decoded is dropped on its own rather than taking the others with it.
+func (b *LocalBus) Drain(userID uint32) ([]*chat.MessageResponse, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	queued := b.offline[userID]
+	messages := make([]*chat.MessageResponse, 0, len(queued))
+	var errs []error
+	for _, data := range queued {
+		msg, err := decodeQueued(data)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	delete(b.offline, userID)
+	return messages, errors.Join(errs...)
+}
+
+// QueueDepths counts the stored messages of each user.
+func (b *LocalBus) QueueDepths() (map[uint32]int, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	depths := make(map[uint32]int, len(b.offline))
+	for userID, queued := range b.offline {
+		depths[userID] = len(queued)
+	}
+	return depths, nil
+}
+
+// decodeQueued unmarshals a message stored for an offline user.
+func decodeQueued(data []byte) (*chat.MessageResponse, error) {
+	msg := &chat.MessageResponse{}
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal queued message: %w", err)
+	}
+	return msg, nil
+}
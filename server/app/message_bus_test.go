@@ -0,0 +1,177 @@
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/johnkhk/cli_chat_app/genproto/chat"
+	"github.com/johnkhk/cli_chat_app/server/storage"
+)
+
+// recordingStream is a server-side chat stream that records the messages sent to it.
+type recordingStream struct {
+	grpc.ServerStream
+	mu   sync.Mutex
+	sent []*chat.MessageResponse
+}
+
+func (s *recordingStream) Send(resp *chat.MessageResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, resp)
+	return nil
+}
+
+func (s *recordingStream) Recv() (*chat.MessageRequest, error) {
+	return nil, context.Canceled
+}
+
+func (s *recordingStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *recordingStream) messages() []*chat.MessageResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*chat.MessageResponse(nil), s.sent...)
+}
+
+// openBusDB opens another connection to the migrated SQLite database at path, like a second server node would.
+func openBusDB(t *testing.T, path string) *storage.BusStore {
+	db, err := storage.OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("Failed to open SQLite database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return storage.NewBusStore(db)
+}
+
+func TestLocalRouterKeepsNewerStream(t *testing.T) {
+	router := NewLocalRouter(testLogger())
+	old, current := &recordingStream{}, &recordingStream{}
+	router.Register(1, old)
+	router.Register(1, current)
+
+	// The old connection only notices it is gone after the user has reconnected
+	router.Unregister(1, old)
+	if !router.IsOnline(1) {
+		t.Fatal("Expected the reconnected user to stay online")
+	}
+	if delivered, err := router.Route(&chat.MessageResponse{RecipientId: 1, MessageId: "m1"}); err != nil || !delivered {
+		t.Fatalf("Expected the message to reach the newer stream, got %t (err: %v)", delivered, err)
+	}
+	if len(current.messages()) != 1 || len(old.messages()) != 0 {
+		t.Fatalf("Expected only the newer stream to get the message, got %d and %d", len(current.messages()), len(old.messages()))
+	}
+
+	router.Unregister(1, current)
+	if router.IsOnline(1) {
+		t.Fatal("Expected the user to be offline once their last stream is gone")
+	}
+}
+
+func TestLocalBusDrainKeepsDecodableMessages(t *testing.T) {
+	bus := NewLocalBus()
+	for _, id := range []string{"m1", "m2"} {
+		if err := bus.Enqueue(1, &chat.MessageResponse{RecipientId: 1, MessageId: id}); err != nil {
+			t.Fatalf("Failed to queue message %s: %v", id, err)
+		}
+	}
+	bus.offline[1] = append(bus.offline[1][:1], append([][]byte{{0xff, 0xff}}, bus.offline[1][1:]...)...)
+
+	messages, err := bus.Drain(1)
+	if err == nil {
+		t.Fatal("Expected the message that can't be decoded to be reported")
+	}
+	if len(messages) != 2 || messages[0].MessageId != "m1" || messages[1].MessageId != "m2" {
+		t.Fatalf("Expected the other messages to be drained, got: %v", messages)
+	}
+	if depths, _ := bus.QueueDepths(); len(depths) != 0 {
+		t.Fatalf("Expected the queue to be empty after draining, got: %v", depths)
+	}
+}
+
+func TestSQLBusAcrossNodes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.db")
+	db, err := storage.OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("Failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+	migrator, err := storage.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Failed to apply migrations: %v", err)
+	}
+	repo := storage.NewSQLRepository(db)
+	alice, err := repo.CreateUser("alice", "hash", false)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// Each node has its own connection to the shared database
+	newNode := func(nodeID string) *BusRouter {
+		bus := &SQLBus{Store: openBusDB(t, path), PollInterval: 10 * time.Millisecond, Logger: testLogger()}
+		router, err := NewBusRouter(nodeID, bus, testLogger())
+		if err != nil {
+			t.Fatalf("Failed to create router for %s: %v", nodeID, err)
+		}
+		t.Cleanup(router.Close)
+		return router
+	}
+	nodeA, nodeB := newNode("node-a"), newNode("node-b")
+
+	stream := &recordingStream{}
+	nodeA.Register(alice, stream)
+	if !nodeB.IsOnline(alice) {
+		t.Fatal("Expected alice to be online from node-b")
+	}
+	if delivered, err := nodeB.Route(&chat.MessageResponse{RecipientId: alice, MessageId: "m1"}); err != nil || !delivered {
+		t.Fatalf("Expected the message to be forwarded to node-a, got %t (err: %v)", delivered, err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(stream.messages()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if received := stream.messages(); len(received) != 1 || received[0].MessageId != "m1" {
+		t.Fatalf("Expected alice to receive m1 on node-a, got: %v", received)
+	}
+
+	// Once alice is gone, messages wait in the database for whichever node she reconnects to
+	nodeA.Unregister(alice, stream)
+	if nodeB.IsOnline(alice) {
+		t.Fatal("Expected alice to be offline after disconnecting")
+	}
+	if delivered, err := nodeB.Route(&chat.MessageResponse{RecipientId: alice, MessageId: "m2"}); err != nil || delivered {
+		t.Fatalf("Expected the message to be queued, got %t (err: %v)", delivered, err)
+	}
+	if err := nodeB.Bus.(*SQLBus).Store.Enqueue(alice, []byte{0xff, 0xff}); err != nil {
+		t.Fatalf("Failed to queue a broken message: %v", err)
+	}
+	data, _ := proto.Marshal(&chat.MessageResponse{RecipientId: alice, MessageId: "m3"})
+	if err := nodeB.Bus.(*SQLBus).Store.Enqueue(alice, data); err != nil {
+		t.Fatalf("Failed to queue message: %v", err)
+	}
+	if depths, err := nodeA.QueueDepths(); err != nil || depths[alice] != 3 {
+		t.Fatalf("Expected 3 queued messages for alice, got %v (err: %v)", depths, err)
+	}
+
+	messages, err := nodeA.TakeUndelivered(alice)
+	if err == nil {
+		t.Fatal("Expected the broken message to be reported")
+	}
+	if len(messages) != 2 || messages[0].MessageId != "m2" || messages[1].MessageId != "m3" {
+		t.Fatalf("Expected m2 and m3 to be drained, got: %v", messages)
+	}
+	if messages, err := nodeB.TakeUndelivered(alice); err != nil || len(messages) != 0 {
+		t.Fatalf("Expected the queue to be empty after draining, got %v (err: %v)", messages, err)
+	}
+}
@@ -0,0 +1,165 @@
+package app
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/johnkhk/cli_chat_app/genproto/chat"
+)
+
+// MessageRouter delivers chat messages to the stream of the recipient, wherever that stream lives.
+type MessageRouter interface {
+	// Register attaches a user's stream to this node.
+	Register(userID uint32, stream chat.ChatService_StreamMessagesServer)
+	// Unregister detaches a user's stream from this node, unless the user has since registered another one.
+	Unregister(userID uint32, stream chat.ChatService_StreamMessagesServer)
+	// Disconnect ends the user's stream on this node, if there is one, and reports whether there was.
+	Disconnect(userID uint32) bool
+	// IsOnline reports whether the user currently has an open stream on any node.
+	IsOnline(userID uint32) bool
+	// Route forwards the message to the recipient's stream, or buffers it if the recipient is offline.
+	// It returns true if the message was handed to a live stream.
+	Route(resp *chat.MessageResponse) (bool, error)
+	// TakeUndelivered removes and returns the messages buffered for the user. An error can come with the
+	// messages that could still be read, which should be delivered anyway.
+	TakeUndelivered(userID uint32) ([]*chat.MessageResponse, error)
+	// QueueDepths returns the number of messages buffered for each offline user.
+	QueueDepths() (map[uint32]int, error)
+}
+
+// LocalRouter is an in-process MessageRouter. It only knows about streams held by this process,
+// so it is suitable for a single server replica.
+type LocalRouter struct {
+	ActiveClients       map[uint32]chat.ChatService_StreamMessagesServer // Map from userID to their active stream
+	UndeliveredMessages map[uint32][]*chat.MessageResponse               // Map from userID to their undelivered messages
+	mu                  sync.RWMutex                                     // Protect access to ActiveClients and UndeliveredMessages
+	Logger              *logrus.Logger
+}
+
+var _ MessageRouter = (*LocalRouter)(nil)
+
+// NewLocalRouter creates an in-process router with no connected clients.
+func NewLocalRouter(logger *logrus.Logger) *LocalRouter {
+	return &LocalRouter{
+		ActiveClients:       make(map[uint32]chat.ChatService_StreamMessagesServer),
+		UndeliveredMessages: make(map[uint32][]*chat.MessageResponse),
+		Logger:              logger,
+	}
+}
+
+// Register registers a client's stream with their user ID.
+func (r *LocalRouter) Register(userID uint32, stream chat.ChatService_StreamMessagesServer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ActiveClients[userID] = stream
+	r.Logger.Infof("User %d has been registered in active clients", userID)
+}
+
+// Unregister removes a client's stream from the active clients map. A stream registered by a newer
+// connection of the same user is left in place.
+func (r *LocalRouter) Unregister(userID uint32, stream chat.ChatService_StreamMessagesServer) {
+	r.unregister(userID, stream)
+}
+
+// unregister removes the stream and reports whether it was still the user's active one.
+func (r *LocalRouter) unregister(userID uint32, stream chat.ChatService_StreamMessagesServer) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ActiveClients[userID] != stream {
+		r.Logger.Infof("User %d has reconnected, keeping their newer stream", userID)
+		return false
+	}
+	delete(r.ActiveClients, userID)
+	r.Logger.Infof("User %d has been unregistered from active clients", userID)
+	return true
+}
+
+// Disconnect asks the user's stream to end if it supports being disconnected, as a SendQueue does.
+// The stream stays registered until its handler unregisters it.
+func (r *LocalRouter) Disconnect(userID uint32) bool {
+	r.mu.RLock()
+	stream, ok := r.ActiveClients[userID]
+	r.mu.RUnlock()
+	if !ok {
+		return false
+	}
+
+	d, ok := stream.(interface{ Disconnect() })
+	if !ok {
+		r.Logger.Warnf("Stream of user %d can't be disconnected", userID)
+		return false
+	}
+	d.Disconnect()
+	r.Logger.Infof("Disconnected the stream of user %d", userID)
+	return true
+}
+
+// IsOnline checks if a user is in the ActiveClients map.
+func (r *LocalRouter) IsOnline(userID uint32) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, exists := r.ActiveClients[userID]
+	return exists
+}
+
+// Route sends the message directly to the recipient if they are connected,
+// otherwise it stores the message in the undelivered messages buffer.
+func (r *LocalRouter) Route(resp *chat.MessageResponse) (bool, error) {
+	delivered, err := r.deliverLocal(resp)
+	if err != nil || delivered {
+		return delivered, err
+	}
+
+	r.Logger.Warnf("Recipient %d is not connected, storing message ID %s in buffer", resp.RecipientId, resp.MessageId)
+	r.store(resp)
+	return false, nil
+}
+
+// TakeUndelivered removes the buffered messages for the user and returns them.
+func (r *LocalRouter) TakeUndelivered(userID uint32) ([]*chat.MessageResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	messages := r.UndeliveredMessages[userID]
+	delete(r.UndeliveredMessages, userID)
+	return messages, nil
+}
+
+// QueueDepths counts the buffered messages of each user.
+func (r *LocalRouter) QueueDepths() (map[uint32]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	depths := make(map[uint32]int, len(r.UndeliveredMessages))
+	for userID, messages := range r.UndeliveredMessages {
+		depths[userID] = len(messages)
+	}
+	return depths, nil
+}
+
+// deliverLocal forwards the message to the recipient's stream if it is held by this process.
+// It returns false without an error if the recipient has no stream here.
+func (r *LocalRouter) deliverLocal(resp *chat.MessageResponse) (bool, error) {
+	r.mu.RLock()
+	recipientStream, recipientConnected := r.ActiveClients[resp.RecipientId]
+	r.mu.RUnlock()
+
+	if !recipientConnected {
+		return false, nil
+	}
+
+	r.Logger.Infof("Forwarding message ID %s to recipient %d", resp.MessageId, resp.RecipientId)
+	if err := recipientStream.Send(resp); err != nil {
+		return false, fmt.Errorf("failed to send message ID %s to recipient %d: %v", resp.MessageId, resp.RecipientId, err)
+	}
+
+	r.Logger.Infof("Message ID %s successfully delivered to recipient %d", resp.MessageId, resp.RecipientId)
+	return true, nil
+}
+
+// store appends the message to the recipient's undelivered messages buffer.
+func (r *LocalRouter) store(resp *chat.MessageResponse) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.UndeliveredMessages[resp.RecipientId] = append(r.UndeliveredMessages[resp.RecipientId], resp)
+}
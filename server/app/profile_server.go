@@ -0,0 +1,123 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/johnkhk/cli_chat_app/genproto/friends"
+	"github.com/johnkhk/cli_chat_app/genproto/userprofile"
+	"github.com/johnkhk/cli_chat_app/server/storage"
+)
+
+// MaxEncryptedProfileSize caps an uploaded profile, leaving room for a small avatar after encryption.
+const MaxEncryptedProfileSize = 128 << 10
+
+// ProfileServer implements the UserProfileService. Profiles are encrypted by their owners with a key
+// only their friends are sent, so the server stores and hands out ciphertext it cannot read.
+type ProfileServer struct {
+	userprofile.UnimplementedUserProfileServiceServer
+	Repo   storage.Repository
+	Events *FriendEventHub
+	Logger *logrus.Logger
+}
+
+// NewProfileServer creates a new ProfileServer with the given dependencies.
+func NewProfileServer(repo storage.Repository, events *FriendEventHub, logger *logrus.Logger) *ProfileServer {
+	return &ProfileServer{
+		Repo:   repo,
+		Events: events,
+		Logger: logger,
+	}
+}
+
+// GetProfile returns the encrypted profile of the caller or one of their friends.
+func (s *ProfileServer) GetProfile(ctx context.Context, req *userprofile.GetProfileRequest) (*userprofile.GetProfileResponse, error) {
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only friends hold the key, but don't hand the ciphertext to anyone else either
+	if req.UserId != uint32(userID) {
+		friendsWith, err := s.Repo.AreFriends(uint32(userID), req.UserId)
+		if err != nil {
+			return nil, err
+		}
+		if !friendsWith {
+			return &userprofile.GetProfileResponse{
+				Found:   false,
+				Message: "Profile not available",
+			}, nil
+		}
+	}
+
+	profile, err := s.Repo.GetProfile(req.UserId)
+	if errors.Is(err, storage.ErrProfileNotFound) {
+		return &userprofile.GetProfileResponse{
+			Found:   false,
+			Message: "No profile set",
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &userprofile.GetProfileResponse{
+		Found:            true,
+		EncryptedProfile: profile.Ciphertext,
+		UpdatedAt:        timestamppb.New(profile.UpdatedAt),
+	}, nil
+}
+
+// UpdateProfile replaces the caller's encrypted profile and lets their friends know it changed.
+func (s *ProfileServer) UpdateProfile(ctx context.Context, req *userprofile.UpdateProfileRequest) (*userprofile.UpdateProfileResponse, error) {
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(req.EncryptedProfile) == 0 {
+		return &userprofile.UpdateProfileResponse{
+			Success: false,
+			Message: "No profile given",
+		}, nil
+	}
+	if len(req.EncryptedProfile) > MaxEncryptedProfileSize {
+		return &userprofile.UpdateProfileResponse{
+			Success: false,
+			Message: fmt.Sprintf("Profile is too large, the limit is %d KiB", MaxEncryptedProfileSize>>10),
+		}, nil
+	}
+
+	updatedAt, err := s.Repo.SaveProfile(uint32(userID), req.EncryptedProfile)
+	if err != nil {
+		s.Logger.Errorf("Error saving profile of user %d: %v", userID, err)
+		return nil, fmt.Errorf("error saving profile: %w", err)
+	}
+	s.Logger.Infof("User %d updated their profile", userID)
+
+	// Friends refetch the profile when told; failing to tell them only delays the update
+	friendRows, err := s.Repo.ListFriends(uint32(userID))
+	if err != nil {
+		s.Logger.Errorf("Not sending %s events: error listing friends of user %d: %v", friends.FriendEventType_PROFILE_UPDATED, userID, err)
+	}
+	username, _ := ctx.Value("username").(string)
+	for _, friend := range friendRows {
+		s.Events.Publish(friend.UserID, &friends.FriendEvent{
+			Type:      friends.FriendEventType_PROFILE_UPDATED,
+			UserId:    int32(userID),
+			Username:  username,
+			Timestamp: timestamppb.New(updatedAt),
+		})
+	}
+
+	return &userprofile.UpdateProfileResponse{
+		Success:   true,
+		Message:   "Profile updated",
+		UpdatedAt: timestamppb.New(updatedAt),
+	}, nil
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/johnkhk/cli_chat_app/genproto/friends"
+	"github.com/johnkhk/cli_chat_app/genproto/userprofile"
+	"github.com/johnkhk/cli_chat_app/server/storage"
+)
+
+func TestProfiles(t *testing.T) {
+	repo := newFakeRepository()
+	alice, bob, carol := repo.addUser("alice"), repo.addUser("bob"), repo.addUser("carol")
+	hub := NewFriendEventHub(testLogger())
+	server := NewProfileServer(repo, hub, testLogger())
+	repo.SendFriendRequest(alice, bob, storage.FriendRequestLimits{})
+	incoming, _ := repo.IncomingFriendRequests(bob)
+	repo.AcceptFriendRequest(incoming[0].ID, bob)
+	bobEvents, unsubscribeBob := hub.Subscribe(bob)
+	defer unsubscribeBob()
+	carolEvents, unsubscribeCarol := hub.Subscribe(carol)
+	defer unsubscribeCarol()
+
+	aliceCtx := userContext(alice, "alice")
+	if resp, err := server.GetProfile(aliceCtx, &userprofile.GetProfileRequest{UserId: alice}); err != nil || resp.Found {
+		t.Fatalf("Expected alice to have no profile yet, got %v (err: %v)", resp, err)
+	}
+	if resp, err := server.UpdateProfile(aliceCtx, &userprofile.UpdateProfileRequest{}); err != nil || resp.Success {
+		t.Fatalf("Expected an empty profile to be refused, got %v (err: %v)", resp, err)
+	}
+	tooLarge := &userprofile.UpdateProfileRequest{EncryptedProfile: make([]byte, MaxEncryptedProfileSize+1)}
+	if resp, err := server.UpdateProfile(aliceCtx, tooLarge); err != nil || resp.Success {
+		t.Fatalf("Expected an oversized profile to be refused, got %v (err: %v)", resp, err)
+	}
+
+	ciphertext := []byte("sealed profile")
+	resp, err := server.UpdateProfile(aliceCtx, &userprofile.UpdateProfileRequest{EncryptedProfile: ciphertext})
+	if err != nil || !resp.Success || resp.UpdatedAt == nil {
+		t.Fatalf("Failed to update profile: %v (err: %v)", resp, err)
+	}
+
+	// Only friends are told, and only friends and the owner can fetch it
+	if event := <-bobEvents; event.Type != friends.FriendEventType_PROFILE_UPDATED || event.UserId != int32(alice) || event.Username != "alice" {
+		t.Fatalf("Expected a profile update event from alice, got %v", event)
+	}
+	if len(carolEvents) != 0 {
+		t.Fatalf("Expected carol, who is not a friend, to hear nothing, got %v", <-carolEvents)
+	}
+	for _, reader := range []struct {
+		id   uint32
+		name string
+	}{{alice, "alice"}, {bob, "bob"}} {
+		got, err := server.GetProfile(userContext(reader.id, reader.name), &userprofile.GetProfileRequest{UserId: alice})
+		if err != nil || !got.Found || !bytes.Equal(got.EncryptedProfile, ciphertext) {
+			t.Fatalf("Expected %s to get alice's profile, got %v (err: %v)", reader.name, got, err)
+		}
+	}
+	got, err := server.GetProfile(userContext(carol, "carol"), &userprofile.GetProfileRequest{UserId: alice})
+	if err != nil || got.Found || len(got.EncryptedProfile) != 0 {
+		t.Fatalf("Expected carol not to get alice's profile, got %v (err: %v)", got, err)
+	}
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// RegistrationMode decides who can create an account on the server.
+type RegistrationMode string
+
+const (
+	// RegistrationOpen lets anyone register.
+	RegistrationOpen RegistrationMode = "open"
+	// RegistrationInviteOnly only lets users with an invite code from an existing user register.
+	RegistrationInviteOnly RegistrationMode = "invite"
+	// RegistrationApproval lets anyone register, but accounts can't log in until an administrator approves
+	// them. An invite code counts as approval.
+	RegistrationApproval RegistrationMode = "approval"
+)
+
+// RegistrationPolicy is the server's configuration for new accounts.
+type RegistrationPolicy struct {
+	Mode      RegistrationMode
+	Allowlist []string // Patterns usernames must match to register, like *@example.com; empty allows any
+}
+
+// RegistrationPolicyFromEnv reads the policy from REGISTRATION_MODE (open, invite or approval; open if unset)
+// and REGISTRATION_ALLOWLIST (comma separated username patterns).
+func RegistrationPolicyFromEnv() (RegistrationPolicy, error) {
+	policy := RegistrationPolicy{Mode: RegistrationOpen}
+	switch mode := RegistrationMode(strings.ToLower(strings.TrimSpace(os.Getenv("REGISTRATION_MODE")))); mode {
+	case "":
+	case RegistrationOpen, RegistrationInviteOnly, RegistrationApproval:
+		policy.Mode = mode
+	default:
+		return policy, fmt.Errorf("unknown REGISTRATION_MODE %q, expected open, invite or approval", mode)
+	}
+
+	allowlist, err := ParseAllowlist(os.Getenv("REGISTRATION_ALLOWLIST"))
+	if err != nil {
+		return policy, fmt.Errorf("invalid REGISTRATION_ALLOWLIST: %w", err)
+	}
+	policy.Allowlist = allowlist
+	return policy, nil
+}
+
+// ParseAllowlist splits a comma separated list of username patterns. Patterns use path.Match syntax and
+// ignore case; one starting with @ allows every username ending in that domain, so @example.com is
+// short for *@example.com.
+func ParseAllowlist(list string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(list, ",") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if strings.HasPrefix(pattern, "@") {
+			pattern = "*" + pattern
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// Allows reports whether the username matches the allowlist.
+func (p RegistrationPolicy) Allows(username string) bool {
+	if len(p.Allowlist) == 0 {
+		return true
+	}
+	username = strings.ToLower(username)
+	for _, pattern := range p.Allowlist {
+		if matched, _ := path.Match(pattern, username); matched {
+			return true
+		}
+	}
+	return false
+}
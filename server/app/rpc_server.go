@@ -12,8 +12,32 @@ import (
 	"github.com/johnkhk/cli_chat_app/genproto/auth"
 	"github.com/johnkhk/cli_chat_app/genproto/chat"
 	"github.com/johnkhk/cli_chat_app/genproto/friends"
+	"github.com/johnkhk/cli_chat_app/genproto/history"
+	"github.com/johnkhk/cli_chat_app/genproto/userprofile"
+	"github.com/johnkhk/cli_chat_app/server/storage"
 )
 
+const (
+	// queueDepthInterval is how often the offline queue depths are written to the database.
+	queueDepthInterval = 30 * time.Second
+	// revocationCheckInterval is how often the streams of users whose sessions were revoked are ended.
+	revocationCheckInterval = 5 * time.Second
+	// friendRequestExpiryInterval is how often stale friend requests are expired.
+	friendRequestExpiryInterval = time.Hour
+	// FriendRequestMaxAge is how long a friend request waits for an answer before it expires.
+	FriendRequestMaxAge = 30 * 24 * time.Hour
+)
+
+// RevokedSessions lists the users whose sessions were revoked, such as by locking them.
+type RevokedSessions interface {
+	SessionsRevokedSince(since time.Time) ([]uint32, error)
+}
+
+// FriendRequestExpirer expires friend requests nobody answered.
+type FriendRequestExpirer interface {
+	ExpireFriendRequests(maxAge time.Duration) (int64, error)
+}
+
 // RunGRPCServer initializes and runs the gRPC server.
 func RunGRPCServer(ctx context.Context, port string, db *sql.DB, log *logrus.Logger) error {
 	// Initialize the token validator
@@ -22,22 +46,59 @@ func RunGRPCServer(ctx context.Context, port string, db *sql.DB, log *logrus.Log
 		log.Fatal("JWT secret key is not set in GRPC server.")
 	}
 	tokenValidator := NewJWTTokenValidator(secretKey)
+	repo := storage.NewSQLRepository(db)
+	tokenValidator.Revocations = repo
 
 	// Create a new gRPC server with the authentication interceptor
 	grpcServer := SetupGRPCServer(tokenValidator, log)
 
 	// Register the AuthServer
-	authServer := NewAuthServer(db, log, time.Hour, time.Hour*24*7)
+	registration, err := RegistrationPolicyFromEnv()
+	if err != nil {
+		return err
+	}
+	log.Infof("Registration is %s", registration.Mode)
+	friendEvents := NewFriendEventHub(log)
+	authServer := NewAuthServer(repo, log, time.Hour, time.Hour*24*7)
+	authServer.Registration = registration
+	authServer.Events = friendEvents
 	auth.RegisterAuthServiceServer(grpcServer, authServer)
 
 	// Register the FriendsServer
-	friendsServer := NewFriendsServer(db, log)
+	router, closeRouter, err := MessageRouterFromEnv(db, log)
+	if err != nil {
+		return err
+	}
+	defer closeRouter()
+	friendsServer := NewFriendsServer(repo, friendEvents, log)
+	friendsServer.Presence = router
 	friends.RegisterFriendManagementServer(grpcServer, friendsServer)
 
+	// Register the ProfileServer
+	profileServer := NewProfileServer(repo, friendEvents, log)
+	userprofile.RegisterUserProfileServiceServer(grpcServer, profileServer)
+
 	// Register the ChatServer
-	chatServer := NewChatServiceServer(log)
+	chatServer := NewChatServiceServer(log, router)
+	chatServer.Blocks = repo
+	chatServer.Requests = repo
+	chatServer.Events = friendEvents
+	chatServer.Activity = repo
 	chat.RegisterChatServiceServer(grpcServer, chatServer)
 
+	// Report offline queue depths for the admin tool
+	go RecordQueueDepths(ctx, router, storage.NewAccountStore(db), queueDepthInterval, log)
+
+	// End the open streams of users that are locked or logged out
+	go DisconnectRevokedSessions(ctx, storage.NewAccountStore(db), router, friendEvents, revocationCheckInterval, log)
+
+	// Expire friend requests left unanswered
+	go ExpireFriendRequests(ctx, repo, FriendRequestMaxAge, friendRequestExpiryInterval, log)
+
+	// Register the HistoryServer
+	historyServer := NewHistoryServer(log)
+	history.RegisterHistoryTransferServer(grpcServer, historyServer)
+
 	// Listen on the specified port
 	listener, err := net.Listen("tcp", "0.0.0.0:"+port)
 	if err != nil {
@@ -64,3 +125,76 @@ func RunGRPCServer(ctx context.Context, port string, db *sql.DB, log *logrus.Log
 	log.Info("gRPC server stopped.")
 	return nil
 }
+
+// RecordQueueDepths periodically stores the router's offline queue depths until ctx is canceled.
+func RecordQueueDepths(ctx context.Context, router MessageRouter, accounts *storage.AccountStore, interval time.Duration, log *logrus.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			depths, err := router.QueueDepths()
+			if err != nil {
+				log.Errorf("Failed to read offline queue depths: %v", err)
+				continue
+			}
+			if err := accounts.RecordQueueDepths(depths); err != nil {
+				log.Errorf("Failed to record offline queue depths: %v", err)
+			}
+		}
+	}
+}
+
+// DisconnectRevokedSessions checks every interval, until ctx is canceled, for users whose sessions were revoked
+// since the last check, and ends their chat and friend event streams on this node. Their tokens are already
+// rejected, so the clients have to log in again before reconnecting.
+func DisconnectRevokedSessions(ctx context.Context, revoked RevokedSessions, router MessageRouter, events *FriendEventHub, interval time.Duration, log *logrus.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	since := time.Now().Truncate(time.Second)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Revocation times are stored to the second, so the check overlaps the previous one by up to a second
+			checkedAt := time.Now().Truncate(time.Second)
+			userIDs, err := revoked.SessionsRevokedSince(since)
+			if err != nil {
+				log.Errorf("Failed to check for revoked sessions: %v", err)
+				continue
+			}
+			since = checkedAt
+			for _, userID := range userIDs {
+				chatStream := router.Disconnect(userID)
+				eventStreams := events.Disconnect(userID)
+				if chatStream || eventStreams > 0 {
+					log.Infof("Ended the streams of user %d, whose sessions were revoked", userID)
+				}
+			}
+		}
+	}
+}
+
+// ExpireFriendRequests expires the friend requests pending for longer than maxAge, once at the start and
+// then every interval until ctx is canceled. Expired requests can be sent again.
+func ExpireFriendRequests(ctx context.Context, requests FriendRequestExpirer, maxAge, interval time.Duration, log *logrus.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		expired, err := requests.ExpireFriendRequests(maxAge)
+		if err != nil {
+			log.Errorf("Failed to expire friend requests: %v", err)
+		} else if expired > 0 {
+			log.Infof("Expired %d friend requests", expired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
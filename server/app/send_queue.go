@@ -0,0 +1,258 @@
+package app
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/johnkhk/cli_chat_app/genproto/chat"
+)
+
+var (
+	// ErrSendQueueFull is returned when a message cannot be queued because the recipient is not keeping up.
+	ErrSendQueueFull = errors.New("send queue is full")
+	// ErrSendQueueClosed is returned when a message is queued after the recipient's stream has gone away.
+	ErrSendQueueClosed = errors.New("send queue is closed")
+)
+
+// OverflowPolicy decides what happens to a new message when a recipient's queue stays full.
+type OverflowPolicy int
+
+const (
+	// OverflowReject fails the new message so the sender is told delivery failed.
+	OverflowReject OverflowPolicy = iota
+	// OverflowDropOldest discards the oldest queued message to make room for the new one.
+	OverflowDropOldest
+)
+
+// SendQueueConfig configures the outbound queue of each connected client.
+type SendQueueConfig struct {
+	Capacity       int            // Maximum number of messages waiting to be written to the client
+	EnqueueTimeout time.Duration  // How long a sender waits for room before the overflow policy applies
+	Overflow       OverflowPolicy // What to do once the timeout has passed
+}
+
+// DefaultSendQueueConfig returns the queue settings used by the server.
+func DefaultSendQueueConfig() SendQueueConfig {
+	return SendQueueConfig{
+		Capacity:       256,
+		EnqueueTimeout: 100 * time.Millisecond,
+		Overflow:       OverflowReject,
+	}
+}
+
+// SendQueue is a bounded outbound queue for one client stream. Messages passed to Send are
+// written to the underlying stream by a dedicated goroutine, so a slow reader only holds up
+// its own queue and the stream is never written to concurrently.
+type SendQueue struct {
+	chat.ChatService_StreamMessagesServer
+	userID  uint32
+	config  SendQueueConfig
+	metrics *SendQueueMetrics
+	logger  *logrus.Logger
+
+	queue   chan *chat.MessageResponse
+	done    chan struct{} // Closed by Close to stop the writer
+	stopped chan struct{} // Closed when the writer exits
+	failed  *chat.MessageResponse
+	once    sync.Once
+
+	disconnected   chan struct{} // Closed by Disconnect to end the stream
+	disconnectOnce sync.Once
+}
+
+// NewSendQueue wraps the stream in a bounded queue and starts its writer goroutine.
+func NewSendQueue(userID uint32, stream chat.ChatService_StreamMessagesServer, config SendQueueConfig, metrics *SendQueueMetrics, logger *logrus.Logger) *SendQueue {
+	if config.Capacity <= 0 {
+		config.Capacity = DefaultSendQueueConfig().Capacity
+	}
+	q := &SendQueue{
+		ChatService_StreamMessagesServer: stream,
+		userID:                           userID,
+		config:                           config,
+		metrics:                          metrics,
+		logger:                           logger,
+		queue:                            make(chan *chat.MessageResponse, config.Capacity),
+		done:                             make(chan struct{}),
+		stopped:                          make(chan struct{}),
+		disconnected:                     make(chan struct{}),
+	}
+	metrics.track(userID, q)
+	go q.writeLoop()
+	return q
+}
+
+// Send queues the message for the client. It waits up to the configured timeout for room
+// and then applies the overflow policy.
+func (q *SendQueue) Send(resp *chat.MessageResponse) error {
+	select {
+	case <-q.done:
+		return ErrSendQueueClosed
+	case <-q.stopped:
+		return ErrSendQueueClosed
+	default:
+	}
+
+	select {
+	case q.queue <- resp:
+		q.metrics.enqueued.Add(1)
+		return nil
+	default:
+	}
+
+	// The queue is full, so wait for the writer to make room.
+	timer := time.NewTimer(q.config.EnqueueTimeout)
+	defer timer.Stop()
+	select {
+	case q.queue <- resp:
+		q.metrics.enqueued.Add(1)
+		return nil
+	case <-q.done:
+		return ErrSendQueueClosed
+	case <-q.stopped:
+		return ErrSendQueueClosed
+	case <-timer.C:
+	}
+
+	switch q.config.Overflow {
+	case OverflowDropOldest:
+		for {
+			select {
+			case q.queue <- resp:
+				q.metrics.enqueued.Add(1)
+				return nil
+			default:
+			}
+			select {
+			case dropped := <-q.queue:
+				q.metrics.dropped.Add(1)
+				q.logger.Warnf("Send queue for user %d is full, dropped message ID %s", q.userID, dropped.MessageId)
+			default:
+			}
+		}
+	default:
+		q.metrics.rejected.Add(1)
+		q.logger.Warnf("Send queue for user %d is full, rejected message ID %s", q.userID, resp.MessageId)
+		return ErrSendQueueFull
+	}
+}
+
+// Len returns the number of messages waiting to be written.
+func (q *SendQueue) Len() int {
+	return len(q.queue)
+}
+
+// Disconnect asks the stream's handler to end the stream, for example because the user's session was revoked.
+func (q *SendQueue) Disconnect() {
+	q.disconnectOnce.Do(func() { close(q.disconnected) })
+}
+
+// Disconnected is closed once Disconnect has been called.
+func (q *SendQueue) Disconnected() <-chan struct{} {
+	return q.disconnected
+}
+
+// Close stops the writer and returns the messages that never reached the client,
+// so the caller can store them for later delivery.
+func (q *SendQueue) Close() []*chat.MessageResponse {
+	q.once.Do(func() { close(q.done) })
+	<-q.stopped
+	q.metrics.untrack(q.userID, q)
+
+	var pending []*chat.MessageResponse
+	if q.failed != nil {
+		pending = append(pending, q.failed)
+	}
+	for {
+		select {
+		case resp := <-q.queue:
+			pending = append(pending, resp)
+		default:
+			return pending
+		}
+	}
+}
+
+// writeLoop writes queued messages to the stream until the queue is closed or a write fails.
+func (q *SendQueue) writeLoop() {
+	defer close(q.stopped)
+	ctx := q.ChatService_StreamMessagesServer.Context()
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-ctx.Done():
+			return
+		case resp := <-q.queue:
+			if err := q.ChatService_StreamMessagesServer.Send(resp); err != nil {
+				q.logger.Errorf("Failed to write message ID %s to user %d: %v", resp.MessageId, q.userID, err)
+				q.failed = resp
+				return
+			}
+			q.metrics.sent.Add(1)
+		}
+	}
+}
+
+// SendQueueMetrics collects queue depth and overflow counters across all client queues.
+type SendQueueMetrics struct {
+	mu       sync.Mutex
+	queues   map[uint32]*SendQueue
+	enqueued atomic.Uint64
+	sent     atomic.Uint64
+	dropped  atomic.Uint64
+	rejected atomic.Uint64
+}
+
+// SendQueueStats is a point-in-time view of the send queues.
+type SendQueueStats struct {
+	Depths   map[uint32]int // Messages waiting per connected user
+	MaxDepth int            // Deepest single queue
+	Enqueued uint64         // Messages accepted into a queue
+	Sent     uint64         // Messages written to a client
+	Dropped  uint64         // Messages discarded by OverflowDropOldest
+	Rejected uint64         // Messages refused by OverflowReject
+}
+
+// NewSendQueueMetrics creates an empty metrics collector.
+func NewSendQueueMetrics() *SendQueueMetrics {
+	return &SendQueueMetrics{queues: make(map[uint32]*SendQueue)}
+}
+
+// Snapshot returns the current queue depths and counters.
+func (m *SendQueueMetrics) Snapshot() SendQueueStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := SendQueueStats{
+		Depths:   make(map[uint32]int, len(m.queues)),
+		Enqueued: m.enqueued.Load(),
+		Sent:     m.sent.Load(),
+		Dropped:  m.dropped.Load(),
+		Rejected: m.rejected.Load(),
+	}
+	for userID, q := range m.queues {
+		depth := q.Len()
+		stats.Depths[userID] = depth
+		if depth > stats.MaxDepth {
+			stats.MaxDepth = depth
+		}
+	}
+	return stats
+}
+
+func (m *SendQueueMetrics) track(userID uint32, q *SendQueue) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queues[userID] = q
+}
+
+func (m *SendQueueMetrics) untrack(userID uint32, q *SendQueue) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.queues[userID] == q {
+		delete(m.queues, userID)
+	}
+}
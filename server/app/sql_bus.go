@@ -0,0 +1,161 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/johnkhk/cli_chat_app/genproto/chat"
+	"github.com/johnkhk/cli_chat_app/server/storage"
+)
+
+const (
+	// DefaultBusPollInterval is how often an SQLBus checks for messages forwarded to its node.
+	DefaultBusPollInterval = 200 * time.Millisecond
+	// busPollBatch is how many forwarded messages are loaded at a time.
+	busPollBatch = 100
+)
+
+// SQLBus is a MessageBus kept in the server database, so every node using the same database shares it.
+// Forwarded messages are stored for the receiving node, which polls for them.
+type SQLBus struct {
+	Store        *storage.BusStore
+	PollInterval time.Duration
+	Logger       *logrus.Logger
+}
+
+var _ MessageBus = (*SQLBus)(nil)
+
+// NewSQLBus creates a bus on db, which must be migrated with storage.NewMigrator.
+func NewSQLBus(db *sql.DB, logger *logrus.Logger) *SQLBus {
+	return &SQLBus{
+		Store:        storage.NewBusStore(db),
+		PollInterval: DefaultBusPollInterval,
+		Logger:       logger,
+	}
+}
+
+// Publish stores the message for the node to pick up.
+func (b *SQLBus) Publish(nodeID string, resp *chat.MessageResponse) error {
+	data, err := proto.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return b.Store.Forward(nodeID, data)
+}
+
+// Subscribe clears the presence left by an earlier run of the node and polls for messages forwarded to it
+// until the returned func is called. Each message is deleted once the handler has returned.
+func (b *SQLBus) Subscribe(nodeID string, handler func(*chat.MessageResponse)) (func(), error) {
+	if err := b.Store.ClearNode(nodeID); err != nil {
+		return nil, err
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(b.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				b.poll(nodeID, handler)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			<-done
+		})
+	}, nil
+}
+
+// poll hands the messages forwarded to the node to the handler, a batch at a time.
+func (b *SQLBus) poll(nodeID string, handler func(*chat.MessageResponse)) {
+	for {
+		forwarded, err := b.Store.ForwardedMessages(nodeID, busPollBatch)
+		if err != nil {
+			b.Logger.Errorf("Failed to load messages forwarded to node %s: %v", nodeID, err)
+			return
+		}
+
+		ids := make([]int64, 0, len(forwarded))
+		for _, m := range forwarded {
+			msg := &chat.MessageResponse{}
+			if err := proto.Unmarshal(m.Payload, msg); err != nil {
+				b.Logger.Errorf("Dropping forwarded message %d that can't be decoded: %v", m.ID, err)
+			} else {
+				handler(msg)
+			}
+			ids = append(ids, m.ID)
+		}
+		if err := b.Store.DeleteForwarded(ids); err != nil {
+			b.Logger.Errorf("Failed to delete messages forwarded to node %s: %v", nodeID, err)
+			return
+		}
+
+		if len(forwarded) < busPollBatch {
+			return
+		}
+	}
+}
+
+// SetPresence records the node holding the user's stream.
+func (b *SQLBus) SetPresence(userID uint32, nodeID string) error {
+	return b.Store.SetPresence(userID, nodeID)
+}
+
+// ClearPresence removes the user's presence if it still points at the node.
+func (b *SQLBus) ClearPresence(userID uint32, nodeID string) error {
+	return b.Store.ClearPresence(userID, nodeID)
+}
+
+// Presence returns the node holding the user's stream.
+func (b *SQLBus) Presence(userID uint32) (string, bool, error) {
+	return b.Store.Presence(userID)
+}
+
+// Enqueue stores the message until the user reconnects.
+func (b *SQLBus) Enqueue(userID uint32, resp *chat.MessageResponse) error {
+	data, err := proto.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return b.Store.Enqueue(userID, data)
+}
+
+// Drain removes and returns the stored messages for the user. They are deleted in the transaction that
+// reads them, so two nodes draining at once don't both get them.
+func (b *SQLBus) Drain(userID uint32) ([]*chat.MessageResponse, error) {
+	var messages []*chat.MessageResponse
+	var errs []error
+	err := b.Store.DrainQueue(userID, func(m storage.BusMessage) error {
+		msg, err := decodeQueued(m.Payload)
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		messages = append(messages, msg)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return messages, errors.Join(errs...)
+}
+
+// QueueDepths counts the stored messages of each user.
+func (b *SQLBus) QueueDepths() (map[uint32]int, error) {
+	return b.Store.QueueDepths()
+}
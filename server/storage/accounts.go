@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrUserNotFound is returned when an account operation names a user that does not exist.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUserNotPending is returned when approving or rejecting an account that is not waiting for approval.
+	ErrUserNotPending = errors.New("user is not waiting for approval")
+)
+
+// AccountStore manages user accounts for the server and for administration tools.
+type AccountStore struct {
+	DB *sql.DB
+}
+
+// NewAccountStore creates an AccountStore backed by db.
+func NewAccountStore(db *sql.DB) *AccountStore {
+	return &AccountStore{DB: db}
+}
+
+// ListUsers returns every account, ordered by ID.
+func (s *AccountStore) ListUsers() ([]User, error) {
+	return s.listUsers("")
+}
+
+// PendingUsers returns the accounts waiting for an administrator's approval, oldest first.
+func (s *AccountStore) PendingUsers() ([]User, error) {
+	return s.listUsers("WHERE pending")
+}
+
+// listUsers returns the accounts matching where, ordered by ID.
+func (s *AccountStore) listUsers(where string) ([]User, error) {
+	rows, err := s.DB.Query(`
+		SELECT id, username, is_bot, locked, pending, last_login_at, created_at
+		FROM users
+		` + where + `
+		ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		var lastLogin sql.NullTime
+		if err := rows.Scan(&user.ID, &user.Username, &user.IsBot, &user.Locked, &user.Pending, &lastLogin, &user.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning user row: %w", err)
+		}
+		if lastLogin.Valid {
+			user.LastLoginAt = &lastLogin.Time
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// SetLocked locks or unlocks an account. Locking also revokes the account's sessions.
+func (s *AccountStore) SetLocked(username string, locked bool) error {
+	if locked {
+		return s.updateUser(username, "UPDATE users SET locked = ?, sessions_revoked_at = ? WHERE username = ?", true, now(), username)
+	}
+	return s.updateUser(username, "UPDATE users SET locked = ? WHERE username = ?", false, username)
+}
+
+// ApproveUser lets an account waiting for approval log in.
+func (s *AccountStore) ApproveUser(username string) error {
+	return s.settlePending(username, "UPDATE users SET pending = ? WHERE username = ? AND pending", false, username)
+}
+
+// RejectUser deletes an account waiting for approval, which frees its username, along with everything
+// that refers to it, such as friend requests sent to it before it was approved.
+func (s *AccountStore) RejectUser(username string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userID uint32
+	var pending bool
+	err = tx.QueryRow("SELECT id, pending FROM users WHERE username = ?"+s.forUpdate(), username).Scan(&userID, &pending)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, username)
+	}
+	if err != nil {
+		return fmt.Errorf("error looking up user %s: %w", username, err)
+	}
+	if !pending {
+		return fmt.Errorf("%w: %s", ErrUserNotPending, username)
+	}
+
+	// These tables refer to users without ON DELETE CASCADE; the rest go with the user row
+	if _, err := tx.Exec("DELETE FROM friend_requests WHERE requester_id = ? OR recipient_id = ?", userID, userID); err != nil {
+		return fmt.Errorf("error deleting friend requests of user %s: %w", username, err)
+	}
+	if _, err := tx.Exec("DELETE FROM friends WHERE user_id = ? OR friend_id = ?", userID, userID); err != nil {
+		return fmt.Errorf("error deleting friends of user %s: %w", username, err)
+	}
+	if _, err := tx.Exec("DELETE FROM onetime_prekeys WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("error deleting prekeys of user %s: %w", username, err)
+	}
+	if _, err := tx.Exec("DELETE FROM users WHERE id = ?", userID); err != nil {
+		return fmt.Errorf("error deleting user %s: %w", username, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// settlePending runs a statement against an account waiting for approval and reports ErrUserNotPending or
+// ErrUserNotFound if it matched nothing.
+func (s *AccountStore) settlePending(username, query string, args ...interface{}) error {
+	result, err := s.DB.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("error updating user %s: %w", username, err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		var exists bool
+		if err := s.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)", username).Scan(&exists); err != nil {
+			return fmt.Errorf("error looking up user %s: %w", username, err)
+		}
+		if !exists {
+			return fmt.Errorf("%w: %s", ErrUserNotFound, username)
+		}
+		return fmt.Errorf("%w: %s", ErrUserNotPending, username)
+	}
+	return nil
+}
+
+// RevokeSessions invalidates every access and refresh token issued to the account so far.
+func (s *AccountStore) RevokeSessions(username string) error {
+	return s.updateUser(username, "UPDATE users SET sessions_revoked_at = ? WHERE username = ?", now(), username)
+}
+
+// SessionsRevokedSince returns the IDs of the accounts whose sessions were revoked at or after since,
+// which includes accounts locked or given a new password since then.
+func (s *AccountStore) SessionsRevokedSince(since time.Time) ([]uint32, error) {
+	rows, err := s.DB.Query("SELECT id FROM users WHERE sessions_revoked_at >= ? ORDER BY id", since.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error listing revoked sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []uint32
+	for rows.Next() {
+		var userID uint32
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("error scanning user ID: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
+// SetPasswordHash replaces the account's password hash and revokes its sessions.
+func (s *AccountStore) SetPasswordHash(username, passwordHash string) error {
+	return s.updateUser(username, "UPDATE users SET password_hash = ?, sessions_revoked_at = ? WHERE username = ?", passwordHash, now(), username)
+}
+
+// HasPreKeyBundle reports whether the user has published a prekey bundle.
+func (s *AccountStore) HasPreKeyBundle(username string) (bool, error) {
+	var exists bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM prekey_bundle p JOIN users u ON u.id = p.user_id WHERE u.username = ?)`, username).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error checking prekey bundle of %s: %w", username, err)
+	}
+	return exists, nil
+}
+
+// PurgeStalePreKeys deletes the prekey bundles and one-time prekeys of locked accounts that have not
+// logged in for longer than inactiveFor. It returns the number of bundles removed.
+// Clients only upload a bundle when a device is first set up, so bundles of active accounts are never touched.
+func (s *AccountStore) PurgeStalePreKeys(inactiveFor time.Duration) (int64, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	const stale = `
+		SELECT id FROM users
+		WHERE locked AND COALESCE(last_login_at, created_at) < ?`
+	cutoff := now().Add(-inactiveFor)
+
+	if _, err := tx.Exec("DELETE FROM onetime_prekeys WHERE user_id IN ("+stale+")", cutoff); err != nil {
+		return 0, fmt.Errorf("error purging one-time prekeys: %w", err)
+	}
+	result, err := tx.Exec("DELETE FROM prekey_bundle WHERE user_id IN ("+stale+")", cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("error purging prekey bundles: %w", err)
+	}
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return purged, nil
+}
+
+// RecordQueueDepths replaces the recorded offline queue depths with depths, keyed by user ID.
+func (s *AccountStore) RecordQueueDepths(depths map[uint32]int) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM offline_queue_depth"); err != nil {
+		return fmt.Errorf("error clearing queue depths: %w", err)
+	}
+	recordedAt := now()
+	for userID, depth := range depths {
+		if depth == 0 {
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO offline_queue_depth (user_id, depth, recorded_at) VALUES (?, ?, ?)", userID, depth, recordedAt); err != nil {
+			return fmt.Errorf("error recording queue depth of user %d: %w", userID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// QueueDepths returns the offline queue depths last recorded by the server, deepest first.
+func (s *AccountStore) QueueDepths() ([]QueueDepth, error) {
+	rows, err := s.DB.Query(`
+		SELECT q.user_id, u.username, q.depth, q.recorded_at
+		FROM offline_queue_depth q
+		JOIN users u ON u.id = q.user_id
+		ORDER BY q.depth DESC, u.username`)
+	if err != nil {
+		return nil, fmt.Errorf("error reading queue depths: %w", err)
+	}
+	defer rows.Close()
+
+	var depths []QueueDepth
+	for rows.Next() {
+		var depth QueueDepth
+		if err := rows.Scan(&depth.UserID, &depth.Username, &depth.Depth, &depth.RecordedAt); err != nil {
+			return nil, fmt.Errorf("error scanning queue depth row: %w", err)
+		}
+		depths = append(depths, depth)
+	}
+	return depths, rows.Err()
+}
+
+// updateUser runs an UPDATE against a single account and reports ErrUserNotFound if it matched nothing.
+func (s *AccountStore) updateUser(username, query string, args ...interface{}) error {
+	result, err := s.DB.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("error updating user %s: %w", username, err)
+	}
+	// MySQL counts changed rows, so an update that changes nothing looks like a missing user; check for one.
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		var exists bool
+		if err := s.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)", username).Scan(&exists); err != nil {
+			return fmt.Errorf("error looking up user %s: %w", username, err)
+		}
+		if !exists {
+			return fmt.Errorf("%w: %s", ErrUserNotFound, username)
+		}
+	}
+	return nil
+}
+
+// forUpdate locks the selected rows on MySQL; see SQLRepository.forUpdate.
+func (s *AccountStore) forUpdate() string {
+	if isSQLite(s.DB) {
+		return ""
+	}
+	return " FOR UPDATE"
+}
@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// BusMessage is a serialized chat message waiting in one of the bus tables.
+type BusMessage struct {
+	ID      int64
+	Payload []byte
+}
+
+// BusStore keeps the state server nodes share to route chat messages to each other: which node holds each
+// user's stream, messages forwarded to a node, and messages queued for offline users.
+type BusStore struct {
+	DB *sql.DB
+}
+
+// NewBusStore creates a BusStore backed by db, which must be migrated with NewMigrator.
+func NewBusStore(db *sql.DB) *BusStore {
+	return &BusStore{DB: db}
+}
+
+// SetPresence records that the node holds the user's stream, replacing any other node.
+func (s *BusStore) SetPresence(userID uint32, nodeID string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Delete and insert rather than upsert, whose syntax differs between MySQL and SQLite
+	if _, err := tx.Exec("DELETE FROM bus_presence WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("error replacing presence of user %d: %w", userID, err)
+	}
+	if _, err := tx.Exec("INSERT INTO bus_presence (user_id, node_id, updated_at) VALUES (?, ?, ?)", userID, nodeID, now()); err != nil {
+		return fmt.Errorf("error saving presence of user %d: %w", userID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ClearPresence removes the user's presence if it is still held by the node.
+func (s *BusStore) ClearPresence(userID uint32, nodeID string) error {
+	if _, err := s.DB.Exec("DELETE FROM bus_presence WHERE user_id = ? AND node_id = ?", userID, nodeID); err != nil {
+		return fmt.Errorf("error clearing presence of user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// ClearNode removes every presence held by the node. A node calls it when it starts, since streams held
+// before a crash or restart are gone.
+func (s *BusStore) ClearNode(nodeID string) error {
+	if _, err := s.DB.Exec("DELETE FROM bus_presence WHERE node_id = ?", nodeID); err != nil {
+		return fmt.Errorf("error clearing presence on node %s: %w", nodeID, err)
+	}
+	return nil
+}
+
+// Presence returns the node holding the user's stream, if any.
+func (s *BusStore) Presence(userID uint32) (string, bool, error) {
+	var nodeID string
+	err := s.DB.QueryRow("SELECT node_id FROM bus_presence WHERE user_id = ?", userID).Scan(&nodeID)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("error looking up presence of user %d: %w", userID, err)
+	}
+	return nodeID, true, nil
+}
+
+// Forward stores a message for the node to pick up with ForwardedMessages.
+func (s *BusStore) Forward(nodeID string, payload []byte) error {
+	if _, err := s.DB.Exec("INSERT INTO bus_forwarded (node_id, payload, created_at) VALUES (?, ?, ?)", nodeID, payload, now()); err != nil {
+		return fmt.Errorf("error forwarding message to node %s: %w", nodeID, err)
+	}
+	return nil
+}
+
+// ForwardedMessages returns up to limit messages forwarded to the node, oldest first. They stay stored
+// until the node deletes them with DeleteForwarded.
+func (s *BusStore) ForwardedMessages(nodeID string, limit int) ([]BusMessage, error) {
+	rows, err := s.DB.Query("SELECT id, payload FROM bus_forwarded WHERE node_id = ? ORDER BY id LIMIT ?", nodeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error loading messages forwarded to node %s: %w", nodeID, err)
+	}
+	return scanBusMessages(rows)
+}
+
+// DeleteForwarded removes forwarded messages the node has handled.
+func (s *BusStore) DeleteForwarded(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	placeholders, args := busIDArgs(ids)
+	if _, err := s.DB.Exec("DELETE FROM bus_forwarded WHERE id IN ("+placeholders+")", args...); err != nil {
+		return fmt.Errorf("error deleting forwarded messages: %w", err)
+	}
+	return nil
+}
+
+// Enqueue stores a message until the offline user reconnects.
+func (s *BusStore) Enqueue(userID uint32, payload []byte) error {
+	if _, err := s.DB.Exec("INSERT INTO bus_queue (user_id, payload, created_at) VALUES (?, ?, ?)", userID, payload, now()); err != nil {
+		return fmt.Errorf("error queueing message for user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// DrainQueue passes each message queued for the user to handle, oldest first, and deletes them in the same
+// transaction once they are handled. Nothing is deleted if handle returns an error.
+func (s *BusStore) DrainQueue(userID uint32, handle func(BusMessage) error) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, payload FROM bus_queue WHERE user_id = ? ORDER BY id"+s.forUpdate(), userID)
+	if err != nil {
+		return fmt.Errorf("error loading messages queued for user %d: %w", userID, err)
+	}
+	queued, err := scanBusMessages(rows)
+	if err != nil {
+		return err
+	}
+	if len(queued) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(queued))
+	for _, msg := range queued {
+		if err := handle(msg); err != nil {
+			return err
+		}
+		ids = append(ids, msg.ID)
+	}
+
+	placeholders, args := busIDArgs(ids)
+	if _, err := tx.Exec("DELETE FROM bus_queue WHERE id IN ("+placeholders+")", args...); err != nil {
+		return fmt.Errorf("error deleting messages queued for user %d: %w", userID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// QueueDepths returns the number of messages queued for each offline user.
+func (s *BusStore) QueueDepths() (map[uint32]int, error) {
+	rows, err := s.DB.Query("SELECT user_id, COUNT(*) FROM bus_queue GROUP BY user_id")
+	if err != nil {
+		return nil, fmt.Errorf("error counting queued messages: %w", err)
+	}
+	defer rows.Close()
+
+	depths := make(map[uint32]int)
+	for rows.Next() {
+		var userID uint32
+		var depth int
+		if err := rows.Scan(&userID, &depth); err != nil {
+			return nil, fmt.Errorf("error scanning queue depth: %w", err)
+		}
+		depths[userID] = depth
+	}
+	return depths, rows.Err()
+}
+
+// forUpdate locks the selected rows on MySQL; see SQLRepository.forUpdate.
+func (s *BusStore) forUpdate() string {
+	if isSQLite(s.DB) {
+		return ""
+	}
+	return " FOR UPDATE"
+}
+
+// scanBusMessages reads and closes rows of id and payload.
+func scanBusMessages(rows *sql.Rows) ([]BusMessage, error) {
+	defer rows.Close()
+	var messages []BusMessage
+	for rows.Next() {
+		var msg BusMessage
+		if err := rows.Scan(&msg.ID, &msg.Payload); err != nil {
+			return nil, fmt.Errorf("error scanning bus message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// busIDArgs returns the placeholders and arguments for an IN list of message IDs.
+func busIDArgs(ids []int64) (string, []interface{}) {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", "), args
+}
@@ -4,18 +4,27 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql" // Import MySQL driver
+	"github.com/mattn/go-sqlite3"
 )
 
+// sqlitePrefix marks a DATABASE_URL that names a SQLite database file instead of a MySQL server.
+const sqlitePrefix = "sqlite:"
+
 // InitDB initializes the database connection with retry logic.
+// A DATABASE_URL of the form sqlite:<path> opens an embedded SQLite database instead of MySQL.
 func InitDB() (*sql.DB, error) {
 	// Get the database URL from environment variables
 	dsn := os.Getenv("DATABASE_URL")
 	if dsn == "" {
 		return nil, fmt.Errorf("DATABASE_URL environment variable is not set")
 	}
+	if path, ok := strings.CutPrefix(dsn, sqlitePrefix); ok {
+		return OpenSQLite(path)
+	}
 
 	// Retry logic
 	maxRetries := 10
@@ -44,3 +53,30 @@ func InitDB() (*sql.DB, error) {
 	// If all retries fail, return the last error
 	return nil, fmt.Errorf("could not connect to the database after %d attempts: %w", maxRetries, err)
 }
+
+// OpenSQLite opens, and creates if needed, the SQLite database file at path.
+// Foreign keys are enforced like in MySQL, and writers wait for each other instead of failing.
+func OpenSQLite(path string) (*sql.DB, error) {
+	dsn := "file:" + path + "?_foreign_keys=1&_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate"
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database connection: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open SQLite database %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// isSQLite reports whether db is an embedded SQLite database rather than a MySQL server.
+func isSQLite(db *sql.DB) bool {
+	_, ok := db.Driver().(*sqlite3.SQLiteDriver)
+	return ok
+}
+
+// now returns the current time as the server stores it: in UTC, to the second like MySQL's TIMESTAMP.
+// Times are passed to queries instead of using NOW(), which SQLite does not have.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
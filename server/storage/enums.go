@@ -9,6 +9,7 @@ var (
 	StatusCancelledStr = friends.FriendRequestStatus_name[int32(friends.FriendRequestStatus_CANCELED)]
 	StatusUnknownStr   = friends.FriendRequestStatus_name[int32(friends.FriendRequestStatus_UNKNOWN)]
 	StatusFailedStr    = friends.FriendRequestStatus_name[int32(friends.FriendRequestStatus_FAILED)]
+	StatusExpiredStr   = friends.FriendRequestStatus_name[int32(friends.FriendRequestStatus_EXPIRED)]
 )
 
 const (
@@ -18,4 +19,5 @@ const (
 	StatusCanceledInt32 = int32(friends.FriendRequestStatus_CANCELED)
 	StatusUnknownInt32  = int32(friends.FriendRequestStatus_UNKNOWN)
 	StatusFailedInt32   = int32(friends.FriendRequestStatus_FAILED)
+	StatusExpiredInt32  = int32(friends.FriendRequestStatus_EXPIRED)
 )
@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/johnkhk/cli_chat_app/db/migrations"
+)
+
+// migrationLock is the MySQL named lock that keeps two servers from migrating the same database at once.
+const migrationLock = "cli_chat_app_schema_migrations"
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one versioned change to the database schema.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// MigrationStatus is a migration and when it was applied, if it has been.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies and reverts schema migrations, recording them in the schema_migrations table.
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+}
+
+// NewMigrator creates a Migrator for the migrations embedded in the binary, picking the MySQL or SQLite set to match db.
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	files := fs.FS(migrations.FS)
+	if isSQLite(db) {
+		files = migrations.SQLite
+	}
+	loaded, err := LoadMigrations(files)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Migrations: loaded}, nil
+}
+
+// LoadMigrations reads <version>_<name>.up.sql and .down.sql pairs from fsys, ordered by version.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		match := migrationFileName.FindStringSubmatch(file)
+		if match == nil {
+			return nil, fmt.Errorf("migration file %s is not named <version>_<name>.up.sql or .down.sql", file)
+		}
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", file, err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	loaded := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %s needs both an up and a down file", migration)
+		}
+		loaded = append(loaded, *migration)
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].Version < loaded[j].Version })
+	return loaded, nil
+}
+
+// Up applies every migration that has not been applied yet, in order, and returns the ones it applied.
+// It refuses to run against a database migrated by a newer build.
+func (m *Migrator) Up() ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(func(conn *sql.Conn, done map[int]time.Time) error {
+		known := make(map[int]bool, len(m.Migrations))
+		for _, migration := range m.Migrations {
+			known[migration.Version] = true
+		}
+		for version := range done {
+			if !known[version] {
+				return fmt.Errorf("database has migration %d, which this build does not know; upgrade the server", version)
+			}
+		}
+
+		for _, migration := range m.Migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			if err := execStatements(conn, migration.Up); err != nil {
+				return fmt.Errorf("migration %s failed: %w", migration, err)
+			}
+			if _, err := conn.ExecContext(context.Background(),
+				"INSERT INTO schema_migrations (version, name) VALUES (?, ?)", migration.Version, migration.Name); err != nil {
+				return fmt.Errorf("error recording migration %s: %w", migration, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the latest steps applied migrations, newest first, and returns the ones it reverted.
+// A steps of zero or less reverts all of them.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.withLock(func(conn *sql.Conn, done map[int]time.Time) error {
+		for i := len(m.Migrations) - 1; i >= 0; i-- {
+			if steps > 0 && len(reverted) == steps {
+				break
+			}
+			migration := m.Migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+			if err := execStatements(conn, migration.Down); err != nil {
+				return fmt.Errorf("reverting migration %s failed: %w", migration, err)
+			}
+			if _, err := conn.ExecContext(context.Background(),
+				"DELETE FROM schema_migrations WHERE version = ?", migration.Version); err != nil {
+				return fmt.Errorf("error recording revert of migration %s: %w", migration, err)
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists every known migration and when it was applied.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(func(conn *sql.Conn, done map[int]time.Time) error {
+		for _, migration := range m.Migrations {
+			status := MigrationStatus{Migration: migration}
+			if appliedAt, ok := done[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// withLock runs fn on a single connection holding the migration lock, with the applied versions and their times.
+func (m *Migrator) withLock(fn func(conn *sql.Conn, done map[int]time.Time) error) error {
+	ctx := context.Background()
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get a database connection: %w", err)
+	}
+	defer conn.Close()
+
+	// SQLite databases belong to a single server process, so only MySQL needs the lock.
+	if !isSQLite(m.DB) {
+		var locked sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 60)", migrationLock).Scan(&locked); err != nil {
+			return fmt.Errorf("failed to take the migration lock: %w", err)
+		}
+		if locked.Int64 != 1 {
+			return fmt.Errorf("timed out waiting for another process to finish migrating")
+		}
+		defer conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", migrationLock)
+	}
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT NOT NULL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`); err != nil {
+		return fmt.Errorf("error creating schema_migrations table: %w", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return fmt.Errorf("error reading applied migrations: %w", err)
+	}
+	done := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt sql.NullTime
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning applied migration: %w", err)
+		}
+		done[version] = appliedAt.Time
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return fn(conn, done)
+}
+
+// execStatements runs the semicolon separated statements of a migration one at a time.
+// MySQL commits schema changes immediately, so a failing statement leaves the earlier ones applied;
+// keep each migration small enough to finish by hand.
+func execStatements(conn *sql.Conn, script string) error {
+	for _, statement := range strings.Split(script, ";") {
+		statement = strings.TrimSpace(statement)
+		if isBlankSQL(statement) {
+			continue
+		}
+		if _, err := conn.ExecContext(context.Background(), statement); err != nil {
+			return fmt.Errorf("%w\nStatement:\n%s", err, statement)
+		}
+	}
+	return nil
+}
+
+// isBlankSQL reports whether statement holds nothing but whitespace and -- comments.
+func isBlankSQL(statement string) bool {
+	for _, line := range strings.Split(statement, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/johnkhk/cli_chat_app/db/migrations"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	loaded, err := LoadMigrations(fstest.MapFS{
+		"0002_add_column.up.sql":   {Data: []byte("ALTER TABLE t ADD COLUMN c INT")},
+		"0002_add_column.down.sql": {Data: []byte("ALTER TABLE t DROP COLUMN c")},
+		"0001_initial.up.sql":      {Data: []byte("CREATE TABLE t (id INT)")},
+		"0001_initial.down.sql":    {Data: []byte("DROP TABLE t")},
+	})
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if len(loaded) != 2 || loaded[0].String() != "0001_initial" || loaded[1].String() != "0002_add_column" {
+		t.Fatalf("Expected migrations ordered by version, got: %v", loaded)
+	}
+	if loaded[1].Down != "ALTER TABLE t DROP COLUMN c" {
+		t.Fatalf("Unexpected down migration: %q", loaded[1].Down)
+	}
+
+	invalid := map[string]fstest.MapFS{
+		"missing down": {"0001_initial.up.sql": {Data: []byte("CREATE TABLE t (id INT)")}},
+		"bad name":     {"initial.sql": {Data: []byte("CREATE TABLE t (id INT)")}},
+		"duplicate version": {
+			"0001_a.up.sql": {Data: []byte("SELECT 1")}, "0001_a.down.sql": {Data: []byte("SELECT 1")},
+			"0001_b.up.sql": {Data: []byte("SELECT 1")}, "0001_b.down.sql": {Data: []byte("SELECT 1")},
+		},
+	}
+	for name, fsys := range invalid {
+		if _, err := LoadMigrations(fsys); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+
+	// The migrations shipped with the server must load as well.
+	if _, err := LoadMigrations(migrations.FS); err != nil {
+		t.Fatalf("Failed to load embedded migrations: %v", err)
+	}
+}
+
+func TestIsBlankSQL(t *testing.T) {
+	if !isBlankSQL("-- trailing comment\n  \n") {
+		t.Error("Expected a comment-only statement to be blank")
+	}
+	if isBlankSQL("-- Drop the table\nDROP TABLE t") {
+		t.Error("Expected a commented statement not to be blank")
+	}
+}
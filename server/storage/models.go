@@ -3,8 +3,116 @@ package storage
 import "time"
 
 type User struct {
+	ID          uint32     `json:"id"`
+	Username    string     `json:"username"`
+	Password    string     `json:"password"` // Hash the password for security
+	IsBot       bool       `json:"is_bot"`
+	Locked      bool       `json:"locked"`
+	Pending     bool       `json:"pending"`       // Waiting for an administrator to approve the registration
+	LastLoginAt *time.Time `json:"last_login_at"` // Nil if the user has never logged in
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// QueueDepth is the number of messages the server is holding for an offline user.
+type QueueDepth struct {
+	UserID     uint32    `json:"user_id"`
+	Username   string    `json:"username"`
+	Depth      int       `json:"depth"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// FriendRequest is a friend request together with the usernames of both sides.
+type FriendRequest struct {
+	ID                uint32    `json:"id"`
+	RequesterID       uint32    `json:"requester_id"`
+	RecipientID       uint32    `json:"recipient_id"`
+	RequesterUsername string    `json:"requester_username"`
+	RecipientUsername string    `json:"recipient_username"`
+	Status            string    `json:"status"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// Invite is a code that makes whoever redeems it a friend of its creator.
+type Invite struct {
 	ID        uint32    `json:"id"`
-	Username  string    `json:"username"`
-	Password  string    `json:"password"` // Hash the password for security
+	Code      string    `json:"code"`
+	CreatorID uint32    `json:"creator_id"`
+	MaxUses   int       `json:"max_uses"`
+	Uses      int       `json:"uses"`
+	ExpiresAt time.Time `json:"expires_at"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// Friend is an entry in a user's friend list.
+type Friend struct {
+	UserID         uint32     `json:"user_id"`
+	Username       string     `json:"username"`
+	IsBot          bool       `json:"is_bot"`
+	AddedAt        time.Time  `json:"added_at"`
+	LastActivityAt *time.Time `json:"last_activity_at"` // Nil if the two have not messaged each other since it was tracked
+}
+
+// FriendOrder is an order ListFriendsPage can list friends in. Ties are broken by user ID.
+type FriendOrder int
+
+const (
+	// FriendsByRecentActivity puts the friends messaged most recently first, then the friends never messaged,
+	// newest friendships first.
+	FriendsByRecentActivity FriendOrder = iota
+	// FriendsByName orders friends by username, ignoring case.
+	FriendsByName
+)
+
+// BlockedUser is an entry in a user's block list.
+type BlockedUser struct {
+	UserID    uint32    `json:"user_id"`
+	Username  string    `json:"username"`
+	BlockedAt time.Time `json:"blocked_at"`
+}
+
+// UserSearchResult is a user found by SearchUsers, with how they relate to the user searching.
+type UserSearchResult struct {
+	UserID         uint32 `json:"user_id"`
+	Username       string `json:"username"`
+	IsBot          bool   `json:"is_bot"`
+	IsFriend       bool   `json:"is_friend"`
+	RequestPending bool   `json:"request_pending"` // A friend request between the two is waiting for an answer
+}
+
+// MessageRequest summarizes the messages a user who is not a friend sent, held until the recipient answers.
+type MessageRequest struct {
+	SenderID       uint32    `json:"sender_id"`
+	SenderUsername string    `json:"sender_username"`
+	Messages       int       `json:"messages"`
+	LastReceivedAt time.Time `json:"last_received_at"`
+}
+
+// HeldMessage is one message of a message request.
+type HeldMessage struct {
+	ID          uint32    `json:"id"`
+	SenderID    uint32    `json:"sender_id"`
+	RecipientID uint32    `json:"recipient_id"`
+	MessageID   string    `json:"message_id"`
+	Payload     []byte    `json:"payload"` // Encoded by the caller; the message itself stays end-to-end encrypted
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// EncryptedProfile is a user's profile as the server stores it: encrypted with a key only the user's friends have.
+type EncryptedProfile struct {
+	UserID     uint32    `json:"user_id"`
+	Ciphertext []byte    `json:"ciphertext"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// PreKeyBundle holds the public keys other users need to start an encrypted session with a device.
+type PreKeyBundle struct {
+	UserID                uint32 `json:"user_id"`
+	RegistrationID        uint32 `json:"registration_id"`
+	DeviceID              uint32 `json:"device_id"`
+	IdentityKey           []byte `json:"identity_key"`
+	PreKeyID              uint32 `json:"pre_key_id"`
+	PreKey                []byte `json:"pre_key"`
+	SignedPreKeyID        uint32 `json:"signed_pre_key_id"`
+	SignedPreKey          []byte `json:"signed_pre_key"`
+	SignedPreKeySignature []byte `json:"signed_pre_key_signature"`
+}
@@ -0,0 +1,1194 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrFriendRequestNotFound is returned when no pending friend request matches.
+	ErrFriendRequestNotFound = errors.New("friend request not found")
+	// ErrFriendRequestPending is returned when a friend request between two users is already pending.
+	ErrFriendRequestPending = errors.New("friend request already pending")
+	// ErrAlreadyFriends is returned when a friend request is sent to a friend.
+	ErrAlreadyFriends = errors.New("already friends")
+	// ErrBlocked is returned when one of two users has blocked the other.
+	ErrBlocked = errors.New("user is blocked")
+	// ErrMessageRequestNotFound is returned when no messages from the sender are held for the recipient.
+	ErrMessageRequestNotFound = errors.New("message request not found")
+	// ErrMessageRequestFull is returned when a sender already has MaxHeldMessages waiting for the recipient.
+	ErrMessageRequestFull = errors.New("too many messages waiting for the recipient to accept")
+	// ErrUsernameTaken is returned when registering a username that is in use.
+	ErrUsernameTaken = errors.New("username already exists")
+	// ErrProfileNotFound is returned when a user has not set a profile.
+	ErrProfileNotFound = errors.New("profile not found")
+	// ErrPreKeyBundleNotFound is returned when a user has not uploaded a prekey bundle for the device.
+	ErrPreKeyBundleNotFound = errors.New("prekey bundle not found")
+	// ErrInviteNotFound is returned when an invite code is unknown, expired or used up.
+	ErrInviteNotFound = errors.New("invite not found")
+	// ErrOwnInvite is returned when a user redeems an invite they created.
+	ErrOwnInvite = errors.New("invite created by the same user")
+	// ErrTooManyPendingFriendRequests is returned when a user already has FriendRequestLimits.MaxPending
+	// friend requests waiting for an answer.
+	ErrTooManyPendingFriendRequests = errors.New("too many friend requests waiting for an answer")
+	// ErrFriendRequestDailyLimit is returned when a user has sent FriendRequestLimits.MaxPerDay friend requests
+	// in the last day.
+	ErrFriendRequestDailyLimit = errors.New("too many friend requests sent in the last day")
+)
+
+// MaxHeldMessages is how many messages a user can send someone who is not their friend before they answer.
+const MaxHeldMessages = 20
+
+// FriendRequestLimits bound the friend requests a user can send, so one account can't flood others with them.
+type FriendRequestLimits struct {
+	MaxPending int // Requests a user can have waiting for an answer at once; 0 for no limit
+	MaxPerDay  int // Requests a user can send in any 24 hours, counting each time one is sent again; 0 for no limit
+}
+
+// ActivityResolution is how stale a friendship's recorded activity gets before a new message updates it.
+const ActivityResolution = time.Minute
+
+// Repository is the server's persistent state: users, friends, friend requests, blocks, message requests,
+// profiles, prekey bundles and invites.
+type Repository interface {
+	UserRepository
+	FriendRepository
+	BlockRepository
+	DiscoveryRepository
+	MessageRequestRepository
+	ProfileRepository
+	PreKeyRepository
+	InviteRepository
+}
+
+// UserRepository stores accounts.
+type UserRepository interface {
+	// GetUserByUsername returns the account with its password hash, or ErrUserNotFound.
+	GetUserByUsername(username string) (*User, error)
+	// CreateUser adds an account and returns its ID, or ErrUsernameTaken.
+	CreateUser(username, passwordHash string, isBot bool) (uint32, error)
+	// CreatePendingUser adds an account like CreateUser that can't log in until an administrator approves it.
+	CreatePendingUser(username, passwordHash string, isBot bool) (uint32, error)
+	// RecordLogin stores the time of the user's latest login.
+	RecordLogin(userID uint32) error
+	// IsRevoked reports whether a token issued to the user at issuedAt should be rejected.
+	IsRevoked(userID uint32, issuedAt time.Time) (bool, error)
+}
+
+// FriendRepository stores friend requests and friendships.
+// Operations that read and then write, or touch more than one table, run in a single transaction.
+type FriendRepository interface {
+	// SendFriendRequest adds a pending request from requesterID to recipientID, or makes a declined, canceled
+	// or expired request between them pending again, and reports whether it reopened one.
+	// It returns ErrFriendRequestPending or ErrAlreadyFriends when there is nothing to send,
+	// and ErrBlocked when either user has blocked the other. Every send is logged, and the requester's limits
+	// are checked against the log in the same transaction: ErrTooManyPendingFriendRequests or
+	// ErrFriendRequestDailyLimit is returned without sending if they are reached.
+	SendFriendRequest(requesterID, recipientID uint32, limits FriendRequestLimits) (bool, error)
+	// AcceptFriendRequest accepts a pending request sent to recipientID, makes both users friends
+	// and returns the requester's ID, or ErrFriendRequestNotFound.
+	AcceptFriendRequest(requestID, recipientID uint32) (uint32, error)
+	// DeclineFriendRequest declines a pending request sent to recipientID and returns the requester's ID,
+	// or ErrFriendRequestNotFound.
+	DeclineFriendRequest(requestID, recipientID uint32) (uint32, error)
+	// CancelFriendRequest cancels a pending request sent by requesterID and returns the recipient's ID,
+	// or ErrFriendRequestNotFound, also when the request was sent by someone else.
+	CancelFriendRequest(requestID, requesterID uint32) (uint32, error)
+	// FriendRequestStats returns how many of the requests requesterID sent are pending, and how many times they
+	// sent one, including sending one again, within the last window.
+	FriendRequestStats(requesterID uint32, window time.Duration) (pending, sent int, err error)
+	// ExpireFriendRequests expires the requests that have been pending for longer than maxAge and returns
+	// how many it expired. Sends logged more than maxAge ago are deleted.
+	ExpireFriendRequests(maxAge time.Duration) (int64, error)
+	// RemoveFriend ends a friendship, cancels the requests between the two users and reports whether there was one.
+	RemoveFriend(userID, friendID uint32) (bool, error)
+	// IncomingFriendRequests returns the pending requests sent to the user.
+	IncomingFriendRequests(userID uint32) ([]FriendRequest, error)
+	// OutgoingFriendRequests returns the pending requests the user has sent.
+	OutgoingFriendRequests(userID uint32) ([]FriendRequest, error)
+	// ListFriends returns the user's friends.
+	ListFriends(userID uint32) ([]Friend, error)
+	// ListFriendsPage returns up to limit of the user's friends in the order, starting after the friend
+	// after, or from the first friend if it is nil. Only the fields the order sorts by are read from after.
+	ListFriendsPage(userID uint32, order FriendOrder, after *Friend, limit int) ([]Friend, error)
+	// AreFriends reports whether two users are friends.
+	AreFriends(userID, otherID uint32) (bool, error)
+	// RecordFriendActivity notes that two friends just messaged each other. To spare the database a write
+	// per message, it only updates friendships whose activity is older than ActivityResolution.
+	RecordFriendActivity(userID, friendID uint32) error
+}
+
+// BlockRepository stores the users each user has blocked.
+type BlockRepository interface {
+	// BlockUser blocks blockedID for userID, ending their friendship, canceling the friend requests between them
+	// and dropping the messages either holds for the other, and reports whether they were friends. It returns ErrUserNotFound if blockedID does not exist.
+	BlockUser(userID, blockedID uint32) (bool, error)
+	// UnblockUser lifts a block and reports whether there was one.
+	UnblockUser(userID, blockedID uint32) (bool, error)
+	// ListBlockedUsers returns the users the user has blocked.
+	ListBlockedUsers(userID uint32) ([]BlockedUser, error)
+	// IsBlocked reports whether either user has blocked the other.
+	IsBlocked(userID, otherID uint32) (bool, error)
+}
+
+// DiscoveryRepository finds users by name for people who don't know the exact username.
+type DiscoveryRepository interface {
+	// SearchUsers returns up to limit users whose usernames match query, skipping the first offset, and reports
+	// whether there are more. Exact matches come first, then prefix and substring matches, then usernames that
+	// merely contain the query's characters in order. The searcher, locked accounts, users blocked either way and
+	// users who opted out of discovery are left out, except that friends can always be found.
+	SearchUsers(searcherID uint32, query string, offset, limit int) ([]UserSearchResult, bool, error)
+	// Discoverable reports whether other users can find the user with SearchUsers.
+	Discoverable(userID uint32) (bool, error)
+	// SetDiscoverable sets whether other users can find the user with SearchUsers.
+	SetDiscoverable(userID uint32, discoverable bool) error
+}
+
+// MessageRequestRepository holds the messages users send to people who are not their friends
+// until the recipient accepts or rejects them.
+type MessageRequestRepository interface {
+	// HoldMessage keeps a message for the recipient and returns how many the sender now has waiting,
+	// or ErrMessageRequestFull once MaxHeldMessages are. It returns ErrUserNotFound if the recipient
+	// does not exist or is waiting for approval.
+	HoldMessage(message HeldMessage) (int, error)
+	// MessageRequests returns the senders who have messages waiting for the recipient, latest first.
+	MessageRequests(recipientID uint32) ([]MessageRequest, error)
+	// AcceptMessageRequest makes the two users friends and hands back the sender's held messages, oldest first,
+	// removing them. It returns ErrMessageRequestNotFound if the sender has none waiting.
+	AcceptMessageRequest(recipientID, senderID uint32) ([]HeldMessage, error)
+	// RejectMessageRequest drops the sender's held messages and reports whether there were any.
+	RejectMessageRequest(recipientID, senderID uint32) (bool, error)
+}
+
+// ProfileRepository stores user profiles, which clients encrypt before uploading.
+type ProfileRepository interface {
+	// SaveProfile replaces the user's encrypted profile and returns when it was saved.
+	SaveProfile(userID uint32, ciphertext []byte) (time.Time, error)
+	// GetProfile returns the user's encrypted profile, or ErrProfileNotFound.
+	GetProfile(userID uint32) (*EncryptedProfile, error)
+}
+
+// InviteRepository stores invite codes, which make whoever redeems them a friend of the invite's creator.
+type InviteRepository interface {
+	// CreateInvite stores an invite that maxUses users can redeem until expiresAt.
+	CreateInvite(creatorID uint32, code string, maxUses int, expiresAt time.Time) (*Invite, error)
+	// RedeemInvite uses one use of an invite and makes userID a friend of its creator, whom it returns.
+	// It returns ErrInviteNotFound, ErrOwnInvite, ErrAlreadyFriends or ErrBlocked without using the invite.
+	RedeemInvite(code string, userID uint32) (*Friend, error)
+	// CreateUserWithInvite adds an account like CreateUser and redeems an invite for it, returning the new
+	// account's ID and the invite's creator. It adds neither if the username is taken or the invite can't be redeemed.
+	CreateUserWithInvite(username, passwordHash string, isBot bool, code string) (uint32, *Friend, error)
+}
+
+// PreKeyRepository stores the prekey bundles used to start encrypted sessions.
+type PreKeyRepository interface {
+	// SavePreKeyBundle stores a device's prekey bundle.
+	SavePreKeyBundle(bundle PreKeyBundle) error
+	// GetPreKeyBundle returns the bundle of one of the user's devices, or of their first device if deviceID is 0,
+	// or ErrPreKeyBundleNotFound.
+	GetPreKeyBundle(userID, deviceID uint32) (*PreKeyBundle, error)
+}
+
+// SQLRepository is the Repository backed by a MySQL or SQLite database.
+// Its queries are plain SQL that both understand; times are passed in rather than taken from NOW().
+type SQLRepository struct {
+	DB *sql.DB
+}
+
+var _ Repository = (*SQLRepository)(nil)
+
+// NewSQLRepository creates a Repository backed by db, which must be migrated with NewMigrator.
+func NewSQLRepository(db *sql.DB) *SQLRepository {
+	return &SQLRepository{DB: db}
+}
+
+// inTx runs fn in a transaction, committing it if fn succeeds and rolling it back otherwise.
+// SQLite transactions take the write lock when they begin (see OpenSQLite), so they never interleave.
+func (r *SQLRepository) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// forUpdate is appended to a SELECT whose result a transaction goes on to act on, so MySQL locks the rows
+// (and, for no rows, the gap they would be in) until it commits. SQLite needs no row locks.
+func (r *SQLRepository) forUpdate() string {
+	if isSQLite(r.DB) {
+		return ""
+	}
+	return " FOR UPDATE"
+}
+
+func (r *SQLRepository) GetUserByUsername(username string) (*User, error) {
+	var user User
+	err := r.DB.QueryRow(`
+		SELECT id, username, password_hash, is_bot, locked, pending, created_at
+		FROM users
+		WHERE username = ?`, username).Scan(&user.ID, &user.Username, &user.Password, &user.IsBot, &user.Locked, &user.Pending, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, username)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving user %s: %w", username, err)
+	}
+	return &user, nil
+}
+
+func (r *SQLRepository) CreateUser(username, passwordHash string, isBot bool) (uint32, error) {
+	var userID uint32
+	err := r.inTx(func(tx *sql.Tx) error {
+		var err error
+		userID, err = r.createUser(tx, username, passwordHash, isBot, false)
+		return err
+	})
+	return userID, err
+}
+
+func (r *SQLRepository) CreatePendingUser(username, passwordHash string, isBot bool) (uint32, error) {
+	var userID uint32
+	err := r.inTx(func(tx *sql.Tx) error {
+		var err error
+		userID, err = r.createUser(tx, username, passwordHash, isBot, true)
+		return err
+	})
+	return userID, err
+}
+
+// createUser adds an account, which can't log in while pending, and returns its ID, or ErrUsernameTaken.
+func (r *SQLRepository) createUser(tx *sql.Tx, username, passwordHash string, isBot, pending bool) (uint32, error) {
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)"+r.forUpdate(), username).Scan(&exists); err != nil {
+		return 0, fmt.Errorf("error checking user existence: %w", err)
+	}
+	if exists {
+		return 0, ErrUsernameTaken
+	}
+
+	result, err := tx.Exec("INSERT INTO users (username, password_hash, is_bot, pending, created_at) VALUES (?, ?, ?, ?, ?)",
+		username, passwordHash, isBot, pending, now())
+	if err != nil {
+		return 0, fmt.Errorf("error saving user to database: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving new user ID: %w", err)
+	}
+	return uint32(id), nil
+}
+
+func (r *SQLRepository) RecordLogin(userID uint32) error {
+	if _, err := r.DB.Exec("UPDATE users SET last_login_at = ? WHERE id = ?", now(), userID); err != nil {
+		return fmt.Errorf("error recording login for user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// IsRevoked reports whether the account is locked or its sessions were revoked after the token was issued.
+// A user that no longer exists counts as revoked.
+func (r *SQLRepository) IsRevoked(userID uint32, issuedAt time.Time) (bool, error) {
+	var revoked bool
+	err := r.DB.QueryRow(`
+		SELECT locked OR pending OR (sessions_revoked_at IS NOT NULL AND sessions_revoked_at > ?)
+		FROM users
+		WHERE id = ?`, issuedAt.UTC(), userID).Scan(&revoked)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error checking sessions of user %d: %w", userID, err)
+	}
+	return revoked, nil
+}
+
+func (r *SQLRepository) SendFriendRequest(requesterID, recipientID uint32, limits FriendRequestLimits) (bool, error) {
+	reopened := false
+	err := r.inTx(func(tx *sql.Tx) error {
+		// Lock the requester so their concurrent sends are counted one after another
+		var id uint32
+		if err := tx.QueryRow("SELECT id FROM users WHERE id = ?"+r.forUpdate(), requesterID).Scan(&id); err != nil {
+			return fmt.Errorf("error locking user %d: %w", requesterID, err)
+		}
+
+		blocked, err := isBlocked(tx, requesterID, recipientID)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return ErrBlocked
+		}
+
+		// Accepting a message request makes friends without a friend request
+		friends, err := areFriends(tx, requesterID, recipientID)
+		if err != nil {
+			return err
+		}
+		if friends {
+			return ErrAlreadyFriends
+		}
+
+		// Requests are unique per pair of users, whichever of them sent it
+		var requestID uint32
+		var status string
+		err = tx.QueryRow(`
+			SELECT id, status
+			FROM friend_requests
+			WHERE (requester_id = ? AND recipient_id = ?)
+			   OR (requester_id = ? AND recipient_id = ?)`+r.forUpdate(),
+			requesterID, recipientID, recipientID, requesterID).Scan(&requestID, &status)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("error checking existing friend request: %w", err)
+		}
+
+		exists := err == nil
+		switch {
+		case exists && status == StatusPendingStr:
+			return ErrFriendRequestPending
+		case exists && status == StatusAcceptedStr:
+			return ErrAlreadyFriends
+		}
+
+		sentAt := now()
+		pending, sent, err := friendRequestStats(tx, requesterID, sentAt.Add(-24*time.Hour))
+		if err != nil {
+			return err
+		}
+		if limits.MaxPending > 0 && pending >= limits.MaxPending {
+			return ErrTooManyPendingFriendRequests
+		}
+		if limits.MaxPerDay > 0 && sent >= limits.MaxPerDay {
+			return ErrFriendRequestDailyLimit
+		}
+
+		if !exists {
+			_, err = tx.Exec(`
+				INSERT INTO friend_requests (requester_id, recipient_id, status, created_at)
+				VALUES (?, ?, ?, ?)`,
+				requesterID, recipientID, StatusPendingStr, sentAt)
+			if err != nil {
+				return fmt.Errorf("error inserting friend request into database: %w", err)
+			}
+		} else {
+			// Reopen a declined, canceled or expired request as one from the new requester, whoever sent it before
+			_, err = tx.Exec(`
+				UPDATE friend_requests
+				SET requester_id = ?, recipient_id = ?, status = ?, created_at = ?, response_at = NULL
+				WHERE id = ?`,
+				requesterID, recipientID, StatusPendingStr, sentAt, requestID)
+			if err != nil {
+				return fmt.Errorf("error updating friend request to pending: %w", err)
+			}
+			reopened = true
+		}
+
+		// The request row is reused when it is sent again, so the log is what counts sends
+		_, err = tx.Exec(`
+			INSERT INTO friend_request_sends (requester_id, recipient_id, created_at) VALUES (?, ?, ?)`,
+			requesterID, recipientID, sentAt)
+		if err != nil {
+			return fmt.Errorf("error logging friend request: %w", err)
+		}
+		return nil
+	})
+	return reopened, err
+}
+
+func (r *SQLRepository) AcceptFriendRequest(requestID, recipientID uint32) (uint32, error) {
+	var requesterID uint32
+	err := r.inTx(func(tx *sql.Tx) error {
+		var err error
+		if requesterID, err = respondToFriendRequest(tx, requestID, recipientID, StatusAcceptedStr); err != nil {
+			return err
+		}
+		addedAt := now()
+		_, err = tx.Exec(`
+			INSERT INTO friends (user_id, friend_id, created_at) VALUES (?, ?, ?), (?, ?, ?)`,
+			recipientID, requesterID, addedAt, requesterID, recipientID, addedAt)
+		if err != nil {
+			return fmt.Errorf("error inserting into friends table: %w", err)
+		}
+		return nil
+	})
+	return requesterID, err
+}
+
+func (r *SQLRepository) DeclineFriendRequest(requestID, recipientID uint32) (uint32, error) {
+	var requesterID uint32
+	err := r.inTx(func(tx *sql.Tx) error {
+		var err error
+		requesterID, err = respondToFriendRequest(tx, requestID, recipientID, StatusDeclinedStr)
+		return err
+	})
+	return requesterID, err
+}
+
+func (r *SQLRepository) CancelFriendRequest(requestID, requesterID uint32) (uint32, error) {
+	var recipientID uint32
+	err := r.inTx(func(tx *sql.Tx) error {
+		err := tx.QueryRow(`
+			SELECT recipient_id
+			FROM friend_requests
+			WHERE id = ? AND requester_id = ? AND status = ?`+r.forUpdate(),
+			requestID, requesterID, StatusPendingStr).Scan(&recipientID)
+		if err == sql.ErrNoRows {
+			return ErrFriendRequestNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("error retrieving friend request: %w", err)
+		}
+
+		if _, err := tx.Exec(`UPDATE friend_requests SET status = ?, response_at = ? WHERE id = ?`,
+			StatusCancelledStr, now(), requestID); err != nil {
+			return fmt.Errorf("error canceling friend request: %w", err)
+		}
+		return nil
+	})
+	return recipientID, err
+}
+
+func (r *SQLRepository) FriendRequestStats(requesterID uint32, window time.Duration) (int, int, error) {
+	return friendRequestStats(r.DB, requesterID, now().Add(-window))
+}
+
+func (r *SQLRepository) ExpireFriendRequests(maxAge time.Duration) (int64, error) {
+	at := now()
+	res, err := r.DB.Exec(`UPDATE friend_requests SET status = ?, response_at = ? WHERE status = ? AND created_at < ?`,
+		StatusExpiredStr, at, StatusPendingStr, at.Add(-maxAge))
+	if err != nil {
+		return 0, fmt.Errorf("error expiring friend requests: %w", err)
+	}
+	if _, err := r.DB.Exec(`DELETE FROM friend_request_sends WHERE created_at < ?`, at.Add(-maxAge)); err != nil {
+		return 0, fmt.Errorf("error deleting old friend request sends: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// friendRequestStats returns how many of the requests requesterID sent are pending, and how many sends of
+// theirs are logged since the given time.
+func friendRequestStats(q queryRower, requesterID uint32, since time.Time) (int, int, error) {
+	var pending, sent int
+	err := q.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM friend_requests WHERE requester_id = ? AND status = ?),
+		       (SELECT COUNT(*) FROM friend_request_sends WHERE requester_id = ? AND created_at >= ?)`,
+		requesterID, StatusPendingStr, requesterID, since).Scan(&pending, &sent)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error counting friend requests of user %d: %w", requesterID, err)
+	}
+	return pending, sent, nil
+}
+
+// respondToFriendRequest moves a pending request sent to recipientID to status and returns the requester's ID,
+// or ErrFriendRequestNotFound.
+func respondToFriendRequest(tx *sql.Tx, requestID, recipientID uint32, status string) (uint32, error) {
+	res, err := tx.Exec(`UPDATE friend_requests SET status = ?, response_at = ? WHERE id = ? AND recipient_id = ? AND status = ?`,
+		status, now(), requestID, recipientID, StatusPendingStr)
+	if err != nil {
+		return 0, fmt.Errorf("error updating friend request status to %s: %w", status, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking affected rows: %w", err)
+	}
+	if rowsAffected != 1 {
+		return 0, ErrFriendRequestNotFound
+	}
+
+	var requesterID uint32
+	if err := tx.QueryRow(`SELECT requester_id FROM friend_requests WHERE id = ?`, requestID).Scan(&requesterID); err != nil {
+		return 0, fmt.Errorf("error retrieving requester ID: %w", err)
+	}
+	return requesterID, nil
+}
+
+func (r *SQLRepository) RemoveFriend(userID, friendID uint32) (bool, error) {
+	removed := false
+	err := r.inTx(func(tx *sql.Tx) error {
+		var err error
+		if removed, err = removeFriendship(tx, userID, friendID); err != nil || !removed {
+			return err
+		}
+		return cancelFriendRequests(tx, userID, friendID)
+	})
+	return removed, err
+}
+
+// removeFriendship deletes the friendship between two users in both directions and reports whether there was one.
+func removeFriendship(tx *sql.Tx, userID, friendID uint32) (bool, error) {
+	res, err := tx.Exec(`DELETE FROM friends WHERE (user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)`,
+		userID, friendID, friendID, userID)
+	if err != nil {
+		return false, fmt.Errorf("error removing friend from friends table: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking affected rows: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+// cancelFriendRequests cancels the request between two users, whichever of them sent it.
+func cancelFriendRequests(tx *sql.Tx, userID, otherID uint32) error {
+	_, err := tx.Exec(`UPDATE friend_requests SET status = ? WHERE (requester_id = ? AND recipient_id = ?) OR (requester_id = ? AND recipient_id = ?)`,
+		StatusCancelledStr, userID, otherID, otherID, userID)
+	if err != nil {
+		return fmt.Errorf("error updating friend request status to cancelled: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLRepository) IncomingFriendRequests(userID uint32) ([]FriendRequest, error) {
+	return r.pendingFriendRequests("fr.recipient_id = ?", userID)
+}
+
+func (r *SQLRepository) OutgoingFriendRequests(userID uint32) ([]FriendRequest, error) {
+	return r.pendingFriendRequests("fr.requester_id = ?", userID)
+}
+
+// pendingFriendRequests returns the pending requests matching condition, including both usernames.
+func (r *SQLRepository) pendingFriendRequests(condition string, userID uint32) ([]FriendRequest, error) {
+	rows, err := r.DB.Query(`
+        SELECT fr.id, fr.requester_id, fr.recipient_id, fr.status, fr.created_at,
+               u_sender.username AS sender_username,
+               u_recipient.username AS recipient_username
+        FROM friend_requests fr
+        JOIN users u_sender ON fr.requester_id = u_sender.id
+        JOIN users u_recipient ON fr.recipient_id = u_recipient.id
+        WHERE `+condition+` AND fr.status = ?`, userID, StatusPendingStr)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching friend requests: %w", err)
+	}
+	defer rows.Close()
+
+	var requests []FriendRequest
+	for rows.Next() {
+		var request FriendRequest
+		if err := rows.Scan(
+			&request.ID,
+			&request.RequesterID,
+			&request.RecipientID,
+			&request.Status,
+			&request.CreatedAt,
+			&request.RequesterUsername,
+			&request.RecipientUsername,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning friend request row: %w", err)
+		}
+		requests = append(requests, request)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over friend requests: %w", err)
+	}
+	return requests, nil
+}
+
+func (r *SQLRepository) ListFriends(userID uint32) ([]Friend, error) {
+	rows, err := r.DB.Query(`
+        SELECT f.friend_id, u.username, u.is_bot, f.created_at, f.last_activity_at
+        FROM friends f
+        JOIN users u ON f.friend_id = u.id
+        WHERE f.user_id = ?`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching friend list: %w", err)
+	}
+	return scanFriends(rows)
+}
+
+func (r *SQLRepository) ListFriendsPage(userID uint32, order FriendOrder, after *Friend, limit int) ([]Friend, error) {
+	// The page starts after the key of the last friend on the previous one, so the database only
+	// has to read as far as this page goes
+	var keyset, orderBy string
+	args := []interface{}{userID}
+	switch order {
+	case FriendsByName:
+		orderBy = "LOWER(u.username), f.friend_id"
+		if after != nil {
+			keyset = "AND (LOWER(u.username), f.friend_id) > (LOWER(?), ?)"
+			args = append(args, after.Username, after.UserID)
+		}
+	default:
+		// Times sort newest first and IDs lowest first, so the key can't be compared as one tuple.
+		// Times are stored in UTC, and SQLite compares them as text, so compare in UTC too.
+		orderBy = "f.last_activity_at IS NULL, f.last_activity_at DESC, f.created_at DESC, f.friend_id"
+		switch {
+		case after == nil:
+		case after.LastActivityAt != nil:
+			lastActivityAt, addedAt := after.LastActivityAt.UTC(), after.AddedAt.UTC()
+			keyset = `AND (f.last_activity_at IS NULL OR f.last_activity_at < ?
+				OR (f.last_activity_at = ? AND (f.created_at < ? OR (f.created_at = ? AND f.friend_id > ?))))`
+			args = append(args, lastActivityAt, lastActivityAt, addedAt, addedAt, after.UserID)
+		default:
+			addedAt := after.AddedAt.UTC()
+			keyset = "AND f.last_activity_at IS NULL AND (f.created_at < ? OR (f.created_at = ? AND f.friend_id > ?))"
+			args = append(args, addedAt, addedAt, after.UserID)
+		}
+	}
+	args = append(args, limit)
+
+	rows, err := r.DB.Query(`
+        SELECT f.friend_id, u.username, u.is_bot, f.created_at, f.last_activity_at
+        FROM friends f
+        JOIN users u ON f.friend_id = u.id
+        WHERE f.user_id = ? `+keyset+`
+        ORDER BY `+orderBy+`
+        LIMIT ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching friend list: %w", err)
+	}
+	return scanFriends(rows)
+}
+
+// scanFriends reads and closes rows of friend ID, username, is_bot, created_at and last_activity_at.
+func scanFriends(rows *sql.Rows) ([]Friend, error) {
+	defer rows.Close()
+
+	var friends []Friend
+	for rows.Next() {
+		var friend Friend
+		var lastActivity sql.NullTime
+		if err := rows.Scan(&friend.UserID, &friend.Username, &friend.IsBot, &friend.AddedAt, &lastActivity); err != nil {
+			return nil, fmt.Errorf("error scanning friend row: %w", err)
+		}
+		if lastActivity.Valid {
+			friend.LastActivityAt = &lastActivity.Time
+		}
+		friends = append(friends, friend)
+	}
+	return friends, rows.Err()
+}
+
+func (r *SQLRepository) RecordFriendActivity(userID, friendID uint32) error {
+	at := now()
+	_, err := r.DB.Exec(`
+        UPDATE friends SET last_activity_at = ?
+        WHERE ((user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?))
+          AND (last_activity_at IS NULL OR last_activity_at < ?)`,
+		at, userID, friendID, friendID, userID, at.Add(-ActivityResolution))
+	if err != nil {
+		return fmt.Errorf("error recording activity of users %d and %d: %w", userID, friendID, err)
+	}
+	return nil
+}
+
+func (r *SQLRepository) AreFriends(userID, otherID uint32) (bool, error) {
+	return areFriends(r.DB, userID, otherID)
+}
+
+// areFriends reports whether two users are friends.
+func areFriends(q queryRower, userID, otherID uint32) (bool, error) {
+	var friends bool
+	err := q.QueryRow("SELECT EXISTS(SELECT 1 FROM friends WHERE user_id = ? AND friend_id = ?)", userID, otherID).Scan(&friends)
+	if err != nil {
+		return false, fmt.Errorf("error checking friendship of users %d and %d: %w", userID, otherID, err)
+	}
+	return friends, nil
+}
+
+func (r *SQLRepository) BlockUser(userID, blockedID uint32) (bool, error) {
+	wasFriend := false
+	err := r.inTx(func(tx *sql.Tx) error {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", blockedID).Scan(&exists); err != nil {
+			return fmt.Errorf("error checking user existence: %w", err)
+		}
+		if !exists {
+			return fmt.Errorf("%w: %d", ErrUserNotFound, blockedID)
+		}
+
+		var blocked bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM blocked_users WHERE user_id = ? AND blocked_id = ?)"+r.forUpdate(),
+			userID, blockedID).Scan(&blocked); err != nil {
+			return fmt.Errorf("error checking existing block: %w", err)
+		}
+		if !blocked {
+			if _, err := tx.Exec("INSERT INTO blocked_users (user_id, blocked_id, created_at) VALUES (?, ?, ?)",
+				userID, blockedID, now()); err != nil {
+				return fmt.Errorf("error inserting into blocked_users table: %w", err)
+			}
+		}
+
+		var err error
+		if wasFriend, err = removeFriendship(tx, userID, blockedID); err != nil {
+			return err
+		}
+		if err := cancelFriendRequests(tx, userID, blockedID); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM message_requests WHERE (sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?)`,
+			userID, blockedID, blockedID, userID)
+		if err != nil {
+			return fmt.Errorf("error dropping held messages: %w", err)
+		}
+		return nil
+	})
+	return wasFriend, err
+}
+
+func (r *SQLRepository) UnblockUser(userID, blockedID uint32) (bool, error) {
+	res, err := r.DB.Exec("DELETE FROM blocked_users WHERE user_id = ? AND blocked_id = ?", userID, blockedID)
+	if err != nil {
+		return false, fmt.Errorf("error removing block: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking affected rows: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+func (r *SQLRepository) ListBlockedUsers(userID uint32) ([]BlockedUser, error) {
+	rows, err := r.DB.Query(`
+        SELECT b.blocked_id, u.username, b.created_at
+        FROM blocked_users b
+        JOIN users u ON b.blocked_id = u.id
+        WHERE b.user_id = ?
+        ORDER BY b.created_at, b.blocked_id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching blocked users: %w", err)
+	}
+	defer rows.Close()
+
+	var blocked []BlockedUser
+	for rows.Next() {
+		var user BlockedUser
+		if err := rows.Scan(&user.UserID, &user.Username, &user.BlockedAt); err != nil {
+			return nil, fmt.Errorf("error scanning blocked user row: %w", err)
+		}
+		blocked = append(blocked, user)
+	}
+	return blocked, rows.Err()
+}
+
+func (r *SQLRepository) IsBlocked(userID, otherID uint32) (bool, error) {
+	return isBlocked(r.DB, userID, otherID)
+}
+
+func (r *SQLRepository) SearchUsers(searcherID uint32, query string, offset, limit int) ([]UserSearchResult, bool, error) {
+	query = strings.ToLower(query)
+	escaped := escapeLike(query)
+	var fuzzy strings.Builder
+	fuzzy.WriteString("%")
+	for _, c := range query {
+		fuzzy.WriteString(escapeLike(string(c)))
+		fuzzy.WriteString("%")
+	}
+
+	// One extra row tells whether there is another page
+	rows, err := r.DB.Query(`
+		SELECT u.id, u.username, u.is_bot,
+			EXISTS(SELECT 1 FROM friends f WHERE f.user_id = ? AND f.friend_id = u.id) AS is_friend,
+			EXISTS(
+				SELECT 1 FROM friend_requests fr
+				WHERE fr.status = ?
+				AND ((fr.requester_id = ? AND fr.recipient_id = u.id) OR (fr.requester_id = u.id AND fr.recipient_id = ?)))
+		FROM users u
+		WHERE u.id <> ? AND NOT u.locked AND NOT u.pending
+		AND LOWER(u.username) LIKE ? ESCAPE '!'
+		AND (u.discoverable OR EXISTS(SELECT 1 FROM friends f WHERE f.user_id = ? AND f.friend_id = u.id))
+		AND NOT EXISTS(
+			SELECT 1 FROM blocked_users b
+			WHERE (b.user_id = ? AND b.blocked_id = u.id) OR (b.user_id = u.id AND b.blocked_id = ?))
+		ORDER BY
+			CASE
+				WHEN LOWER(u.username) = ? THEN 0
+				WHEN LOWER(u.username) LIKE ? ESCAPE '!' THEN 1
+				WHEN LOWER(u.username) LIKE ? ESCAPE '!' THEN 2
+				ELSE 3
+			END,
+			LENGTH(u.username), u.username
+		LIMIT ? OFFSET ?`,
+		searcherID, StatusPendingStr, searcherID, searcherID,
+		searcherID, fuzzy.String(), searcherID, searcherID, searcherID,
+		query, escaped+"%", "%"+escaped+"%",
+		limit+1, offset)
+	if err != nil {
+		return nil, false, fmt.Errorf("error searching users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []UserSearchResult
+	for rows.Next() {
+		var user UserSearchResult
+		if err := rows.Scan(&user.UserID, &user.Username, &user.IsBot, &user.IsFriend, &user.RequestPending); err != nil {
+			return nil, false, fmt.Errorf("error scanning user search row: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("error searching users: %w", err)
+	}
+	if len(users) > limit {
+		return users[:limit], true, nil
+	}
+	return users, false, nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, using '!' as the escape character
+// because a backslash means different things in MySQL and SQLite string literals.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+func (r *SQLRepository) Discoverable(userID uint32) (bool, error) {
+	var discoverable bool
+	err := r.DB.QueryRow("SELECT discoverable FROM users WHERE id = ?", userID).Scan(&discoverable)
+	if err == sql.ErrNoRows {
+		return false, fmt.Errorf("%w: %d", ErrUserNotFound, userID)
+	}
+	if err != nil {
+		return false, fmt.Errorf("error retrieving discoverability of user %d: %w", userID, err)
+	}
+	return discoverable, nil
+}
+
+func (r *SQLRepository) SetDiscoverable(userID uint32, discoverable bool) error {
+	if _, err := r.DB.Exec("UPDATE users SET discoverable = ? WHERE id = ?", discoverable, userID); err != nil {
+		return fmt.Errorf("error updating discoverability of user %d: %w", userID, err)
+	}
+	return nil
+}
+
+func (r *SQLRepository) SaveProfile(userID uint32, ciphertext []byte) (time.Time, error) {
+	updatedAt := now()
+	err := r.inTx(func(tx *sql.Tx) error {
+		// Delete and insert rather than upsert, whose syntax differs between MySQL and SQLite
+		if _, err := tx.Exec("DELETE FROM profiles WHERE user_id = ?", userID); err != nil {
+			return fmt.Errorf("error replacing profile of user %d: %w", userID, err)
+		}
+		if _, err := tx.Exec("INSERT INTO profiles (user_id, ciphertext, updated_at) VALUES (?, ?, ?)", userID, ciphertext, updatedAt); err != nil {
+			return fmt.Errorf("error saving profile of user %d: %w", userID, err)
+		}
+		return nil
+	})
+	return updatedAt, err
+}
+
+func (r *SQLRepository) GetProfile(userID uint32) (*EncryptedProfile, error) {
+	profile := EncryptedProfile{UserID: userID}
+	err := r.DB.QueryRow("SELECT ciphertext, updated_at FROM profiles WHERE user_id = ?", userID).Scan(&profile.Ciphertext, &profile.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: user %d", ErrProfileNotFound, userID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving profile of user %d: %w", userID, err)
+	}
+	return &profile, nil
+}
+
+// queryRower is the part of *sql.DB and *sql.Tx that isBlocked needs.
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// isBlocked reports whether either user has blocked the other.
+func isBlocked(q queryRower, userID, otherID uint32) (bool, error) {
+	var blocked bool
+	err := q.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM blocked_users
+			WHERE (user_id = ? AND blocked_id = ?) OR (user_id = ? AND blocked_id = ?))`,
+		userID, otherID, otherID, userID).Scan(&blocked)
+	if err != nil {
+		return false, fmt.Errorf("error checking blocks between users %d and %d: %w", userID, otherID, err)
+	}
+	return blocked, nil
+}
+
+func (r *SQLRepository) HoldMessage(message HeldMessage) (int, error) {
+	var held int
+	err := r.inTx(func(tx *sql.Tx) error {
+		// Accounts waiting for approval can't be messaged until they are approved
+		var pending bool
+		err := tx.QueryRow("SELECT pending FROM users WHERE id = ?", message.RecipientID).Scan(&pending)
+		if err == sql.ErrNoRows || (err == nil && pending) {
+			return fmt.Errorf("%w: %d", ErrUserNotFound, message.RecipientID)
+		}
+		if err != nil {
+			return fmt.Errorf("error retrieving recipient %d: %w", message.RecipientID, err)
+		}
+
+		// Lock the sender's held messages, so two at once can't both take the last place
+		rows, err := tx.Query("SELECT id FROM message_requests WHERE recipient_id = ? AND sender_id = ?"+r.forUpdate(),
+			message.RecipientID, message.SenderID)
+		if err != nil {
+			return fmt.Errorf("error counting held messages: %w", err)
+		}
+		for rows.Next() {
+			held++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error counting held messages: %w", err)
+		}
+		if held >= MaxHeldMessages {
+			return ErrMessageRequestFull
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO message_requests (sender_id, recipient_id, message_id, payload, created_at)
+			VALUES (?, ?, ?, ?, ?)`,
+			message.SenderID, message.RecipientID, message.MessageID, message.Payload, now())
+		if err != nil {
+			return fmt.Errorf("error holding message: %w", err)
+		}
+		held++
+		return nil
+	})
+	return held, err
+}
+
+func (r *SQLRepository) MessageRequests(recipientID uint32) ([]MessageRequest, error) {
+	// Summarize in Go: SQLite returns MAX() of a timestamp as text, which does not scan into a time.Time
+	rows, err := r.DB.Query(`
+        SELECT m.sender_id, u.username, m.created_at
+        FROM message_requests m
+        JOIN users u ON m.sender_id = u.id
+        WHERE m.recipient_id = ?
+        ORDER BY m.id`, recipientID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching message requests: %w", err)
+	}
+	defer rows.Close()
+
+	var requests []MessageRequest
+	bySender := make(map[uint32]int)
+	for rows.Next() {
+		var senderID uint32
+		var username string
+		var createdAt time.Time
+		if err := rows.Scan(&senderID, &username, &createdAt); err != nil {
+			return nil, fmt.Errorf("error scanning message request row: %w", err)
+		}
+		i, ok := bySender[senderID]
+		if !ok {
+			i = len(requests)
+			bySender[senderID] = i
+			requests = append(requests, MessageRequest{SenderID: senderID, SenderUsername: username})
+		}
+		requests[i].Messages++
+		requests[i].LastReceivedAt = createdAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over message requests: %w", err)
+	}
+
+	sort.SliceStable(requests, func(i, j int) bool { return requests[i].LastReceivedAt.After(requests[j].LastReceivedAt) })
+	return requests, nil
+}
+
+func (r *SQLRepository) AcceptMessageRequest(recipientID, senderID uint32) ([]HeldMessage, error) {
+	var messages []HeldMessage
+	err := r.inTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(`
+			SELECT id, sender_id, recipient_id, message_id, payload, created_at
+			FROM message_requests
+			WHERE recipient_id = ? AND sender_id = ?
+			ORDER BY id`+r.forUpdate(), recipientID, senderID)
+		if err != nil {
+			return fmt.Errorf("error fetching held messages: %w", err)
+		}
+		for rows.Next() {
+			var message HeldMessage
+			if err := rows.Scan(&message.ID, &message.SenderID, &message.RecipientID, &message.MessageID, &message.Payload, &message.CreatedAt); err != nil {
+				rows.Close()
+				return fmt.Errorf("error scanning held message row: %w", err)
+			}
+			messages = append(messages, message)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating over held messages: %w", err)
+		}
+		if len(messages) == 0 {
+			return ErrMessageRequestNotFound
+		}
+
+		if _, err := tx.Exec("DELETE FROM message_requests WHERE recipient_id = ? AND sender_id = ?", recipientID, senderID); err != nil {
+			return fmt.Errorf("error removing held messages: %w", err)
+		}
+		return addFriendship(tx, recipientID, senderID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// addFriendship makes two users friends unless they already are. A friend request between them is marked
+// accepted, so it can't be answered again.
+func addFriendship(tx *sql.Tx, userID, friendID uint32) error {
+	friends, err := areFriends(tx, userID, friendID)
+	if err != nil || friends {
+		return err
+	}
+
+	addedAt := now()
+	_, err = tx.Exec(`
+		INSERT INTO friends (user_id, friend_id, created_at) VALUES (?, ?, ?), (?, ?, ?)`,
+		userID, friendID, addedAt, friendID, userID, addedAt)
+	if err != nil {
+		return fmt.Errorf("error inserting into friends table: %w", err)
+	}
+	_, err = tx.Exec(`UPDATE friend_requests SET status = ?, response_at = ? WHERE (requester_id = ? AND recipient_id = ?) OR (requester_id = ? AND recipient_id = ?)`,
+		StatusAcceptedStr, addedAt, userID, friendID, friendID, userID)
+	if err != nil {
+		return fmt.Errorf("error updating friend request status to accepted: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLRepository) RejectMessageRequest(recipientID, senderID uint32) (bool, error) {
+	res, err := r.DB.Exec("DELETE FROM message_requests WHERE recipient_id = ? AND sender_id = ?", recipientID, senderID)
+	if err != nil {
+		return false, fmt.Errorf("error dropping held messages: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking affected rows: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+func (r *SQLRepository) SavePreKeyBundle(bundle PreKeyBundle) error {
+	_, err := r.DB.Exec(`
+        INSERT INTO prekey_bundle (user_id, registration_id, device_id, identity_key, pre_key_id, pre_key, signed_pre_key_id, signed_pre_key, signed_pre_key_signature)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		bundle.UserID,
+		bundle.RegistrationID,
+		bundle.DeviceID,
+		bundle.IdentityKey,
+		bundle.PreKeyID,
+		bundle.PreKey,
+		bundle.SignedPreKeyID,
+		bundle.SignedPreKey,
+		bundle.SignedPreKeySignature)
+	if err != nil {
+		return fmt.Errorf("failed to insert prekey bundle: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLRepository) GetPreKeyBundle(userID, deviceID uint32) (*PreKeyBundle, error) {
+	query := `SELECT user_id, registration_id, device_id, identity_key, pre_key_id, pre_key, signed_pre_key_id, signed_pre_key, signed_pre_key_signature
+              FROM prekey_bundle WHERE user_id = ?`
+	args := []interface{}{userID}
+	if deviceID == 0 {
+		// Without a device ID, use the user's first device
+		query += " LIMIT 1"
+	} else {
+		query += " AND device_id = ?"
+		args = append(args, deviceID)
+	}
+
+	var bundle PreKeyBundle
+	err := r.DB.QueryRow(query, args...).Scan(&bundle.UserID, &bundle.RegistrationID, &bundle.DeviceID, &bundle.IdentityKey,
+		&bundle.PreKeyID, &bundle.PreKey, &bundle.SignedPreKeyID, &bundle.SignedPreKey, &bundle.SignedPreKeySignature)
+	if err == sql.ErrNoRows {
+		return nil, ErrPreKeyBundleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch prekey bundle: %w", err)
+	}
+	return &bundle, nil
+}
+
+func (r *SQLRepository) CreateInvite(creatorID uint32, code string, maxUses int, expiresAt time.Time) (*Invite, error) {
+	invite := &Invite{Code: code, CreatorID: creatorID, MaxUses: maxUses, ExpiresAt: expiresAt, CreatedAt: now()}
+	result, err := r.DB.Exec("INSERT INTO invites (code, creator_id, max_uses, expires_at, created_at) VALUES (?, ?, ?, ?, ?)",
+		code, creatorID, maxUses, expiresAt, invite.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error saving invite: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving new invite ID: %w", err)
+	}
+	invite.ID = uint32(id)
+	return invite, nil
+}
+
+func (r *SQLRepository) RedeemInvite(code string, userID uint32) (*Friend, error) {
+	var creator *Friend
+	err := r.inTx(func(tx *sql.Tx) error {
+		var err error
+		creator, err = r.redeemInvite(tx, code, userID)
+		return err
+	})
+	return creator, err
+}
+
+func (r *SQLRepository) CreateUserWithInvite(username, passwordHash string, isBot bool, code string) (uint32, *Friend, error) {
+	var userID uint32
+	var creator *Friend
+	err := r.inTx(func(tx *sql.Tx) error {
+		var err error
+		if userID, err = r.createUser(tx, username, passwordHash, isBot, false); err != nil {
+			return err
+		}
+		creator, err = r.redeemInvite(tx, code, userID)
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return userID, creator, nil
+}
+
+// redeemInvite uses one use of an invite and makes userID a friend of its creator, whom it returns.
+func (r *SQLRepository) redeemInvite(tx *sql.Tx, code string, userID uint32) (*Friend, error) {
+	var inviteID uint32
+	var creator Friend
+	err := tx.QueryRow(`
+		SELECT i.id, u.id, u.username, u.is_bot
+		FROM invites i
+		JOIN users u ON u.id = i.creator_id AND NOT u.locked AND NOT u.pending
+		WHERE i.code = ? AND i.uses < i.max_uses AND i.expires_at > ?`+r.forUpdate(),
+		code, now()).Scan(&inviteID, &creator.UserID, &creator.Username, &creator.IsBot)
+	if err == sql.ErrNoRows {
+		return nil, ErrInviteNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving invite: %w", err)
+	}
+	if creator.UserID == userID {
+		return nil, ErrOwnInvite
+	}
+
+	blocked, err := isBlocked(tx, userID, creator.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrBlocked
+	}
+	friends, err := areFriends(tx, userID, creator.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if friends {
+		return nil, ErrAlreadyFriends
+	}
+
+	if _, err := tx.Exec("UPDATE invites SET uses = uses + 1 WHERE id = ?", inviteID); err != nil {
+		return nil, fmt.Errorf("error using invite: %w", err)
+	}
+	if err := addFriendship(tx, userID, creator.UserID); err != nil {
+		return nil, err
+	}
+	creator.AddedAt = now()
+	return &creator, nil
+}
@@ -0,0 +1,723 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestRepository returns a repository on a migrated SQLite database in a temporary directory.
+func newTestRepository(t *testing.T) *SQLRepository {
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "server.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Failed to apply migrations: %v", err)
+	}
+	return NewSQLRepository(db)
+}
+
+func TestSQLRepositoryUsers(t *testing.T) {
+	repo := newTestRepository(t)
+
+	id, err := repo.CreateUser("alice", "hash", true)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	user, err := repo.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if user.ID != id || user.Password != "hash" || !user.IsBot || user.Locked {
+		t.Fatalf("Unexpected user: %+v", user)
+	}
+	if _, err := repo.CreateUser("alice", "other", false); !errors.Is(err, ErrUsernameTaken) {
+		t.Fatalf("Expected ErrUsernameTaken, got: %v", err)
+	}
+	if _, err := repo.GetUserByUsername("bob"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("Expected ErrUserNotFound, got: %v", err)
+	}
+
+	issuedAt := time.Now().Add(-time.Minute)
+	if revoked, err := repo.IsRevoked(id, issuedAt); err != nil || revoked {
+		t.Fatalf("Expected a fresh token not to be revoked, got %t (err: %v)", revoked, err)
+	}
+	if err := NewAccountStore(repo.DB).RevokeSessions("alice"); err != nil {
+		t.Fatalf("Failed to revoke sessions: %v", err)
+	}
+	if revoked, err := repo.IsRevoked(id, issuedAt); err != nil || !revoked {
+		t.Fatalf("Expected a token issued before the revocation to be revoked, got %t (err: %v)", revoked, err)
+	}
+	if revoked, err := repo.IsRevoked(id, time.Now().Add(time.Minute)); err != nil || revoked {
+		t.Fatalf("Expected a token issued after the revocation to be valid, got %t (err: %v)", revoked, err)
+	}
+	if userIDs, err := NewAccountStore(repo.DB).SessionsRevokedSince(issuedAt); err != nil || len(userIDs) != 1 || userIDs[0] != id {
+		t.Fatalf("Expected alice's sessions to be listed as revoked, got %v (err: %v)", userIDs, err)
+	}
+	if userIDs, err := NewAccountStore(repo.DB).SessionsRevokedSince(time.Now().Add(time.Minute)); err != nil || len(userIDs) != 0 {
+		t.Fatalf("Expected no sessions revoked after the revocation, got %v (err: %v)", userIDs, err)
+	}
+}
+
+func TestSQLRepositoryPendingUsers(t *testing.T) {
+	repo := newTestRepository(t)
+	accounts := NewAccountStore(repo.DB)
+	repo.CreateUser("alice", "hash", false)
+	bob, err := repo.CreatePendingUser("bob", "hash", false)
+	if err != nil {
+		t.Fatalf("Failed to create pending user: %v", err)
+	}
+	carol, _ := repo.CreatePendingUser("carol", "hash", false)
+
+	if user, _ := repo.GetUserByUsername("bob"); !user.Pending {
+		t.Fatalf("Expected bob to be pending, got %+v", user)
+	}
+	if revoked, err := repo.IsRevoked(bob, time.Now()); err != nil || !revoked {
+		t.Fatalf("Expected a pending account's tokens to be rejected, got %t (err: %v)", revoked, err)
+	}
+	alice, _ := repo.GetUserByUsername("alice")
+	if found, _, err := repo.SearchUsers(alice.ID, "bob", 0, 10); err != nil || len(found) != 0 {
+		t.Fatalf("Expected pending accounts to be left out of searches, got %+v (err: %v)", found, err)
+	}
+	if _, err := repo.HoldMessage(HeldMessage{SenderID: alice.ID, RecipientID: bob, MessageID: "m1", Payload: []byte("hi")}); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("Expected messages to a pending account to be refused, got %v", err)
+	}
+	pending, err := accounts.PendingUsers()
+	if err != nil || len(pending) != 2 || pending[0].Username != "bob" || pending[1].Username != "carol" {
+		t.Fatalf("Expected bob and carol to be pending, got %+v (err: %v)", pending, err)
+	}
+
+	if err := accounts.ApproveUser("bob"); err != nil {
+		t.Fatalf("Failed to approve bob: %v", err)
+	}
+	if user, _ := repo.GetUserByUsername("bob"); user.Pending {
+		t.Fatalf("Expected bob to be approved, got %+v", user)
+	}
+	if found, _, err := repo.SearchUsers(alice.ID, "bob", 0, 10); err != nil || len(found) != 1 {
+		t.Fatalf("Expected bob to show up in searches once approved, got %+v (err: %v)", found, err)
+	}
+	if _, err := repo.CreateInvite(carol, "CAROL123", 1, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to create invite: %v", err)
+	}
+	if _, err := repo.RedeemInvite("CAROL123", alice.ID); !errors.Is(err, ErrInviteNotFound) {
+		t.Fatalf("Expected the invite of a pending account not to be redeemable, got %v", err)
+	}
+	if err := accounts.RejectUser("carol"); err != nil {
+		t.Fatalf("Failed to reject carol: %v", err)
+	}
+	if _, err := repo.GetUserByUsername("carol"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("Expected the rejected account to be deleted, got %v", err)
+	}
+
+	// Only pending accounts can be approved or rejected
+	if err := accounts.RejectUser("alice"); !errors.Is(err, ErrUserNotPending) {
+		t.Fatalf("Expected ErrUserNotPending, got %v", err)
+	}
+	if err := accounts.ApproveUser("dave"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("Expected ErrUserNotFound, got %v", err)
+	}
+	if pending, _ := accounts.PendingUsers(); len(pending) != 0 {
+		t.Fatalf("Expected no pending accounts left, got %+v", pending)
+	}
+}
+
+func TestSQLRepositoryRejectUserWithFriendRequest(t *testing.T) {
+	repo := newTestRepository(t)
+	accounts := NewAccountStore(repo.DB)
+	alice, _ := repo.CreateUser("alice", "hash", false)
+	bob, _ := repo.CreatePendingUser("bob", "hash", false)
+
+	// A request sent to bob before he registered through the approval queue still refers to his account
+	if _, err := repo.SendFriendRequest(alice, bob, FriendRequestLimits{}); err != nil {
+		t.Fatalf("Failed to send friend request: %v", err)
+	}
+	bundle := PreKeyBundle{
+		UserID:                bob,
+		IdentityKey:           []byte("identity"),
+		PreKey:                []byte("prekey"),
+		SignedPreKey:          []byte("signed"),
+		SignedPreKeySignature: []byte("signature"),
+	}
+	if err := repo.SavePreKeyBundle(bundle); err != nil {
+		t.Fatalf("Failed to save bundle: %v", err)
+	}
+
+	if err := accounts.RejectUser("bob"); err != nil {
+		t.Fatalf("Failed to reject bob: %v", err)
+	}
+	if _, err := repo.GetUserByUsername("bob"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("Expected the rejected account to be deleted, got %v", err)
+	}
+	if requests, err := repo.OutgoingFriendRequests(alice); err != nil || len(requests) != 0 {
+		t.Fatalf("Expected the request to bob to be deleted with him, got %+v (err: %v)", requests, err)
+	}
+	if pending, sent, err := repo.FriendRequestStats(alice, 24*time.Hour); err != nil || pending != 0 || sent != 0 {
+		t.Fatalf("Expected no requests counted against alice, got %d pending and %d sent (err: %v)", pending, sent, err)
+	}
+
+	// The username is free again
+	if _, err := repo.CreateUser("bob", "hash", false); err != nil {
+		t.Fatalf("Failed to register the rejected username again: %v", err)
+	}
+}
+
+func TestSQLRepositoryFriends(t *testing.T) {
+	repo := newTestRepository(t)
+	alice, _ := repo.CreateUser("alice", "hash", false)
+	bob, _ := repo.CreateUser("bob", "hash", false)
+
+	if reopened, err := repo.SendFriendRequest(alice, bob, FriendRequestLimits{}); err != nil || reopened {
+		t.Fatalf("Failed to send friend request: %t (err: %v)", reopened, err)
+	}
+	if _, err := repo.SendFriendRequest(bob, alice, FriendRequestLimits{}); !errors.Is(err, ErrFriendRequestPending) {
+		t.Fatalf("Expected a pending request in either direction to block another, got: %v", err)
+	}
+
+	incoming, err := repo.IncomingFriendRequests(bob)
+	if err != nil || len(incoming) != 1 {
+		t.Fatalf("Expected one incoming request, got %v (err: %v)", incoming, err)
+	}
+	if incoming[0].RequesterUsername != "alice" || incoming[0].RecipientUsername != "bob" {
+		t.Fatalf("Unexpected request: %+v", incoming[0])
+	}
+	if outgoing, err := repo.OutgoingFriendRequests(alice); err != nil || len(outgoing) != 1 {
+		t.Fatalf("Expected one outgoing request, got %v (err: %v)", outgoing, err)
+	}
+
+	if _, err := repo.AcceptFriendRequest(incoming[0].ID, alice); !errors.Is(err, ErrFriendRequestNotFound) {
+		t.Fatalf("Expected only the recipient to respond, got: %v", err)
+	}
+	requesterID, err := repo.AcceptFriendRequest(incoming[0].ID, bob)
+	if err != nil || requesterID != alice {
+		t.Fatalf("Failed to accept request: %d (err: %v)", requesterID, err)
+	}
+	if _, err := repo.SendFriendRequest(alice, bob, FriendRequestLimits{}); !errors.Is(err, ErrAlreadyFriends) {
+		t.Fatalf("Expected ErrAlreadyFriends, got: %v", err)
+	}
+
+	for _, userID := range []uint32{alice, bob} {
+		friends, err := repo.ListFriends(userID)
+		if err != nil || len(friends) != 1 || friends[0].LastActivityAt != nil {
+			t.Fatalf("Expected one friend without activity for user %d, got %v (err: %v)", userID, friends, err)
+		}
+	}
+
+	// Activity is recorded for both sides, and not again until it is ActivityResolution old
+	if err := repo.RecordFriendActivity(alice, bob); err != nil {
+		t.Fatalf("Failed to record activity: %v", err)
+	}
+	friends, _ := repo.ListFriends(bob)
+	if len(friends) != 1 || friends[0].LastActivityAt == nil {
+		t.Fatalf("Expected bob's friendship to have activity, got %v", friends)
+	}
+	recorded := *friends[0].LastActivityAt
+	if err := repo.RecordFriendActivity(bob, alice); err != nil {
+		t.Fatalf("Failed to record activity: %v", err)
+	}
+	friends, _ = repo.ListFriends(alice)
+	if len(friends) != 1 || friends[0].LastActivityAt == nil || !friends[0].LastActivityAt.Equal(recorded) {
+		t.Fatalf("Expected alice's friendship to keep the activity recorded moments ago, got %v", friends)
+	}
+
+	if removed, err := repo.RemoveFriend(bob, alice); err != nil || !removed {
+		t.Fatalf("Failed to remove friend: %t (err: %v)", removed, err)
+	}
+	if removed, err := repo.RemoveFriend(bob, alice); err != nil || removed {
+		t.Fatalf("Expected nothing left to remove, got %t (err: %v)", removed, err)
+	}
+
+	// The canceled request is reopened as one from bob, who did not send the original
+	if reopened, err := repo.SendFriendRequest(bob, alice, FriendRequestLimits{}); err != nil || !reopened {
+		t.Fatalf("Expected the canceled request to be reopened: %t (err: %v)", reopened, err)
+	}
+	incoming, err = repo.IncomingFriendRequests(alice)
+	if err != nil || len(incoming) != 1 || incoming[0].RequesterID != bob {
+		t.Fatalf("Expected the reopened request to come from bob, got %v (err: %v)", incoming, err)
+	}
+	if requesterID, err := repo.DeclineFriendRequest(incoming[0].ID, alice); err != nil || requesterID != bob {
+		t.Fatalf("Failed to decline request: %d (err: %v)", requesterID, err)
+	}
+	if requests, _ := repo.IncomingFriendRequests(alice); len(requests) != 0 {
+		t.Fatalf("Expected no pending requests after declining, got %v", requests)
+	}
+
+	// Only the requester can cancel their request
+	if _, err := repo.SendFriendRequest(alice, bob, FriendRequestLimits{}); err != nil {
+		t.Fatalf("Failed to send friend request: %v", err)
+	}
+	outgoing, _ := repo.OutgoingFriendRequests(alice)
+	if _, err := repo.CancelFriendRequest(outgoing[0].ID, bob); !errors.Is(err, ErrFriendRequestNotFound) {
+		t.Fatalf("Expected the recipient not to be able to cancel, got %v", err)
+	}
+	if recipientID, err := repo.CancelFriendRequest(outgoing[0].ID, alice); err != nil || recipientID != bob {
+		t.Fatalf("Failed to cancel request: %d (err: %v)", recipientID, err)
+	}
+	if requests, _ := repo.IncomingFriendRequests(bob); len(requests) != 0 {
+		t.Fatalf("Expected no pending requests after canceling, got %v", requests)
+	}
+	if _, err := repo.CancelFriendRequest(outgoing[0].ID, alice); !errors.Is(err, ErrFriendRequestNotFound) {
+		t.Fatalf("Expected canceling twice to fail, got %v", err)
+	}
+}
+
+func TestSQLRepositoryListFriendsPage(t *testing.T) {
+	repo := newTestRepository(t)
+	alice, _ := repo.CreateUser("alice", "hash", false)
+	base := now().Add(-time.Hour)
+	added := map[string]time.Time{"Dave": base, "bob": base, "carol": base.Add(time.Minute), "erin": base.Add(2 * time.Minute)}
+	active := map[string]time.Time{"bob": base.Add(30 * time.Minute), "Dave": base.Add(30 * time.Minute)}
+	for _, name := range []string{"Dave", "bob", "carol", "erin"} {
+		id, _ := repo.CreateUser(name, "hash", false)
+		var lastActivityAt interface{}
+		if at, ok := active[name]; ok {
+			lastActivityAt = at
+		}
+		if _, err := repo.DB.Exec("INSERT INTO friends (user_id, friend_id, created_at, last_activity_at) VALUES (?, ?, ?, ?)",
+			alice, id, added[name], lastActivityAt); err != nil {
+			t.Fatalf("Failed to add friend %s: %v", name, err)
+		}
+	}
+
+	// Each page continues after the last friend of the previous one, like a page token would
+	list := func(order FriendOrder, limit int) []string {
+		t.Helper()
+		var names []string
+		var after *Friend
+		for {
+			page, err := repo.ListFriendsPage(alice, order, after, limit)
+			if err != nil {
+				t.Fatalf("Failed to list friends: %v", err)
+			}
+			for _, friend := range page {
+				names = append(names, friend.Username)
+			}
+			if len(page) < limit || len(names) > 4 {
+				return names
+			}
+			// Tokens carry times in whatever zone they were decoded in
+			last := page[len(page)-1]
+			last.AddedAt = last.AddedAt.In(time.FixedZone("UTC+2", 2*60*60))
+			after = &last
+		}
+	}
+	for _, tt := range []struct {
+		order FriendOrder
+		want  string
+	}{
+		{FriendsByRecentActivity, "[Dave bob erin carol]"},
+		{FriendsByName, "[bob carol Dave erin]"},
+	} {
+		for _, limit := range []int{1, 3, 10} {
+			if got := fmt.Sprint(list(tt.order, limit)); got != tt.want {
+				t.Fatalf("Expected order %d in pages of %d to be %s, got %s", tt.order, limit, tt.want, got)
+			}
+		}
+	}
+}
+
+func TestSQLRepositoryAcceptFriendRequestRollsBack(t *testing.T) {
+	repo := newTestRepository(t)
+	alice, _ := repo.CreateUser("alice", "hash", false)
+	bob, _ := repo.CreateUser("bob", "hash", false)
+	if _, err := repo.SendFriendRequest(alice, bob, FriendRequestLimits{}); err != nil {
+		t.Fatalf("Failed to send friend request: %v", err)
+	}
+	incoming, _ := repo.IncomingFriendRequests(bob)
+
+	// A leftover friends row makes adding the friendship fail after the request was updated
+	if _, err := repo.DB.Exec("INSERT INTO friends (user_id, friend_id, created_at) VALUES (?, ?, ?)", alice, bob, now()); err != nil {
+		t.Fatalf("Failed to insert friends row: %v", err)
+	}
+	if _, err := repo.AcceptFriendRequest(incoming[0].ID, bob); err == nil {
+		t.Fatalf("Expected accepting to fail")
+	}
+
+	if requests, err := repo.IncomingFriendRequests(bob); err != nil || len(requests) != 1 {
+		t.Fatalf("Expected the request to still be pending, got %v (err: %v)", requests, err)
+	}
+	if friends, err := repo.ListFriends(bob); err != nil || len(friends) != 0 {
+		t.Fatalf("Expected no friendship to be added, got %v (err: %v)", friends, err)
+	}
+}
+
+func TestSQLRepositoryFriendRequestStatsAndExpiry(t *testing.T) {
+	repo := newTestRepository(t)
+	alice, _ := repo.CreateUser("alice", "hash", false)
+	bob, _ := repo.CreateUser("bob", "hash", false)
+	carol, _ := repo.CreateUser("carol", "hash", false)
+	for _, recipient := range []uint32{bob, carol} {
+		if _, err := repo.SendFriendRequest(alice, recipient, FriendRequestLimits{}); err != nil {
+			t.Fatalf("Failed to send friend request: %v", err)
+		}
+	}
+
+	// The request to bob was sent two days ago and is still pending
+	for _, table := range []string{"friend_requests", "friend_request_sends"} {
+		if _, err := repo.DB.Exec("UPDATE "+table+" SET created_at = ? WHERE recipient_id = ?", now().Add(-48*time.Hour), bob); err != nil {
+			t.Fatalf("Failed to age friend request: %v", err)
+		}
+	}
+	if pending, sent, err := repo.FriendRequestStats(alice, 24*time.Hour); err != nil || pending != 2 || sent != 1 {
+		t.Fatalf("Expected 2 pending and 1 sent in the last day, got %d and %d (err: %v)", pending, sent, err)
+	}
+	if pending, sent, err := repo.FriendRequestStats(bob, 24*time.Hour); err != nil || pending != 0 || sent != 0 {
+		t.Fatalf("Expected bob to have sent nothing, got %d and %d (err: %v)", pending, sent, err)
+	}
+
+	if expired, err := repo.ExpireFriendRequests(24 * time.Hour); err != nil || expired != 1 {
+		t.Fatalf("Expected 1 request to expire, got %d (err: %v)", expired, err)
+	}
+	if incoming, _ := repo.IncomingFriendRequests(bob); len(incoming) != 0 {
+		t.Fatalf("Expected the expired request to leave bob's incoming requests, got %v", incoming)
+	}
+	if incoming, _ := repo.IncomingFriendRequests(carol); len(incoming) != 1 {
+		t.Fatalf("Expected carol's recent request to stay pending, got %v", incoming)
+	}
+
+	// An expired request can be sent again
+	if reopened, err := repo.SendFriendRequest(alice, bob, FriendRequestLimits{}); err != nil || !reopened {
+		t.Fatalf("Expected the expired request to be reopened: %t (err: %v)", reopened, err)
+	}
+	if pending, sent, err := repo.FriendRequestStats(alice, 24*time.Hour); err != nil || pending != 2 || sent != 2 {
+		t.Fatalf("Expected the request sent again to count, got %d pending and %d sent (err: %v)", pending, sent, err)
+	}
+}
+
+func TestSQLRepositoryFriendRequestLimits(t *testing.T) {
+	repo := newTestRepository(t)
+	alice, _ := repo.CreateUser("alice", "hash", false)
+	bob, _ := repo.CreateUser("bob", "hash", false)
+	carol, _ := repo.CreateUser("carol", "hash", false)
+	limits := FriendRequestLimits{MaxPending: 1, MaxPerDay: 3}
+
+	if _, err := repo.SendFriendRequest(alice, bob, limits); err != nil {
+		t.Fatalf("Failed to send friend request: %v", err)
+	}
+	if _, err := repo.SendFriendRequest(alice, carol, limits); !errors.Is(err, ErrTooManyPendingFriendRequests) {
+		t.Fatalf("Expected ErrTooManyPendingFriendRequests, got: %v", err)
+	}
+
+	// Canceling and sending the same request again reuses its row, but every send counts
+	for i := 0; i < 2; i++ {
+		outgoing, _ := repo.OutgoingFriendRequests(alice)
+		if _, err := repo.CancelFriendRequest(outgoing[0].ID, alice); err != nil {
+			t.Fatalf("Failed to cancel friend request: %v", err)
+		}
+		if reopened, err := repo.SendFriendRequest(alice, bob, limits); err != nil || !reopened {
+			t.Fatalf("Expected the request to be sent again: %t (err: %v)", reopened, err)
+		}
+	}
+	outgoing, _ := repo.OutgoingFriendRequests(alice)
+	if _, err := repo.CancelFriendRequest(outgoing[0].ID, alice); err != nil {
+		t.Fatalf("Failed to cancel friend request: %v", err)
+	}
+	if _, err := repo.SendFriendRequest(alice, bob, limits); !errors.Is(err, ErrFriendRequestDailyLimit) {
+		t.Fatalf("Expected ErrFriendRequestDailyLimit after 3 sends, got: %v", err)
+	}
+	if outgoing, _ := repo.OutgoingFriendRequests(alice); len(outgoing) != 0 {
+		t.Fatalf("Expected nothing to be sent over the limit, got %v", outgoing)
+	}
+}
+
+func TestSQLRepositoryInvites(t *testing.T) {
+	repo := newTestRepository(t)
+	alice, _ := repo.CreateUser("alice", "hash", false)
+	bob, _ := repo.CreateUser("bob", "hash", false)
+	if _, err := repo.CreateInvite(alice, "ABCDEFGH", 2, now().Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to create invite: %v", err)
+	}
+
+	if _, err := repo.RedeemInvite("ABCDEFGH", alice); !errors.Is(err, ErrOwnInvite) {
+		t.Fatalf("Expected ErrOwnInvite, got %v", err)
+	}
+	if _, err := repo.RedeemInvite("UNKNOWN", bob); !errors.Is(err, ErrInviteNotFound) {
+		t.Fatalf("Expected ErrInviteNotFound, got %v", err)
+	}
+	creator, err := repo.RedeemInvite("ABCDEFGH", bob)
+	if err != nil || creator.UserID != alice || creator.Username != "alice" {
+		t.Fatalf("Expected bob to redeem alice's invite, got %v (err: %v)", creator, err)
+	}
+	if friends, _ := repo.AreFriends(alice, bob); !friends {
+		t.Fatalf("Expected redeeming the invite to make alice and bob friends")
+	}
+	if _, err := repo.RedeemInvite("ABCDEFGH", bob); !errors.Is(err, ErrAlreadyFriends) {
+		t.Fatalf("Expected ErrAlreadyFriends, got %v", err)
+	}
+
+	// A taken username leaves the invite unused, so the last use still works
+	if _, _, err := repo.CreateUserWithInvite("bob", "hash", false, "ABCDEFGH"); !errors.Is(err, ErrUsernameTaken) {
+		t.Fatalf("Expected ErrUsernameTaken, got %v", err)
+	}
+	carol, creator, err := repo.CreateUserWithInvite("carol", "hash", false, "ABCDEFGH")
+	if err != nil || creator.UserID != alice {
+		t.Fatalf("Expected carol to register with the invite, got %v (err: %v)", creator, err)
+	}
+	if friends, _ := repo.AreFriends(alice, carol); !friends {
+		t.Fatalf("Expected carol to be alice's friend")
+	}
+
+	// The invite is used up, and a failed redeem doesn't create the account
+	if _, _, err := repo.CreateUserWithInvite("dave", "hash", false, "ABCDEFGH"); !errors.Is(err, ErrInviteNotFound) {
+		t.Fatalf("Expected the used up invite to be refused, got %v", err)
+	}
+	if _, err := repo.GetUserByUsername("dave"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("Expected no account for dave, got %v", err)
+	}
+
+	// Expired invites can't be redeemed
+	repo.CreateInvite(alice, "EXPIRED1", 5, now().Add(-time.Minute))
+	if _, _, err := repo.CreateUserWithInvite("dave", "hash", false, "EXPIRED1"); !errors.Is(err, ErrInviteNotFound) {
+		t.Fatalf("Expected the expired invite to be refused, got %v", err)
+	}
+
+	// Nor can the invites of a locked account
+	erin, _ := repo.CreateUser("erin", "hash", false)
+	repo.CreateInvite(alice, "LOCKED12", 5, now().Add(time.Hour))
+	if err := NewAccountStore(repo.DB).SetLocked("alice", true); err != nil {
+		t.Fatalf("Failed to lock alice: %v", err)
+	}
+	if _, err := repo.RedeemInvite("LOCKED12", erin); !errors.Is(err, ErrInviteNotFound) {
+		t.Fatalf("Expected the invite of a locked account to be refused, got %v", err)
+	}
+	if friends, _ := repo.AreFriends(alice, erin); friends {
+		t.Fatalf("Expected erin not to become friends with the locked account")
+	}
+	if _, _, err := repo.CreateUserWithInvite("dave", "hash", false, "LOCKED12"); !errors.Is(err, ErrInviteNotFound) {
+		t.Fatalf("Expected registering with the invite of a locked account to be refused, got %v", err)
+	}
+	if _, err := repo.GetUserByUsername("dave"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("Expected no account for dave, got %v", err)
+	}
+}
+
+func TestSQLRepositoryBlocks(t *testing.T) {
+	repo := newTestRepository(t)
+	alice, _ := repo.CreateUser("alice", "hash", false)
+	bob, _ := repo.CreateUser("bob", "hash", false)
+	repo.SendFriendRequest(alice, bob, FriendRequestLimits{})
+	incoming, _ := repo.IncomingFriendRequests(bob)
+	repo.AcceptFriendRequest(incoming[0].ID, bob)
+
+	if _, err := repo.BlockUser(bob, 99); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("Expected ErrUserNotFound, got: %v", err)
+	}
+	if wasFriend, err := repo.BlockUser(bob, alice); err != nil || !wasFriend {
+		t.Fatalf("Failed to block friend: %t (err: %v)", wasFriend, err)
+	}
+	if wasFriend, err := repo.BlockUser(bob, alice); err != nil || wasFriend {
+		t.Fatalf("Expected blocking again to succeed without a friendship, got %t (err: %v)", wasFriend, err)
+	}
+	if friends, _ := repo.ListFriends(alice); len(friends) != 0 {
+		t.Fatalf("Expected the block to end the friendship, got %v", friends)
+	}
+	for _, pair := range [][2]uint32{{alice, bob}, {bob, alice}} {
+		if blocked, err := repo.IsBlocked(pair[0], pair[1]); err != nil || !blocked {
+			t.Fatalf("Expected users %v to be blocked, got %t (err: %v)", pair, blocked, err)
+		}
+	}
+	if _, err := repo.SendFriendRequest(alice, bob, FriendRequestLimits{}); !errors.Is(err, ErrBlocked) {
+		t.Fatalf("Expected ErrBlocked, got: %v", err)
+	}
+	blocked, err := repo.ListBlockedUsers(bob)
+	if err != nil || len(blocked) != 1 || blocked[0].UserID != alice || blocked[0].Username != "alice" {
+		t.Fatalf("Expected alice in bob's block list, got %v (err: %v)", blocked, err)
+	}
+
+	if unblocked, err := repo.UnblockUser(alice, bob); err != nil || unblocked {
+		t.Fatalf("Expected alice to have no block to lift, got %t (err: %v)", unblocked, err)
+	}
+	if unblocked, err := repo.UnblockUser(bob, alice); err != nil || !unblocked {
+		t.Fatalf("Failed to unblock: %t (err: %v)", unblocked, err)
+	}
+	if reopened, err := repo.SendFriendRequest(alice, bob, FriendRequestLimits{}); err != nil || !reopened {
+		t.Fatalf("Expected the canceled request to be reopened after unblocking: %t (err: %v)", reopened, err)
+	}
+}
+
+func TestSQLRepositorySearchUsers(t *testing.T) {
+	repo := newTestRepository(t)
+	alice, _ := repo.CreateUser("alice", "hash", false)
+	for _, username := range []string{"al", "albert", "malia", "a_l_x", "anneli", "bob"} {
+		repo.CreateUser(username, "hash", false)
+	}
+
+	usernames := func(users []UserSearchResult) []string {
+		var names []string
+		for _, user := range users {
+			names = append(names, user.Username)
+		}
+		return names
+	}
+
+	// Exact, then prefix, then substring, then in-order matches; the searcher is left out
+	users, more, err := repo.SearchUsers(alice, "AL", 0, 10)
+	if err != nil || more || strings.Join(usernames(users), ",") != "al,albert,malia,a_l_x,anneli" {
+		t.Fatalf("Unexpected results: %v, more %t (err: %v)", usernames(users), more, err)
+	}
+	// Wildcards in the query match themselves
+	if users, _, _ := repo.SearchUsers(alice, "_", 0, 10); len(users) != 1 || users[0].Username != "a_l_x" {
+		t.Fatalf("Expected only a_l_x to match an underscore, got %v", usernames(users))
+	}
+
+	// Pages pick up where the last one ended
+	page, more, err := repo.SearchUsers(alice, "al", 2, 2)
+	if err != nil || !more || strings.Join(usernames(page), ",") != "malia,a_l_x" {
+		t.Fatalf("Unexpected second page: %v, more %t (err: %v)", usernames(page), more, err)
+	}
+
+	// Users who opt out, or are blocked, can't be found, but friends always can
+	bob, _ := repo.GetUserByUsername("bob")
+	if err := repo.SetDiscoverable(bob.ID, false); err != nil {
+		t.Fatalf("Failed to opt out of discovery: %v", err)
+	}
+	if discoverable, err := repo.Discoverable(bob.ID); err != nil || discoverable {
+		t.Fatalf("Expected bob not to be discoverable, got %t (err: %v)", discoverable, err)
+	}
+	if users, _, _ := repo.SearchUsers(alice, "bob", 0, 10); len(users) != 0 {
+		t.Fatalf("Expected bob to be hidden, got %v", usernames(users))
+	}
+	repo.SendFriendRequest(bob.ID, alice, FriendRequestLimits{})
+	if users, _, _ := repo.SearchUsers(alice, "bob", 0, 10); len(users) != 0 {
+		t.Fatalf("Expected bob to stay hidden until they are friends, got %v", usernames(users))
+	}
+	incoming, _ := repo.IncomingFriendRequests(alice)
+	repo.AcceptFriendRequest(incoming[0].ID, alice)
+	if users, _, _ := repo.SearchUsers(alice, "bob", 0, 10); len(users) != 1 || !users[0].IsFriend {
+		t.Fatalf("Expected to find bob as a friend, got %+v", users)
+	}
+
+	albert, _ := repo.GetUserByUsername("albert")
+	repo.SendFriendRequest(alice, albert.ID, FriendRequestLimits{})
+	if users, _, _ := repo.SearchUsers(alice, "albert", 0, 10); len(users) != 1 || !users[0].RequestPending {
+		t.Fatalf("Expected a pending request to albert, got %+v", users)
+	}
+	repo.BlockUser(albert.ID, alice)
+	if users, _, _ := repo.SearchUsers(alice, "albert", 0, 10); len(users) != 0 {
+		t.Fatalf("Expected albert to be hidden after blocking alice, got %v", usernames(users))
+	}
+}
+
+func TestSQLRepositoryMessageRequests(t *testing.T) {
+	repo := newTestRepository(t)
+	alice, _ := repo.CreateUser("alice", "hash", false)
+	bob, _ := repo.CreateUser("bob", "hash", false)
+	carol, _ := repo.CreateUser("carol", "hash", false)
+
+	hold := func(from, to uint32, messageID string) (int, error) {
+		return repo.HoldMessage(HeldMessage{SenderID: from, RecipientID: to, MessageID: messageID, Payload: []byte(messageID)})
+	}
+	for i, messageID := range []string{"a1", "a2"} {
+		if held, err := hold(alice, bob, messageID); err != nil || held != i+1 {
+			t.Fatalf("Failed to hold message %s: %d (err: %v)", messageID, held, err)
+		}
+	}
+	hold(carol, bob, "c1")
+
+	requests, err := repo.MessageRequests(bob)
+	if err != nil || len(requests) != 2 {
+		t.Fatalf("Expected requests from alice and carol, got %v (err: %v)", requests, err)
+	}
+	for _, request := range requests {
+		if request.SenderID == alice && (request.SenderUsername != "alice" || request.Messages != 2) {
+			t.Fatalf("Unexpected request from alice: %+v", request)
+		}
+	}
+
+	if _, err := repo.AcceptMessageRequest(alice, bob); !errors.Is(err, ErrMessageRequestNotFound) {
+		t.Fatalf("Expected only the recipient to accept, got: %v", err)
+	}
+	held, err := repo.AcceptMessageRequest(bob, alice)
+	if err != nil || len(held) != 2 || held[0].MessageID != "a1" || string(held[1].Payload) != "a2" {
+		t.Fatalf("Expected alice's messages in order, got %v (err: %v)", held, err)
+	}
+	if friends, err := repo.AreFriends(alice, bob); err != nil || !friends {
+		t.Fatalf("Expected accepting to make alice and bob friends, got %t (err: %v)", friends, err)
+	}
+	if _, err := repo.SendFriendRequest(bob, alice, FriendRequestLimits{}); !errors.Is(err, ErrAlreadyFriends) {
+		t.Fatalf("Expected ErrAlreadyFriends, got: %v", err)
+	}
+
+	if rejected, err := repo.RejectMessageRequest(bob, carol); err != nil || !rejected {
+		t.Fatalf("Failed to reject carol's request: %t (err: %v)", rejected, err)
+	}
+	if requests, _ := repo.MessageRequests(bob); len(requests) != 0 {
+		t.Fatalf("Expected no requests left, got %v", requests)
+	}
+
+	// Blocking drops held messages, and a sender can only have so many waiting
+	for i := 0; i < MaxHeldMessages; i++ {
+		if _, err := hold(carol, alice, "spam"); err != nil {
+			t.Fatalf("Failed to hold message %d: %v", i, err)
+		}
+	}
+	if _, err := hold(carol, alice, "spam"); !errors.Is(err, ErrMessageRequestFull) {
+		t.Fatalf("Expected ErrMessageRequestFull, got: %v", err)
+	}
+	repo.BlockUser(alice, carol)
+	if requests, _ := repo.MessageRequests(alice); len(requests) != 0 {
+		t.Fatalf("Expected blocking to drop carol's messages, got %v", requests)
+	}
+}
+
+func TestSQLRepositoryProfiles(t *testing.T) {
+	repo := newTestRepository(t)
+	alice, _ := repo.CreateUser("alice", "hash", false)
+
+	if _, err := repo.GetProfile(alice); !errors.Is(err, ErrProfileNotFound) {
+		t.Fatalf("Expected ErrProfileNotFound, got: %v", err)
+	}
+
+	for _, ciphertext := range []string{"first", "second"} {
+		updatedAt, err := repo.SaveProfile(alice, []byte(ciphertext))
+		if err != nil {
+			t.Fatalf("Failed to save profile: %v", err)
+		}
+		got, err := repo.GetProfile(alice)
+		if err != nil || string(got.Ciphertext) != ciphertext || !got.UpdatedAt.Equal(updatedAt) {
+			t.Fatalf("Expected profile %q saved at %v, got %+v (err: %v)", ciphertext, updatedAt, got, err)
+		}
+	}
+}
+
+func TestSQLRepositoryPreKeyBundles(t *testing.T) {
+	repo := newTestRepository(t)
+	alice, _ := repo.CreateUser("alice", "hash", false)
+
+	if _, err := repo.GetPreKeyBundle(alice, 0); !errors.Is(err, ErrPreKeyBundleNotFound) {
+		t.Fatalf("Expected ErrPreKeyBundleNotFound, got: %v", err)
+	}
+
+	bundle := PreKeyBundle{
+		UserID:                alice,
+		RegistrationID:        7,
+		DeviceID:              3,
+		IdentityKey:           []byte("identity"),
+		PreKeyID:              1,
+		PreKey:                []byte("prekey"),
+		SignedPreKeyID:        2,
+		SignedPreKey:          []byte("signed"),
+		SignedPreKeySignature: []byte("signature"),
+	}
+	if err := repo.SavePreKeyBundle(bundle); err != nil {
+		t.Fatalf("Failed to save bundle: %v", err)
+	}
+	for _, deviceID := range []uint32{0, 3} {
+		got, err := repo.GetPreKeyBundle(alice, deviceID)
+		if err != nil || got.RegistrationID != 7 || string(got.SignedPreKeySignature) != "signature" {
+			t.Fatalf("Unexpected bundle for device %d: %+v (err: %v)", deviceID, got, err)
+		}
+	}
+	if _, err := repo.GetPreKeyBundle(alice, 4); !errors.Is(err, ErrPreKeyBundleNotFound) {
+		t.Fatalf("Expected no bundle for another device, got: %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/johnkhk/cli_chat_app/server/storage"
+	utils "github.com/johnkhk/cli_chat_app/test"
+	"github.com/johnkhk/cli_chat_app/test/setup"
+)
+
+// TestAdminLockLogoutAndResetPassword tests the account operations behind the admin tool.
+func TestAdminLockLogoutAndResetPassword(t *testing.T) {
+	rpcClients, db, cleanup, _ := setup.InitializeTestResources(t, nil, 1)
+	defer cleanup()
+
+	client := rpcClients[0]
+	accounts := storage.NewAccountStore(db)
+
+	utils.RegisterAndLoginUser(t, client, "user1")
+
+	users, err := accounts.ListUsers()
+	if err != nil || len(users) != 1 {
+		t.Fatalf("Expected 1 user, got: %v (err: %v)", users, err)
+	}
+	if users[0].Username != "user1" || users[0].LastLoginAt == nil || users[0].Locked {
+		t.Fatalf("Unexpected user row: %+v", users[0])
+	}
+
+	// Token issue times have second resolution, so revoke in a later second than the login.
+	time.Sleep(1100 * time.Millisecond)
+	if err := accounts.RevokeSessions("user1"); err != nil {
+		t.Fatalf("Failed to revoke sessions: %v", err)
+	}
+	if _, err := client.FriendsClient.GetFriendList(); err == nil {
+		t.Fatal("Expected requests with a revoked token to fail")
+	}
+
+	// A locked account cannot log in again
+	if err := accounts.SetLocked("user1", true); err != nil {
+		t.Fatalf("Failed to lock user1: %v", err)
+	}
+	if err, _ := client.AuthClient.LoginUser("user1", "password"); err == nil {
+		t.Fatal("Expected login of a locked account to fail")
+	}
+
+	if err := accounts.SetLocked("user1", false); err != nil {
+		t.Fatalf("Failed to unlock user1: %v", err)
+	}
+	if err, _ := client.AuthClient.LoginUser("user1", "password"); err != nil {
+		t.Fatalf("Failed to login after unlocking: %v", err)
+	}
+	if _, err := client.FriendsClient.GetFriendList(); err != nil {
+		t.Fatalf("Expected requests to work after logging in again: %v", err)
+	}
+
+	// After a reset only the new password works
+	hash, err := bcrypt.GenerateFromPassword([]byte("new-password"), bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	if err := accounts.SetPasswordHash("user1", string(hash)); err != nil {
+		t.Fatalf("Failed to reset password: %v", err)
+	}
+	if err, _ := client.AuthClient.LoginUser("user1", "password"); err == nil {
+		t.Fatal("Expected the old password to be rejected")
+	}
+	if err, _ := client.AuthClient.LoginUser("user1", "new-password"); err != nil {
+		t.Fatalf("Failed to login with the new password: %v", err)
+	}
+
+	if err := accounts.SetLocked("nobody", true); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Fatalf("Expected ErrUserNotFound for an unknown user, got: %v", err)
+	}
+}
+
+// TestAdminQueueDepth tests that queue depths reported by the router can be read back by the admin tool.
+func TestAdminQueueDepth(t *testing.T) {
+	rpcClients, db, cleanup, server := setup.InitializeTestResources(t, nil, 2)
+	defer cleanup()
+
+	client1 := rpcClients[0]
+	client2 := rpcClients[1]
+	accounts := storage.NewAccountStore(db)
+
+	utils.RegisterAndLoginUser(t, client1, "user1")
+	utils.RegisterAndLoginUser(t, client2, "user2")
+	utils.MakeFriends(t, client1, client2, "user2")
+	user2ID := client2.CurrentUserID
+
+	if err := client2.AuthClient.LogoutUser(); err != nil {
+		t.Fatalf("Failed to logout user2: %v", err)
+	}
+	time.Sleep(2 * time.Second) // Allow the logout to close the stream
+
+	for i := 0; i < 2; i++ {
+		if err := client1.ChatClient.SendUnencryptedMessage(context.Background(), user2ID, "queued"); err != nil {
+			t.Fatalf("Failed to send message to offline user2: %v", err)
+		}
+	}
+	time.Sleep(time.Second) // Allow the messages to be queued
+
+	depths, err := server.Router.QueueDepths()
+	if err != nil {
+		t.Fatalf("Failed to read queue depths: %v", err)
+	}
+	if err := accounts.RecordQueueDepths(depths); err != nil {
+		t.Fatalf("Failed to record queue depths: %v", err)
+	}
+
+	recorded, err := accounts.QueueDepths()
+	if err != nil {
+		t.Fatalf("Failed to read recorded queue depths: %v", err)
+	}
+	if len(recorded) != 1 || recorded[0].Username != "user2" || recorded[0].Depth != 2 {
+		t.Fatalf("Expected 2 messages queued for user2, got: %+v", recorded)
+	}
+}
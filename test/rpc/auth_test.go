@@ -3,6 +3,7 @@ package rpc
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -12,7 +13,10 @@ import (
 
 	"github.com/Johnkhk/libsignal-go/protocol/prekey"
 
+	"github.com/johnkhk/cli_chat_app/client/app"
 	"github.com/johnkhk/cli_chat_app/client/e2ee/store"
+	serverapp "github.com/johnkhk/cli_chat_app/server/app"
+	"github.com/johnkhk/cli_chat_app/server/storage"
 	"github.com/johnkhk/cli_chat_app/test"
 	"github.com/johnkhk/cli_chat_app/test/setup"
 )
@@ -29,7 +33,7 @@ func TestRegisterLoginFlow(t *testing.T) {
 
 	// Get the directory path for storing JWT tokens
 	tokenDir := filepath.Join(os.TempDir(), fmt.Sprintf(".test_cli_chat_app_%s_client_0", t.Name()))
-	tokenFile := filepath.Join(tokenDir, "jwt_tokens") // Assuming the token file is named "jwt_tokens"
+	tokenFile := filepath.Join(tokenDir, "credentials") // The encrypted credentials file written by the test setup
 
 	// Test the login of an unregistered/wrong credentials user
 	log.Infof("Testing unregistered user login")
@@ -69,6 +73,19 @@ func TestRegisterLoginFlow(t *testing.T) {
 	if _, err := os.Stat(tokenFile); err != nil {
 		t.Fatalf("JWT token file was not created after successful login")
 	}
+
+	// Ensure the tokens are not stored in plaintext
+	accessToken, _, err := rpcClient.AuthClient.TokenManager.ReadTokens()
+	if err != nil {
+		t.Fatalf("Failed to read tokens: %v", err)
+	}
+	data, err := os.ReadFile(tokenFile)
+	if err != nil {
+		t.Fatalf("Failed to read token file: %v", err)
+	}
+	if bytes.Contains(data, []byte(accessToken)) {
+		t.Fatalf("Access token was stored in plaintext")
+	}
 }
 
 // / TestTokenExpirationAndRefresh tests the token expiration and refresh functionality.
@@ -488,3 +505,27 @@ func TestFetchPublicKeyBundle(t *testing.T) {
 
 	// Optionally add more checks or validations here if necessary
 }
+
+// TestRegistrationApproval tests that accounts registered on a server that approves them can only log in once
+// an administrator does.
+func TestRegistrationApproval(t *testing.T) {
+	rpcClients, db, cleanup, servers := setup.InitializeTestResources(t, nil, 1)
+	rpcClient := rpcClients[0]
+	defer cleanup()
+	servers.AuthServer.Registration.Mode = serverapp.RegistrationApproval
+
+	err := rpcClient.AuthClient.RegisterUser("newcomer", "testpassword")
+	if !errors.Is(err, app.ErrRegistrationPending) {
+		t.Fatalf("Expected the registration to wait for approval, got: %v", err)
+	}
+	if err, _ := rpcClient.AuthClient.LoginUser("newcomer", "testpassword"); err == nil {
+		t.Fatal("Expected a pending account not to log in")
+	}
+
+	if err := storage.NewAccountStore(db).ApproveUser("newcomer"); err != nil {
+		t.Fatalf("Failed to approve the account: %v", err)
+	}
+	if err, _ := rpcClient.AuthClient.LoginUser("newcomer", "testpassword"); err != nil {
+		t.Fatalf("Expected the approved account to log in: %v", err)
+	}
+}
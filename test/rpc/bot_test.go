@@ -0,0 +1,52 @@
+package rpc
+
+import (
+	"testing"
+
+	utils "github.com/johnkhk/cli_chat_app/test"
+	"github.com/johnkhk/cli_chat_app/test/setup"
+)
+
+// TestBotAccountsAreFlaggedInFriendLists tests that a bot account is marked as a bot to its friends.
+func TestBotAccountsAreFlaggedInFriendLists(t *testing.T) {
+	rpcClients, _, cleanup, _ := setup.InitializeTestResources(t, nil, 2)
+	defer cleanup()
+
+	human := rpcClients[0]
+	bot := rpcClients[1]
+
+	utils.RegisterAndLoginUser(t, human, "user1")
+	if err := bot.AuthClient.RegisterBot("ci-bot", "password"); err != nil {
+		t.Fatalf("Failed to register bot: %v", err)
+	}
+	if err, _ := bot.AuthClient.LoginUser("ci-bot", "password"); err != nil {
+		t.Fatalf("Failed to login bot: %v", err)
+	}
+
+	if err := human.FriendsClient.SendFriendRequest("ci-bot"); err != nil {
+		t.Fatalf("Failed to send friend request to the bot: %v", err)
+	}
+	incomingRequests, err := bot.FriendsClient.GetIncomingFriendRequests()
+	if err != nil || len(incomingRequests) == 0 {
+		t.Fatalf("Bot did not receive the friend request: %v", err)
+	}
+	if err := bot.FriendsClient.AcceptFriendRequest(incomingRequests[0].RequestId); err != nil {
+		t.Fatalf("Bot failed to accept friend request: %v", err)
+	}
+
+	humanFriends, err := human.FriendsClient.GetFriendList()
+	if err != nil || len(humanFriends) != 1 {
+		t.Fatalf("Expected 1 friend for user1, got: %v (err: %v)", humanFriends, err)
+	}
+	if !humanFriends[0].IsBot {
+		t.Fatalf("Expected ci-bot to be flagged as a bot in user1's friend list")
+	}
+
+	botFriends, err := bot.FriendsClient.GetFriendList()
+	if err != nil || len(botFriends) != 1 {
+		t.Fatalf("Expected 1 friend for ci-bot, got: %v (err: %v)", botFriends, err)
+	}
+	if botFriends[0].IsBot {
+		t.Fatalf("Expected user1 not to be flagged as a bot")
+	}
+}
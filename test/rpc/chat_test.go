@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/johnkhk/cli_chat_app/client/app"
 	utils "github.com/johnkhk/cli_chat_app/test"
 	"github.com/johnkhk/cli_chat_app/test/setup"
 )
@@ -23,7 +24,7 @@ func TestRegisterLoginAndStreamFlow(t *testing.T) {
 	time.Sleep(2 * time.Second) // Adjust as needed, depending on gRPC setup
 
 	// Check that the user is registered in ActiveClients on the chat server
-	activeClients := server.ChatServer.ActiveClients
+	activeClients := server.Router.ActiveClients
 	log.Infof("Active clients count: %d", len(activeClients))
 	for k, v := range activeClients {
 		log.Infof("Active Client Key: %d, Value: %v", k, v)
@@ -58,6 +59,7 @@ func TestTwoUsersSendUnencrypteedMessages(t *testing.T) {
 
 	utils.RegisterAndLoginUser(t, client1, "user1")
 	utils.RegisterAndLoginUser(t, client2, "user2")
+	utils.MakeFriends(t, client1, client2, "user2")
 
 	utils.WaitForWelcomeMessage(t, client1, "user1")
 	utils.WaitForWelcomeMessage(t, client2, "user2")
@@ -91,6 +93,7 @@ func TestSenderAndReceiverSavesChatHistory(t *testing.T) {
 
 	utils.RegisterAndLoginUser(t, client1, "user1")
 	utils.RegisterAndLoginUser(t, client2, "user2")
+	utils.MakeFriends(t, client1, client2, "user2")
 
 	utils.WaitForWelcomeMessage(t, client1, "user1")
 	utils.WaitForWelcomeMessage(t, client2, "user2")
@@ -167,7 +170,7 @@ func TestLogoutUser(t *testing.T) {
 	time.Sleep(2 * time.Second)
 
 	// Make sure active clients map is updated
-	activeClients := server.ChatServer.ActiveClients
+	activeClients := server.Router.ActiveClients
 	if len(activeClients) != 2 {
 		t.Fatalf("Expected 2 active client, but got: %d", len(activeClients))
 	}
@@ -179,7 +182,7 @@ func TestLogoutUser(t *testing.T) {
 	time.Sleep(2 * time.Second) // Sleep to allow logout to cancel context, stream
 
 	// Make sure active clients map is updated
-	activeClients = server.ChatServer.ActiveClients
+	activeClients = server.Router.ActiveClients
 	if len(activeClients) != 1 {
 		t.Fatalf("Expected 1 active client, but got: %d", len(activeClients))
 	}
@@ -205,6 +208,7 @@ func TestReceiverIsOfflineWhenSenderSends(t *testing.T) {
 	if err, _ := client2.AuthClient.LoginUser("user2", "password"); err != nil {
 		t.Fatalf("Failed to login user2: %v", err)
 	}
+	utils.MakeFriends(t, client1, client2, "user2")
 
 	user1ID, err := client1.AuthClient.TokenManager.GetUserIdFromAccessToken()
 	if err != nil {
@@ -252,8 +256,8 @@ func TestReceiverIsOfflineWhenSenderSends(t *testing.T) {
 	}
 
 	// Message should be in server buffer for later delivery
-	if len(server.ChatServer.UndeliveredMessages) != 1 {
-		t.Fatalf("Expected 1 undelivered message in server buffer, but got: %d", len(server.ChatServer.UndeliveredMessages))
+	if len(server.Router.UndeliveredMessages) != 1 {
+		t.Fatalf("Expected 1 undelivered message in server buffer, but got: %d", len(server.Router.UndeliveredMessages))
 	}
 
 	// Log in User2
@@ -263,8 +267,8 @@ func TestReceiverIsOfflineWhenSenderSends(t *testing.T) {
 	time.Sleep(2 * time.Second)
 
 	// Buffer should be empty after User2 logs in
-	if len(server.ChatServer.UndeliveredMessages) != 0 {
-		t.Fatalf("Expected 0 undelivered message in server buffer, but got: %d", len(server.ChatServer.UndeliveredMessages))
+	if len(server.Router.UndeliveredMessages) != 0 {
+		t.Fatalf("Expected 0 undelivered message in server buffer, but got: %d", len(server.Router.UndeliveredMessages))
 	}
 
 	// User 2 should have received the message
@@ -277,3 +281,147 @@ func TestReceiverIsOfflineWhenSenderSends(t *testing.T) {
 		t.Fatalf("Expected message %s, but got: %s", messageFromUser1, msgReceived.Message)
 	}
 }
+
+// TestBlockedUserCannotMessage checks that a block stops messages in both directions until it is lifted.
+func TestBlockedUserCannotMessage(t *testing.T) {
+	rpcClients, _, cleanup, _ := setup.InitializeTestResources(t, nil, 2)
+	defer cleanup()
+
+	client1 := rpcClients[0] // Represents User1
+	client2 := rpcClients[1] // Represents User2
+
+	utils.RegisterAndLoginUser(t, client1, "user1")
+	utils.RegisterAndLoginUser(t, client2, "user2")
+
+	utils.WaitForWelcomeMessage(t, client1, "user1")
+	utils.WaitForWelcomeMessage(t, client2, "user2")
+
+	// User2 blocks User1
+	if err := client2.FriendsClient.BlockUser(int32(client1.CurrentUserID)); err != nil {
+		t.Fatalf("Failed to block User 1: %v", err)
+	}
+	blocked, err := client2.FriendsClient.GetBlockedUsers()
+	if err != nil || len(blocked) != 1 || blocked[0].Username != "user1" {
+		t.Fatalf("Expected user1 to be blocked, got %v (err: %v)", blocked, err)
+	}
+
+	if err := client1.ChatClient.SendUnencryptedMessage(context.Background(), client2.CurrentUserID, "Can you hear me?"); err != nil {
+		t.Fatalf("Failed to send message from User 1 to User 2: %v", err)
+	}
+	if err := client2.ChatClient.SendUnencryptedMessage(context.Background(), client1.CurrentUserID, "Nor me?"); err != nil {
+		t.Fatalf("Failed to send message from User 2 to User 1: %v", err)
+	}
+	// Each sender is told delivery failed, and neither receives the other's message
+	for _, client := range []*app.RpcClient{client1, client2} {
+		timeout := time.After(500 * time.Millisecond)
+	wait:
+		for {
+			select {
+			case msg := <-client.ChatClient.MessageChannel:
+				if msg.Status == "received" {
+					t.Fatalf("Expected no message between blocked users, got: %s", msg.EncryptedMessage)
+				}
+			case <-timeout:
+				break wait
+			}
+		}
+	}
+	if err := client1.FriendsClient.SendFriendRequest("user2"); err == nil {
+		t.Fatalf("Expected a friend request to a user who blocked you to fail")
+	}
+
+	// Once unblocked, messages go through again, though only as a message request since the block ended any friendship
+	if err := client2.FriendsClient.UnblockUser(int32(client1.CurrentUserID)); err != nil {
+		t.Fatalf("Failed to unblock User 1: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	status, err := client1.ChatClient.SendMessageAndWait(ctx, client2.CurrentUserID, 0, []byte("Hello again"), nil)
+	if err != nil {
+		t.Fatalf("Failed to send message from User 1 to User 2: %v", err)
+	}
+	if status != "request_held" {
+		t.Fatalf("Expected the message to be held as a message request, got status %q", status)
+	}
+}
+
+// TestMessageRequestFlow checks that messages from a non-friend wait for the recipient to accept them.
+func TestMessageRequestFlow(t *testing.T) {
+	rpcClients, _, cleanup, _ := setup.InitializeTestResources(t, nil, 3)
+	defer cleanup()
+
+	client1 := rpcClients[0] // Represents User1
+	client2 := rpcClients[1] // Represents User2
+	client3 := rpcClients[2] // Represents User3
+
+	utils.RegisterAndLoginUser(t, client1, "user1")
+	utils.RegisterAndLoginUser(t, client2, "user2")
+	utils.RegisterAndLoginUser(t, client3, "user3")
+
+	utils.WaitForWelcomeMessage(t, client1, "user1")
+	utils.WaitForWelcomeMessage(t, client2, "user2")
+	utils.WaitForWelcomeMessage(t, client3, "user3")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// User1 and User3 message User2, who is friends with neither
+	for _, sender := range []*app.RpcClient{client1, client1, client3} {
+		status, err := sender.ChatClient.SendMessageAndWait(ctx, client2.CurrentUserID, 0, []byte("Hi, we have not met"), nil)
+		if err != nil {
+			t.Fatalf("Failed to send message to User 2: %v", err)
+		}
+		if status != "request_held" {
+			t.Fatalf("Expected the message to be held as a message request, got status %q", status)
+		}
+	}
+	select {
+	case msg := <-client2.ChatClient.MessageChannel:
+		t.Fatalf("Expected no message before the request is accepted, got: %s", msg.EncryptedMessage)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	requests, err := client2.ChatClient.GetMessageRequests()
+	if err != nil || len(requests) != 2 {
+		t.Fatalf("Expected 2 message requests, got %v (err: %v)", requests, err)
+	}
+	counts := make(map[string]uint32)
+	for _, req := range requests {
+		counts[req.SenderUsername] = req.MessageCount
+	}
+	if counts["user1"] != 2 || counts["user3"] != 1 {
+		t.Fatalf("Expected 2 messages from user1 and 1 from user3, got %v", counts)
+	}
+
+	// Accepting delivers the held messages and makes the two friends
+	if err := client2.ChatClient.AcceptMessageRequest(client1.CurrentUserID); err != nil {
+		t.Fatalf("Failed to accept message request: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-client2.ChatClient.MessageChannel:
+			if msg.SenderId != client1.CurrentUserID {
+				t.Fatalf("Expected a message from User 1, got one from user %d", msg.SenderId)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("User 2 did not receive the held messages in time")
+		}
+	}
+	friendList, err := client2.FriendsClient.GetFriendList()
+	if err != nil || len(friendList) != 1 || friendList[0].Username != "user1" {
+		t.Fatalf("Expected user1 to be User 2's only friend, got %v (err: %v)", friendList, err)
+	}
+	status, err := client1.ChatClient.SendMessageAndWait(ctx, client2.CurrentUserID, 0, []byte("Thanks"), nil)
+	if err != nil || status != "delivered" {
+		t.Fatalf("Expected messages between friends to be delivered, got status %q (err: %v)", status, err)
+	}
+
+	// Rejecting drops the held message without telling the sender
+	if err := client2.ChatClient.RejectMessageRequest(client3.CurrentUserID); err != nil {
+		t.Fatalf("Failed to reject message request: %v", err)
+	}
+	requests, err = client2.ChatClient.GetMessageRequests()
+	if err != nil || len(requests) != 0 {
+		t.Fatalf("Expected no message requests after rejecting, got %v (err: %v)", requests, err)
+	}
+}
@@ -53,6 +53,7 @@ func TestOneUserSendingMessagesPreKeyOnly(t *testing.T) {
 
 	utils.RegisterAndLoginUser(t, client1, "user1")
 	utils.RegisterAndLoginUser(t, client2, "user2")
+	utils.MakeFriends(t, client1, client2, "user2")
 
 	utils.WaitForWelcomeMessage(t, client1, "user1")
 	utils.WaitForWelcomeMessage(t, client2, "user2")
@@ -71,6 +72,7 @@ func TestPreKeyToSignalMessageTransition(t *testing.T) {
 
 	utils.RegisterAndLoginUser(t, client1, "user1")
 	utils.RegisterAndLoginUser(t, client2, "user2")
+	utils.MakeFriends(t, client1, client2, "user2")
 
 	utils.WaitForWelcomeMessage(t, client1, "user1")
 	utils.WaitForWelcomeMessage(t, client2, "user2")
@@ -98,6 +100,7 @@ func TestSenderAndReceiverSaveEncryptedChatHistory(t *testing.T) {
 
 	utils.RegisterAndLoginUser(t, client1, "user1")
 	utils.RegisterAndLoginUser(t, client2, "user2")
+	utils.MakeFriends(t, client1, client2, "user2")
 
 	utils.WaitForWelcomeMessage(t, client1, "user1")
 	utils.WaitForWelcomeMessage(t, client2, "user2")
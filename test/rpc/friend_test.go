@@ -1,10 +1,15 @@
 package rpc
 
 import (
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/johnkhk/cli_chat_app/client/app"
 	"github.com/johnkhk/cli_chat_app/genproto/friends"
+	serverapp "github.com/johnkhk/cli_chat_app/server/app"
 	"github.com/johnkhk/cli_chat_app/server/storage"
+	utils "github.com/johnkhk/cli_chat_app/test"
 	"github.com/johnkhk/cli_chat_app/test/setup"
 )
 
@@ -427,3 +432,234 @@ func TestRemoveFriendAndVerify(t *testing.T) {
 		t.Fatalf("Expected friend request status to be PENDING in db, got: %s", status)
 	}
 }
+
+// TestFriendEventsAreStreamed tests that each side of a friendship hears about the other's actions as they happen.
+func TestFriendEventsAreStreamed(t *testing.T) {
+	rpcClients, _, cleanup, server := setup.InitializeTestResources(t, nil, 2)
+	defer cleanup()
+
+	client1, client2 := rpcClients[0], rpcClients[1]
+	password := "password"
+	for i, client := range rpcClients {
+		username := []string{"user1", "user2"}[i]
+		if err := client.AuthClient.RegisterUser(username, password); err != nil {
+			t.Fatalf("Failed to register %s: %v", username, err)
+		}
+		if err, _ := client.AuthClient.LoginUser(username, password); err != nil {
+			t.Fatalf("Failed to login %s: %v", username, err)
+		}
+	}
+
+	// Logging in opens the event streams in the background; wait until the server has both
+	events := server.FriendsServer.Events
+	deadline := time.Now().Add(5 * time.Second)
+	for events.Subscribers(client1.CurrentUserID) == 0 || events.Subscribers(client2.CurrentUserID) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the friend event streams to open")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	expectEvent := func(client *app.RpcClient, eventType friends.FriendEventType, from string) {
+		t.Helper()
+		select {
+		case event := <-client.FriendsClient.Events:
+			if event.Type != eventType || event.Username != from {
+				t.Fatalf("Expected %s from %s, got %s from %s", eventType, from, event.Type, event.Username)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for %s from %s", eventType, from)
+		}
+	}
+
+	if err := client1.FriendsClient.SendFriendRequest("user2"); err != nil {
+		t.Fatalf("Failed to send friend request: %v", err)
+	}
+	expectEvent(client2, friends.FriendEventType_FRIEND_REQUEST_CREATED, "user1")
+
+	incoming, err := client2.FriendsClient.GetIncomingFriendRequests()
+	if err != nil || len(incoming) != 1 {
+		t.Fatalf("Expected 1 incoming friend request, got %v (err: %v)", incoming, err)
+	}
+	if err := client2.FriendsClient.AcceptFriendRequest(incoming[0].RequestId); err != nil {
+		t.Fatalf("Failed to accept friend request: %v", err)
+	}
+	expectEvent(client1, friends.FriendEventType_FRIEND_REQUEST_ACCEPTED, "user2")
+
+	if err := client1.FriendsClient.RemoveFriend(int32(client2.CurrentUserID)); err != nil {
+		t.Fatalf("Failed to remove friend: %v", err)
+	}
+	expectEvent(client2, friends.FriendEventType_FRIEND_REMOVED, "user1")
+}
+
+// TestSearchUsersAndOptOut tests finding users by part of their name, and hiding from search.
+func TestSearchUsersAndOptOut(t *testing.T) {
+	rpcClients, _, cleanup, _ := setup.InitializeTestResources(t, nil, 3)
+	defer cleanup()
+
+	client1 := rpcClients[0] // Represents User1
+	client2 := rpcClients[1] // Represents john_smith
+	client3 := rpcClients[2] // Represents jsmith
+
+	utils.RegisterAndLoginUser(t, client1, "user1")
+	utils.RegisterAndLoginUser(t, client2, "john_smith")
+	utils.RegisterAndLoginUser(t, client3, "jsmith")
+
+	users, more, err := client1.FriendsClient.SearchUsers("jsmth", 0, 0)
+	if err != nil || more || len(users) != 2 {
+		t.Fatalf("Expected both smiths to match, got %v (more %t, err: %v)", users, more, err)
+	}
+	users, more, err = client1.FriendsClient.SearchUsers("smith", 0, 1)
+	if err != nil || !more || len(users) != 1 || users[0].Username != "jsmith" {
+		t.Fatalf("Expected jsmith first with another page to come, got %v (more %t, err: %v)", users, more, err)
+	}
+
+	// Hiding from search doesn't stop requests to the exact username
+	if err := client2.FriendsClient.SetDiscoverable(false); err != nil {
+		t.Fatalf("Failed to opt out of discovery: %v", err)
+	}
+	if settings, err := client2.FriendsClient.GetPrivacySettings(); err != nil || settings.Discoverable {
+		t.Fatalf("Expected john_smith not to be discoverable, got %v (err: %v)", settings, err)
+	}
+	users, _, err = client1.FriendsClient.SearchUsers("smith", 0, 0)
+	if err != nil || len(users) != 1 || users[0].Username != "jsmith" {
+		t.Fatalf("Expected only jsmith to be found, got %v (err: %v)", users, err)
+	}
+	if err := client1.FriendsClient.SendFriendRequest("john_smith"); err != nil {
+		t.Fatalf("Failed to send friend request by exact username: %v", err)
+	}
+}
+
+// TestGetFriendListPages tests paging through the friend list in alphabetical order.
+func TestGetFriendListPages(t *testing.T) {
+	rpcClients, _, cleanup, _ := setup.InitializeTestResources(t, nil, 4)
+	defer cleanup()
+
+	alice := rpcClients[0]
+	utils.RegisterAndLoginUser(t, alice, "alice")
+	for i, username := range []string{"dave", "bob", "carol"} {
+		utils.RegisterAndLoginUser(t, rpcClients[i+1], username)
+		utils.MakeFriends(t, alice, rpcClients[i+1], username)
+	}
+
+	var usernames []string
+	pageToken := ""
+	for pages := 0; ; pages++ {
+		if pages == 3 {
+			t.Fatalf("Expected the last page after 3 friends, got a token for another: %q", pageToken)
+		}
+		page, nextPageToken, err := alice.FriendsClient.GetFriendListPage(pageToken, 1, friends.FriendListSort_ALPHABETICAL)
+		if err != nil {
+			t.Fatalf("Failed to get friend list page: %v", err)
+		}
+		if len(page) != 1 {
+			t.Fatalf("Expected 1 friend per page, got: %d", len(page))
+		}
+		usernames = append(usernames, page[0].Username)
+		if nextPageToken == "" {
+			break
+		}
+		pageToken = nextPageToken
+	}
+	if strings.Join(usernames, ",") != "bob,carol,dave" {
+		t.Fatalf("Expected friends in alphabetical order, got: %v", usernames)
+	}
+
+	// A token only continues the order it was given for
+	_, next, err := alice.FriendsClient.GetFriendListPage("", 1, friends.FriendListSort_ALPHABETICAL)
+	if err != nil {
+		t.Fatalf("Failed to get first friend list page: %v", err)
+	}
+	if _, _, err := alice.FriendsClient.GetFriendListPage(next, 1, friends.FriendListSort_ONLINE_FIRST); err == nil {
+		t.Fatal("Expected a page token for another order to be rejected")
+	}
+
+	// The whole list follows every page
+	all, err := alice.FriendsClient.GetFriendListSorted(friends.FriendListSort_ONLINE_FIRST)
+	if err != nil {
+		t.Fatalf("Failed to get sorted friend list: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("Expected 3 friends, got: %d", len(all))
+	}
+}
+
+// TestCancelFriendRequest tests that a canceled request leaves the recipient's incoming requests.
+func TestCancelFriendRequest(t *testing.T) {
+	rpcClients, _, cleanup, _ := setup.InitializeTestResources(t, nil, 2)
+	defer cleanup()
+
+	alice, bob := rpcClients[0], rpcClients[1]
+	utils.RegisterAndLoginUser(t, alice, "alice")
+	utils.RegisterAndLoginUser(t, bob, "bob")
+
+	if err := alice.FriendsClient.SendFriendRequest("bob"); err != nil {
+		t.Fatalf("Failed to send friend request: %v", err)
+	}
+	outgoing, err := alice.FriendsClient.GetOutgoingFriendRequests()
+	if err != nil || len(outgoing) != 1 {
+		t.Fatalf("Expected 1 outgoing request, got %v (err: %v)", outgoing, err)
+	}
+
+	// Only the requester can cancel
+	if err := bob.FriendsClient.CancelFriendRequest(outgoing[0].RequestId); err == nil {
+		t.Fatal("Expected the recipient not to be able to cancel the request")
+	}
+	if err := alice.FriendsClient.CancelFriendRequest(outgoing[0].RequestId); err != nil {
+		t.Fatalf("Failed to cancel friend request: %v", err)
+	}
+
+	incoming, err := bob.FriendsClient.GetIncomingFriendRequests()
+	if err != nil || len(incoming) != 0 {
+		t.Fatalf("Expected no incoming requests after canceling, got %v (err: %v)", incoming, err)
+	}
+	outgoing, err = alice.FriendsClient.GetOutgoingFriendRequests()
+	if err != nil || len(outgoing) != 0 {
+		t.Fatalf("Expected no outgoing requests after canceling, got %v (err: %v)", outgoing, err)
+	}
+}
+
+func TestInvites(t *testing.T) {
+	rpcClients, _, cleanup, servers := setup.InitializeTestResources(t, nil, 3)
+	defer cleanup()
+
+	alice, bob, carol := rpcClients[0], rpcClients[1], rpcClients[2]
+	utils.RegisterAndLoginUser(t, alice, "alice")
+	utils.RegisterAndLoginUser(t, bob, "bob")
+
+	invite, err := alice.FriendsClient.CreateInvite(2, 24*time.Hour)
+	if err != nil || invite.MaxUses != 2 {
+		t.Fatalf("Expected an invite for 2 users, got %v (err: %v)", invite, err)
+	}
+
+	// Redeeming makes bob alice's friend right away
+	friend, err := bob.FriendsClient.RedeemInvite(strings.ToLower(invite.Code))
+	if err != nil || friend.Username != "alice" {
+		t.Fatalf("Expected bob to become alice's friend, got %v (err: %v)", friend, err)
+	}
+	friendList, err := alice.FriendsClient.GetFriendList()
+	if err != nil || len(friendList) != 1 || friendList[0].Username != "bob" {
+		t.Fatalf("Expected bob in alice's friend list, got %v (err: %v)", friendList, err)
+	}
+
+	// On an invite-only server carol can only register with the invite
+	servers.AuthServer.Registration.Mode = serverapp.RegistrationInviteOnly
+	if err := carol.AuthClient.RegisterUser("carol", "password"); err == nil {
+		t.Fatal("Expected registering without an invite to fail")
+	}
+	if err := carol.AuthClient.RegisterUserWithInvite("carol", "password", invite.Code); err != nil {
+		t.Fatalf("Failed to register with an invite: %v", err)
+	}
+	if err, _ := carol.AuthClient.LoginUser("carol", "password"); err != nil {
+		t.Fatalf("Failed to login carol: %v", err)
+	}
+	friendList, err = carol.FriendsClient.GetFriendList()
+	if err != nil || len(friendList) != 1 || friendList[0].Username != "alice" {
+		t.Fatalf("Expected alice in carol's friend list, got %v (err: %v)", friendList, err)
+	}
+
+	// Both uses are gone
+	if err := carol.AuthClient.RegisterUserWithInvite("dave", "password", invite.Code); err == nil {
+		t.Fatal("Expected the used up invite to be refused")
+	}
+}
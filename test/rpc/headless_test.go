@@ -0,0 +1,67 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	utils "github.com/johnkhk/cli_chat_app/test"
+	"github.com/johnkhk/cli_chat_app/test/setup"
+)
+
+// Test that a script can send a message, wait for the acknowledgement, and read the reply as JSON
+func TestHeadlessSendAndReceive(t *testing.T) {
+	rpcClients, _, cleanup, _ := setup.InitializeTestResources(t, nil, 2)
+	defer cleanup()
+
+	client1 := rpcClients[0]
+	client2 := rpcClients[1]
+
+	utils.RegisterAndLoginUser(t, client1, "user1")
+	utils.RegisterAndLoginUser(t, client2, "user2")
+	utils.MakeFriends(t, client1, client2, "user2")
+
+	utils.WaitForWelcomeMessage(t, client1, "user1")
+	utils.WaitForWelcomeMessage(t, client2, "user2")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	status, err := client1.ChatClient.SendMessageAndWait(ctx, client2.CurrentUserID, 0, []byte("build 42 passed"), nil)
+	if err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	if status != "delivered" {
+		t.Fatalf("Expected message to be delivered to an online user, got status %s", status)
+	}
+
+	msg, err := client2.ChatClient.ReceiveMessage(ctx, client1.CurrentUserID)
+	if err != nil {
+		t.Fatalf("Did not receive message: %v", err)
+	}
+	if msg.Body != "build 42 passed" || msg.Sender != "user1" || msg.Type != "text" {
+		t.Fatalf("Unexpected message: %+v", msg)
+	}
+
+	line, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Failed to encode message as JSON: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(line, &decoded); err != nil {
+		t.Fatalf("Failed to decode JSON line: %v", err)
+	}
+	for _, field := range []string{"sender", "timestamp", "type", "body"} {
+		if _, ok := decoded[field]; !ok {
+			t.Fatalf("JSON line %s is missing %q", line, field)
+		}
+	}
+
+	// No reply arrives, so waiting for one times out.
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer shortCancel()
+	if _, err := client1.ChatClient.ReceiveMessage(shortCtx, client2.CurrentUserID); err == nil {
+		t.Fatal("Expected waiting for a reply to time out")
+	}
+}
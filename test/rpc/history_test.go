@@ -0,0 +1,98 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/johnkhk/cli_chat_app/client/app"
+	utils "github.com/johnkhk/cli_chat_app/test"
+	"github.com/johnkhk/cli_chat_app/test/setup"
+)
+
+// TestHistoryTransferToNewDevice moves chat history from one device of a user to another.
+func TestHistoryTransferToNewDevice(t *testing.T) {
+	rpcClients, _, cleanup, _ := setup.InitializeTestResources(t, nil, 3)
+	defer cleanup()
+	oldDevice, other, newDevice := rpcClients[0], rpcClients[1], rpcClients[2]
+
+	utils.RegisterAndLoginUser(t, oldDevice, "alice")
+	utils.RegisterAndLoginUser(t, other, "bob")
+	if err, _ := newDevice.AuthClient.LoginUser("alice", "password"); err != nil {
+		t.Fatalf("Failed to login alice on new device: %v", err)
+	}
+
+	aliceID, bobID := oldDevice.CurrentUserID, other.CurrentUserID
+
+	// Seed the old device with a conversation.
+	if err := oldDevice.Store.SaveChatMessage("m1", aliceID, bobID, []byte("hi bob"), 1, nil); err != nil {
+		t.Fatalf("Failed to seed message: %v", err)
+	}
+	if err := oldDevice.Store.SaveChatMessage("m2", bobID, aliceID, []byte("hi alice"), 1, nil); err != nil {
+		t.Fatalf("Failed to seed message: %v", err)
+	}
+
+	// The new device opens a transfer.
+	transfer, err := newDevice.HistoryClient.StartReceive()
+	if err != nil {
+		t.Fatalf("Failed to start history transfer: %v", err)
+	}
+
+	// Another user cannot see the transfer.
+	if _, err := other.HistoryClient.LookupTransfer(transfer.Code); err == nil {
+		t.Fatalf("Expected another user's lookup of the transfer to fail")
+	}
+
+	// The old device sees the same fingerprint the new device shows.
+	fingerprint, err := oldDevice.HistoryClient.LookupTransfer(transfer.Code)
+	if err != nil {
+		t.Fatalf("Failed to look up history transfer: %v", err)
+	}
+	if fingerprint != transfer.Fingerprint {
+		t.Fatalf("Expected fingerprint %q, got: %q", transfer.Fingerprint, fingerprint)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	received := make(chan error, 1)
+	var imported int
+	go func() {
+		var err error
+		imported, err = newDevice.HistoryClient.ReceiveHistory(ctx, transfer.Code)
+		received <- err
+	}()
+
+	// A fingerprint other than the verified one aborts the send.
+	if _, err := oldDevice.HistoryClient.SendHistory(transfer.Code, "not the verified fingerprint"); !errors.Is(err, app.ErrTransferKeyChanged) {
+		t.Fatalf("Expected ErrTransferKeyChanged for a mismatched fingerprint, got: %v", err)
+	}
+
+	sent, err := oldDevice.HistoryClient.SendHistory(transfer.Code, fingerprint)
+	if err != nil {
+		t.Fatalf("Failed to send history: %v", err)
+	}
+	if sent != 2 {
+		t.Fatalf("Expected 2 messages sent, got: %d", sent)
+	}
+
+	if err := <-received; err != nil {
+		t.Fatalf("Failed to receive history: %v", err)
+	}
+	if imported != 2 {
+		t.Fatalf("Expected 2 messages imported, got: %d", imported)
+	}
+
+	history, err := newDevice.Store.GetChatHistory(aliceID, bobID)
+	if err != nil {
+		t.Fatalf("Failed to get chat history on new device: %v", err)
+	}
+	if len(history) != 2 || history[0].Message != "hi bob" || history[1].Message != "hi alice" {
+		t.Fatalf("Unexpected chat history on new device: %+v", history)
+	}
+
+	// The transfer is single use.
+	if _, err := oldDevice.HistoryClient.SendHistory(transfer.Code, fingerprint); err == nil {
+		t.Fatalf("Expected a second send on the same transfer to fail")
+	}
+}
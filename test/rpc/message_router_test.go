@@ -0,0 +1,173 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+
+	"github.com/johnkhk/cli_chat_app/genproto/chat"
+	"github.com/johnkhk/cli_chat_app/server/app"
+)
+
+// fakeStream is a server-side chat stream that records the messages sent to it.
+type fakeStream struct {
+	grpc.ServerStream
+	mu   sync.Mutex
+	sent []*chat.MessageResponse
+}
+
+func (f *fakeStream) Send(resp *chat.MessageResponse) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, resp)
+	return nil
+}
+
+func (f *fakeStream) Recv() (*chat.MessageRequest, error) {
+	return nil, io.EOF
+}
+
+func (f *fakeStream) Context() context.Context {
+	return context.Background()
+}
+
+func (f *fakeStream) messages() []*chat.MessageResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*chat.MessageResponse(nil), f.sent...)
+}
+
+func newQuietLogger() *logrus.Logger {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	return log
+}
+
+// TestBusRouterForwardsAcrossNodes checks that two nodes sharing a bus deliver to each other's users.
+func TestBusRouterForwardsAcrossNodes(t *testing.T) {
+	log := newQuietLogger()
+	bus := app.NewLocalBus()
+
+	nodeA, err := app.NewBusRouter("node-a", bus, log)
+	if err != nil {
+		t.Fatalf("Failed to create router for node-a: %v", err)
+	}
+	defer nodeA.Close()
+	nodeB, err := app.NewBusRouter("node-b", bus, log)
+	if err != nil {
+		t.Fatalf("Failed to create router for node-b: %v", err)
+	}
+	defer nodeB.Close()
+
+	// User 1 is connected to node A.
+	stream := &fakeStream{}
+	nodeA.Register(1, stream)
+
+	if !nodeB.IsOnline(1) {
+		t.Fatalf("Expected user 1 to be online from node-b")
+	}
+
+	// User 2 on node B sends a message to user 1.
+	delivered, err := nodeB.Route(&chat.MessageResponse{SenderId: 2, RecipientId: 1, MessageId: "m1", EncryptedMessage: []byte("hi")})
+	if err != nil {
+		t.Fatalf("Failed to route message: %v", err)
+	}
+	if !delivered {
+		t.Fatalf("Expected message to be delivered to node-a")
+	}
+
+	received := stream.messages()
+	if len(received) != 1 || received[0].MessageId != "m1" || string(received[0].EncryptedMessage) != "hi" {
+		t.Fatalf("Expected user 1 to receive message m1, got: %v", received)
+	}
+}
+
+// TestBusRouterQueuesForOfflineUsers checks that messages for offline users are kept on the bus
+// and picked up by whichever node the user reconnects to.
+func TestBusRouterQueuesForOfflineUsers(t *testing.T) {
+	log := newQuietLogger()
+	bus := app.NewLocalBus()
+
+	nodeA, err := app.NewBusRouter("node-a", bus, log)
+	if err != nil {
+		t.Fatalf("Failed to create router for node-a: %v", err)
+	}
+	defer nodeA.Close()
+	nodeB, err := app.NewBusRouter("node-b", bus, log)
+	if err != nil {
+		t.Fatalf("Failed to create router for node-b: %v", err)
+	}
+	defer nodeB.Close()
+
+	// User 1 connects to node A and then disconnects.
+	streamA := &fakeStream{}
+	nodeA.Register(1, streamA)
+	nodeA.Unregister(1, streamA)
+	if nodeB.IsOnline(1) {
+		t.Fatalf("Expected user 1 to be offline after unregistering")
+	}
+
+	delivered, err := nodeB.Route(&chat.MessageResponse{SenderId: 2, RecipientId: 1, MessageId: "m1"})
+	if err != nil {
+		t.Fatalf("Failed to route message: %v", err)
+	}
+	if delivered {
+		t.Fatalf("Expected message to be queued for offline user")
+	}
+
+	// User 1 reconnects to node B and picks up the queued message.
+	nodeB.Register(1, &fakeStream{})
+	pending, err := nodeB.TakeUndelivered(1)
+	if err != nil {
+		t.Fatalf("Failed to take undelivered messages: %v", err)
+	}
+	if len(pending) != 1 || pending[0].MessageId != "m1" {
+		t.Fatalf("Expected 1 queued message m1, got: %v", pending)
+	}
+
+	pending, err = nodeA.TakeUndelivered(1)
+	if err != nil {
+		t.Fatalf("Failed to take undelivered messages: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("Expected queue to be empty after draining, got: %d", len(pending))
+	}
+}
+
+// TestBusRouterStalePresence checks that a node disconnecting does not clear a newer connection on another node.
+func TestBusRouterStalePresence(t *testing.T) {
+	log := newQuietLogger()
+	bus := app.NewLocalBus()
+
+	nodeA, err := app.NewBusRouter("node-a", bus, log)
+	if err != nil {
+		t.Fatalf("Failed to create router for node-a: %v", err)
+	}
+	defer nodeA.Close()
+	nodeB, err := app.NewBusRouter("node-b", bus, log)
+	if err != nil {
+		t.Fatalf("Failed to create router for node-b: %v", err)
+	}
+	defer nodeB.Close()
+
+	streamA := &fakeStream{}
+	nodeA.Register(1, streamA)
+	stream := &fakeStream{}
+	nodeB.Register(1, stream)
+	nodeA.Unregister(1, streamA)
+
+	if !nodeA.IsOnline(1) {
+		t.Fatalf("Expected user 1 to still be online via node-b")
+	}
+
+	if _, err := nodeA.Route(&chat.MessageResponse{SenderId: 2, RecipientId: 1, MessageId: "m1"}); err != nil {
+		t.Fatalf("Failed to route message: %v", err)
+	}
+	if len(stream.messages()) != 1 {
+		t.Fatalf("Expected message to reach user 1 on node-b")
+	}
+}
@@ -0,0 +1,61 @@
+package rpc
+
+import (
+	"testing"
+
+	"github.com/johnkhk/cli_chat_app/server/storage"
+	"github.com/johnkhk/cli_chat_app/test/setup"
+)
+
+// TestMigrationsDownAndUp tests that the latest migration can be reverted and applied again.
+func TestMigrationsDownAndUp(t *testing.T) {
+	_, db, cleanup, _ := setup.InitializeTestResources(t, nil, 0)
+	defer cleanup()
+
+	migrator, err := storage.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	latest := migrator.Migrations[len(migrator.Migrations)-1]
+
+	statuses, err := migrator.Status()
+	if err != nil {
+		t.Fatalf("Failed to read migration status: %v", err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			t.Fatalf("Expected migration %s to be applied by the test setup", status.Migration)
+		}
+	}
+
+	reverted, err := migrator.Down(1)
+	if err != nil || len(reverted) != 1 || reverted[0].Version != latest.Version {
+		t.Fatalf("Expected to revert %s, got: %v (err: %v)", latest, reverted, err)
+	}
+	if applied := latestApplied(t, migrator); applied {
+		t.Fatalf("Expected %s to be reverted", latest)
+	}
+
+	applied, err := migrator.Up()
+	if err != nil || len(applied) != 1 || applied[0].Version != latest.Version {
+		t.Fatalf("Expected to apply %s again, got: %v (err: %v)", latest, applied, err)
+	}
+	if applied := latestApplied(t, migrator); !applied {
+		t.Fatalf("Expected %s to be applied again", latest)
+	}
+
+	applied, err = migrator.Up()
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("Expected nothing left to apply, got: %v (err: %v)", applied, err)
+	}
+}
+
+// latestApplied reports whether the status table records the latest migration as applied.
+func latestApplied(t *testing.T, migrator *storage.Migrator) bool {
+	t.Helper()
+	statuses, err := migrator.Status()
+	if err != nil {
+		t.Fatalf("Failed to read migration status: %v", err)
+	}
+	return statuses[len(statuses)-1].AppliedAt != nil
+}
@@ -68,6 +68,7 @@ func TestMultiMediaChat(t *testing.T) {
 
 	utils.RegisterAndLoginUser(t, client1, "user1")
 	utils.RegisterAndLoginUser(t, client2, "user2")
+	utils.MakeFriends(t, client1, client2, "user2")
 
 	utils.WaitForWelcomeMessage(t, client1, "user1")
 	utils.WaitForWelcomeMessage(t, client2, "user2")
@@ -0,0 +1,66 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/johnkhk/cli_chat_app/client/app"
+	utils "github.com/johnkhk/cli_chat_app/test"
+	"github.com/johnkhk/cli_chat_app/test/setup"
+)
+
+// waitForProfileKey waits until client has been sent the profile key of the user with ownerID.
+func waitForProfileKey(t *testing.T, client *app.RpcClient, ownerID uint32) {
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		key, err := client.Store.ProfileKey(ownerID)
+		if err != nil {
+			t.Fatalf("Failed to load profile key: %v", err)
+		}
+		if key != nil {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("Did not receive the profile key of user %d within timeout period", ownerID)
+}
+
+func TestProfilesAreSharedWithFriendsOnly(t *testing.T) {
+	rpcClients, _, cleanup, _ := setup.InitializeTestResources(t, nil, 3)
+	defer cleanup()
+
+	alice, bob, carol := rpcClients[0], rpcClients[1], rpcClients[2]
+	utils.RegisterAndLoginUser(t, alice, "alice")
+	utils.RegisterAndLoginUser(t, bob, "bob")
+	utils.RegisterAndLoginUser(t, carol, "carol")
+	utils.MakeFriends(t, alice, bob, "bob")
+
+	utils.WaitForWelcomeMessage(t, alice, "alice")
+	utils.WaitForWelcomeMessage(t, bob, "bob")
+
+	profile := &app.UserProfile{DisplayName: "Alice A.", Status: "Around today", Avatar: []byte("tiny image")}
+	if err := alice.UserProfileClient.UpdateProfile(context.Background(), profile, []uint32{bob.CurrentUserID}); err != nil {
+		t.Fatalf("Failed to update profile: %v", err)
+	}
+
+	waitForProfileKey(t, bob, alice.CurrentUserID)
+	got, err := bob.UserProfileClient.GetProfile(alice.CurrentUserID)
+	if err != nil || got == nil {
+		t.Fatalf("Expected bob to read alice's profile, got %v (err: %v)", got, err)
+	}
+	if got.DisplayName != profile.DisplayName || got.Status != profile.Status || string(got.Avatar) != string(profile.Avatar) {
+		t.Fatalf("Profile mismatch. Got: %+v, Want: %+v", got, profile)
+	}
+
+	// The key travels as a message, but it must not show up as one
+	select {
+	case msg := <-bob.ChatClient.MessageChannel:
+		t.Fatalf("Expected the profile key to stay out of the chat, got message %s", msg.MessageId)
+	default:
+	}
+
+	if got, err := carol.UserProfileClient.GetProfile(alice.CurrentUserID); err != nil || got != nil {
+		t.Fatalf("Expected carol, who is not a friend, not to read alice's profile, got %v (err: %v)", got, err)
+	}
+}
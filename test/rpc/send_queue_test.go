@@ -0,0 +1,172 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/johnkhk/cli_chat_app/genproto/chat"
+	"github.com/johnkhk/cli_chat_app/server/app"
+)
+
+// slowStream is a chat stream whose Send blocks until the test releases it or the stream is cancelled.
+type slowStream struct {
+	fakeStream
+	ctx     context.Context
+	release chan struct{}
+}
+
+func newSlowStream(ctx context.Context) *slowStream {
+	return &slowStream{ctx: ctx, release: make(chan struct{})}
+}
+
+func (s *slowStream) Send(resp *chat.MessageResponse) error {
+	select {
+	case <-s.release:
+		return s.fakeStream.Send(resp)
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+func (s *slowStream) Context() context.Context {
+	return s.ctx
+}
+
+func waitForMessages(t *testing.T, stream *fakeStream, count int) []*chat.MessageResponse {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if msgs := stream.messages(); len(msgs) >= count {
+			return msgs
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %d messages, got: %d", count, len(stream.messages()))
+	return nil
+}
+
+// fillQueue blocks the writer on the first message and fills the queue behind it.
+func fillQueue(t *testing.T, queue *app.SendQueue, capacity int) {
+	for i := 0; i <= capacity; i++ {
+		if err := queue.Send(&chat.MessageResponse{RecipientId: 1, MessageId: fmt.Sprintf("m%d", i)}); err != nil {
+			t.Fatalf("Failed to queue message %d: %v", i, err)
+		}
+		if i == 0 {
+			// Give the writer time to pick up the first message and block on it.
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+}
+
+// TestSendQueueWritesInOrder checks that queued messages reach the stream in the order they were sent.
+func TestSendQueueWritesInOrder(t *testing.T) {
+	stream := &fakeStream{}
+	metrics := app.NewSendQueueMetrics()
+	queue := app.NewSendQueue(1, stream, app.DefaultSendQueueConfig(), metrics, newQuietLogger())
+	defer queue.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := queue.Send(&chat.MessageResponse{RecipientId: 1, MessageId: fmt.Sprintf("m%d", i)}); err != nil {
+			t.Fatalf("Failed to queue message %d: %v", i, err)
+		}
+	}
+
+	msgs := waitForMessages(t, stream, 5)
+	for i, msg := range msgs {
+		if msg.MessageId != fmt.Sprintf("m%d", i) {
+			t.Fatalf("Expected message m%d at position %d, got: %s", i, i, msg.MessageId)
+		}
+	}
+	if sent := metrics.Snapshot().Sent; sent != 5 {
+		t.Fatalf("Expected 5 sent messages in metrics, got: %d", sent)
+	}
+}
+
+// TestSendQueueRejectsWhenFull checks that a slow reader causes new messages to be rejected, not block the sender.
+func TestSendQueueRejectsWhenFull(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := newSlowStream(ctx)
+	metrics := app.NewSendQueueMetrics()
+	config := app.SendQueueConfig{Capacity: 2, EnqueueTimeout: 20 * time.Millisecond, Overflow: app.OverflowReject}
+	queue := app.NewSendQueue(1, stream, config, metrics, newQuietLogger())
+
+	fillQueue(t, queue, config.Capacity)
+
+	start := time.Now()
+	err := queue.Send(&chat.MessageResponse{RecipientId: 1, MessageId: "overflow"})
+	if !errors.Is(err, app.ErrSendQueueFull) {
+		t.Fatalf("Expected ErrSendQueueFull, got: %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("Sender was blocked for %v by a slow reader", time.Since(start))
+	}
+
+	stats := metrics.Snapshot()
+	if stats.Rejected != 1 {
+		t.Fatalf("Expected 1 rejected message, got: %d", stats.Rejected)
+	}
+	if stats.Depths[1] != config.Capacity {
+		t.Fatalf("Expected queue depth %d, got: %d", config.Capacity, stats.Depths[1])
+	}
+
+	// Releasing the reader drains the queue.
+	close(stream.release)
+	waitForMessages(t, &stream.fakeStream, config.Capacity+1)
+	queue.Close()
+}
+
+// TestSendQueueDropsOldestWhenFull checks that the drop-oldest policy keeps the newest messages.
+func TestSendQueueDropsOldestWhenFull(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := newSlowStream(ctx)
+	metrics := app.NewSendQueueMetrics()
+	config := app.SendQueueConfig{Capacity: 2, EnqueueTimeout: 20 * time.Millisecond, Overflow: app.OverflowDropOldest}
+	queue := app.NewSendQueue(1, stream, config, metrics, newQuietLogger())
+
+	fillQueue(t, queue, config.Capacity)
+	if err := queue.Send(&chat.MessageResponse{RecipientId: 1, MessageId: "newest"}); err != nil {
+		t.Fatalf("Expected newest message to be queued, got: %v", err)
+	}
+
+	if dropped := metrics.Snapshot().Dropped; dropped != 1 {
+		t.Fatalf("Expected 1 dropped message, got: %d", dropped)
+	}
+
+	close(stream.release)
+	msgs := waitForMessages(t, &stream.fakeStream, config.Capacity+1)
+	want := []string{"m0", "m2", "newest"}
+	for i, id := range want {
+		if msgs[i].MessageId != id {
+			t.Fatalf("Expected message %s at position %d, got: %s", id, i, msgs[i].MessageId)
+		}
+	}
+	queue.Close()
+}
+
+// TestSendQueueCloseReturnsUnsent checks that messages still queued when the stream goes away are handed back.
+func TestSendQueueCloseReturnsUnsent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := newSlowStream(ctx)
+	metrics := app.NewSendQueueMetrics()
+	config := app.SendQueueConfig{Capacity: 2, EnqueueTimeout: 20 * time.Millisecond, Overflow: app.OverflowReject}
+	queue := app.NewSendQueue(1, stream, config, metrics, newQuietLogger())
+
+	fillQueue(t, queue, config.Capacity)
+
+	// The client disconnects while the writer is blocked on m0.
+	cancel()
+	pending := queue.Close()
+	if len(pending) != config.Capacity+1 {
+		t.Fatalf("Expected %d unsent messages, got: %d", config.Capacity+1, len(pending))
+	}
+	if err := queue.Send(&chat.MessageResponse{RecipientId: 1, MessageId: "late"}); !errors.Is(err, app.ErrSendQueueClosed) {
+		t.Fatalf("Expected ErrSendQueueClosed after close, got: %v", err)
+	}
+	if _, tracked := metrics.Snapshot().Depths[1]; tracked {
+		t.Fatalf("Expected closed queue to be removed from metrics")
+	}
+}
@@ -18,7 +18,10 @@ import (
 	"github.com/johnkhk/cli_chat_app/genproto/auth"
 	"github.com/johnkhk/cli_chat_app/genproto/chat"
 	"github.com/johnkhk/cli_chat_app/genproto/friends"
+	"github.com/johnkhk/cli_chat_app/genproto/history"
+	"github.com/johnkhk/cli_chat_app/genproto/userprofile"
 	"github.com/johnkhk/cli_chat_app/server/app"
+	"github.com/johnkhk/cli_chat_app/server/storage"
 )
 
 const BufSize = 1024 * 1024
@@ -36,7 +39,10 @@ type TestServerConfig struct {
 type ServerStruct struct {
 	AuthServer    *app.AuthServer
 	FriendsServer *app.FriendsServer
+	ProfileServer *app.ProfileServer
 	ChatServer    *app.ChatServiceServer
+	Router        *app.LocalRouter
+	HistoryServer *app.HistoryServer
 }
 
 // InitTestServer initializes the in-memory gRPC server and the test database.
@@ -65,21 +71,42 @@ func InitTestServer(t *testing.T, serverConfig TestServerConfig) (*sql.DB, *Serv
 		}
 	}
 
+	// Reject tokens of locked accounts and revoked sessions, as the real server does
+	repo := storage.NewSQLRepository(db)
+	tokenValidator.Revocations = repo
+
 	// Initialize the servers with the test database
-	authServer := app.NewAuthServer(db, serverConfig.Log, serverConfig.AccessTokenDuration, serverConfig.RefreshTokenDuration)
+	friendEvents := app.NewFriendEventHub(serverConfig.Log)
+	authServer := app.NewAuthServer(repo, serverConfig.Log, serverConfig.AccessTokenDuration, serverConfig.RefreshTokenDuration)
+	authServer.Events = friendEvents
 	auth.RegisterAuthServiceServer(s, authServer)
 
-	friendsServer := app.NewFriendsServer(db, serverConfig.Log)
+	router := app.NewLocalRouter(serverConfig.Log)
+	friendsServer := app.NewFriendsServer(repo, friendEvents, serverConfig.Log)
+	friendsServer.Presence = router
 	friends.RegisterFriendManagementServer(s, friendsServer)
 
-	chatServer := app.NewChatServiceServer(serverConfig.Log)
+	profileServer := app.NewProfileServer(repo, friendEvents, serverConfig.Log)
+	userprofile.RegisterUserProfileServiceServer(s, profileServer)
+
+	chatServer := app.NewChatServiceServer(serverConfig.Log, router)
+	chatServer.Blocks = repo
+	chatServer.Requests = repo
+	chatServer.Events = friendEvents
+	chatServer.Activity = repo
 	chat.RegisterChatServiceServer(s, chatServer)
 
+	historyServer := app.NewHistoryServer(serverConfig.Log)
+	history.RegisterHistoryTransferServer(s, historyServer)
+
 	// serverStruct
 	serverStruct := &ServerStruct{
 		AuthServer:    authServer,
 		FriendsServer: friendsServer,
+		ProfileServer: profileServer,
 		ChatServer:    chatServer,
+		Router:        router,
+		HistoryServer: historyServer,
 	}
 
 	// Start serving the in-memory server
@@ -5,17 +5,23 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/johnkhk/cli_chat_app/server/storage"
 )
 
-// SetupTestDatabase initializes the test database.
+// SetupTestDatabase initializes the test database. It uses the MySQL server at TEST_DATABASE_URL,
+// or a SQLite file in the temporary directory when that is not set, so the tests can run offline.
 func SetupTestDatabase(testDBName string) (*sql.DB, error) {
 	// Get the Data Source Name (DSN) from environment variables
 	dsn := os.Getenv("TEST_DATABASE_URL")
 	if dsn == "" {
-		return nil, fmt.Errorf("TEST_DATABASE_URL is not set")
+		db, err := storage.OpenSQLite(sqliteTestPath(testDBName))
+		if err != nil {
+			return nil, err
+		}
+		return migrateTestDatabase(db)
 	}
 
 	// Connect to the MySQL server (without specifying a database initially)
@@ -50,22 +56,51 @@ func SetupTestDatabase(testDBName string) (*sql.DB, error) {
 		return nil, fmt.Errorf("Failed to drop all tables: %v", err)
 	}
 
-	// Execute the SQL file to set up tables and other structures
-	upSQLPath := getAbsolutePath("db/migrations/02_up.sql")
-	if err := runSQLFile(db, upSQLPath); err != nil {
+	return migrateTestDatabase(db)
+}
+
+// migrateTestDatabase applies the server's migrations to set up tables and other structures.
+func migrateTestDatabase(db *sql.DB) (*sql.DB, error) {
+	migrator, err := storage.NewMigrator(db)
+	if err != nil {
 		db.Close()
-		return nil, fmt.Errorf("Failed to execute setup SQL file: %v", err)
+		return nil, fmt.Errorf("Failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Failed to apply migrations: %v", err)
 	}
-
 	return db, nil
 }
 
+// sqliteTestPath is where the SQLite test database named testDBName is kept.
+func sqliteTestPath(testDBName string) string {
+	return filepath.Join(os.TempDir(), testDBName+".db")
+}
+
 // TeardownTestDatabase cleans up the test database.
 func TeardownTestDatabase(db *sql.DB, testDBName string) error {
-	// Optionally run the teardown SQL script if needed
-	downSQLPath := getAbsolutePath("db/migrations/01_down.sql")
-	if err := runSQLFile(db, downSQLPath); err != nil {
-		return fmt.Errorf("Failed to run teardown SQL file: %v", err)
+	// Revert every migration, which also checks that the down migrations work
+	migrator, err := storage.NewMigrator(db)
+	if err != nil {
+		return fmt.Errorf("Failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Down(0); err != nil {
+		return fmt.Errorf("Failed to revert migrations: %v", err)
+	}
+
+	// A SQLite test database is a file; close it and remove it with its WAL files
+	if os.Getenv("TEST_DATABASE_URL") == "" {
+		if err := db.Close(); err != nil {
+			return err
+		}
+		path := sqliteTestPath(testDBName)
+		for _, file := range []string{path, path + "-wal", path + "-shm"} {
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("Failed to remove test database: %v", err)
+			}
+		}
+		return nil
 	}
 
 	// Drop the entire test database to ensure a clean state
@@ -102,29 +137,6 @@ func dropAllTables(db *sql.DB, dbName string) error {
 	return nil
 }
 
-// runSQLFile executes SQL commands from a file, statement by statement.
-func runSQLFile(db *sql.DB, filePath string) error {
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return fmt.Errorf("Failed to read SQL file: %v", err)
-	}
-
-	// Split the SQL file content by semicolons
-	statements := strings.Split(string(content), ";")
-
-	for _, statement := range statements {
-		trimmedStmt := strings.TrimSpace(statement)
-		if trimmedStmt == "" {
-			continue // Skip empty statements
-		}
-
-		if _, err = db.Exec(trimmedStmt); err != nil {
-			return fmt.Errorf("Failed to execute SQL statement: %v\nStatement:\n%s", err, trimmedStmt)
-		}
-	}
-	return nil
-}
-
 // checkMySQLVersion logs the MySQL version.
 func checkMySQLVersion(db *sql.DB) {
 	var version string
@@ -134,12 +146,3 @@ func checkMySQLVersion(db *sql.DB) {
 		return
 	}
 }
-
-// getAbsolutePath constructs an absolute path for a given relative file path.
-func getAbsolutePath(relativePath string) string {
-	absPath, err := filepath.Abs("../../" + relativePath)
-	if err != nil {
-		panic(fmt.Sprintf("Failed to get absolute path for %s: %v", relativePath, err))
-	}
-	return absPath
-}
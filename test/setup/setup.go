@@ -2,6 +2,7 @@ package setup
 
 import (
 	"crypto/md5"
+	"crypto/rand"
 	"database/sql"
 	"fmt"
 	"os"
@@ -123,10 +124,14 @@ func InitializeTestResources(t *testing.T, serverConfig *TestServerConfig, numCl
 	for i := 0; i < numClients; i++ {
 		// Create a unique directory for each client
 		appDir := filepath.Join(os.TempDir(), fmt.Sprintf(".test_cli_chat_app_%s_client_%d", t.Name(), i))
-		tokenDir := filepath.Join(appDir, "jwt_tokens")
+		credentialsKey := make([]byte, 32)
+		if _, err := rand.Read(credentialsKey); err != nil {
+			t.Fatalf("Failed to generate credentials key: %v", err)
+		}
+		credentials := app.NewEncryptedFileCredentialStore(filepath.Join(appDir, "credentials"), credentialsKey)
 
 		// Create the TokenManager for the client
-		tokenManager := app.NewTokenManager(tokenDir, nil)
+		tokenManager := app.NewTokenManager(credentials, nil)
 		tokenManager.TimeProvider = serverConfig.TimeProvider
 
 		conn := CreateTestClientConn(t, app.UnaryInterceptor(tokenManager, serverConfig.Log), app.StreamInterceptor(tokenManager, serverConfig.Log))
@@ -29,6 +29,21 @@ func RegisterAndLoginUser(t *testing.T, client *app.RpcClient, username string)
 	}
 }
 
+// MakeFriends has the first user send a friend request to the second, who accepts it.
+// Messages between users who are not friends are held as message requests.
+func MakeFriends(t *testing.T, client *app.RpcClient, friend *app.RpcClient, friendUsername string) {
+	if err := client.FriendsClient.SendFriendRequest(friendUsername); err != nil {
+		t.Fatalf("Failed to send friend request to %s: %v", friendUsername, err)
+	}
+	incoming, err := friend.FriendsClient.GetIncomingFriendRequests()
+	if err != nil || len(incoming) == 0 {
+		t.Fatalf("%s did not receive the friend request: %v", friendUsername, err)
+	}
+	if err := friend.FriendsClient.AcceptFriendRequest(incoming[len(incoming)-1].RequestId); err != nil {
+		t.Fatalf("%s failed to accept the friend request: %v", friendUsername, err)
+	}
+}
+
 // Helper function for waiting for the welcome message
 func WaitForWelcomeMessage(t *testing.T, client *app.RpcClient, username string) {
 	select {